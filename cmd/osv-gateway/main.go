@@ -0,0 +1,107 @@
+// Command osv-gateway serves robot variables over HTTP/JSON and, with
+// -grpc, over gRPC.
+//
+// Usage:
+//
+//	osv-gateway -config robots.json [-listen :8080] [-grpc :9090] [-timeout 5s]
+//
+// The configuration lists the robots:
+//
+//	{"robots": [{"id": "cell1", "host": "192.168.1.10", "port": 7000}]}
+//
+// See package gateway for the routes and package osvgrpc for the gRPC service.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/selimserbes/go-openshowvar/pkg/gateway"
+	"github.com/selimserbes/go-openshowvar/pkg/openshowvar"
+	"github.com/selimserbes/go-openshowvar/pkg/osvgrpc"
+	"google.golang.org/grpc"
+)
+
+// config is the configuration file.
+type config struct {
+	Robots []gateway.RobotConfig `json:"robots"`
+}
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintln(os.Stderr, "osv-gateway:", err)
+		os.Exit(1)
+	}
+}
+
+// run serves the gateway until the process is interrupted.
+func run() error {
+	configPath := flag.String("config", "robots.json", "configuration file")
+	listen := flag.String("listen", ":8080", "HTTP listen address")
+	grpcListen := flag.String("grpc", "", "gRPC listen address, gRPC is disabled if empty")
+	timeout := flag.Duration("timeout", 5*time.Second, "time limit for each request to a robot")
+	streamInterval := flag.Duration("stream-interval", 100*time.Millisecond, "default poll interval of streamed variables")
+	flag.Parse()
+
+	data, err := os.ReadFile(*configPath)
+	if err != nil {
+		return err
+	}
+	var cfg config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return fmt.Errorf("%s: %v", *configPath, err)
+	}
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+	for i := range cfg.Robots {
+		cfg.Robots[i].Options = []openshowvar.Option{openshowvar.WithLogger(logger.With("robot", cfg.Robots[i].ID))}
+	}
+	gw, err := gateway.New(cfg.Robots...)
+	if err != nil {
+		return err
+	}
+	gw.Timeout = *timeout
+	gw.StreamInterval = *streamInterval
+	defer gw.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	server := &http.Server{Addr: *listen, Handler: gw, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	if *grpcListen != "" {
+		listener, err := net.Listen("tcp", *grpcListen)
+		if err != nil {
+			return err
+		}
+		rpc := osvgrpc.NewServer(gw)
+		rpc.Timeout = *timeout
+		rpc.WatchInterval = *streamInterval
+		grpcServer := grpc.NewServer()
+		osvgrpc.RegisterOpenShowVarServer(grpcServer, rpc)
+		go grpcServer.Serve(listener)
+		defer grpcServer.Stop()
+		logger.Info("serving gRPC", "address", *grpcListen)
+	}
+
+	logger.Info("listening", "address", *listen, "robots", len(cfg.Robots))
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+// Command osv-modbus serves robot variables as a Modbus TCP server.
+//
+// Usage:
+//
+//	osv-modbus -config modbus.json
+//
+// The configuration assigns each robot a unit identifier and maps its
+// variables to Modbus addresses:
+//
+//	{
+//	  "listen": ":502",
+//	  "robots": [{"id": "cell1", "host": "192.168.1.10", "port": 7000, "unit_id": 1,
+//	              "mappings": [
+//	                {"table": "holding_registers", "address": 0, "var": "$OV_PRO"},
+//	                {"table": "input_registers", "address": 0, "var": "$POS_ACT.X", "type": "int32", "scale": 100},
+//	                {"table": "coils", "address": 0, "var": "$OUT", "count": 16}]}]
+//	}
+//
+// See package modbus for the mappings.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"os/signal"
+
+	"github.com/selimserbes/go-openshowvar/pkg/gateway"
+	"github.com/selimserbes/go-openshowvar/pkg/modbus"
+	"github.com/selimserbes/go-openshowvar/pkg/openshowvar"
+)
+
+// config is the configuration file.
+type config struct {
+	// Listen is the TCP address of the server, ":502" if empty.
+	Listen string        `json:"listen"`
+	Robots []robotConfig `json:"robots"`
+}
+
+// robotConfig is a robot and its address space.
+type robotConfig struct {
+	gateway.RobotConfig
+	UnitID   uint8            `json:"unit_id"`
+	Mappings []modbus.Mapping `json:"mappings"`
+}
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintln(os.Stderr, "osv-modbus:", err)
+		os.Exit(1)
+	}
+}
+
+// run serves the robots until the process is interrupted.
+func run() error {
+	configPath := flag.String("config", "modbus.json", "configuration file")
+	flag.Parse()
+
+	data, err := os.ReadFile(*configPath)
+	if err != nil {
+		return err
+	}
+	var cfg config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return fmt.Errorf("%s: %v", *configPath, err)
+	}
+	if cfg.Listen == "" {
+		cfg.Listen = ":502"
+	}
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+	robots := make([]gateway.RobotConfig, len(cfg.Robots))
+	for i, r := range cfg.Robots {
+		robots[i] = r.RobotConfig
+		robots[i].Options = []openshowvar.Option{openshowvar.WithLogger(logger.With("robot", r.ID))}
+	}
+	gw, err := gateway.New(robots...)
+	if err != nil {
+		return err
+	}
+	defer gw.Close()
+
+	server := modbus.NewServer()
+	defer server.Close()
+	for _, r := range cfg.Robots {
+		robot, _ := gw.Robot(r.ID)
+		if err := server.AddRobot(r.UnitID, robot, r.Mappings); err != nil {
+			return fmt.Errorf("robot %s: %v", r.ID, err)
+		}
+	}
+
+	listener, err := net.Listen("tcp", cfg.Listen)
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+
+	logger.Info("serving", "addr", listener.Addr().String(), "robots", len(cfg.Robots))
+	return server.Serve(listener)
+}
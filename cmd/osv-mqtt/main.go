@@ -0,0 +1,136 @@
+// Command osv-mqtt bridges robot variables to an MQTT broker.
+//
+// Usage:
+//
+//	osv-mqtt -config bridge.json
+//
+// The configuration names the broker and the variables of each robot:
+//
+//	{
+//	  "broker": "tcp://localhost:1883",
+//	  "robots": [{"id": "cell1", "host": "192.168.1.10", "port": 7000,
+//	              "vars": ["$POS_ACT", "$OV_PRO"], "interval": "100ms"}]
+//	}
+//
+// See package mqttbridge for the topics.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/selimserbes/go-openshowvar/pkg/gateway"
+	"github.com/selimserbes/go-openshowvar/pkg/mqttbridge"
+	"github.com/selimserbes/go-openshowvar/pkg/openshowvar"
+)
+
+// config is the configuration file.
+type config struct {
+	Broker   string `json:"broker"`
+	ClientID string `json:"client_id"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	// Prefix is the first topic level, "robots" if empty.
+	Prefix string        `json:"prefix"`
+	QoS    byte          `json:"qos"`
+	Robots []robotConfig `json:"robots"`
+}
+
+// robotConfig is a robot and its bridged variables.
+type robotConfig struct {
+	gateway.RobotConfig
+	Vars     []string `json:"vars"`
+	Interval string   `json:"interval"`
+}
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintln(os.Stderr, "osv-mqtt:", err)
+		os.Exit(1)
+	}
+}
+
+// run bridges the robots until the process is interrupted.
+func run() error {
+	configPath := flag.String("config", "bridge.json", "configuration file")
+	flag.Parse()
+
+	data, err := os.ReadFile(*configPath)
+	if err != nil {
+		return err
+	}
+	var cfg config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return fmt.Errorf("%s: %v", *configPath, err)
+	}
+	if cfg.Broker == "" {
+		return fmt.Errorf("%s: missing broker", *configPath)
+	}
+	if cfg.ClientID == "" {
+		cfg.ClientID = "osv-mqtt"
+	}
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+	robots := make([]gateway.RobotConfig, len(cfg.Robots))
+	for i, r := range cfg.Robots {
+		robots[i] = r.RobotConfig
+		robots[i].Options = []openshowvar.Option{openshowvar.WithLogger(logger.With("robot", r.ID))}
+	}
+	gw, err := gateway.New(robots...)
+	if err != nil {
+		return err
+	}
+	defer gw.Close()
+
+	// Each robot has its own MQTT connection, so its last will covers it.
+	var bridges []*mqttbridge.Bridge
+	for _, r := range cfg.Robots {
+		var interval time.Duration
+		if r.Interval != "" {
+			if interval, err = time.ParseDuration(r.Interval); err != nil {
+				return fmt.Errorf("robot %s: invalid interval: %v", r.ID, err)
+			}
+		}
+		opts := mqtt.NewClientOptions().
+			AddBroker(cfg.Broker).
+			SetClientID(cfg.ClientID + "-" + r.ID).
+			SetUsername(cfg.Username).
+			SetPassword(cfg.Password).
+			SetAutoReconnect(true)
+		robot, _ := gw.Robot(r.ID)
+		bridges = append(bridges, mqttbridge.New(robot, opts, mqttbridge.Config{
+			Vars:     r.Vars,
+			Interval: interval,
+			Prefix:   cfg.Prefix,
+			QoS:      cfg.QoS,
+		}))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	logger.Info("bridging", "broker", cfg.Broker, "robots", len(bridges))
+	errs := make([]error, len(bridges))
+	var wg sync.WaitGroup
+	for i, b := range bridges {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = b.Run(ctx)
+			if errs[i] != nil {
+				stop()
+			}
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
@@ -0,0 +1,113 @@
+// Command osv-opcua serves robot variables over OPC UA.
+//
+// Usage:
+//
+//	osv-opcua -config opcua.json
+//
+// The configuration names the variables of each robot and whether clients
+// may write them:
+//
+//	{
+//	  "listen": ":4840",
+//	  "robots": [{"id": "cell1", "host": "192.168.1.10", "port": 7000,
+//	              "vars": [{"name": "$POS_ACT"}, {"name": "$OV_PRO", "writable": true}]}]
+//	}
+//
+// Each variable is read once at startup to derive its data type, so the
+// robots must be reachable. See package opcua for the address space.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/selimserbes/go-openshowvar/pkg/gateway"
+	"github.com/selimserbes/go-openshowvar/pkg/opcua"
+	"github.com/selimserbes/go-openshowvar/pkg/openshowvar"
+)
+
+// config is the configuration file.
+type config struct {
+	// Listen is the TCP address of the server, ":4840" if empty.
+	Listen string `json:"listen"`
+	// EndpointURL is advertised to clients, e.g. behind NAT.
+	EndpointURL string        `json:"endpoint_url"`
+	Robots      []robotConfig `json:"robots"`
+}
+
+// robotConfig is a robot and its exposed variables.
+type robotConfig struct {
+	gateway.RobotConfig
+	Vars []opcua.Variable `json:"vars"`
+}
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintln(os.Stderr, "osv-opcua:", err)
+		os.Exit(1)
+	}
+}
+
+// run serves the robots until the process is interrupted.
+func run() error {
+	configPath := flag.String("config", "opcua.json", "configuration file")
+	flag.Parse()
+
+	data, err := os.ReadFile(*configPath)
+	if err != nil {
+		return err
+	}
+	var cfg config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return fmt.Errorf("%s: %v", *configPath, err)
+	}
+	if cfg.Listen == "" {
+		cfg.Listen = ":4840"
+	}
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+	robots := make([]gateway.RobotConfig, len(cfg.Robots))
+	for i, r := range cfg.Robots {
+		robots[i] = r.RobotConfig
+		robots[i].Options = []openshowvar.Option{openshowvar.WithLogger(logger.With("robot", r.ID))}
+	}
+	gw, err := gateway.New(robots...)
+	if err != nil {
+		return err
+	}
+	defer gw.Close()
+
+	server := opcua.NewServer()
+	server.EndpointURL = cfg.EndpointURL
+	defer server.Close()
+	for _, r := range cfg.Robots {
+		robot, _ := gw.Robot(r.ID)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		err := server.AddRobot(ctx, robot, r.Vars)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("robot %s: %v", r.ID, err)
+		}
+	}
+
+	listener, err := net.Listen("tcp", cfg.Listen)
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+
+	logger.Info("serving", "addr", listener.Addr().String(), "robots", len(cfg.Robots))
+	return server.Serve(listener)
+}
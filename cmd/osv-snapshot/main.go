@@ -0,0 +1,211 @@
+// Command osv-snapshot takes snapshots of robot variables and compares them.
+//
+// Usage:
+//
+//	osv-snapshot take [-host 192.168.1.10] [-port 7000] [-timeout 30s] [-names vars.txt] [-o snapshot.json] [name ...]
+//	osv-snapshot diff before.json after.json
+//	osv-snapshot restore [-host 192.168.1.10] [-port 7000] [-timeout 30s] [-dry-run] [-include ...] [-exclude ...] [-first ...] [-last ...] [-skip-unchanged] snapshot.json
+//
+// Names may use the patterns of snapshot.Expand, e.g. "$TOOL_DATA[1..16]".
+// diff exits with 1 if the snapshots differ and 2 on errors, like diff(1).
+// restore exits with 1 if a write failed. Its pattern flags take comma
+// separated lists, see snapshot.RestoreOptions.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/selimserbes/go-openshowvar/pkg/openshowvar"
+	"github.com/selimserbes/go-openshowvar/pkg/snapshot"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	var err error
+	switch os.Args[1] {
+	case "take":
+		err = take(os.Args[2:])
+	case "diff":
+		var differ bool
+		differ, err = diff(os.Args[2:])
+		if err == nil && differ {
+			os.Exit(1)
+		}
+	case "restore":
+		var failed bool
+		failed, err = restore(os.Args[2:])
+		if err == nil && failed {
+			os.Exit(1)
+		}
+	default:
+		usage()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "osv-snapshot:", err)
+		os.Exit(2)
+	}
+}
+
+// usage prints the usage and exits.
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: osv-snapshot take [flags] [name ...]")
+	fmt.Fprintln(os.Stderr, "       osv-snapshot diff before.json after.json")
+	fmt.Fprintln(os.Stderr, "       osv-snapshot restore [flags] snapshot.json")
+	os.Exit(2)
+}
+
+// take reads the variables named by the arguments and the names file into a snapshot.
+func take(args []string) error {
+	flags := flag.NewFlagSet("take", flag.ExitOnError)
+	host := flags.String("host", "192.168.1.10", "KukaVarProxy address")
+	port := flags.Int("port", 7000, "KukaVarProxy port")
+	timeout := flags.Duration("timeout", 30*time.Second, "time limit for the whole snapshot")
+	namesFile := flags.String("names", "", "file with one variable name or pattern per line")
+	out := flags.String("o", "", "output file, standard output if empty")
+	flags.Parse(args)
+
+	names, err := snapshot.Expand(flags.Args()...)
+	if err != nil {
+		return err
+	}
+	if *namesFile != "" {
+		file, err := os.Open(*namesFile)
+		if err != nil {
+			return err
+		}
+		fromFile, err := snapshot.ReadNames(file)
+		file.Close()
+		if err != nil {
+			return err
+		}
+		names = append(names, fromFile...)
+	}
+	if len(names) == 0 {
+		return fmt.Errorf("no variables given")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	osv := openshowvar.NewOpenShowVar(*host, *port)
+	if err := osv.ConnectContext(ctx); err != nil {
+		return err
+	}
+	defer osv.Disconnect()
+
+	s, err := snapshot.Take(ctx, osv, names)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		file, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+	return s.Save(w)
+}
+
+// diff prints the changes between two snapshot files and reports whether there are any.
+func diff(args []string) (bool, error) {
+	if len(args) != 2 {
+		usage()
+	}
+	a, err := load(args[0])
+	if err != nil {
+		return false, err
+	}
+	b, err := load(args[1])
+	if err != nil {
+		return false, err
+	}
+
+	changes := snapshot.Diff(a, b)
+	for _, c := range changes {
+		fmt.Println(c)
+	}
+	return len(changes) > 0, nil
+}
+
+// restore writes a snapshot file back and reports whether a write failed.
+func restore(args []string) (bool, error) {
+	flags := flag.NewFlagSet("restore", flag.ExitOnError)
+	host := flags.String("host", "192.168.1.10", "KukaVarProxy address")
+	port := flags.Int("port", 7000, "KukaVarProxy port")
+	timeout := flags.Duration("timeout", 30*time.Second, "time limit for the whole restore")
+	dryRun := flags.Bool("dry-run", false, "report what would be written without writing")
+	include := flags.String("include", "", "only restore variables matching these patterns")
+	exclude := flags.String("exclude", "", "skip variables matching these patterns")
+	first := flags.String("first", "", "write variables matching these patterns first")
+	last := flags.String("last", "", "write variables matching these patterns last")
+	skipUnchanged := flags.Bool("skip-unchanged", false, "skip variables that already have the value")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		usage()
+	}
+
+	s, err := load(flags.Arg(0))
+	if err != nil {
+		return false, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	osv := openshowvar.NewOpenShowVar(*host, *port)
+	if err := osv.ConnectContext(ctx); err != nil {
+		return false, err
+	}
+	defer osv.Disconnect()
+
+	report, err := snapshot.Restore(ctx, osv, s, snapshot.RestoreOptions{
+		DryRun:        *dryRun,
+		Include:       patterns(*include),
+		Exclude:       patterns(*exclude),
+		First:         patterns(*first),
+		Last:          patterns(*last),
+		SkipUnchanged: *skipUnchanged,
+	})
+	if report != nil {
+		for _, res := range report.Results {
+			fmt.Println(res)
+		}
+	}
+	if err != nil {
+		return false, err
+	}
+	return report.Count(snapshot.Failed) > 0, nil
+}
+
+// patterns splits a comma separated flag value.
+func patterns(list string) []string {
+	var out []string
+	for _, p := range strings.Split(list, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// load reads a snapshot file.
+func load(path string) (*snapshot.Snapshot, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return snapshot.Load(file)
+}
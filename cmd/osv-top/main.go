@@ -0,0 +1,199 @@
+// Command osv-top shows live robot variables in a refreshing terminal table.
+//
+// Usage:
+//
+//	osv-top [-host 192.168.1.10] [-port 7000] [-interval 200ms] [-refresh 500ms] [-names vars.txt] [name ...]
+//
+// Every variable is read through one connection at the poll interval. The
+// table shows the current value, highlighted for a moment after it changes,
+// the read and change rates, the last error and a sparkline of recent INT and
+// REAL values. Names may use the patterns of snapshot.Expand. Press q to quit.
+//
+// Each read is limited to -timeout. When reads fail because the connection
+// is lost, the title shows the error and the connection is opened again at
+// most once per -timeout.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+
+	"golang.org/x/term"
+
+	"github.com/selimserbes/go-openshowvar/internal/top"
+	"github.com/selimserbes/go-openshowvar/pkg/openshowvar"
+	"github.com/selimserbes/go-openshowvar/pkg/snapshot"
+)
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintln(os.Stderr, "osv-top:", err)
+		os.Exit(1)
+	}
+}
+
+// run polls the variables and redraws the table until q is pressed or the process is interrupted.
+func run() error {
+	host := flag.String("host", "192.168.1.10", "KukaVarProxy address")
+	port := flag.Int("port", 7000, "KukaVarProxy port")
+	timeout := flag.Duration("timeout", 5*time.Second, "time limit for connecting and each read")
+	interval := flag.Duration("interval", 200*time.Millisecond, "time between reads of all variables")
+	refresh := flag.Duration("refresh", 500*time.Millisecond, "time between redraws")
+	namesFile := flag.String("names", "", "file with one variable name or pattern per line")
+	points := flag.Int("history", 30, "number of values in the sparkline")
+	flag.Parse()
+	switch {
+	case *interval <= 0:
+		return errors.New("-interval must be positive")
+	case *refresh <= 0:
+		return errors.New("-refresh must be positive")
+	case *timeout <= 0:
+		return errors.New("-timeout must be positive")
+	case *points < 0:
+		return errors.New("-history must not be negative")
+	}
+
+	names, err := snapshot.Expand(flag.Args()...)
+	if err != nil {
+		return err
+	}
+	if *namesFile != "" {
+		file, err := os.Open(*namesFile)
+		if err != nil {
+			return err
+		}
+		fromFile, err := snapshot.ReadNames(file)
+		file.Close()
+		if err != nil {
+			return err
+		}
+		names = append(names, fromFile...)
+	}
+	if len(names) == 0 {
+		return fmt.Errorf("no variables given")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	// Limit every read, so that a connection that stops answering fails the
+	// reads instead of blocking the poller.
+	limit := func(ctx context.Context, req openshowvar.Request, next openshowvar.Handler) (openshowvar.Response, error) {
+		ctx, cancel := context.WithTimeout(ctx, *timeout)
+		defer cancel()
+		return next(ctx, req)
+	}
+	osv := openshowvar.NewOpenShowVar(*host, *port, openshowvar.WithInterceptors(limit))
+	connect := func() error {
+		connectCtx, cancel := context.WithTimeout(ctx, *timeout)
+		defer cancel()
+		return osv.ConnectContext(connectCtx)
+	}
+	if err := connect(); err != nil {
+		return err
+	}
+	defer osv.Disconnect()
+
+	// Switch to raw mode and the alternate screen on a terminal.
+	fd := int(os.Stdin.Fd())
+	if term.IsTerminal(fd) {
+		state, err := term.MakeRaw(fd)
+		if err != nil {
+			return err
+		}
+		defer term.Restore(fd, state)
+		fmt.Print("\x1b[?1049h\x1b[?25l")
+		defer fmt.Print("\x1b[?25h\x1b[?1049l")
+
+		ctx, stop = context.WithCancel(ctx)
+		defer stop()
+		go func() {
+			buf := make([]byte, 16)
+			for {
+				n, err := os.Stdin.Read(buf)
+				if err != nil {
+					stop()
+					return
+				}
+				for _, key := range buf[:n] {
+					if key == 'q' || key == 3 {
+						stop()
+						return
+					}
+				}
+			}
+		}()
+	}
+
+	// lost is set by reads failing after the last connect for other reasons
+	// than a missing variable.
+	var mu sync.Mutex
+	var lost error
+	connected := time.Now()
+	table := top.NewTable(names, 2*time.Second, *points)
+	poller := openshowvar.NewPoller(osv, openshowvar.Group{
+		Name:     "top",
+		Vars:     names,
+		Interval: *interval,
+		Handler: func(s openshowvar.Snapshot) {
+			mu.Lock()
+			defer mu.Unlock()
+			table.Update(s)
+			for _, sample := range s.Values {
+				if sample.Err != nil && !errors.Is(sample.Err, openshowvar.ErrVariableNotFound) && sample.Time.After(connected) {
+					lost = sample.Err
+				}
+			}
+		},
+	})
+	pollErr := make(chan error, 1)
+	go func() {
+		pollErr <- poller.Run(ctx)
+	}()
+
+	title := fmt.Sprintf("osv-top %s:%d", *host, *port)
+	ticker := time.NewTicker(*refresh)
+	defer ticker.Stop()
+	for {
+		mu.Lock()
+		if lost != nil && table.Status == "" {
+			table.Status = "connection lost: " + lost.Error()
+		}
+		reconnect := lost != nil && time.Since(connected) >= *timeout
+		width := 120
+		if w, _, err := term.GetSize(int(os.Stdout.Fd())); err == nil && w > 0 {
+			width = w
+		}
+		table.Render(os.Stdout, title, width, time.Now())
+		mu.Unlock()
+
+		// Reconnect after the connection was lost, at most once per timeout.
+		if reconnect {
+			osv.Disconnect()
+			err := connect()
+			mu.Lock()
+			lost, connected, table.Status = nil, time.Now(), ""
+			if err != nil {
+				lost, table.Status = err, "reconnect failed: "+err.Error()
+			}
+			mu.Unlock()
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-pollErr:
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("poller: %v", err)
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/selimserbes/go-openshowvar/internal/cli"
+	"github.com/selimserbes/go-openshowvar/pkg/openshowvar"
+	"github.com/selimserbes/go-openshowvar/pkg/snapshot"
+)
+
+// readCmd reads variables and prints their values.
+func readCmd(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+	flags, opts := newFlags("read", stderr)
+	if err := opts.parse(flags, args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		return fmt.Errorf("%w: read needs at least one variable name", cli.ErrUsage)
+	}
+
+	osv, err := opts.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer osv.Disconnect()
+
+	out := &cli.Printer{W: stdout, Format: opts.format, Named: flags.NArg() > 1}
+	var firstErr error
+	for _, name := range flags.Args() {
+		value, err := opts.request(ctx, func(ctx context.Context) (string, error) {
+			return osv.ReadContext(ctx, name)
+		})
+		if errors.Is(err, cli.ErrConnection) {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "osv: %s: %v\n", name, err)
+			if firstErr == nil {
+				firstErr = &cli.ReportedError{Err: err}
+			}
+			continue
+		}
+		out.Value(name, value)
+	}
+	return firstErr
+}
+
+// writeCmd writes a variable and prints the value reported back.
+func writeCmd(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+	flags, opts := newFlags("write", stderr)
+	if err := opts.parse(flags, args); err != nil {
+		return err
+	}
+	if flags.NArg() != 2 {
+		return fmt.Errorf("%w: write needs a variable name and a value", cli.ErrUsage)
+	}
+	name, value := flags.Arg(0), flags.Arg(1)
+
+	osv, err := opts.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer osv.Disconnect()
+
+	written, err := opts.request(ctx, func(ctx context.Context) (string, error) {
+		return osv.WriteContext(ctx, name, value)
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	(&cli.Printer{W: stdout, Format: opts.format}).Value(name, written)
+	return nil
+}
+
+// watchCmd prints the changes of variables until interrupted.
+func watchCmd(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+	flags, opts := newFlags("watch", stderr)
+	interval := flags.Duration("interval", 100*time.Millisecond, "time between reads")
+	if err := opts.parse(flags, args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		return fmt.Errorf("%w: watch needs at least one variable name", cli.ErrUsage)
+	}
+
+	osv, err := opts.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer osv.Disconnect()
+
+	// Merge the changes of all variables into one stream.
+	changes := make(chan openshowvar.Change)
+	var wg sync.WaitGroup
+	for _, name := range flags.Args() {
+		wg.Add(1)
+		go func(ch <-chan openshowvar.Change) {
+			defer wg.Done()
+			for change := range ch {
+				changes <- change
+			}
+		}(osv.Subscribe(ctx, name, *interval))
+	}
+	go func() {
+		wg.Wait()
+		close(changes)
+	}()
+
+	out := &cli.Printer{W: stdout, Format: opts.format, Named: true}
+	for change := range changes {
+		if change.Err != nil {
+			fmt.Fprintf(stderr, "osv: %s: %v\n", change.VarName, change.Err)
+			continue
+		}
+		out.Change(change)
+	}
+	return nil
+}
+
+// dumpCmd reads a list of variables and prints them all, as a snapshot document in JSON.
+func dumpCmd(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+	flags, opts := newFlags("dump", stderr)
+	namesFile := flags.String("names", "", "file with one variable name or pattern per line")
+	if err := opts.parse(flags, args); err != nil {
+		return err
+	}
+
+	names, err := snapshot.Expand(flags.Args()...)
+	if err != nil {
+		return fmt.Errorf("%w: %v", cli.ErrUsage, err)
+	}
+	if *namesFile != "" {
+		file, err := os.Open(*namesFile)
+		if err != nil {
+			return err
+		}
+		fromFile, err := snapshot.ReadNames(file)
+		file.Close()
+		if err != nil {
+			return err
+		}
+		names = append(names, fromFile...)
+	}
+	if len(names) == 0 {
+		return fmt.Errorf("%w: dump needs variable names or a names file", cli.ErrUsage)
+	}
+
+	osv, err := opts.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer osv.Disconnect()
+
+	s := &snapshot.Snapshot{Time: time.Now()}
+	var firstErr error
+	for _, name := range names {
+		value, err := opts.request(ctx, func(ctx context.Context) (string, error) {
+			return osv.ReadContext(ctx, name)
+		})
+		if errors.Is(err, cli.ErrConnection) {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		v := snapshot.Var{Name: name, Value: value}
+		if err != nil {
+			v.Err = err.Error()
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+		s.Vars = append(s.Vars, v)
+	}
+
+	if opts.format == "json" {
+		if err := s.Save(stdout); err != nil {
+			return err
+		}
+		if firstErr != nil {
+			return fmt.Errorf("some variables could not be read: %w", firstErr)
+		}
+		return nil
+	}
+	out := &cli.Printer{W: stdout, Format: opts.format, Named: true}
+	for _, v := range s.Vars {
+		if v.Err != "" {
+			fmt.Fprintf(stderr, "osv: %s: %s\n", v.Name, v.Err)
+			continue
+		}
+		out.Value(v.Name, v.Value)
+	}
+	if firstErr != nil {
+		return &cli.ReportedError{Err: firstErr}
+	}
+	return nil
+}
+
+// pingCmd connects and measures the round trip time of reads.
+func pingCmd(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+	flags, opts := newFlags("ping", stderr)
+	count := flags.Int("count", 4, "number of reads")
+	varname := flags.String("var", "$OV_PRO", "variable read by each ping")
+	interval := flags.Duration("interval", time.Second, "time between reads")
+	if err := opts.parse(flags, args); err != nil {
+		return err
+	}
+
+	start := time.Now()
+	osv, err := opts.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer osv.Disconnect()
+
+	out := &cli.Printer{W: stdout, Format: opts.format}
+	out.Ping(0, time.Since(start))
+	for seq := 1; seq <= *count; seq++ {
+		if seq > 1 {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(*interval):
+			}
+		}
+		start := time.Now()
+		if _, err := opts.request(ctx, func(ctx context.Context) (string, error) {
+			return osv.ReadContext(ctx, *varname)
+		}); err != nil {
+			return fmt.Errorf("%s: %w", *varname, err)
+		}
+		out.Ping(seq, time.Since(start))
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+// Command osv reads and writes robot variables through KukaVarProxy.
+//
+// Usage:
+//
+//	osv read [flags] name ...
+//	osv write [flags] name value
+//	osv watch [flags] [-interval 100ms] name ...
+//	osv dump [flags] [-names vars.txt] [name ...]
+//	osv ping [flags] [-count 4] [-var $OV_PRO]
+//	osv shell [flags] [-log session.log] [-names vars.txt]
+//
+// Common flags are -host and -port, defaulting to $OSV_HOST and $OSV_PORT,
+// -timeout and -format, which is plain, json or krl. Names given to dump may
+// use the patterns of snapshot.Expand, e.g. "$TOOL_DATA[1..16]".
+//
+// shell keeps one connection open for get, set and watch commands, with
+// history and tab completion of variable names on a terminal. It reconnects
+// when the connection is lost and shows the connection state in the prompt.
+//
+// Exit codes:
+//
+//	0  success
+//	1  other errors
+//	2  invalid usage
+//	3  connection failures and timeouts
+//	4  missing variables, or values rejected by KukaVarProxy
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"time"
+
+	"github.com/selimserbes/go-openshowvar/internal/cli"
+	"github.com/selimserbes/go-openshowvar/pkg/openshowvar"
+)
+
+// commands maps subcommand names to their implementation.
+var commands = map[string]func(ctx context.Context, args []string, stdout, stderr io.Writer) error{
+	"read":  readCmd,
+	"write": writeCmd,
+	"watch": watchCmd,
+	"dump":  dumpCmd,
+	"ping":  pingCmd,
+	"shell": shellCmd,
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	code := run(ctx, os.Args[1:], os.Stdout, os.Stderr)
+	stop()
+	os.Exit(code)
+}
+
+// run runs a subcommand and returns the exit code.
+func run(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || commands[args[0]] == nil {
+		fmt.Fprintln(stderr, "usage: osv read|write|watch|dump|ping|shell [flags] [args]")
+		return cli.ExitUsage
+	}
+	err := commands[args[0]](ctx, args[1:], stdout, stderr)
+	var reported *cli.ReportedError
+	if err != nil && !errors.As(err, &reported) {
+		fmt.Fprintln(stderr, "osv:", err)
+	}
+	return cli.ExitCode(err)
+}
+
+// options are the flags shared by all subcommands.
+type options struct {
+	host    string
+	port    int
+	timeout time.Duration
+	format  string
+}
+
+// newFlags creates the flag set of a subcommand with the common flags.
+func newFlags(name string, stderr io.Writer) (*flag.FlagSet, *options) {
+	port, err := strconv.Atoi(os.Getenv("OSV_PORT"))
+	if err != nil {
+		port = 7000
+	}
+	host := os.Getenv("OSV_HOST")
+	if host == "" {
+		host = "192.168.1.10"
+	}
+
+	opts := &options{}
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.StringVar(&opts.host, "host", host, "KukaVarProxy address")
+	flags.IntVar(&opts.port, "port", port, "KukaVarProxy port")
+	flags.DurationVar(&opts.timeout, "timeout", 5*time.Second, "time limit for connecting and each request")
+	flags.StringVar(&opts.format, "format", "plain", "output format: plain, json or krl")
+	return flags, opts
+}
+
+// parse parses the flags and checks the output format.
+func (opts *options) parse(flags *flag.FlagSet, args []string) error {
+	if err := flags.Parse(args); err != nil {
+		return fmt.Errorf("%w: %v", cli.ErrUsage, err)
+	}
+	switch opts.format {
+	case "plain", "json", "krl":
+		return nil
+	}
+	return fmt.Errorf("%w: unknown format %q", cli.ErrUsage, opts.format)
+}
+
+// connect opens a connection within the timeout.
+func (opts *options) connect(ctx context.Context) (*openshowvar.OpenShowVar, error) {
+	ctx, cancel := context.WithTimeout(ctx, opts.timeout)
+	defer cancel()
+
+	osv := openshowvar.NewOpenShowVar(opts.host, opts.port)
+	if err := osv.ConnectContext(ctx); err != nil {
+		return nil, fmt.Errorf("%w: %v", cli.ErrConnection, err)
+	}
+	return osv, nil
+}
+
+// request runs one request within the timeout, marking I/O errors as connection errors.
+func (opts *options) request(ctx context.Context, do func(ctx context.Context) (string, error)) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, opts.timeout)
+	defer cancel()
+
+	value, err := do(ctx)
+	if err != nil && !errors.Is(err, openshowvar.ErrVariableNotFound) && cli.ExitCode(err) == cli.ExitConnection {
+		return "", fmt.Errorf("%w: %w", cli.ErrConnection, err)
+	}
+	return value, err
+}
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+
+	"github.com/selimserbes/go-openshowvar/internal/cli"
+	"github.com/selimserbes/go-openshowvar/pkg/openshowvar"
+	"github.com/selimserbes/go-openshowvar/pkg/snapshot"
+)
+
+// systemVars are offered for completion in every session.
+var systemVars = []string{
+	"$ACT_BASE", "$ACT_TOOL", "$AXIS_ACT", "$BASE", "$IN[", "$MODE_OP", "$OUT[",
+	"$OV_PRO", "$POS_ACT", "$PRO_NAME", "$PRO_STATE", "$ROB_STOPPED", "$TOOL", "$VEL_ACT",
+}
+
+// shellCommands are the commands of the shell, for help and completion.
+var shellCommands = []string{"get", "set", "watch", "vars", "history", "help", "quit"}
+
+// shellHelp describes the shell commands.
+const shellHelp = `get NAME ...                      read variables, STRUC values are printed indented
+set NAME VALUE                    write a variable
+watch [-interval D] [-for D] NAME ...
+                                  print changes until a key is pressed or -for has passed
+vars                              list the variable names known for completion
+history                           list the commands of this session
+help                              show this help
+quit                              end the session
+`
+
+// shell is an interactive session on one connection.
+type shell struct {
+	opts *options
+	osv  *openshowvar.OpenShowVar
+	// up tells whether the connection is established, reconnects how
+	// often it was established again after the first time.
+	up          bool
+	connectedAt time.Time
+	reconnects  int
+
+	// term is set for interactive sessions, keys feeds it and watch.
+	term  *term.Terminal
+	keys  chan []byte
+	lines *bufio.Scanner
+
+	out       io.Writer
+	log       io.Writer
+	completer *cli.Completer
+	history   cli.History
+}
+
+// shellCmd runs an interactive shell, or executes commands from standard input when it is not a terminal.
+func shellCmd(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+	flags, opts := newFlags("shell", stderr)
+	logPath := flags.String("log", "", "append the session to this file")
+	namesFile := flags.String("names", "", "file with variable names offered for completion")
+	if err := opts.parse(flags, args); err != nil {
+		return err
+	}
+
+	sh := &shell{opts: opts, out: stdout, completer: &cli.Completer{Commands: shellCommands}}
+	for _, name := range systemVars {
+		sh.completer.Remember(name)
+	}
+	if *namesFile != "" {
+		file, err := os.Open(*namesFile)
+		if err != nil {
+			return err
+		}
+		names, err := snapshot.ReadNames(file)
+		file.Close()
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			sh.completer.Remember(name)
+		}
+	}
+	if *logPath != "" {
+		file, err := os.OpenFile(*logPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		sh.log = file
+		fmt.Fprintf(file, "# session %s %s:%d\n", time.Now().Format(time.RFC3339), opts.host, opts.port)
+	}
+
+	// Use a line editor with history and completion on a terminal.
+	fd := int(os.Stdin.Fd())
+	if term.IsTerminal(fd) {
+		state, err := term.MakeRaw(fd)
+		if err != nil {
+			return err
+		}
+		defer term.Restore(fd, state)
+
+		sh.keys = make(chan []byte)
+		go readKeys(os.Stdin, sh.keys)
+		sh.term = term.NewTerminal(struct {
+			io.Reader
+			io.Writer
+		}{&keyReader{keys: sh.keys}, stdout}, "")
+		sh.term.AutoCompleteCallback = sh.completer.Complete
+		if width, height, err := term.GetSize(fd); err == nil && width > 0 {
+			sh.term.SetSize(width, height)
+		}
+		sh.out = sh.term
+	} else {
+		sh.lines = bufio.NewScanner(os.Stdin)
+	}
+
+	sh.osv = openshowvar.NewOpenShowVar(opts.host, opts.port)
+	defer sh.osv.Disconnect()
+	if err := sh.connect(ctx); err != nil {
+		sh.printf("%v\n", err)
+	}
+	return sh.run(ctx)
+}
+
+// run reads and executes commands until quit, end of input or ctx is done.
+func (sh *shell) run(ctx context.Context) error {
+	for ctx.Err() == nil {
+		line, err := sh.readLine()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		sh.history.Add(line)
+		if sh.log != nil {
+			fmt.Fprintf(sh.log, "%s > %s\n", time.Now().Format("15:04:05.000"), line)
+		}
+		if quit := sh.execute(ctx, line); quit {
+			return nil
+		}
+	}
+	return nil
+}
+
+// readLine reads the next command, showing the prompt on a terminal.
+func (sh *shell) readLine() (string, error) {
+	if sh.term != nil {
+		sh.term.SetPrompt(sh.prompt())
+		return sh.term.ReadLine()
+	}
+	if !sh.lines.Scan() {
+		if err := sh.lines.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+	return sh.lines.Text(), nil
+}
+
+// prompt shows the endpoint and whether the connection is up.
+func (sh *shell) prompt() string {
+	status := ""
+	if !sh.up {
+		status = " (disconnected)"
+	} else if sh.reconnects > 0 {
+		status = fmt.Sprintf(" (reconnected %dx)", sh.reconnects)
+	}
+	return fmt.Sprintf("osv %s:%d%s> ", sh.opts.host, sh.opts.port, status)
+}
+
+// execute runs one command and reports whether the session ends.
+func (sh *shell) execute(ctx context.Context, line string) bool {
+	fields := strings.Fields(line)
+	switch fields[0] {
+	case "get":
+		if len(fields) < 2 {
+			sh.printf("usage: get NAME ...\n")
+			return false
+		}
+		for _, name := range fields[1:] {
+			value, err := sh.request(ctx, func(ctx context.Context) (string, error) {
+				return sh.osv.ReadContext(ctx, name)
+			})
+			if err != nil {
+				sh.printf("%s: %v\n", name, err)
+				continue
+			}
+			sh.completer.Remember(name)
+			sh.printf("%s = %s\n", name, cli.Pretty(value))
+		}
+	case "set":
+		if len(fields) < 3 {
+			sh.printf("usage: set NAME VALUE\n")
+			return false
+		}
+		// The value is the rest of the line, it may contain spaces.
+		name := fields[1]
+		rest := strings.TrimSpace(line[len(fields[0]):])
+		value := strings.TrimSpace(rest[len(name):])
+		written, err := sh.request(ctx, func(ctx context.Context) (string, error) {
+			return sh.osv.WriteContext(ctx, name, value)
+		})
+		if err != nil {
+			sh.printf("%s: %v\n", name, err)
+			return false
+		}
+		sh.completer.Remember(name)
+		sh.printf("%s = %s\n", name, cli.Pretty(written))
+	case "watch":
+		sh.watch(ctx, fields[1:])
+	case "vars":
+		for _, name := range sh.completer.Names() {
+			sh.printf("%s\n", name)
+		}
+	case "history":
+		sh.printf("%s", sh.history.String())
+	case "help":
+		sh.printf("%s", shellHelp)
+	case "quit", "exit":
+		return true
+	default:
+		sh.printf("unknown command %q, try help\n", fields[0])
+	}
+	return false
+}
+
+// watch prints changes of variables until a key is pressed, the duration has passed or ctx is done.
+func (sh *shell) watch(ctx context.Context, args []string) {
+	flags := flag.NewFlagSet("watch", flag.ContinueOnError)
+	flags.SetOutput(sh.out)
+	interval := flags.Duration("interval", 100*time.Millisecond, "time between reads")
+	duration := flags.Duration("for", 0, "stop after this time")
+	if err := flags.Parse(args); err != nil {
+		return
+	}
+	if flags.NArg() == 0 {
+		sh.printf("usage: watch [-interval D] [-for D] NAME ...\n")
+		return
+	}
+	if err := sh.connect(ctx); err != nil {
+		sh.printf("%v\n", err)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if *duration > 0 {
+		ctx, cancel = context.WithTimeout(ctx, *duration)
+		defer cancel()
+	}
+	if sh.term != nil {
+		sh.printf("watching, press any key to stop\n")
+	}
+
+	changes := make(chan openshowvar.Change)
+	for _, name := range flags.Args() {
+		sh.completer.Remember(name)
+		go func(ch <-chan openshowvar.Change) {
+			for change := range ch {
+				select {
+				case changes <- change:
+				case <-ctx.Done():
+				}
+			}
+		}(sh.osv.Subscribe(ctx, name, *interval))
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sh.keys:
+			return
+		case change := <-changes:
+			if change.Err != nil {
+				sh.printf("%s %s: %v\n", change.Time.Format("15:04:05.000"), change.VarName, change.Err)
+				continue
+			}
+			sh.printf("%s %s = %s\n", change.Time.Format("15:04:05.000"), change.VarName, cli.Pretty(change.Value))
+		}
+	}
+}
+
+// connect establishes the connection if it is down.
+func (sh *shell) connect(ctx context.Context) error {
+	if sh.up {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, sh.opts.timeout)
+	defer cancel()
+	if err := sh.osv.ConnectContext(ctx); err != nil {
+		return fmt.Errorf("%w: %v", cli.ErrConnection, err)
+	}
+	if !sh.connectedAt.IsZero() {
+		sh.reconnects++
+		sh.printf("reconnected to %s:%d\n", sh.opts.host, sh.opts.port)
+	}
+	sh.up = true
+	sh.connectedAt = time.Now()
+	return nil
+}
+
+// request runs a request, reconnecting and retrying once if the connection was lost.
+func (sh *shell) request(ctx context.Context, do func(ctx context.Context) (string, error)) (string, error) {
+	for attempt := 0; ; attempt++ {
+		if err := sh.connect(ctx); err != nil {
+			return "", err
+		}
+		value, err := sh.opts.request(ctx, do)
+		if !errors.Is(err, cli.ErrConnection) || attempt > 0 {
+			return value, err
+		}
+		sh.osv.Disconnect()
+		sh.up = false
+	}
+}
+
+// printf writes to the terminal and the session log.
+func (sh *shell) printf(format string, args ...any) {
+	text := fmt.Sprintf(format, args...)
+	io.WriteString(sh.out, text)
+	if sh.log != nil {
+		io.WriteString(sh.log, text)
+	}
+}
+
+// readKeys sends everything read from r to keys until r fails.
+func readKeys(r io.Reader, keys chan<- []byte) {
+	for {
+		buf := make([]byte, 256)
+		n, err := r.Read(buf)
+		if n > 0 {
+			keys <- buf[:n]
+		}
+		if err != nil {
+			close(keys)
+			return
+		}
+	}
+}
+
+// keyReader reads the keys sent by readKeys, so that watch can take a key
+// press without the line editor losing input.
+type keyReader struct {
+	keys    <-chan []byte
+	pending []byte
+}
+
+// Read returns buffered keys or waits for the next ones.
+func (r *keyReader) Read(p []byte) (int, error) {
+	if len(r.pending) == 0 {
+		keys, ok := <-r.keys
+		if !ok {
+			return 0, io.EOF
+		}
+		r.pending = keys
+	}
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
@@ -0,0 +1,58 @@
+// Package cli holds the parts of the osv command that do not need a robot:
+// exit codes, output formats, and completion and formatting of the shell.
+package cli
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+
+	"github.com/selimserbes/go-openshowvar/pkg/openshowvar"
+)
+
+// Exit codes.
+const (
+	ExitOK         = 0
+	ExitError      = 1
+	ExitUsage      = 2
+	ExitConnection = 3
+	ExitNotFound   = 4
+)
+
+// ErrConnection marks errors of the connection to KukaVarProxy.
+var ErrConnection = errors.New("connection failed")
+
+// ErrUsage marks invalid arguments.
+var ErrUsage = errors.New("invalid usage")
+
+// ReportedError wraps an error whose details were already printed.
+type ReportedError struct {
+	Err error
+}
+
+func (e *ReportedError) Error() string { return e.Err.Error() }
+func (e *ReportedError) Unwrap() error { return e.Err }
+
+// ExitCode maps an error to the exit code of the command.
+//
+// Parameters:
+// - err: The error returned by a subcommand, nil on success.
+//
+// Returns: ExitUsage for invalid arguments, ExitNotFound for missing variables,
+// ExitConnection for connection failures and timeouts, ExitError otherwise.
+func ExitCode(err error) int {
+	var netErr net.Error
+	switch {
+	case err == nil:
+		return ExitOK
+	case errors.Is(err, ErrUsage):
+		return ExitUsage
+	case errors.Is(err, openshowvar.ErrVariableNotFound):
+		return ExitNotFound
+	case errors.Is(err, ErrConnection), errors.Is(err, context.DeadlineExceeded),
+		errors.Is(err, io.EOF), errors.Is(err, net.ErrClosed), errors.As(err, &netErr):
+		return ExitConnection
+	}
+	return ExitError
+}
@@ -0,0 +1,107 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/selimserbes/go-openshowvar/pkg/krl"
+	"github.com/selimserbes/go-openshowvar/pkg/openshowvar"
+)
+
+// Printer writes values in the selected output format.
+//
+// plain prints the value as text, STRING values without quotes, preceded by
+// the name when several variables are printed. json prints one object per
+// line with typed values. krl prints KRL assignments.
+type Printer struct {
+	W io.Writer
+	// Format is plain, json or krl.
+	Format string
+	// Named prints the variable name in plain output.
+	Named bool
+}
+
+// jsonValue is the JSON output of a value.
+type jsonValue struct {
+	Time     *time.Time `json:"time,omitempty"`
+	Name     string     `json:"name"`
+	Value    any        `json:"value"`
+	Previous any        `json:"previous,omitempty"`
+}
+
+// Value prints the value of a variable.
+func (p *Printer) Value(name, value string) {
+	switch p.Format {
+	case "json":
+		p.json(jsonValue{Name: name, Value: typed(value)})
+	case "krl":
+		fmt.Fprintf(p.W, "%s = %s\n", name, literal(value))
+	default:
+		if p.Named {
+			fmt.Fprintf(p.W, "%s\t%s\n", name, text(value))
+		} else {
+			fmt.Fprintln(p.W, text(value))
+		}
+	}
+}
+
+// Change prints a change reported by a subscription.
+func (p *Printer) Change(c openshowvar.Change) {
+	switch p.Format {
+	case "json":
+		out := jsonValue{Time: &c.Time, Name: c.VarName, Value: typed(c.Value)}
+		if c.Previous != "" {
+			out.Previous = typed(c.Previous)
+		}
+		p.json(out)
+	case "krl":
+		fmt.Fprintf(p.W, "%s = %s ; %s\n", c.VarName, literal(c.Value), c.Time.Format("15:04:05.000"))
+	default:
+		fmt.Fprintf(p.W, "%s\t%s\t%s\n", c.Time.Format("15:04:05.000"), c.VarName, text(c.Value))
+	}
+}
+
+// Ping prints the latency of a ping, seq 0 being the connection.
+func (p *Printer) Ping(seq int, latency time.Duration) {
+	ms := float64(latency.Microseconds()) / 1000
+	switch {
+	case p.Format == "json":
+		p.json(map[string]any{"seq": seq, "latency_ms": ms})
+	case seq == 0:
+		fmt.Fprintf(p.W, "connected in %.3f ms\n", ms)
+	default:
+		fmt.Fprintf(p.W, "seq=%d time=%.3f ms\n", seq, ms)
+	}
+}
+
+// json prints v as one line of JSON.
+func (p *Printer) json(v any) {
+	data, _ := json.Marshal(v)
+	fmt.Fprintln(p.W, string(data))
+}
+
+// typed converts a KRL literal to a JSON value, keeping other values as strings.
+func typed(value string) any {
+	if v, err := krl.Parse(value); err == nil {
+		return v.Interface()
+	}
+	return value
+}
+
+// text returns a KRL literal as plain text.
+func text(value string) string {
+	if v, err := krl.Parse(value); err == nil {
+		return v.Text()
+	}
+	return value
+}
+
+// literal normalizes a KRL literal.
+func literal(value string) string {
+	if v, err := krl.Parse(value); err == nil {
+		return v.String()
+	}
+	return value
+}
@@ -0,0 +1,135 @@
+package cli
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/selimserbes/go-openshowvar/pkg/krl"
+)
+
+// Completer completes shell commands and the variable names seen in a session.
+type Completer struct {
+	// Commands are completed as the first word of a line.
+	Commands []string
+
+	known map[string]string
+}
+
+// Remember adds a variable name to the completion list. Names differing only
+// in case are kept once, with the spelling seen last.
+func (c *Completer) Remember(name string) {
+	if c.known == nil {
+		c.known = make(map[string]string)
+	}
+	c.known[strings.ToUpper(name)] = name
+}
+
+// Names returns the known variable names in order.
+func (c *Completer) Names() []string {
+	names := make([]string, 0, len(c.known))
+	for _, name := range c.known {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Complete completes the command or variable name before the cursor on tab,
+// as a term.Terminal AutoCompleteCallback.
+//
+// Parameters:
+// - line: The line being edited.
+// - pos: The cursor position in line.
+// - key: The key pressed.
+//
+// Returns: The new line and cursor position, and whether the line was completed.
+func (c *Completer) Complete(line string, pos int, key rune) (string, int, bool) {
+	if key != '\t' {
+		return "", 0, false
+	}
+	start := strings.LastIndexByte(line[:pos], ' ') + 1
+	prefix := strings.ToUpper(line[start:pos])
+
+	candidates := c.Commands
+	if start > 0 {
+		candidates = c.Names()
+	}
+	var matches []string
+	for _, candidate := range candidates {
+		if strings.HasPrefix(strings.ToUpper(candidate), prefix) {
+			matches = append(matches, candidate)
+		}
+	}
+	if len(matches) == 0 {
+		return "", 0, false
+	}
+
+	// Complete to the longest common prefix of all matches.
+	completion := matches[0]
+	for _, m := range matches[1:] {
+		n := 0
+		for n < len(completion) && n < len(m) && strings.EqualFold(completion[n:n+1], m[n:n+1]) {
+			n++
+		}
+		completion = completion[:n]
+	}
+	if len(matches) == 1 && !strings.HasSuffix(completion, "[") {
+		completion += " "
+	}
+	return line[:start] + completion + line[pos:], start + len(completion), true
+}
+
+// History holds the commands of a shell session.
+type History struct {
+	lines []string
+}
+
+// Add appends a command.
+func (h *History) Add(line string) {
+	h.lines = append(h.lines, line)
+}
+
+// String lists the commands, numbered from 1.
+func (h *History) String() string {
+	var b strings.Builder
+	for i, line := range h.lines {
+		fmt.Fprintf(&b, "%4d  %s\n", i+1, line)
+	}
+	return b.String()
+}
+
+// Pretty formats a value, with STRUC members on indented lines.
+//
+// Parameters:
+// - value: A KRL literal, other values are returned unchanged.
+//
+// Returns: The formatted value.
+func Pretty(value string) string {
+	v, err := krl.Parse(value)
+	if err != nil || v.Kind != krl.Struc {
+		return value
+	}
+	var b strings.Builder
+	writePretty(&b, v, "")
+	return b.String()
+}
+
+// writePretty writes a STRUC value with its members indented below indent.
+func writePretty(b *strings.Builder, v krl.Value, indent string) {
+	b.WriteByte('{')
+	if v.Type != "" {
+		b.WriteString(v.Type + ":")
+	}
+	b.WriteByte('\n')
+	for _, f := range v.Fields {
+		b.WriteString(indent + "  " + f.Name + " ")
+		if f.Value.Kind == krl.Struc {
+			writePretty(b, f.Value, indent+"  ")
+		} else {
+			b.WriteString(f.Value.String())
+		}
+		b.WriteByte('\n')
+	}
+	b.WriteString(indent + "}")
+}
@@ -0,0 +1,203 @@
+// Package top keeps the state of the osv-top table and draws it.
+package top
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/selimserbes/go-openshowvar/pkg/krl"
+	"github.com/selimserbes/go-openshowvar/pkg/openshowvar"
+)
+
+// ANSI escape sequences used for drawing.
+const (
+	clearScreen = "\x1b[H\x1b[2J"
+	bold        = "\x1b[1m"
+	highlight   = "\x1b[30;43m"
+	red         = "\x1b[31m"
+	reset       = "\x1b[0m"
+)
+
+// rateWindow is the time over which read and change rates are averaged.
+const rateWindow = 5 * time.Second
+
+// sparkBlocks are the levels of a sparkline.
+var sparkBlocks = []rune("▁▂▃▄▅▆▇█")
+
+// row is the state of one variable in the table.
+type row struct {
+	name    string
+	value   string
+	changed time.Time
+	// since is when the variable was first read.
+	since time.Time
+	// reads and changes hold the times within rateWindow.
+	reads   []time.Time
+	changes []time.Time
+	lastErr string
+	errTime time.Time
+	// history holds the recent numeric values for the sparkline.
+	history []float64
+}
+
+// Table tracks the rows of all variables.
+type Table struct {
+	// Status is shown next to the title, e.g. while reconnecting.
+	Status string
+
+	rows []*row
+	// highlight is how long a changed value stays highlighted.
+	highlight time.Duration
+	// points is the number of values kept for sparklines.
+	points int
+}
+
+// NewTable creates a table for the given variables.
+//
+// Parameters:
+// - names: The variables, in the order of the poller group.
+// - highlight: How long a changed value stays highlighted.
+// - points: The number of values kept for sparklines.
+//
+// Returns: A new Table.
+func NewTable(names []string, highlight time.Duration, points int) *Table {
+	t := &Table{highlight: highlight, points: points}
+	for _, name := range names {
+		t.rows = append(t.rows, &row{name: name})
+	}
+	return t
+}
+
+// Update applies the samples of a poller snapshot.
+func (t *Table) Update(snapshot openshowvar.Snapshot) {
+	for i, s := range snapshot.Values {
+		r := t.rows[i]
+		if r.since.IsZero() {
+			r.since = s.Time
+		}
+		r.reads = append(prune(r.reads, s.Time), s.Time)
+		r.changes = prune(r.changes, s.Time)
+		if s.Err != nil {
+			r.lastErr, r.errTime = s.Err.Error(), s.Time
+			continue
+		}
+
+		if r.value != s.Value {
+			if r.value != "" || !r.changed.IsZero() {
+				r.changes = append(r.changes, s.Time)
+			}
+			r.value, r.changed = s.Value, s.Time
+		}
+		if v, err := krl.Parse(s.Value); err == nil {
+			if f, ok := v.Float(); ok {
+				r.history = append(r.history, f)
+				if len(r.history) > t.points {
+					r.history = r.history[len(r.history)-t.points:]
+				}
+			}
+		}
+	}
+}
+
+// prune drops the times older than rateWindow before now.
+func prune(times []time.Time, now time.Time) []time.Time {
+	i := 0
+	for i < len(times) && now.Sub(times[i]) > rateWindow {
+		i++
+	}
+	return times[i:]
+}
+
+// rate returns the number of events per second within rateWindow, or
+// since the variable was first read if that is more recent.
+func rate(times []time.Time, since, now time.Time) float64 {
+	window := now.Sub(since)
+	if window > rateWindow {
+		window = rateWindow
+	}
+	if since.IsZero() || window <= 0 {
+		return 0
+	}
+	return float64(len(prune(times, now))) / window.Seconds()
+}
+
+// Render draws the table for a terminal of the given width. Each row is as
+// wide as the terminal once its sparkline is complete, the value column
+// taking the space left by the others but at least 10 columns.
+func (t *Table) Render(w io.Writer, title string, width int, now time.Time) {
+	const (
+		nameWidth  = 20
+		rateWidth  = 8
+		errorWidth = 24
+	)
+	sparkWidth := t.points
+	valueWidth := width - nameWidth - 2*rateWidth - errorWidth - sparkWidth - 5
+	if valueWidth < 10 {
+		valueWidth = 10
+	}
+
+	var b strings.Builder
+	b.WriteString(clearScreen)
+	fmt.Fprintf(&b, "%s%s%s  %s", bold, title, reset, now.Format("15:04:05"))
+	if t.Status != "" {
+		fmt.Fprintf(&b, "  %s%s%s", red, t.Status, reset)
+	}
+	b.WriteString("\r\n\r\n")
+	fmt.Fprintf(&b, "%s%s %s %s %s %s %s%s\r\n", bold,
+		pad("NAME", nameWidth), pad("VALUE", valueWidth), pad("READS/s", rateWidth),
+		pad("CHG/s", rateWidth), pad("LAST ERROR", errorWidth), "HISTORY", reset)
+
+	for _, r := range t.rows {
+		value := pad(strings.Join(strings.Fields(r.value), " "), valueWidth)
+		if !r.changed.IsZero() && now.Sub(r.changed) < t.highlight && len(r.changes) > 0 {
+			value = highlight + value + reset
+		}
+		lastErr := pad("", errorWidth)
+		if r.lastErr != "" {
+			lastErr = red + pad(r.errTime.Format("15:04:05")+" "+r.lastErr, errorWidth) + reset
+		}
+		fmt.Fprintf(&b, "%s %s %s %s %s %s\r\n",
+			pad(r.name, nameWidth), value,
+			pad(fmt.Sprintf("%.1f", rate(r.reads, r.since, now)), rateWidth),
+			pad(fmt.Sprintf("%.1f", rate(r.changes, r.since, now)), rateWidth),
+			lastErr, Sparkline(r.history))
+	}
+	b.WriteString("\r\nq: quit\r\n")
+	io.WriteString(w, b.String())
+}
+
+// pad truncates or pads s to width runes.
+func pad(s string, width int) string {
+	n := utf8.RuneCountInString(s)
+	if n > width {
+		runes := []rune(s)
+		return string(runes[:width-1]) + "…"
+	}
+	return s + strings.Repeat(" ", width-n)
+}
+
+// Sparkline draws values scaled between their minimum and maximum, with
+// the lowest block for all values when they are equal.
+func Sparkline(values []float64) string {
+	if len(values) == 0 {
+		return ""
+	}
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, v := range values {
+		lo, hi = math.Min(lo, v), math.Max(hi, v)
+	}
+
+	var b strings.Builder
+	for _, v := range values {
+		level := 0
+		if hi > lo {
+			level = int((v - lo) / (hi - lo) * float64(len(sparkBlocks)-1))
+		}
+		b.WriteRune(sparkBlocks[level])
+	}
+	return b.String()
+}
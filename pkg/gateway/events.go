@@ -0,0 +1,191 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+)
+
+// heartbeatInterval is the time between keep-alive messages of idle streams.
+const heartbeatInterval = 15 * time.Second
+
+// streamParams reads the variable names and poll interval of a stream request.
+func (g *Gateway) streamParams(req *http.Request) ([]string, time.Duration, error) {
+	query := req.URL.Query()
+	interval := g.streamInterval()
+	if s := query.Get("interval"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return nil, 0, fmt.Errorf("invalid interval: %v", err)
+		}
+		interval = d
+	}
+	return query["name"], interval, nil
+}
+
+// serveEvents handles GET /robots/{id}/events?name=...&interval=100ms and
+// streams the changes of the named variables as Server-Sent Events.
+func (g *Gateway) serveEvents(w http.ResponseWriter, req *http.Request) {
+	r, ok := g.robot(w, req)
+	if !ok {
+		return
+	}
+	names, interval, err := g.streamParams(req)
+	if err == nil && len(names) == 0 {
+		err = errors.New("missing name parameter")
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := req.Context()
+	connectCtx, cancel := context.WithTimeout(ctx, g.timeout())
+	err = r.Connect(connectCtx)
+	cancel()
+	if err != nil {
+		writeError(w, StatusCode(err), err)
+		return
+	}
+
+	s := newStream(r)
+	for _, name := range names {
+		s.subscribe(ctx, name, interval)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	rc := http.NewResponseController(w)
+	rc.Flush()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+	for id := 1; ; {
+		events := s.next(ctx, heartbeat.C)
+		if events == nil {
+			return
+		}
+
+		// Disconnect clients that stop reading.
+		rc.SetWriteDeadline(time.Now().Add(g.writeTimeout()))
+		if len(events) == 0 {
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		}
+		for _, event := range events {
+			data, _ := json.Marshal(event)
+			if _, err := fmt.Fprintf(w, "id: %d\nevent: change\ndata: %s\n\n", id, data); err != nil {
+				return
+			}
+			id++
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// wsRequest is a message from a WebSocket client.
+type wsRequest struct {
+	Subscribe   []string `json:"subscribe,omitempty"`
+	Unsubscribe []string `json:"unsubscribe,omitempty"`
+	// Interval is the poll interval of the variables subscribed by this message, e.g. "50ms".
+	Interval string `json:"interval,omitempty"`
+}
+
+// serveWebSocket handles GET /robots/{id}/ws. Clients send
+// {"subscribe": [...], "interval": "100ms"} and {"unsubscribe": [...]}
+// messages and receive each change as a JSON Event. Initial subscriptions
+// may also be given as name and interval query parameters.
+func (g *Gateway) serveWebSocket(w http.ResponseWriter, req *http.Request) {
+	r, ok := g.robot(w, req)
+	if !ok {
+		return
+	}
+	names, interval, err := g.streamParams(req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	conn, err := websocket.Accept(w, req, nil)
+	if err != nil {
+		return
+	}
+	defer conn.CloseNow()
+
+	ctx, cancel := context.WithCancel(req.Context())
+	defer cancel()
+
+	connectCtx, cancelConnect := context.WithTimeout(ctx, g.timeout())
+	err = r.Connect(connectCtx)
+	cancelConnect()
+	if err != nil {
+		conn.Close(websocket.StatusTryAgainLater, err.Error())
+		return
+	}
+
+	s := newStream(r)
+	for _, name := range names {
+		s.subscribe(ctx, name, interval)
+	}
+
+	// Handle subscription messages until the client goes away.
+	go func() {
+		defer cancel()
+		for {
+			var msg wsRequest
+			if err := wsjson.Read(ctx, conn, &msg); err != nil {
+				return
+			}
+			msgInterval := g.streamInterval()
+			if msg.Interval != "" {
+				d, err := time.ParseDuration(msg.Interval)
+				if err != nil {
+					conn.Close(websocket.StatusPolicyViolation, "invalid interval")
+					return
+				}
+				msgInterval = d
+			}
+			for _, name := range msg.Subscribe {
+				s.subscribe(ctx, name, msgInterval)
+			}
+			for _, name := range msg.Unsubscribe {
+				s.unsubscribe(name)
+			}
+		}
+	}()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		events := s.next(ctx, heartbeat.C)
+		if events == nil {
+			conn.Close(websocket.StatusNormalClosure, "")
+			return
+		}
+
+		// Disconnect clients that stop reading.
+		writeCtx, cancelWrite := context.WithTimeout(ctx, g.writeTimeout())
+		if len(events) == 0 {
+			err = conn.Ping(writeCtx)
+		}
+		for _, event := range events {
+			if err = wsjson.Write(writeCtx, conn, event); err != nil {
+				break
+			}
+		}
+		cancelWrite()
+		if err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,284 @@
+// Package gateway exposes robot variables over HTTP with JSON bodies.
+//
+// Routes:
+//
+//	GET  /robots                       list the configured robots
+//	GET  /robots/{id}/vars/{name}      read a variable
+//	PUT  /robots/{id}/vars/{name}      write a variable, body {"value": ...}
+//	POST /robots/{id}/batch/read       read variables, body {"names": [...]}
+//	POST /robots/{id}/batch/write      write variables, body {"values": [{"name": ..., "value": ...}]}
+//	GET  /robots/{id}/events?name=...  stream changes as Server-Sent Events
+//	GET  /robots/{id}/ws               stream changes over a WebSocket
+//
+// Values are returned typed by parsing them as KRL literals: INT and REAL as
+// numbers, BOOL as booleans, STRUC values as objects and ENUM values as
+// strings with a leading #. The raw literal is returned as well.
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/selimserbes/go-openshowvar/pkg/openshowvar"
+)
+
+// RobotConfig describes a robot served by the gateway.
+type RobotConfig struct {
+	// ID identifies the robot in URLs.
+	ID   string `json:"id"`
+	Host string `json:"host"`
+	Port int    `json:"port"`
+	// Options are passed to the client, e.g. WithDialer or WithMetrics.
+	Options []openshowvar.Option `json:"-"`
+}
+
+// Robot is a robot with its client. The connection is opened on the first
+// request, reused by all following ones and opened again after it failed.
+type Robot struct {
+	ID     string
+	Client *openshowvar.OpenShowVar
+
+	mu        sync.Mutex
+	connected bool
+	// lastConnect is the time of the last connection attempt.
+	lastConnect time.Time
+}
+
+// Connect opens the connection if it is not open.
+func (r *Robot) Connect(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.connected {
+		return nil
+	}
+	r.lastConnect = time.Now()
+	if err := r.Client.ConnectContext(ctx); err != nil {
+		return err
+	}
+	r.connected = true
+	return nil
+}
+
+// Reconnect closes the connection and opens it again, at most once per
+// minInterval, e.g. after streaming reads failed.
+func (r *Robot) Reconnect(ctx context.Context, minInterval time.Duration) error {
+	r.mu.Lock()
+	if time.Since(r.lastConnect) < minInterval {
+		r.mu.Unlock()
+		return nil
+	}
+	r.Client.Disconnect()
+	r.connected = false
+	r.mu.Unlock()
+	return r.Connect(ctx)
+}
+
+// MinSubscribeInterval is the shortest poll interval of Subscribe.
+const MinSubscribeInterval = 10 * time.Millisecond
+
+// ReconnectInterval is the time between reconnection attempts of Subscribe.
+const ReconnectInterval = time.Second
+
+// Subscribe polls a variable with Client.Subscribe, so all subscribers of a
+// variable share one poller, and reconnects the robot every
+// ReconnectInterval while reads fail because of the connection.
+//
+// Parameters:
+// - ctx: Ends the subscription.
+// - name: The variable.
+// - interval: The poll interval, at least MinSubscribeInterval.
+//
+// Returns: The changes, closed when ctx is done.
+func (r *Robot) Subscribe(ctx context.Context, name string, interval time.Duration) <-chan openshowvar.Change {
+	changes := r.Client.Subscribe(ctx, name, max(interval, MinSubscribeInterval))
+	out := make(chan openshowvar.Change)
+	go func() {
+		defer close(out)
+		retry := time.NewTicker(ReconnectInterval)
+		defer retry.Stop()
+		broken := false
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-retry.C:
+				if broken {
+					reconnectCtx, cancel := context.WithTimeout(ctx, ReconnectInterval)
+					r.Reconnect(reconnectCtx, ReconnectInterval)
+					cancel()
+				}
+			case change, ok := <-changes:
+				if !ok {
+					return
+				}
+				if change.Err == nil {
+					broken = false
+				} else if !errors.Is(change.Err, openshowvar.ErrVariableNotFound) {
+					broken = true
+				}
+				select {
+				case out <- change:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return out
+}
+
+// Connected reports whether the connection is open.
+func (r *Robot) Connected() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.connected
+}
+
+// Do runs a request on the connection, connecting first if needed. The
+// connection is closed after I/O errors, so the next request reconnects.
+func (r *Robot) Do(ctx context.Context, do func(ctx context.Context, osv *openshowvar.OpenShowVar) (string, error)) (string, error) {
+	if err := r.Connect(ctx); err != nil {
+		return "", err
+	}
+	value, err := do(ctx, r.Client)
+	if err != nil && !errors.Is(err, openshowvar.ErrVariableNotFound) {
+		r.mu.Lock()
+		r.Client.Disconnect()
+		r.connected = false
+		r.mu.Unlock()
+	}
+	return value, err
+}
+
+// Close closes the connection.
+func (r *Robot) Close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Client.Disconnect()
+	r.connected = false
+}
+
+// Gateway serves the variables of several robots over HTTP.
+type Gateway struct {
+	// Timeout bounds each request to a robot, 5s if zero.
+	Timeout time.Duration
+	// StreamInterval is the default poll interval of streams, 100ms if zero.
+	StreamInterval time.Duration
+	// WriteTimeout disconnects streaming clients that do not accept an event within it, 10s if zero.
+	WriteTimeout time.Duration
+
+	robots map[string]*Robot
+	mux    *http.ServeMux
+}
+
+// New creates a gateway for the given robots.
+//
+// Parameters:
+// - robots: The robots to serve, with unique IDs.
+//
+// Returns: A new Gateway or an error for duplicate or empty IDs.
+func New(robots ...RobotConfig) (*Gateway, error) {
+	g := &Gateway{robots: make(map[string]*Robot), mux: http.NewServeMux()}
+	for _, cfg := range robots {
+		if cfg.ID == "" {
+			return nil, errors.New("robot without id")
+		}
+		if _, ok := g.robots[cfg.ID]; ok {
+			return nil, fmt.Errorf("duplicate robot id %q", cfg.ID)
+		}
+		g.robots[cfg.ID] = &Robot{ID: cfg.ID, Client: openshowvar.NewOpenShowVar(cfg.Host, cfg.Port, cfg.Options...)}
+	}
+
+	g.mux.HandleFunc("GET /robots", g.listRobots)
+	g.mux.HandleFunc("GET /robots/{id}/vars/{name}", g.readVar)
+	g.mux.HandleFunc("PUT /robots/{id}/vars/{name}", g.writeVar)
+	g.mux.HandleFunc("POST /robots/{id}/batch/read", g.batchRead)
+	g.mux.HandleFunc("POST /robots/{id}/batch/write", g.batchWrite)
+	g.mux.HandleFunc("GET /robots/{id}/events", g.serveEvents)
+	g.mux.HandleFunc("GET /robots/{id}/ws", g.serveWebSocket)
+	return g, nil
+}
+
+// Handle registers an additional route, e.g. for health checks.
+func (g *Gateway) Handle(pattern string, handler http.Handler) {
+	g.mux.Handle(pattern, handler)
+}
+
+// Robot returns the robot with the given ID.
+func (g *Gateway) Robot(id string) (*Robot, bool) {
+	r, ok := g.robots[id]
+	return r, ok
+}
+
+// Robots returns all robots ordered by ID.
+func (g *Gateway) Robots() []*Robot {
+	robots := make([]*Robot, 0, len(g.robots))
+	for _, r := range g.robots {
+		robots = append(robots, r)
+	}
+	sort.Slice(robots, func(i, j int) bool { return robots[i].ID < robots[j].ID })
+	return robots
+}
+
+// Close closes the connections of all robots.
+func (g *Gateway) Close() {
+	for _, r := range g.robots {
+		r.Close()
+	}
+}
+
+// ServeHTTP implements http.Handler.
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	g.mux.ServeHTTP(w, req)
+}
+
+// timeout returns the time limit of a request to a robot.
+func (g *Gateway) timeout() time.Duration {
+	if g.Timeout > 0 {
+		return g.Timeout
+	}
+	return 5 * time.Second
+}
+
+// streamInterval returns the default poll interval of streams.
+func (g *Gateway) streamInterval() time.Duration {
+	if g.StreamInterval > 0 {
+		return g.StreamInterval
+	}
+	return 100 * time.Millisecond
+}
+
+// writeTimeout returns the time limit for writing an event to a streaming client.
+func (g *Gateway) writeTimeout() time.Duration {
+	if g.WriteTimeout > 0 {
+		return g.WriteTimeout
+	}
+	return 10 * time.Second
+}
+
+// robot looks up the robot of a request, writing a 404 response if it does not exist.
+func (g *Gateway) robot(w http.ResponseWriter, req *http.Request) (*Robot, bool) {
+	r, ok := g.robots[req.PathValue("id")]
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown robot %q", req.PathValue("id")))
+	}
+	return r, ok
+}
+
+// StatusCode maps an error of a robot request to an HTTP status code.
+func StatusCode(err error) int {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, openshowvar.ErrVariableNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusBadGateway
+}
@@ -0,0 +1,256 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/selimserbes/go-openshowvar/pkg/krl"
+	"github.com/selimserbes/go-openshowvar/pkg/openshowvar"
+)
+
+// maxBodySize bounds request bodies.
+const maxBodySize = 1 << 20
+
+// Var is the JSON representation of a variable.
+type Var struct {
+	Name string `json:"name"`
+	// Value is the typed value, Raw the KRL literal returned by the robot.
+	Value any    `json:"value,omitempty"`
+	Raw   string `json:"raw,omitempty"`
+	// Error is set when the variable could not be read or written.
+	Error string `json:"error,omitempty"`
+}
+
+// robotInfo is the JSON representation of a robot.
+type robotInfo struct {
+	ID        string `json:"id"`
+	Address   string `json:"address"`
+	Connected bool   `json:"connected"`
+}
+
+// writeBody is the body of a write, the value is a KRL literal or a JSON
+// number or boolean converted to one.
+type writeBody struct {
+	Name  string          `json:"name,omitempty"`
+	Value json.RawMessage `json:"value"`
+}
+
+// NewVar creates the JSON representation of a value read from a robot.
+func NewVar(name, raw string) Var {
+	v := Var{Name: name, Raw: raw, Value: raw}
+	if parsed, err := krl.Parse(raw); err == nil {
+		v.Value = parsed.Interface()
+	}
+	return v
+}
+
+// listRobots handles GET /robots.
+func (g *Gateway) listRobots(w http.ResponseWriter, req *http.Request) {
+	var robots []robotInfo
+	for _, r := range g.Robots() {
+		robots = append(robots, robotInfo{
+			ID:        r.ID,
+			Address:   fmt.Sprintf("%s:%d", r.Client.TCP_IP, r.Client.TCP_PORT),
+			Connected: r.Connected(),
+		})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"robots": robots})
+}
+
+// readVar handles GET /robots/{id}/vars/{name}.
+func (g *Gateway) readVar(w http.ResponseWriter, req *http.Request) {
+	r, ok := g.robot(w, req)
+	if !ok {
+		return
+	}
+	name := req.PathValue("name")
+
+	ctx, cancel := context.WithTimeout(req.Context(), g.timeout())
+	defer cancel()
+	value, err := r.Do(ctx, func(ctx context.Context, osv *openshowvar.OpenShowVar) (string, error) {
+		return osv.ReadContext(ctx, name)
+	})
+	if err != nil {
+		writeError(w, StatusCode(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, NewVar(name, value))
+}
+
+// writeVar handles PUT /robots/{id}/vars/{name}.
+func (g *Gateway) writeVar(w http.ResponseWriter, req *http.Request) {
+	r, ok := g.robot(w, req)
+	if !ok {
+		return
+	}
+	name := req.PathValue("name")
+
+	var body writeBody
+	if err := decodeBody(w, req, &body); err != nil {
+		return
+	}
+	value, err := Literal(body.Value)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), g.timeout())
+	defer cancel()
+	written, err := r.Do(ctx, func(ctx context.Context, osv *openshowvar.OpenShowVar) (string, error) {
+		return osv.WriteContext(ctx, name, value)
+	})
+	if err != nil {
+		writeError(w, StatusCode(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, NewVar(name, written))
+}
+
+// batchRead handles POST /robots/{id}/batch/read. Variables that cannot be
+// read are reported with their error, the response is 200 unless the
+// connection fails.
+func (g *Gateway) batchRead(w http.ResponseWriter, req *http.Request) {
+	r, ok := g.robot(w, req)
+	if !ok {
+		return
+	}
+	var body struct {
+		Names []string `json:"names"`
+	}
+	if err := decodeBody(w, req, &body); err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), g.timeout())
+	defer cancel()
+	ctx, end := r.Client.TraceBatch(ctx, openshowvar.ModeRead, len(body.Names))
+	values := make([]Var, 0, len(body.Names))
+	for _, name := range body.Names {
+		value, err := r.Do(ctx, func(ctx context.Context, osv *openshowvar.OpenShowVar) (string, error) {
+			return osv.ReadContext(ctx, name)
+		})
+		if err != nil && !errors.Is(err, openshowvar.ErrVariableNotFound) {
+			end(err)
+			writeError(w, StatusCode(err), err)
+			return
+		}
+		values = append(values, result(name, value, err))
+	}
+	end(nil)
+	writeJSON(w, http.StatusOK, map[string]any{"values": values})
+}
+
+// batchWrite handles POST /robots/{id}/batch/write. The values are written in
+// order, rejected values are reported with their error.
+func (g *Gateway) batchWrite(w http.ResponseWriter, req *http.Request) {
+	r, ok := g.robot(w, req)
+	if !ok {
+		return
+	}
+	var body struct {
+		Values []writeBody `json:"values"`
+	}
+	if err := decodeBody(w, req, &body); err != nil {
+		return
+	}
+
+	// Check all values before writing any of them.
+	literals := make([]string, len(body.Values))
+	for i, v := range body.Values {
+		value, err := Literal(v.Value)
+		if err == nil && v.Name == "" {
+			err = errors.New("missing name")
+		}
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("values[%d]: %v", i, err))
+			return
+		}
+		literals[i] = value
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), g.timeout())
+	defer cancel()
+	ctx, end := r.Client.TraceBatch(ctx, openshowvar.ModeWrite, len(body.Values))
+	values := make([]Var, 0, len(body.Values))
+	for i, v := range body.Values {
+		written, err := r.Do(ctx, func(ctx context.Context, osv *openshowvar.OpenShowVar) (string, error) {
+			return osv.WriteContext(ctx, v.Name, literals[i])
+		})
+		if err != nil && !errors.Is(err, openshowvar.ErrVariableNotFound) {
+			end(err)
+			writeError(w, StatusCode(err), err)
+			return
+		}
+		values = append(values, result(v.Name, written, err))
+	}
+	end(nil)
+	writeJSON(w, http.StatusOK, map[string]any{"values": values})
+}
+
+// result creates the JSON representation of one variable of a batch.
+func result(name, value string, err error) Var {
+	if err != nil {
+		return Var{Name: name, Error: err.Error()}
+	}
+	return NewVar(name, value)
+}
+
+// Literal converts a JSON value to a KRL literal: strings are taken as
+// literals, numbers as they are and booleans as TRUE or FALSE.
+//
+// Parameters:
+// - raw: The JSON value, e.g. a request body field or an MQTT payload.
+//
+// Returns: The KRL literal, or an error for empty strings and other JSON values.
+func Literal(raw json.RawMessage) (string, error) {
+	var v any
+	dec := json.NewDecoder(strings.NewReader(string(raw)))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return "", errors.New("missing or invalid value")
+	}
+	switch v := v.(type) {
+	case string:
+		if v == "" {
+			return "", errors.New("empty value")
+		}
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		if v {
+			return "TRUE", nil
+		}
+		return "FALSE", nil
+	}
+	return "", errors.New("value must be a KRL literal string, a number or a boolean")
+}
+
+// decodeBody decodes a JSON request body, writing a 400 response on errors.
+func decodeBody(w http.ResponseWriter, req *http.Request, v any) error {
+	dec := json.NewDecoder(http.MaxBytesReader(w, req.Body, maxBodySize))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		err = fmt.Errorf("invalid request body: %v", err)
+		writeError(w, http.StatusBadRequest, err)
+		return err
+	}
+	return nil
+}
+
+// writeJSON writes v as the response body.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes an error response with body {"error": ...}.
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,140 @@
+package gateway
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/selimserbes/go-openshowvar/pkg/openshowvar"
+)
+
+// Event is a change of a variable sent to streaming clients.
+type Event struct {
+	Robot string `json:"robot"`
+	Var
+	// Previous is the raw value before the change, empty for the first value.
+	Previous string    `json:"previous,omitempty"`
+	Time     time.Time `json:"time"`
+	// Coalesced counts the changes replaced by this one because the client
+	// did not keep up.
+	Coalesced int `json:"coalesced,omitempty"`
+}
+
+// stream collects the changes of the variables a client subscribed to.
+//
+// Variables are polled with Robot.Subscribe, so all clients of a robot share
+// one poller per variable. Only the latest change of each variable is kept until
+// the client takes it: a slow client skips intermediate values instead of
+// falling behind or slowing down other clients.
+type stream struct {
+	robot *Robot
+
+	mu sync.Mutex
+	// subs holds the current subscription of each variable. Changes of
+	// earlier subscriptions of a variable are dropped.
+	subs    map[string]*streamSub
+	pending map[string]*Event
+	notify  chan struct{}
+}
+
+// streamSub is one subscription of a stream to a variable.
+type streamSub struct {
+	cancel context.CancelFunc
+}
+
+// newStream creates a stream for a robot.
+func newStream(r *Robot) *stream {
+	return &stream{
+		robot:   r,
+		subs:    make(map[string]*streamSub),
+		pending: make(map[string]*Event),
+		notify:  make(chan struct{}, 1),
+	}
+}
+
+// subscribe starts delivering changes of a variable until ctx is done or it is unsubscribed.
+func (s *stream) subscribe(ctx context.Context, name string, interval time.Duration) {
+	s.mu.Lock()
+	if _, ok := s.subs[name]; ok {
+		s.mu.Unlock()
+		return
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	sub := &streamSub{cancel: cancel}
+	s.subs[name] = sub
+	s.mu.Unlock()
+
+	changes := s.robot.Subscribe(ctx, name, interval)
+	go func() {
+		for change := range changes {
+			s.add(sub, change)
+		}
+	}()
+}
+
+// unsubscribe stops delivering changes of a variable and drops its pending change.
+func (s *stream) unsubscribe(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if sub, ok := s.subs[name]; ok {
+		sub.cancel()
+		delete(s.subs, name)
+		delete(s.pending, name)
+	}
+}
+
+// add stores a change of sub, replacing the pending change of the same
+// variable. Changes of subscriptions that were replaced are dropped.
+func (s *stream) add(sub *streamSub, change openshowvar.Change) {
+	event := &Event{Robot: s.robot.ID, Var: NewVar(change.VarName, change.Value), Previous: change.Previous, Time: change.Time}
+	if change.Err != nil {
+		event.Var = Var{Name: change.VarName, Error: change.Err.Error()}
+	}
+
+	s.mu.Lock()
+	if s.subs[change.VarName] != sub {
+		s.mu.Unlock()
+		return
+	}
+	if prev, ok := s.pending[change.VarName]; ok {
+		event.Coalesced = prev.Coalesced + 1
+		if event.Previous != "" && prev.Previous != "" {
+			event.Previous = prev.Previous
+		}
+	}
+	s.pending[change.VarName] = event
+	s.mu.Unlock()
+
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+// take returns the pending changes ordered by time.
+func (s *stream) take() []*Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	events := make([]*Event, 0, len(s.pending))
+	for name, event := range s.pending {
+		events = append(events, event)
+		delete(s.pending, name)
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].Time.Before(events[j].Time) })
+	return events
+}
+
+// next waits for pending changes.
+//
+// Returns: The changes, or nil when ctx is done.
+func (s *stream) next(ctx context.Context, heartbeat <-chan time.Time) []*Event {
+	select {
+	case <-ctx.Done():
+		return nil
+	case <-s.notify:
+		return s.take()
+	case <-heartbeat:
+		return []*Event{}
+	}
+}
@@ -0,0 +1,441 @@
+// Package krl parses and formats the KRL value literals returned by KukaVarProxy,
+// such as 42, 1.5E+02, TRUE, #T1, "text" and {E6POS: X 0.0, Y 0.0, ...}.
+package krl
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Kind is the KRL data type of a value.
+type Kind int
+
+// KRL data types.
+const (
+	Invalid Kind = iota
+	Int
+	Real
+	Bool
+	String
+	Enum
+	Struc
+)
+
+// String returns the KRL name of the kind.
+func (k Kind) String() string {
+	switch k {
+	case Int:
+		return "INT"
+	case Real:
+		return "REAL"
+	case Bool:
+		return "BOOL"
+	case String:
+		return "STRING"
+	case Enum:
+		return "ENUM"
+	case Struc:
+		return "STRUC"
+	}
+	return "INVALID"
+}
+
+// Value is a parsed KRL value.
+type Value struct {
+	Kind Kind
+	// Int holds INT values.
+	Int int64
+	// Real holds REAL values.
+	Real float64
+	// Bool holds BOOL values.
+	Bool bool
+	// Str holds STRING values without quotes and ENUM values without the leading #.
+	Str string
+	// Type is the STRUC type name, e.g. E6POS. It may be empty.
+	Type string
+	// Fields holds STRUC members in order.
+	Fields []Field
+}
+
+// Field is a named member of a STRUC value.
+type Field struct {
+	Name  string
+	Value Value
+}
+
+// Parse parses a KRL value literal.
+//
+// Parameters:
+// - s: The literal, surrounding whitespace is ignored.
+//
+// Returns: The parsed value or an error.
+func Parse(s string) (Value, error) {
+	p := parser{s: s}
+	p.skipSpace()
+	v, err := p.value()
+	if err != nil {
+		return Value{}, err
+	}
+	p.skipSpace()
+	if p.pos != len(p.s) {
+		return Value{}, p.errorf("unexpected %q after value", p.s[p.pos:])
+	}
+	return v, nil
+}
+
+// Field returns the STRUC member with the given name.
+func (v Value) Field(name string) (Value, bool) {
+	for _, f := range v.Fields {
+		if strings.EqualFold(f.Name, name) {
+			return f.Value, true
+		}
+	}
+	return Value{}, false
+}
+
+// Float returns INT and REAL values as float64.
+func (v Value) Float() (float64, bool) {
+	switch v.Kind {
+	case Int:
+		return float64(v.Int), true
+	case Real:
+		return v.Real, true
+	}
+	return 0, false
+}
+
+// Interface converts the value to plain Go types: int64, float64, bool and
+// string for scalars, with ENUM values keeping their leading #, and
+// map[string]any for STRUC values.
+func (v Value) Interface() any {
+	switch v.Kind {
+	case Int:
+		return v.Int
+	case Real:
+		return v.Real
+	case Bool:
+		return v.Bool
+	case String:
+		return v.Str
+	case Enum:
+		return "#" + v.Str
+	case Struc:
+		m := make(map[string]any, len(v.Fields))
+		for _, f := range v.Fields {
+			m[f.Name] = f.Value.Interface()
+		}
+		return m
+	}
+	return nil
+}
+
+// Flatten returns the scalar leaves of the value. STRUC members are named
+// by their path below prefix, e.g. "$POS_ACT.X" or "TOOL.FRAME.X", while a
+// scalar value is returned as a single field named prefix.
+func (v Value) Flatten(prefix string) []Field {
+	if v.Kind != Struc {
+		return []Field{{Name: prefix, Value: v}}
+	}
+	var fields []Field
+	for _, f := range v.Fields {
+		name := f.Name
+		if prefix != "" {
+			name = prefix + "." + f.Name
+		}
+		fields = append(fields, f.Value.Flatten(name)...)
+	}
+	return fields
+}
+
+// Text returns the value as plain text: STRING values without quotes and
+// everything else as its KRL literal.
+func (v Value) Text() string {
+	if v.Kind == String {
+		return v.Str
+	}
+	return v.String()
+}
+
+// String formats the value as a KRL literal.
+func (v Value) String() string {
+	var b strings.Builder
+	v.format(&b)
+	return b.String()
+}
+
+// format appends the KRL literal of v to b.
+func (v Value) format(b *strings.Builder) {
+	switch v.Kind {
+	case Int:
+		b.WriteString(strconv.FormatInt(v.Int, 10))
+	case Real:
+		s := strconv.FormatFloat(v.Real, 'G', -1, 64)
+		if !strings.ContainsAny(s, ".E") {
+			s += ".0"
+		}
+		b.WriteString(s)
+	case Bool:
+		if v.Bool {
+			b.WriteString("TRUE")
+		} else {
+			b.WriteString("FALSE")
+		}
+	case String:
+		b.WriteString(`"` + v.Str + `"`)
+	case Enum:
+		b.WriteString("#" + v.Str)
+	case Struc:
+		b.WriteByte('{')
+		if v.Type != "" {
+			b.WriteString(v.Type + ":")
+			if len(v.Fields) > 0 {
+				b.WriteByte(' ')
+			}
+		}
+		for i, f := range v.Fields {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			b.WriteString(f.Name + " ")
+			f.Value.format(b)
+		}
+		b.WriteByte('}')
+	}
+}
+
+// Equal reports whether a and b are equal. INT and REAL values, including
+// STRUC members, are compared numerically and may differ by up to tolerance.
+// Names of STRUC types and members are compared case-insensitively, like KRL does.
+func Equal(a, b Value, tolerance float64) bool {
+	if fa, ok := a.Float(); ok {
+		fb, ok := b.Float()
+		return ok && math.Abs(fa-fb) <= tolerance
+	}
+	if a.Kind != b.Kind {
+		return false
+	}
+	switch a.Kind {
+	case Bool:
+		return a.Bool == b.Bool
+	case String:
+		return a.Str == b.Str
+	case Enum:
+		return strings.EqualFold(a.Str, b.Str)
+	case Struc:
+		if !strings.EqualFold(a.Type, b.Type) || len(a.Fields) != len(b.Fields) {
+			return false
+		}
+		for i := range a.Fields {
+			if !strings.EqualFold(a.Fields[i].Name, b.Fields[i].Name) || !Equal(a.Fields[i].Value, b.Fields[i].Value, tolerance) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// EqualStrings parses two literals and compares them with Equal. Literals that
+// cannot be parsed are compared as plain strings.
+func EqualStrings(a, b string, tolerance float64) bool {
+	va, errA := Parse(a)
+	vb, errB := Parse(b)
+	if errA != nil || errB != nil {
+		return a == b
+	}
+	return Equal(va, vb, tolerance)
+}
+
+// parser is a recursive descent parser over a KRL literal.
+type parser struct {
+	s   string
+	pos int
+}
+
+// errorf returns a parse error at the current position.
+func (p *parser) errorf(format string, args ...any) error {
+	return fmt.Errorf("krl: offset %d: %s", p.pos, fmt.Sprintf(format, args...))
+}
+
+// skipSpace advances past whitespace.
+func (p *parser) skipSpace() {
+	for p.pos < len(p.s) && (p.s[p.pos] == ' ' || p.s[p.pos] == '\t' || p.s[p.pos] == '\r' || p.s[p.pos] == '\n') {
+		p.pos++
+	}
+}
+
+// value parses any value at the current position.
+func (p *parser) value() (Value, error) {
+	if p.pos >= len(p.s) {
+		return Value{}, p.errorf("unexpected end of input")
+	}
+
+	switch c := p.s[p.pos]; {
+	case c == '{':
+		return p.struc()
+	case c == '"':
+		end := strings.IndexByte(p.s[p.pos+1:], '"')
+		if end < 0 {
+			return Value{}, p.errorf("unterminated string")
+		}
+		v := Value{Kind: String, Str: p.s[p.pos+1 : p.pos+1+end]}
+		p.pos += end + 2
+		return v, nil
+	case c == '#':
+		p.pos++
+		name := p.ident()
+		if name == "" {
+			return Value{}, p.errorf("missing enum name")
+		}
+		return Value{Kind: Enum, Str: name}, nil
+	case c == '\'':
+		return p.based()
+	case c == '+' || c == '-' || c == '.' || (c >= '0' && c <= '9'):
+		return p.number()
+	}
+
+	word := p.ident()
+	switch strings.ToUpper(word) {
+	case "TRUE":
+		return Value{Kind: Bool, Bool: true}, nil
+	case "FALSE":
+		return Value{Kind: Bool, Bool: false}, nil
+	case "":
+		return Value{}, p.errorf("unexpected %q", p.s[p.pos])
+	}
+	return Value{}, p.errorf("unknown literal %q", word)
+}
+
+// ident parses an identifier, which may be empty.
+func (p *parser) ident() string {
+	start := p.pos
+	for p.pos < len(p.s) {
+		c := p.s[p.pos]
+		if c == '_' || c == '$' || (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (p.pos > start && c >= '0' && c <= '9') {
+			p.pos++
+			continue
+		}
+		break
+	}
+	return p.s[start:p.pos]
+}
+
+// number parses an INT or REAL literal.
+func (p *parser) number() (Value, error) {
+	start := p.pos
+	isReal := false
+	if p.s[p.pos] == '+' || p.s[p.pos] == '-' {
+		p.pos++
+	}
+scan:
+	for p.pos < len(p.s) {
+		c := p.s[p.pos]
+		switch {
+		case c >= '0' && c <= '9':
+		case c == '.':
+			isReal = true
+		case c == 'E' || c == 'e':
+			isReal = true
+			if p.pos+1 < len(p.s) && (p.s[p.pos+1] == '+' || p.s[p.pos+1] == '-') {
+				p.pos++
+			}
+		default:
+			break scan
+		}
+		p.pos++
+	}
+	text := p.s[start:p.pos]
+	if !isReal {
+		n, err := strconv.ParseInt(text, 10, 64)
+		if err != nil {
+			return Value{}, p.errorf("invalid INT %q", text)
+		}
+		return Value{Kind: Int, Int: n}, nil
+	}
+	f, err := strconv.ParseFloat(text, 64)
+	if err != nil || math.IsInf(f, 0) {
+		return Value{}, p.errorf("invalid REAL %q", text)
+	}
+	return Value{Kind: Real, Real: f}, nil
+}
+
+// based parses hexadecimal ('H1F') and binary ('B101') INT literals.
+func (p *parser) based() (Value, error) {
+	end := strings.IndexByte(p.s[p.pos+1:], '\'')
+	if end < 1 {
+		return Value{}, p.errorf("invalid based literal")
+	}
+	body := p.s[p.pos+1 : p.pos+1+end]
+	base := 0
+	switch body[0] {
+	case 'H', 'h':
+		base = 16
+	case 'B', 'b':
+		base = 2
+	default:
+		return Value{}, p.errorf("invalid based literal %q", body)
+	}
+	n, err := strconv.ParseUint(body[1:], base, 32)
+	if err != nil {
+		return Value{}, p.errorf("invalid based literal %q", body)
+	}
+	p.pos += end + 2
+	return Value{Kind: Int, Int: int64(int32(n))}, nil
+}
+
+// struc parses a STRUC literal, e.g. {E6POS: X 1.0, Y 2.0}.
+func (p *parser) struc() (Value, error) {
+	v := Value{Kind: Struc}
+	p.pos++
+	p.skipSpace()
+
+	// Optional type name followed by a colon.
+	save := p.pos
+	if name := p.ident(); name != "" {
+		p.skipSpace()
+		if p.pos < len(p.s) && p.s[p.pos] == ':' {
+			v.Type = name
+			p.pos++
+		} else {
+			p.pos = save
+		}
+	}
+
+	for {
+		p.skipSpace()
+		if p.pos >= len(p.s) {
+			return Value{}, p.errorf("unterminated STRUC")
+		}
+		if p.s[p.pos] == '}' && len(v.Fields) == 0 {
+			p.pos++
+			return v, nil
+		}
+
+		name := p.ident()
+		if name == "" {
+			return Value{}, p.errorf("missing member name")
+		}
+		p.skipSpace()
+		member, err := p.value()
+		if err != nil {
+			return Value{}, err
+		}
+		v.Fields = append(v.Fields, Field{Name: name, Value: member})
+
+		p.skipSpace()
+		if p.pos >= len(p.s) {
+			return Value{}, p.errorf("unterminated STRUC")
+		}
+		switch p.s[p.pos] {
+		case ',':
+			p.pos++
+		case '}':
+			p.pos++
+			return v, nil
+		default:
+			return Value{}, p.errorf("expected ',' or '}'")
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package krl
+
+import (
+	"path"
+	"strings"
+)
+
+// brackets escapes array brackets in patterns.
+var brackets = strings.NewReplacer("[", `\[`, "]", `\]`)
+
+// MatchName reports whether a variable name matches a pattern, ignoring case
+// like KRL does.
+//
+// Patterns use path.Match syntax, except that brackets are literal as in
+// array indices: RECIPE[2] matches that element and RECIPE[*] all elements.
+// A pattern also matches the array elements and STRUC members of the
+// variables it matches, so $IN matches $IN[1] and $TOOL_DATA[3] matches
+// $TOOL_DATA[3].X.
+//
+// Parameters:
+// - pattern: The pattern, e.g. "$TOOL_DATA[3]" or "RECIPE_*".
+// - name: The variable name.
+//
+// Returns: Whether the name or a variable it belongs to matches.
+func MatchName(pattern, name string) bool {
+	pattern, name = strings.ToUpper(pattern), strings.ToUpper(name)
+	if pattern == name {
+		return true
+	}
+	pattern = brackets.Replace(pattern)
+	for {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+		i := strings.LastIndexAny(name, "[.")
+		if i <= 0 {
+			return false
+		}
+		name = name[:i]
+	}
+}
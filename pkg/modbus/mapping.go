@@ -0,0 +1,321 @@
+package modbus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/selimserbes/go-openshowvar/pkg/gateway"
+	"github.com/selimserbes/go-openshowvar/pkg/krl"
+	"github.com/selimserbes/go-openshowvar/pkg/openshowvar"
+	"github.com/selimserbes/go-openshowvar/pkg/snapshot"
+)
+
+// Table is a Modbus data table.
+type Table string
+
+// Data tables. Discrete inputs and input registers are read-only.
+const (
+	Coils            Table = "coils"
+	DiscreteInputs   Table = "discrete_inputs"
+	HoldingRegisters Table = "holding_registers"
+	InputRegisters   Table = "input_registers"
+)
+
+// Register types of numeric variables. 32-bit values take two registers,
+// high word first.
+const (
+	Int16   = "int16"
+	Uint16  = "uint16"
+	Int32   = "int32"
+	Uint32  = "uint32"
+	Float32 = "float32"
+)
+
+// Mapping maps a KRL variable or BOOL array to addresses of a table.
+//
+// In coils and discrete inputs, a BOOL variable takes one address and a
+// BOOL array one address per element. In registers, a number takes one or
+// two registers depending on Type, and a BOOL array is packed 16 elements
+// per register, the first element in the least significant bit.
+type Mapping struct {
+	Table   Table  `json:"table"`
+	Address uint16 `json:"address"`
+	// Var is the variable, e.g. $OV_PRO or $POS_ACT.X, or the BOOL array
+	// if Count is set, e.g. $OUT.
+	Var string `json:"var"`
+	// Start is the index of the first array element, 1 if zero.
+	Start int `json:"start,omitempty"`
+	// Count is the number of array elements, 0 for a single variable.
+	Count int `json:"count,omitempty"`
+	// Type is the register type of numbers, Int16 if empty.
+	Type string `json:"type,omitempty"`
+	// Scale multiplies values read from the robot and divides values
+	// written to it, e.g. 10 to transfer a REAL with one decimal in an
+	// integer register. 1 if zero.
+	Scale float64 `json:"scale,omitempty"`
+	// ReadOnly rejects writes. Variables of snapshot.ReadOnlyVars are
+	// always read-only.
+	ReadOnly bool `json:"read_only,omitempty"`
+}
+
+// entry is a validated mapping in the address space of a robot.
+type entry struct {
+	Mapping
+	// size is the number of addresses taken.
+	size     int
+	readOnly bool
+}
+
+// bitTable reports whether a table holds bits rather than registers.
+func bitTable(t Table) bool {
+	return t == Coils || t == DiscreteInputs
+}
+
+// newEntry validates a mapping and applies its defaults.
+func newEntry(m Mapping) (*entry, error) {
+	e := &entry{Mapping: m, readOnly: m.ReadOnly || m.Table == DiscreteInputs || m.Table == InputRegisters}
+	if e.Var == "" {
+		return nil, errors.New("missing var")
+	}
+	if e.Start == 0 {
+		e.Start = 1
+	}
+	if e.Scale == 0 {
+		e.Scale = 1
+	}
+	if e.Count < 0 {
+		return nil, fmt.Errorf("%s: negative count", e.Var)
+	}
+
+	switch {
+	case e.Table != Coils && e.Table != DiscreteInputs && e.Table != HoldingRegisters && e.Table != InputRegisters:
+		return nil, fmt.Errorf("%s: unknown table %q", e.Var, e.Table)
+	case bitTable(e.Table):
+		if e.Type != "" || m.Scale != 0 {
+			return nil, fmt.Errorf("%s: type and scale only apply to registers", e.Var)
+		}
+		e.size = max(e.Count, 1)
+	case e.Count > 0:
+		if e.Type != "" || m.Scale != 0 {
+			return nil, fmt.Errorf("%s: type and scale do not apply to BOOL arrays", e.Var)
+		}
+		e.size = (e.Count + 15) / 16
+	default:
+		switch e.Type {
+		case "":
+			e.Type = Int16
+			e.size = 1
+		case Int16, Uint16:
+			e.size = 1
+		case Int32, Uint32, Float32:
+			e.size = 2
+		default:
+			return nil, fmt.Errorf("%s: unknown type %q", e.Var, e.Type)
+		}
+	}
+	if int(e.Address)+e.size > 1<<16 {
+		return nil, fmt.Errorf("%s: addresses exceed 65535", e.Var)
+	}
+	if snapshot.IsReadOnly(e.Var) {
+		e.readOnly = true
+	}
+	return e, nil
+}
+
+// element returns the name of the variable of the i-th address of bit
+// entries or the i-th bit of packed registers.
+func (e *entry) element(i int) string {
+	if e.Count == 0 {
+		return e.Var
+	}
+	return e.Var + "[" + strconv.Itoa(e.Start+i) + "]"
+}
+
+// values reads the variables of an entry from the robot once per Modbus
+// request.
+type values struct {
+	ctx   context.Context
+	robot *gateway.Robot
+	cache map[string]krl.Value
+}
+
+// read returns the parsed value of a variable.
+func (v *values) read(name string) (krl.Value, error) {
+	if value, ok := v.cache[name]; ok {
+		return value, nil
+	}
+	raw, err := v.robot.Do(v.ctx, func(ctx context.Context, osv *openshowvar.OpenShowVar) (string, error) {
+		return osv.ReadContext(ctx, name)
+	})
+	if err != nil {
+		return krl.Value{}, robotException(err)
+	}
+	value, err := krl.Parse(raw)
+	if err != nil {
+		return krl.Value{}, ServerDeviceFailure
+	}
+	v.cache[name] = value
+	return value, nil
+}
+
+// span returns the first address of an entry within a request for quantity
+// addresses from addr, relative to the entry, and the number of its
+// addresses in the request.
+func (e *entry) span(addr uint16, quantity int) (int, int) {
+	first := max(int(addr), int(e.Address))
+	last := min(int(addr)+quantity, int(e.Address)+e.size)
+	return first - int(e.Address), last - first
+}
+
+// bits returns n bits of a coil or discrete input entry from its address
+// first on, reading only their elements.
+func (e *entry) bits(v *values, first, n int) ([]bool, error) {
+	bits := make([]bool, n)
+	for i := range bits {
+		value, err := v.read(e.element(first + i))
+		if err != nil {
+			return nil, err
+		}
+		if value.Kind != krl.Bool {
+			return nil, ServerDeviceFailure
+		}
+		bits[i] = value.Bool
+	}
+	return bits, nil
+}
+
+// registers returns n registers of a register entry from its address first
+// on. Only the elements of packed BOOL arrays in these registers are read.
+func (e *entry) registers(v *values, first, n int) ([]uint16, error) {
+	regs := make([]uint16, e.size)
+	if e.Count > 0 {
+		for i := first * 16; i < min(e.Count, (first+n)*16); i++ {
+			value, err := v.read(e.element(i))
+			if err != nil {
+				return nil, err
+			}
+			if value.Kind != krl.Bool {
+				return nil, ServerDeviceFailure
+			}
+			if value.Bool {
+				regs[i/16] |= 1 << (i % 16)
+			}
+		}
+		return regs[first : first+n], nil
+	}
+
+	value, err := v.read(e.Var)
+	if err != nil {
+		return nil, err
+	}
+	f, ok := value.Float()
+	if value.Kind == krl.Bool {
+		f, ok = 0, true
+		if value.Bool {
+			f = 1
+		}
+	}
+	if !ok {
+		return nil, ServerDeviceFailure
+	}
+	f *= e.Scale
+	if e.Type == Float32 {
+		putUint32(regs, math.Float32bits(float32(f)))
+		return regs[first : first+n], nil
+	}
+
+	// Integer registers are rounded and out of range values fail rather
+	// than wrap around.
+	f = math.Round(f)
+	lo, hi := typeRange(e.Type)
+	if f < lo || f > hi {
+		return nil, ServerDeviceFailure
+	}
+	switch e.Type {
+	case Int16, Uint16:
+		regs[0] = uint16(int64(f))
+	default:
+		putUint32(regs, uint32(int64(f)))
+	}
+	return regs[first : first+n], nil
+}
+
+// putUint32 stores a 32-bit value in two registers, high word first.
+func putUint32(regs []uint16, v uint32) {
+	regs[0], regs[1] = uint16(v>>16), uint16(v)
+}
+
+// getUint32 returns the 32-bit value of two registers, high word first.
+func getUint32(regs []uint16) uint32 {
+	return uint32(regs[0])<<16 | uint32(regs[1])
+}
+
+// typeRange returns the range of an integer register type.
+func typeRange(typ string) (float64, float64) {
+	switch typ {
+	case Int16:
+		return math.MinInt16, math.MaxInt16
+	case Uint16:
+		return 0, math.MaxUint16
+	case Int32:
+		return math.MinInt32, math.MaxInt32
+	}
+	return 0, math.MaxUint32
+}
+
+// literal converts the registers of a numeric entry to a KRL literal:
+// integers if the unscaled value is whole, REAL literals otherwise.
+func (e *entry) literal(regs []uint16) (string, error) {
+	var f float64
+	switch e.Type {
+	case Int16:
+		f = float64(int16(regs[0]))
+	case Uint16:
+		f = float64(regs[0])
+	case Int32:
+		f = float64(int32(getUint32(regs)))
+	case Uint32:
+		f = float64(getUint32(regs))
+	case Float32:
+		f = float64(math.Float32frombits(getUint32(regs)))
+	}
+	f /= e.Scale
+	switch {
+	case math.IsNaN(f) || math.IsInf(f, 0):
+		return "", IllegalDataValue
+	case f == math.Trunc(f) && math.Abs(f) < 1<<31:
+		return strconv.FormatInt(int64(f), 10), nil
+	}
+	return krl.Value{Kind: krl.Real, Real: f}.String(), nil
+}
+
+// write writes a variable to the robot.
+func write(ctx context.Context, robot *gateway.Robot, name, literal string) error {
+	_, err := robot.Do(ctx, func(ctx context.Context, osv *openshowvar.OpenShowVar) (string, error) {
+		return osv.WriteContext(ctx, name, literal)
+	})
+	if err != nil {
+		return robotException(err)
+	}
+	return nil
+}
+
+// boolLiteral returns the KRL literal of a bit.
+func boolLiteral(b bool) string {
+	if b {
+		return "TRUE"
+	}
+	return "FALSE"
+}
+
+// robotException maps an error of a robot request to an exception: the
+// robot is the target device of the gateway.
+func robotException(err error) Exception {
+	if errors.Is(err, openshowvar.ErrVariableNotFound) {
+		return ServerDeviceFailure
+	}
+	return GatewayTargetFailed
+}
@@ -0,0 +1,520 @@
+// Package modbus serves robot variables as a Modbus TCP server, for PLCs
+// that cannot use the other interfaces.
+//
+// Each robot is a unit, addressed by the unit identifier of requests. A
+// table of mappings assigns KRL variables to coils, discrete inputs,
+// holding registers and input registers; reads and writes of these
+// addresses read and write the variables on the robot. REAL values are
+// scaled into integer registers or transferred as float32, and BOOL arrays
+// are packed into registers.
+//
+// Supported function codes: 1 Read Coils, 2 Read Discrete Inputs, 3 Read
+// Holding Registers, 4 Read Input Registers, 5 Write Single Coil, 6 Write
+// Single Register, 15 Write Multiple Coils and 16 Write Multiple Registers.
+// Writes of several variables are not atomic: they are written in address
+// order and a failure leaves the earlier ones written.
+package modbus
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/selimserbes/go-openshowvar/pkg/gateway"
+	"github.com/selimserbes/go-openshowvar/pkg/krl"
+)
+
+// defaultTimeout bounds the robot requests of one Modbus request.
+const defaultTimeout = 5 * time.Second
+
+// Function codes.
+const (
+	readCoils              = 1
+	readDiscreteInputs     = 2
+	readHoldingRegisters   = 3
+	readInputRegisters     = 4
+	writeSingleCoil        = 5
+	writeSingleRegister    = 6
+	writeMultipleCoils     = 15
+	writeMultipleRegisters = 16
+)
+
+// Quantity limits of the function codes.
+const (
+	maxReadBits       = 2000
+	maxReadRegisters  = 125
+	maxWriteBits      = 1968
+	maxWriteRegisters = 123
+)
+
+// Exception is a Modbus exception code, returned to clients for failed
+// requests.
+type Exception byte
+
+// Exception codes used by the server.
+const (
+	IllegalFunction        Exception = 0x01
+	IllegalDataAddress     Exception = 0x02
+	IllegalDataValue       Exception = 0x03
+	ServerDeviceFailure    Exception = 0x04
+	GatewayPathUnavailable Exception = 0x0A
+	GatewayTargetFailed    Exception = 0x0B
+)
+
+// Error implements error.
+func (e Exception) Error() string {
+	switch e {
+	case IllegalFunction:
+		return "modbus: illegal function"
+	case IllegalDataAddress:
+		return "modbus: illegal data address"
+	case IllegalDataValue:
+		return "modbus: illegal data value"
+	case ServerDeviceFailure:
+		return "modbus: server device failure"
+	case GatewayPathUnavailable:
+		return "modbus: gateway path unavailable"
+	case GatewayTargetFailed:
+		return "modbus: gateway target device failed to respond"
+	}
+	return fmt.Sprintf("modbus: exception %d", byte(e))
+}
+
+// unit is a robot and its address space.
+type unit struct {
+	robot  *gateway.Robot
+	tables map[Table]map[uint16]*entry
+}
+
+// Server is a Modbus TCP server for robots.
+type Server struct {
+	// Timeout bounds the robot requests of one Modbus request, 5s if zero.
+	Timeout time.Duration
+
+	mu        sync.RWMutex
+	units     map[uint8]*unit
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	closed    bool
+}
+
+// NewServer creates a server without units. Add robots with AddRobot
+// before serving.
+func NewServer() *Server {
+	return &Server{
+		units:     make(map[uint8]*unit),
+		listeners: make(map[net.Listener]struct{}),
+		conns:     make(map[net.Conn]struct{}),
+	}
+}
+
+// AddRobot serves a robot as a unit.
+//
+// Parameters:
+// - unitID: The unit identifier of requests for the robot.
+// - robot: The robot, e.g. from a gateway or &gateway.Robot{ID: ..., Client: ...}.
+// - mappings: The variables and their addresses.
+//
+// Returns: An error if the unit is already added, a mapping is invalid or
+// two mappings overlap.
+func (s *Server) AddRobot(unitID uint8, robot *gateway.Robot, mappings []Mapping) error {
+	u := &unit{robot: robot, tables: make(map[Table]map[uint16]*entry)}
+	for _, m := range mappings {
+		e, err := newEntry(m)
+		if err != nil {
+			return err
+		}
+		table := u.tables[e.Table]
+		if table == nil {
+			table = make(map[uint16]*entry)
+			u.tables[e.Table] = table
+		}
+		for i := 0; i < e.size; i++ {
+			addr := e.Address + uint16(i)
+			if other, ok := table[addr]; ok {
+				return fmt.Errorf("%s: %s address %d is taken by %s", e.Var, e.Table, addr, other.Var)
+			}
+			table[addr] = e
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.units[unitID]; ok {
+		return fmt.Errorf("unit %d already added", unitID)
+	}
+	s.units[unitID] = u
+	return nil
+}
+
+// Serve accepts connections on l until the server is closed.
+//
+// Parameters:
+// - l: The listener, e.g. from net.Listen("tcp", ":502").
+//
+// Returns: The error of Accept, nil after Close.
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return errors.New("modbus: server closed")
+	}
+	s.listeners[l] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.listeners, l)
+		s.mu.Unlock()
+	}()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.mu.RLock()
+			closed := s.closed
+			s.mu.RUnlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+		go s.ServeConn(conn)
+	}
+}
+
+// ServeConn answers the requests of a single connection in order and
+// closes it when done.
+func (s *Server) ServeConn(conn net.Conn) {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		conn.Close()
+		return
+	}
+	s.conns[conn] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	for {
+		// The MBAP header: transaction ID, protocol ID 0, length of the
+		// unit ID and PDU, unit ID.
+		header := make([]byte, 7)
+		if _, err := io.ReadFull(conn, header); err != nil {
+			return
+		}
+		length := binary.BigEndian.Uint16(header[4:])
+		if binary.BigEndian.Uint16(header[2:]) != 0 || length < 2 || length > 254 {
+			return
+		}
+		pdu := make([]byte, length-1)
+		if _, err := io.ReadFull(conn, pdu); err != nil {
+			return
+		}
+
+		resp := s.Handle(header[6], pdu)
+		binary.BigEndian.PutUint16(header[4:], uint16(len(resp)+1))
+		if _, err := conn.Write(append(header, resp...)); err != nil {
+			return
+		}
+	}
+}
+
+// Handle answers the PDU of a request for a unit, e.g. for transports other
+// than TCP.
+//
+// Parameters:
+// - unitID: The unit identifier of the request.
+// - pdu: The function code and data of the request.
+//
+// Returns: The PDU of the response, an exception response if the request failed.
+func (s *Server) Handle(unitID uint8, pdu []byte) []byte {
+	if len(pdu) == 0 {
+		return []byte{0x80, byte(IllegalFunction)}
+	}
+	resp, err := s.handle(unitID, pdu)
+	if err != nil {
+		var ex Exception
+		if !errors.As(err, &ex) {
+			ex = ServerDeviceFailure
+		}
+		return []byte{pdu[0] | 0x80, byte(ex)}
+	}
+	return resp
+}
+
+// handle runs a request.
+func (s *Server) handle(unitID uint8, pdu []byte) ([]byte, error) {
+	s.mu.RLock()
+	u, ok := s.units[unitID]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, GatewayPathUnavailable
+	}
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	fc, data := pdu[0], pdu[1:]
+	switch fc {
+	case readCoils, readDiscreteInputs:
+		table := Coils
+		if fc == readDiscreteInputs {
+			table = DiscreteInputs
+		}
+		addr, quantity, err := addressQuantity(data, maxReadBits)
+		if err != nil {
+			return nil, err
+		}
+		bits, err := u.readBits(ctx, table, addr, quantity)
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte{fc, byte(len(bits))}, bits...), nil
+
+	case readHoldingRegisters, readInputRegisters:
+		table := HoldingRegisters
+		if fc == readInputRegisters {
+			table = InputRegisters
+		}
+		addr, quantity, err := addressQuantity(data, maxReadRegisters)
+		if err != nil {
+			return nil, err
+		}
+		regs, err := u.readRegisters(ctx, table, addr, quantity)
+		if err != nil {
+			return nil, err
+		}
+		resp := []byte{fc, byte(2 * len(regs))}
+		for _, r := range regs {
+			resp = binary.BigEndian.AppendUint16(resp, r)
+		}
+		return resp, nil
+
+	case writeSingleCoil:
+		if len(data) != 4 {
+			return nil, IllegalDataValue
+		}
+		var on bool
+		switch binary.BigEndian.Uint16(data[2:]) {
+		case 0xFF00:
+			on = true
+		case 0x0000:
+		default:
+			return nil, IllegalDataValue
+		}
+		if err := u.writeBits(ctx, binary.BigEndian.Uint16(data), []bool{on}); err != nil {
+			return nil, err
+		}
+		return pdu, nil
+
+	case writeSingleRegister:
+		if len(data) != 4 {
+			return nil, IllegalDataValue
+		}
+		if err := u.writeRegisters(ctx, binary.BigEndian.Uint16(data), []uint16{binary.BigEndian.Uint16(data[2:])}); err != nil {
+			return nil, err
+		}
+		return pdu, nil
+
+	case writeMultipleCoils:
+		addr, quantity, err := addressQuantity(data, maxWriteBits)
+		if err != nil {
+			return nil, err
+		}
+		if len(data) < 5 || int(data[4]) != (quantity+7)/8 || len(data) != 5+int(data[4]) {
+			return nil, IllegalDataValue
+		}
+		bits := make([]bool, quantity)
+		for i := range bits {
+			bits[i] = data[5+i/8]&(1<<(i%8)) != 0
+		}
+		if err := u.writeBits(ctx, addr, bits); err != nil {
+			return nil, err
+		}
+		return pdu[:5], nil
+
+	case writeMultipleRegisters:
+		addr, quantity, err := addressQuantity(data, maxWriteRegisters)
+		if err != nil {
+			return nil, err
+		}
+		if len(data) < 5 || int(data[4]) != 2*quantity || len(data) != 5+int(data[4]) {
+			return nil, IllegalDataValue
+		}
+		regs := make([]uint16, quantity)
+		for i := range regs {
+			regs[i] = binary.BigEndian.Uint16(data[5+2*i:])
+		}
+		if err := u.writeRegisters(ctx, addr, regs); err != nil {
+			return nil, err
+		}
+		return pdu[:5], nil
+	}
+	return nil, IllegalFunction
+}
+
+// addressQuantity decodes the starting address and quantity of a request.
+func addressQuantity(data []byte, limit int) (uint16, int, error) {
+	if len(data) < 4 {
+		return 0, 0, IllegalDataValue
+	}
+	addr := binary.BigEndian.Uint16(data)
+	quantity := int(binary.BigEndian.Uint16(data[2:]))
+	if quantity < 1 || quantity > limit {
+		return 0, 0, IllegalDataValue
+	}
+	if int(addr)+quantity > 1<<16 {
+		return 0, 0, IllegalDataAddress
+	}
+	return addr, quantity, nil
+}
+
+// entries returns the entries of consecutive addresses, each once in
+// address order, and fails if any address is not mapped.
+func (u *unit) entries(table Table, addr uint16, quantity int) ([]*entry, error) {
+	var entries []*entry
+	for i := 0; i < quantity; i++ {
+		e, ok := u.tables[table][addr+uint16(i)]
+		if !ok {
+			return nil, IllegalDataAddress
+		}
+		if len(entries) == 0 || entries[len(entries)-1] != e {
+			entries = append(entries, e)
+		}
+	}
+	return entries, nil
+}
+
+// readBits reads coils or discrete inputs, packed as in responses.
+func (u *unit) readBits(ctx context.Context, table Table, addr uint16, quantity int) ([]byte, error) {
+	entries, err := u.entries(table, addr, quantity)
+	if err != nil {
+		return nil, err
+	}
+	v := &values{ctx: ctx, robot: u.robot, cache: make(map[string]krl.Value)}
+	packed := make([]byte, (quantity+7)/8)
+	for _, e := range entries {
+		first, n := e.span(addr, quantity)
+		bits, err := e.bits(v, first, n)
+		if err != nil {
+			return nil, err
+		}
+		for i, bit := range bits {
+			if pos := int(e.Address) + first + i - int(addr); bit {
+				packed[pos/8] |= 1 << (pos % 8)
+			}
+		}
+	}
+	return packed, nil
+}
+
+// readRegisters reads holding or input registers.
+func (u *unit) readRegisters(ctx context.Context, table Table, addr uint16, quantity int) ([]uint16, error) {
+	entries, err := u.entries(table, addr, quantity)
+	if err != nil {
+		return nil, err
+	}
+	v := &values{ctx: ctx, robot: u.robot, cache: make(map[string]krl.Value)}
+	regs := make([]uint16, quantity)
+	for _, e := range entries {
+		first, n := e.span(addr, quantity)
+		entryRegs, err := e.registers(v, first, n)
+		if err != nil {
+			return nil, err
+		}
+		copy(regs[int(e.Address)+first-int(addr):], entryRegs)
+	}
+	return regs, nil
+}
+
+// writeBits writes coils. Only the addressed elements of BOOL arrays are written.
+func (u *unit) writeBits(ctx context.Context, addr uint16, bits []bool) error {
+	entries, err := u.entries(Coils, addr, len(bits))
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.readOnly {
+			return IllegalDataAddress
+		}
+	}
+	for i, bit := range bits {
+		e := u.tables[Coils][addr+uint16(i)]
+		name := e.element(int(addr) + i - int(e.Address))
+		if err := write(ctx, u.robot, name, boolLiteral(bit)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeRegisters writes holding registers. Numbers taking two registers
+// must be written whole, packed BOOL arrays are written per register.
+func (u *unit) writeRegisters(ctx context.Context, addr uint16, regs []uint16) error {
+	entries, err := u.entries(HoldingRegisters, addr, len(regs))
+	if err != nil {
+		return err
+	}
+	end := int(addr) + len(regs)
+	for _, e := range entries {
+		if e.readOnly {
+			return IllegalDataAddress
+		}
+		if e.Count == 0 && (e.Address < addr || int(e.Address)+e.size > end) {
+			return IllegalDataAddress
+		}
+	}
+
+	for _, e := range entries {
+		if e.Count == 0 {
+			literal, err := e.literal(regs[e.Address-addr:])
+			if err != nil {
+				return err
+			}
+			if err := write(ctx, u.robot, e.Var, literal); err != nil {
+				return err
+			}
+			continue
+		}
+		for i := 0; i < e.Count; i++ {
+			pos := int(e.Address) + i/16 - int(addr)
+			if pos < 0 || pos >= len(regs) {
+				continue
+			}
+			if err := write(ctx, u.robot, e.element(i), boolLiteral(regs[pos]&(1<<(i%16)) != 0)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Close closes the listeners and connections.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	for l := range s.listeners {
+		l.Close()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	return nil
+}
@@ -0,0 +1,274 @@
+// Package mqttbridge publishes robot variables to an MQTT broker and
+// writes the values published to their set topics.
+//
+// Topics, with the default prefix "robots":
+//
+//	robots/{id}/availability          "online" or "offline", retained, also the last will
+//	robots/{id}/vars/{name}           the value as JSON, retained, published on every change
+//	robots/{id}/vars/{name}/set       values published here are written to the robot
+//	robots/{id}/vars/{name}/set/result  the result of each write as JSON
+//
+// Values are published as gateway.Event, with the typed value parsed from
+// the KRL literal and the raw literal. A set payload is a JSON string,
+// number or boolean converted like the values of the HTTP gateway, or a bare
+// KRL literal such as {X 1.0, Y 2.0}.
+package mqttbridge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/selimserbes/go-openshowvar/pkg/gateway"
+	"github.com/selimserbes/go-openshowvar/pkg/openshowvar"
+)
+
+// Availability payloads.
+const (
+	Online  = "online"
+	Offline = "offline"
+)
+
+// Config configures a bridge.
+type Config struct {
+	// Vars are the variables published and accepting writes.
+	Vars []string
+	// Interval is the poll interval of the variables, 100ms if zero.
+	Interval time.Duration
+	// Prefix is the first level of all topics, "robots" if empty.
+	Prefix string
+	// QoS is the quality of service of all publications and subscriptions.
+	QoS byte
+	// Timeout bounds writes to the robot and MQTT operations, 5s if zero.
+	Timeout time.Duration
+}
+
+// Bridge connects one robot to an MQTT broker.
+type Bridge struct {
+	robot  *gateway.Robot
+	cfg    Config
+	client mqtt.Client
+	vars   map[string]bool
+
+	mu sync.Mutex
+	// online is the last published availability, started is set once it
+	// was published.
+	online  bool
+	started bool
+	// err is the first error of a write handler publishing its result.
+	err error
+}
+
+// New creates a bridge for a robot.
+//
+// Parameters:
+//   - robot: The robot, e.g. from a gateway or &gateway.Robot{ID: ..., Client: ...}.
+//   - opts: The MQTT client options with the broker. The bridge sets the last
+//     will, the connect handler and disables ordered message handling.
+//   - cfg: The bridged variables and topics.
+//
+// Returns: A new Bridge, started with Run.
+func New(robot *gateway.Robot, opts *mqtt.ClientOptions, cfg Config) *Bridge {
+	if cfg.Interval <= 0 {
+		cfg.Interval = 100 * time.Millisecond
+	}
+	if cfg.Prefix == "" {
+		cfg.Prefix = "robots"
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 5 * time.Second
+	}
+	b := &Bridge{robot: robot, cfg: cfg, vars: make(map[string]bool)}
+	for _, name := range cfg.Vars {
+		b.vars[name] = true
+	}
+
+	opts.SetWill(b.topic("availability"), Offline, cfg.QoS, true)
+	opts.SetOrderMatters(false)
+	opts.SetOnConnectHandler(b.onConnect)
+	b.client = mqtt.NewClient(opts)
+	return b
+}
+
+// Run connects to the broker and the robot and bridges the variables until
+// ctx is done. Connection failures of the robot are retried every second
+// and reported through the availability topic.
+//
+// Returns: nil when ctx is done, or an error if the broker cannot be reached.
+func (b *Bridge) Run(ctx context.Context) error {
+	token := b.client.Connect()
+	if !token.WaitTimeout(b.cfg.Timeout) {
+		return errors.New("mqtt connect: timeout")
+	}
+	if err := token.Error(); err != nil {
+		return fmt.Errorf("mqtt connect: %v", err)
+	}
+	defer func() {
+		// A clean disconnect does not send the last will.
+		b.setOnline(false)
+		b.client.Disconnect(250)
+	}()
+
+	connectCtx, cancel := context.WithTimeout(ctx, b.cfg.Timeout)
+	err := b.robot.Connect(connectCtx)
+	cancel()
+	b.setOnline(err == nil)
+
+	// Merge the changes of all variables into one channel.
+	changes := make(chan openshowvar.Change)
+	for name := range b.vars {
+		go func(sub <-chan openshowvar.Change) {
+			for change := range sub {
+				select {
+				case changes <- change:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}(b.robot.Subscribe(ctx, name, b.cfg.Interval))
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case change := <-changes:
+			if change.Err != nil && !errors.Is(change.Err, openshowvar.ErrVariableNotFound) {
+				// Keep the last value retained, the availability tells
+				// subscribers it is stale.
+				b.setOnline(false)
+				continue
+			}
+			b.setOnline(true)
+			event := gateway.Event{Robot: b.robot.ID, Var: gateway.NewVar(change.VarName, change.Value), Previous: change.Previous, Time: change.Time}
+			if change.Err != nil {
+				event.Var = gateway.Var{Name: change.VarName, Error: change.Err.Error()}
+			}
+			b.publish(b.topic("vars", change.VarName), true, event)
+		}
+	}
+}
+
+// Err returns the first error publishing a message, nil if there is none.
+func (b *Bridge) Err() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.err
+}
+
+// handleSet writes the payload of a set topic to the robot and publishes
+// the result.
+func (b *Bridge) handleSet(client mqtt.Client, msg mqtt.Message) {
+	name := strings.TrimSuffix(strings.TrimPrefix(msg.Topic(), b.topic("vars")+"/"), "/set")
+	result := gateway.Event{Robot: b.robot.ID, Var: gateway.Var{Name: name}, Time: time.Now()}
+
+	value, err := literal(msg.Payload())
+	if err == nil && !b.vars[name] {
+		err = fmt.Errorf("variable %s is not bridged", name)
+	}
+	if err == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), b.cfg.Timeout)
+		value, err = b.robot.Do(ctx, func(ctx context.Context, osv *openshowvar.OpenShowVar) (string, error) {
+			return osv.WriteContext(ctx, name, value)
+		})
+		cancel()
+	}
+	if err != nil {
+		result.Error = err.Error()
+	} else {
+		result.Var = gateway.NewVar(name, value)
+	}
+	b.publish(b.topic("vars", name, "set", "result"), false, result)
+}
+
+// onConnect subscribes to the set topics and, after a reconnect, publishes
+// the availability again. Both are lost with the session.
+func (b *Bridge) onConnect(client mqtt.Client) {
+	client.Subscribe(b.topic("vars", "+", "set"), b.cfg.QoS, b.handleSet)
+	b.mu.Lock()
+	var token mqtt.Token
+	if b.started {
+		token = b.publishAvailability()
+	}
+	b.mu.Unlock()
+	if token != nil {
+		b.wait(token)
+	}
+}
+
+// setOnline publishes the availability if it changed.
+func (b *Bridge) setOnline(online bool) {
+	b.mu.Lock()
+	var token mqtt.Token
+	if b.online != online || !b.started {
+		b.online, b.started = online, true
+		token = b.publishAvailability()
+	}
+	b.mu.Unlock()
+	if token != nil {
+		b.wait(token)
+	}
+}
+
+// publishAvailability publishes the retained availability. b.mu must be
+// held, so availability messages are sent in the order of the changes.
+func (b *Bridge) publishAvailability() mqtt.Token {
+	payload := Offline
+	if b.online {
+		payload = Online
+	}
+	return b.client.Publish(b.topic("availability"), b.cfg.QoS, true, payload)
+}
+
+// publish publishes v as JSON.
+func (b *Bridge) publish(topic string, retained bool, v any) {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		b.fail(err)
+		return
+	}
+	b.wait(b.client.Publish(topic, b.cfg.QoS, retained, payload))
+}
+
+// wait waits for a publication, recording its error.
+func (b *Bridge) wait(token mqtt.Token) {
+	if !token.WaitTimeout(b.cfg.Timeout) {
+		b.fail(errors.New("mqtt publish: timeout"))
+		return
+	}
+	if err := token.Error(); err != nil {
+		b.fail(fmt.Errorf("mqtt publish: %v", err))
+	}
+}
+
+// fail records the first error.
+func (b *Bridge) fail(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.err == nil {
+		b.err = err
+	}
+}
+
+// topic joins levels below the robot's topic.
+func (b *Bridge) topic(levels ...string) string {
+	return strings.Join(append([]string{b.cfg.Prefix, b.robot.ID}, levels...), "/")
+}
+
+// literal converts a set payload to a KRL literal with gateway.Literal.
+// Payloads that are not JSON are taken as literals.
+func literal(payload []byte) (string, error) {
+	text := strings.TrimSpace(string(payload))
+	if text == "" {
+		return "", errors.New("empty value")
+	}
+	if !json.Valid([]byte(text)) {
+		return text, nil
+	}
+	return gateway.Literal([]byte(text))
+}
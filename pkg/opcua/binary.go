@@ -0,0 +1,339 @@
+package opcua
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"time"
+)
+
+// encodable is implemented by types with their own binary encoding.
+type encodable interface {
+	encode(e *encoder)
+}
+
+// decodable is implemented by pointers to types with their own binary encoding.
+type decodable interface {
+	decode(d *decoder)
+}
+
+// encoder appends values in the OPC UA binary encoding: little endian
+// numbers, length prefixed strings and arrays, and structures as their
+// fields in order.
+type encoder struct {
+	b   []byte
+	err error
+}
+
+func (e *encoder) uint8(v uint8)     { e.b = append(e.b, v) }
+func (e *encoder) uint16(v uint16)   { e.b = binary.LittleEndian.AppendUint16(e.b, v) }
+func (e *encoder) uint32(v uint32)   { e.b = binary.LittleEndian.AppendUint32(e.b, v) }
+func (e *encoder) uint64(v uint64)   { e.b = binary.LittleEndian.AppendUint64(e.b, v) }
+func (e *encoder) int32(v int32)     { e.uint32(uint32(v)) }
+func (e *encoder) float32(v float32) { e.uint32(math.Float32bits(v)) }
+func (e *encoder) float64(v float64) { e.uint64(math.Float64bits(v)) }
+
+func (e *encoder) boolean(v bool) {
+	if v {
+		e.uint8(1)
+	} else {
+		e.uint8(0)
+	}
+}
+
+// string encodes a String, the empty string as null.
+func (e *encoder) string(s string) {
+	if s == "" {
+		e.int32(-1)
+		return
+	}
+	e.int32(int32(len(s)))
+	e.b = append(e.b, s...)
+}
+
+// byteString encodes a ByteString, nil as null.
+func (e *encoder) byteString(b []byte) {
+	if b == nil {
+		e.int32(-1)
+		return
+	}
+	e.int32(int32(len(b)))
+	e.b = append(e.b, b...)
+}
+
+// dateTime encodes a DateTime as 100ns intervals since 1601, the zero time as 0.
+func (e *encoder) dateTime(t time.Time) {
+	if t.IsZero() {
+		e.uint64(0)
+		return
+	}
+	e.uint64(uint64(t.UnixNano()/100 + epochOffset))
+}
+
+// epochOffset is the number of 100ns intervals between 1601 and 1970.
+const epochOffset = 116444736000000000
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// value encodes v by reflection. Structures are encoded field by field,
+// slices as arrays and []byte as ByteString.
+func (e *encoder) value(v reflect.Value) {
+	if e.err != nil {
+		return
+	}
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			e.err = fmt.Errorf("cannot encode nil %s", v.Type())
+			return
+		}
+		v = v.Elem()
+	}
+	if c, ok := v.Interface().(encodable); ok {
+		c.encode(e)
+		return
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		e.boolean(v.Bool())
+	case reflect.Int8:
+		e.uint8(uint8(v.Int()))
+	case reflect.Uint8:
+		e.uint8(uint8(v.Uint()))
+	case reflect.Int16:
+		e.uint16(uint16(v.Int()))
+	case reflect.Uint16:
+		e.uint16(uint16(v.Uint()))
+	case reflect.Int32:
+		e.int32(int32(v.Int()))
+	case reflect.Uint32:
+		e.uint32(uint32(v.Uint()))
+	case reflect.Int64:
+		e.uint64(uint64(v.Int()))
+	case reflect.Uint64:
+		e.uint64(v.Uint())
+	case reflect.Float32:
+		e.float32(float32(v.Float()))
+	case reflect.Float64:
+		e.float64(v.Float())
+	case reflect.String:
+		e.string(v.String())
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			e.byteString(v.Bytes())
+			return
+		}
+		if v.IsNil() {
+			e.int32(-1)
+			return
+		}
+		e.int32(int32(v.Len()))
+		for i := 0; i < v.Len(); i++ {
+			e.value(v.Index(i))
+		}
+	case reflect.Struct:
+		if v.Type() == timeType {
+			e.dateTime(v.Interface().(time.Time))
+			return
+		}
+		for i := 0; i < v.NumField(); i++ {
+			e.value(v.Field(i))
+		}
+	default:
+		e.err = fmt.Errorf("cannot encode %s", v.Type())
+	}
+}
+
+// encode returns the binary encoding of v.
+func encode(v any) ([]byte, error) {
+	e := &encoder{}
+	e.value(reflect.ValueOf(v))
+	return e.b, e.err
+}
+
+// errShortBuffer reports a truncated message.
+var errShortBuffer = errors.New("opcua: unexpected end of message")
+
+// decoder reads values in the OPC UA binary encoding. The first error is
+// kept and all following reads return zero values.
+type decoder struct {
+	b   []byte
+	err error
+}
+
+// next returns the next n bytes.
+func (d *decoder) next(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(d.b) {
+		d.err = errShortBuffer
+		return nil
+	}
+	b := d.b[:n]
+	d.b = d.b[n:]
+	return b
+}
+
+func (d *decoder) uint8() uint8 {
+	if b := d.next(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (d *decoder) uint16() uint16 {
+	if b := d.next(2); b != nil {
+		return binary.LittleEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (d *decoder) uint32() uint32 {
+	if b := d.next(4); b != nil {
+		return binary.LittleEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (d *decoder) uint64() uint64 {
+	if b := d.next(8); b != nil {
+		return binary.LittleEndian.Uint64(b)
+	}
+	return 0
+}
+
+func (d *decoder) int32() int32     { return int32(d.uint32()) }
+func (d *decoder) float32() float32 { return math.Float32frombits(d.uint32()) }
+func (d *decoder) float64() float64 { return math.Float64frombits(d.uint64()) }
+func (d *decoder) boolean() bool    { return d.uint8() != 0 }
+
+// length reads the length of a String, ByteString or array, -1 for null.
+// Lengths larger than the rest of the message are rejected before anything
+// is allocated.
+func (d *decoder) length() int {
+	n := d.int32()
+	if n < -1 || int(n) > len(d.b) {
+		if d.err == nil {
+			d.err = fmt.Errorf("opcua: invalid length %d", n)
+		}
+		return -1
+	}
+	return int(n)
+}
+
+// maxArrayLength bounds the length of decoded arrays, so a message cannot
+// make the decoder allocate far more than its own size.
+const maxArrayLength = 65535
+
+// arrayLength reads the length of an array, -1 for null. Lengths above
+// maxArrayLength are rejected like lengths larger than the rest of the
+// message.
+func (d *decoder) arrayLength() int {
+	n := d.length()
+	if n > maxArrayLength {
+		d.err = fmt.Errorf("opcua: array length %d exceeds %d", n, maxArrayLength)
+		return -1
+	}
+	return n
+}
+
+func (d *decoder) string() string {
+	n := d.length()
+	if n <= 0 {
+		return ""
+	}
+	return string(d.next(n))
+}
+
+func (d *decoder) byteString() []byte {
+	n := d.length()
+	if n < 0 {
+		return nil
+	}
+	return append([]byte{}, d.next(n)...)
+}
+
+func (d *decoder) dateTime() time.Time {
+	ticks := int64(d.uint64())
+	if ticks <= 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, (ticks-epochOffset)*100).UTC()
+}
+
+// value decodes into the addressable v by reflection, the counterpart of encoder.value.
+func (d *decoder) value(v reflect.Value) {
+	if d.err != nil {
+		return
+	}
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	if c, ok := v.Addr().Interface().(decodable); ok {
+		c.decode(d)
+		return
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		v.SetBool(d.boolean())
+	case reflect.Int8:
+		v.SetInt(int64(int8(d.uint8())))
+	case reflect.Uint8:
+		v.SetUint(uint64(d.uint8()))
+	case reflect.Int16:
+		v.SetInt(int64(int16(d.uint16())))
+	case reflect.Uint16:
+		v.SetUint(uint64(d.uint16()))
+	case reflect.Int32:
+		v.SetInt(int64(d.int32()))
+	case reflect.Uint32:
+		v.SetUint(uint64(d.uint32()))
+	case reflect.Int64:
+		v.SetInt(int64(d.uint64()))
+	case reflect.Uint64:
+		v.SetUint(d.uint64())
+	case reflect.Float32:
+		v.SetFloat(float64(d.float32()))
+	case reflect.Float64:
+		v.SetFloat(d.float64())
+	case reflect.String:
+		v.SetString(d.string())
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			v.SetBytes(d.byteString())
+			return
+		}
+		n := d.arrayLength()
+		if n < 0 {
+			v.Set(reflect.Zero(v.Type()))
+			return
+		}
+		s := reflect.MakeSlice(v.Type(), n, n)
+		for i := 0; i < n && d.err == nil; i++ {
+			d.value(s.Index(i))
+		}
+		v.Set(s)
+	case reflect.Struct:
+		if v.Type() == timeType {
+			v.Set(reflect.ValueOf(d.dateTime()))
+			return
+		}
+		for i := 0; i < v.NumField(); i++ {
+			d.value(v.Field(i))
+		}
+	default:
+		d.err = fmt.Errorf("cannot decode %s", v.Type())
+	}
+}
+
+// decode decodes b into the value v points to.
+func decode(b []byte, v any) error {
+	d := &decoder{b: b}
+	d.value(reflect.ValueOf(v))
+	return d.err
+}
@@ -0,0 +1,515 @@
+package opcua
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// ErrClientClosed is returned by requests of a closed client.
+var ErrClientClosed = errors.New("opcua: client closed")
+
+// changesBuffer is the capacity of the channel of a Subscription.
+const changesBuffer = 16
+
+// Client is a minimal OPC UA client for servers with the security policy
+// None, e.g. to test the server or to script reads and writes.
+type Client struct {
+	conn *uaConn
+
+	mu         sync.Mutex
+	pending    map[uint32]chan any
+	lastID     uint32
+	token      NodeID
+	subs       map[uint32]*Subscription
+	publishing bool
+	err        error
+	done       chan struct{}
+}
+
+// DataChange is a new value of a node monitored by a Subscription.
+type DataChange struct {
+	NodeID NodeID
+	Value  DataValue
+}
+
+// Subscription delivers value changes of monitored nodes.
+type Subscription struct {
+	ID      uint32
+	c       *Client
+	nodes   map[uint32]NodeID
+	changes chan DataChange
+}
+
+// Dial connects to a server, opens a secure channel without security and
+// activates an anonymous session.
+//
+// Parameters:
+// - ctx: Bounds the connection setup.
+// - endpoint: The endpoint URL, e.g. opc.tcp://localhost:4840.
+//
+// Returns: The client, or an error if the connection or session fails.
+func Dial(ctx context.Context, endpoint string) (*Client, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("opcua: invalid endpoint: %v", err)
+	}
+	if u.Scheme != "opc.tcp" {
+		return nil, fmt.Errorf("opcua: unsupported scheme %q", u.Scheme)
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", u.Host)
+	if err != nil {
+		return nil, err
+	}
+	c := &Client{
+		conn:    newUAConn(conn),
+		pending: make(map[uint32]chan any),
+		subs:    make(map[uint32]*Subscription),
+		done:    make(chan struct{}),
+	}
+	if err := c.hello(ctx, endpoint); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	go c.readLoop()
+
+	if err := c.open(ctx, endpoint); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// hello sends the HEL message and reads the ACK.
+func (c *Client) hello(ctx context.Context, endpoint string) error {
+	if deadline, ok := ctx.Deadline(); ok {
+		c.conn.conn.SetDeadline(deadline)
+		defer c.conn.conn.SetDeadline(time.Time{})
+	}
+	err := c.conn.writeRaw("HEL", &hello{
+		ReceiveBufferSize: bufferSize,
+		SendBufferSize:    bufferSize,
+		MaxMessageSize:    maxMessageSize,
+		EndpointURL:       endpoint,
+	})
+	if err != nil {
+		return err
+	}
+	typ, _, body, err := c.conn.readChunk()
+	if err != nil {
+		return err
+	}
+	switch typ {
+	case "ACK":
+		var ack acknowledge
+		if err := decode(body, &ack); err != nil {
+			return err
+		}
+		c.conn.chunkSize = min(ack.ReceiveBufferSize, bufferSize)
+		return nil
+	case "ERR":
+		var e transportError
+		if err := decode(body, &e); err != nil {
+			return err
+		}
+		return fmt.Errorf("%v: %s", e.Error, e.Reason)
+	}
+	return BadTCPMessageTypeInvalid
+}
+
+// open opens the secure channel and the session.
+func (c *Client) open(ctx context.Context, endpoint string) error {
+	resp, err := c.call(ctx, "OPN", &OpenSecureChannelRequest{
+		SecurityMode:      securityModeNone,
+		RequestedLifetime: uint32(channelLifetime / time.Millisecond),
+	})
+	if err != nil {
+		return err
+	}
+	token := resp.(*OpenSecureChannelResponse).SecurityToken
+	c.conn.wmu.Lock()
+	c.conn.channelID, c.conn.tokenID = token.ChannelID, token.TokenID
+	c.conn.wmu.Unlock()
+
+	resp, err = c.call(ctx, "MSG", &CreateSessionRequest{
+		ClientDescription:       ApplicationDescription{ApplicationURI: productURI + ":client", ApplicationType: 1},
+		EndpointURL:             endpoint,
+		SessionName:             "go-openshowvar",
+		RequestedSessionTimeout: float64(defaultSessionTimeout / time.Millisecond),
+		MaxResponseMessageSize:  maxMessageSize,
+	})
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.token = resp.(*CreateSessionResponse).AuthenticationToken
+	c.mu.Unlock()
+
+	_, err = c.call(ctx, "MSG", &ActivateSessionRequest{
+		UserIdentityToken: NewExtensionObject(&AnonymousIdentityToken{PolicyID: anonymousPolicyID}),
+	})
+	return err
+}
+
+// readLoop delivers responses to the pending requests until the connection fails.
+func (c *Client) readLoop() {
+	for {
+		msg, err := c.conn.readMessage()
+		if err != nil {
+			c.fail(err)
+			return
+		}
+		var resp any
+		v, typeID, err := decodeMessage(msg.body)
+		switch {
+		case err != nil:
+			resp = err
+		case v == nil:
+			resp = fmt.Errorf("opcua: unknown response type %v", typeID)
+		default:
+			resp = v
+		}
+		c.mu.Lock()
+		ch, ok := c.pending[msg.requestID]
+		delete(c.pending, msg.requestID)
+		c.mu.Unlock()
+		if ok {
+			ch <- resp
+		}
+	}
+}
+
+// fail closes the client after the connection failed.
+func (c *Client) fail(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return
+	}
+	c.err = err
+	close(c.done)
+	for id, sub := range c.subs {
+		close(sub.changes)
+		delete(c.subs, id)
+	}
+}
+
+// call sends a request and waits for its response. ServiceFaults and bad
+// service results are returned as StatusCode errors.
+func (c *Client) call(ctx context.Context, typ string, req request) (response, error) {
+	ch := make(chan any, 1)
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return nil, ErrClientClosed
+	}
+	c.lastID++
+	id := c.lastID
+	c.pending[id] = ch
+	h := req.requestHeader()
+	h.AuthenticationToken = c.token
+	c.mu.Unlock()
+
+	h.Timestamp = time.Now()
+	h.RequestHandle = id
+	if deadline, ok := ctx.Deadline(); ok {
+		h.TimeoutHint = uint32(max(time.Until(deadline), 0) / time.Millisecond)
+	}
+	body, err := encodeMessage(req)
+	if err == nil {
+		err = c.conn.writeMessage(typ, id, body)
+	}
+	if err != nil {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+		return nil, err
+	}
+
+	select {
+	case <-ctx.Done():
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+		return nil, ctx.Err()
+	case <-c.done:
+		return nil, ErrClientClosed
+	case v := <-ch:
+		if err, ok := v.(error); ok {
+			return nil, err
+		}
+		resp, ok := v.(response)
+		if !ok {
+			return nil, fmt.Errorf("opcua: unexpected response %T", v)
+		}
+		if code := resp.responseHeader().ServiceResult; code.IsBad() {
+			return nil, code
+		}
+		return resp, nil
+	}
+}
+
+// Read reads the values of nodes.
+//
+// Parameters:
+// - ctx: Bounds the request.
+// - ids: The nodes to read.
+//
+// Returns: The values in the order of ids, with a bad Status for nodes
+// that could not be read, or an error if the request failed.
+func (c *Client) Read(ctx context.Context, ids ...NodeID) ([]DataValue, error) {
+	nodes := make([]ReadValueID, len(ids))
+	for i, id := range ids {
+		nodes[i] = ReadValueID{NodeID: id, AttributeID: AttributeValue}
+	}
+	resp, err := c.call(ctx, "MSG", &ReadRequest{TimestampsToReturn: timestampsBoth, NodesToRead: nodes})
+	if err != nil {
+		return nil, err
+	}
+	return resp.(*ReadResponse).Results, nil
+}
+
+// ReadAttribute reads an attribute of a node.
+//
+// Returns: The value of the attribute, or an error if the request failed or
+// the status of the value is bad.
+func (c *Client) ReadAttribute(ctx context.Context, id NodeID, attr AttributeID) (Variant, error) {
+	resp, err := c.call(ctx, "MSG", &ReadRequest{
+		TimestampsToReturn: timestampsNeither,
+		NodesToRead:        []ReadValueID{{NodeID: id, AttributeID: attr}},
+	})
+	if err != nil {
+		return Variant{}, err
+	}
+	results := resp.(*ReadResponse).Results
+	if len(results) != 1 {
+		return Variant{}, BadUnexpectedError
+	}
+	if results[0].Status.IsBad() {
+		return Variant{}, results[0].Status
+	}
+	return results[0].Value, nil
+}
+
+// Write writes the value of a node.
+//
+// Parameters:
+// - ctx: Bounds the request.
+// - id: The node to write.
+// - value: The value with the Go type of the data type of the node, e.g.
+// int32 for Int32 or float32 for Float.
+//
+// Returns: An error if the request failed or the write was rejected.
+func (c *Client) Write(ctx context.Context, id NodeID, value any) error {
+	resp, err := c.call(ctx, "MSG", &WriteRequest{
+		NodesToWrite: []WriteValue{{NodeID: id, AttributeID: AttributeValue, Value: DataValue{Value: Variant{value}}}},
+	})
+	if err != nil {
+		return err
+	}
+	results := resp.(*WriteResponse).Results
+	if len(results) != 1 {
+		return BadUnexpectedError
+	}
+	if results[0].IsBad() {
+		return results[0]
+	}
+	return nil
+}
+
+// Browse returns the forward hierarchical references of a node, e.g. the
+// robots in the Objects folder or the variables of a robot.
+func (c *Client) Browse(ctx context.Context, id NodeID) ([]ReferenceDescription, error) {
+	resp, err := c.call(ctx, "MSG", &BrowseRequest{
+		NodesToBrowse: []BrowseDescription{{
+			NodeID:          id,
+			ReferenceTypeID: NewNumericNodeID(0, idHierarchicalReferences),
+			IncludeSubtypes: true,
+			// All fields of ReferenceDescription.
+			ResultMask: 0x3f,
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	results := resp.(*BrowseResponse).Results
+	if len(results) != 1 {
+		return nil, BadUnexpectedError
+	}
+	if results[0].StatusCode.IsBad() {
+		return nil, results[0].StatusCode
+	}
+	return results[0].References, nil
+}
+
+// Subscribe creates a subscription that monitors the values of nodes.
+//
+// The current value of each node is delivered first, then each change. If
+// the reader falls behind, changes are dropped.
+//
+// Parameters:
+// - ctx: Bounds the requests creating the subscription.
+// - interval: The publishing and sampling interval.
+// - ids: The nodes to monitor.
+//
+// Returns: The subscription, or an error if it or a monitored item could not
+// be created.
+func (c *Client) Subscribe(ctx context.Context, interval time.Duration, ids ...NodeID) (*Subscription, error) {
+	resp, err := c.call(ctx, "MSG", &CreateSubscriptionRequest{
+		RequestedPublishingInterval: float64(interval / time.Millisecond),
+		RequestedLifetimeCount:      60,
+		RequestedMaxKeepAliveCount:  10,
+		PublishingEnabled:           true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	sub := &Subscription{
+		ID:      resp.(*CreateSubscriptionResponse).SubscriptionID,
+		c:       c,
+		nodes:   make(map[uint32]NodeID),
+		changes: make(chan DataChange, changesBuffer),
+	}
+	items := make([]MonitoredItemCreateRequest, len(ids))
+	for i, id := range ids {
+		sub.nodes[uint32(i+1)] = id
+		items[i] = MonitoredItemCreateRequest{
+			ItemToMonitor:  ReadValueID{NodeID: id, AttributeID: AttributeValue},
+			MonitoringMode: monitoringReporting,
+			RequestedParameters: MonitoringParameters{
+				ClientHandle:     uint32(i + 1),
+				SamplingInterval: float64(interval / time.Millisecond),
+				QueueSize:        1,
+				DiscardOldest:    true,
+			},
+		}
+	}
+	resp, err = c.call(ctx, "MSG", &CreateMonitoredItemsRequest{
+		SubscriptionID:     sub.ID,
+		TimestampsToReturn: timestampsBoth,
+		ItemsToCreate:      items,
+	})
+	if err == nil {
+		for i, result := range resp.(*CreateMonitoredItemsResponse).Results {
+			if result.StatusCode.IsBad() {
+				err = fmt.Errorf("%v: %v", ids[i], result.StatusCode)
+				break
+			}
+		}
+	}
+	if err != nil {
+		c.call(ctx, "MSG", &DeleteSubscriptionsRequest{SubscriptionIDs: []uint32{sub.ID}})
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return nil, ErrClientClosed
+	}
+	c.subs[sub.ID] = sub
+	if !c.publishing {
+		c.publishing = true
+		go c.publishLoop()
+	}
+	return sub, nil
+}
+
+// publishLoop sends Publish requests and delivers the notifications while
+// the client has subscriptions.
+func (c *Client) publishLoop() {
+	var acks []SubscriptionAcknowledgement
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		resp, err := c.call(ctx, "MSG", &PublishRequest{SubscriptionAcknowledgements: acks})
+		cancel()
+		acks = nil
+
+		c.mu.Lock()
+		if err != nil || len(c.subs) == 0 {
+			// Publish fails with BadNoSubscription once the last
+			// subscription is deleted, and a new one restarts the loop.
+			c.publishing = false
+			c.mu.Unlock()
+			return
+		}
+		pr := resp.(*PublishResponse)
+		msg := pr.NotificationMessage
+		sub, ok := c.subs[pr.SubscriptionID]
+		if len(msg.NotificationData) > 0 {
+			acks = append(acks, SubscriptionAcknowledgement{SubscriptionID: pr.SubscriptionID, SequenceNumber: msg.SequenceNumber})
+		}
+		for _, data := range msg.NotificationData {
+			notification, isDataChange := data.Value.(*DataChangeNotification)
+			if !ok || !isDataChange {
+				continue
+			}
+			for _, item := range notification.MonitoredItems {
+				id, known := sub.nodes[item.ClientHandle]
+				if known {
+					sub.deliver(DataChange{NodeID: id, Value: item.Value})
+				}
+			}
+		}
+		c.mu.Unlock()
+	}
+}
+
+// deliver sends a change, dropping the oldest one if the reader falls
+// behind. c.mu must be held.
+func (s *Subscription) deliver(change DataChange) {
+	for {
+		select {
+		case s.changes <- change:
+			return
+		default:
+		}
+		select {
+		case <-s.changes:
+		default:
+		}
+	}
+}
+
+// Changes returns the channel of value changes. It is closed when the
+// subscription or the client is closed.
+func (s *Subscription) Changes() <-chan DataChange {
+	return s.changes
+}
+
+// Close deletes the subscription.
+func (s *Subscription) Close(ctx context.Context) error {
+	s.c.mu.Lock()
+	if _, ok := s.c.subs[s.ID]; !ok {
+		s.c.mu.Unlock()
+		return nil
+	}
+	delete(s.c.subs, s.ID)
+	close(s.changes)
+	s.c.mu.Unlock()
+
+	_, err := s.c.call(ctx, "MSG", &DeleteSubscriptionsRequest{SubscriptionIDs: []uint32{s.ID}})
+	return err
+}
+
+// Close closes the session and the connection.
+func (c *Client) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	c.mu.Lock()
+	open := c.err == nil && !c.token.IsNull()
+	c.mu.Unlock()
+	if open {
+		c.call(ctx, "MSG", &CloseSessionRequest{DeleteSubscriptions: true})
+		if body, err := encodeMessage(&CloseSecureChannelRequest{}); err == nil {
+			c.conn.writeMessage("CLO", 0, body)
+		}
+	}
+	c.fail(ErrClientClosed)
+	return c.conn.Close()
+}
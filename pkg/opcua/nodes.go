@@ -0,0 +1,361 @@
+package opcua
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/selimserbes/go-openshowvar/pkg/gateway"
+	"github.com/selimserbes/go-openshowvar/pkg/krl"
+	"github.com/selimserbes/go-openshowvar/pkg/openshowvar"
+	"github.com/selimserbes/go-openshowvar/pkg/snapshot"
+)
+
+// NamespaceURI is the URI of namespace 1, which holds the robot nodes.
+const NamespaceURI = "urn:go-openshowvar:robots"
+
+// Variable is a KRL variable exposed by the server.
+type Variable struct {
+	Name string `json:"name"`
+	// Writable allows clients to write the variable. Variables of
+	// snapshot.ReadOnlyVars are never writable.
+	Writable bool `json:"writable,omitempty"`
+}
+
+// reference is a reference between two nodes.
+type reference struct {
+	typeID  NodeID
+	forward bool
+	target  NodeID
+}
+
+// node is a node of the address space.
+type node struct {
+	id          NodeID
+	class       NodeClass
+	browseName  QualifiedName
+	displayName string
+	typeDef     NodeID
+	refs        []reference
+
+	// Attributes of variables.
+	dataType  NodeID
+	valueRank int32
+	access    uint8
+	// value returns the value of server nodes.
+	value func() Variant
+
+	// robot is set for robot variables: the value is the member at path of
+	// the KRL variable varName, whose kind is the kind of the member.
+	robot   *gateway.Robot
+	varName string
+	path    []string
+	kind    krl.Kind
+}
+
+// RobotNodeID returns the NodeID of a robot variable or STRUC member, e.g.
+// RobotNodeID("cell1", "$POS_ACT", "X") for ns=1;s=cell1/$POS_ACT.X.
+func RobotNodeID(robot, name string, members ...string) NodeID {
+	return NewStringNodeID(1, robot+"/"+strings.Join(append([]string{name}, members...), "."))
+}
+
+// addNode adds n to the address space. s.mu must be held.
+func (s *Server) addNode(n *node) {
+	s.nodes[n.id] = n
+}
+
+// addReference adds a reference and its inverse. s.mu must be held.
+func (s *Server) addReference(source NodeID, typeID uint32, target NodeID) {
+	refType := NewNumericNodeID(0, typeID)
+	s.nodes[source].refs = append(s.nodes[source].refs, reference{typeID: refType, forward: true, target: target})
+	s.nodes[target].refs = append(s.nodes[target].refs, reference{typeID: refType, target: source})
+}
+
+// addStandardNodes adds the folders and the Server object of namespace 0.
+func (s *Server) addStandardNodes() {
+	folder := func(id uint32, name string) {
+		s.addNode(&node{id: NewNumericNodeID(0, id), class: NodeClassObject, browseName: QualifiedName{Name: name}, displayName: name, typeDef: NewNumericNodeID(0, idFolderType)})
+	}
+	folder(idRootFolder, "Root")
+	folder(idObjectsFolder, "Objects")
+	folder(idTypesFolder, "Types")
+	folder(idViewsFolder, "Views")
+	root := NewNumericNodeID(0, idRootFolder)
+	objects := NewNumericNodeID(0, idObjectsFolder)
+	s.addReference(root, idOrganizes, objects)
+	s.addReference(root, idOrganizes, NewNumericNodeID(0, idTypesFolder))
+	s.addReference(root, idOrganizes, NewNumericNodeID(0, idViewsFolder))
+
+	server := NewNumericNodeID(0, idServer)
+	s.addNode(&node{id: server, class: NodeClassObject, browseName: QualifiedName{Name: "Server"}, displayName: "Server", typeDef: NewNumericNodeID(0, idServerType)})
+	s.addReference(objects, idOrganizes, server)
+
+	variable := func(parent NodeID, refType, id uint32, name string, dataType uint32, valueRank int32, typeDef uint32, value func() Variant) {
+		s.addNode(&node{
+			id:          NewNumericNodeID(0, id),
+			class:       NodeClassVariable,
+			browseName:  QualifiedName{Name: name},
+			displayName: name,
+			typeDef:     NewNumericNodeID(0, typeDef),
+			dataType:    NewNumericNodeID(0, dataType),
+			valueRank:   valueRank,
+			access:      AccessLevelRead,
+			value:       value,
+		})
+		s.addReference(parent, refType, NewNumericNodeID(0, id))
+	}
+	variable(server, idHasProperty, idServerArray, "ServerArray", typeString, 1, idPropertyType, func() Variant {
+		return Variant{[]string{s.applicationURI()}}
+	})
+	variable(server, idHasProperty, idNamespaceArray, "NamespaceArray", typeString, 1, idPropertyType, func() Variant {
+		return Variant{[]string{"http://opcfoundation.org/UA/", NamespaceURI}}
+	})
+	variable(server, idHasComponent, idServerStatus, "ServerStatus", idServerStatusDataType, -1, idServerStatusType, func() Variant {
+		return Variant{NewExtensionObject(&ServerStatusDataType{
+			StartTime:   s.start,
+			CurrentTime: time.Now(),
+			BuildInfo:   BuildInfo{ProductURI: productURI, ManufacturerName: "go-openshowvar", ProductName: "go-openshowvar OPC UA server"},
+		})}
+	})
+	status := NewNumericNodeID(0, idServerStatus)
+	variable(status, idHasComponent, idServerStatusStartTime, "StartTime", typeDateTime, -1, idBaseDataVariableType, func() Variant { return Variant{s.start} })
+	variable(status, idHasComponent, idServerStatusTime, "CurrentTime", typeDateTime, -1, idBaseDataVariableType, func() Variant { return Variant{time.Now()} })
+	// ServerState is an enumeration, 0 is Running.
+	variable(status, idHasComponent, idServerStatusState, "State", 852, -1, idBaseDataVariableType, func() Variant { return Variant{int32(0)} })
+}
+
+// AddRobot exposes variables of a robot as nodes below a folder named after
+// the robot in the Objects folder.
+//
+// Each variable is read once to derive its data type from the KRL value:
+// INT becomes Int32, REAL Float, BOOL Boolean, STRING and ENUM String with
+// ENUM values keeping their leading #. A STRUC variable is a String
+// variable holding the literal, with a component variable for each member.
+//
+// Parameters:
+// - ctx: Bounds the reads.
+// - robot: The robot, e.g. from a gateway or &gateway.Robot{ID: ..., Client: ...}.
+// - vars: The variables to expose.
+//
+// Returns: An error if a variable cannot be read or parsed, or the robot is already added.
+func (s *Server) AddRobot(ctx context.Context, robot *gateway.Robot, vars []Variable) error {
+	values := make([]krl.Value, len(vars))
+	for i, v := range vars {
+		raw, err := robot.Do(ctx, func(ctx context.Context, osv *openshowvar.OpenShowVar) (string, error) {
+			return osv.ReadContext(ctx, v.Name)
+		})
+		if err != nil {
+			return fmt.Errorf("%s: %v", v.Name, err)
+		}
+		if values[i], err = krl.Parse(raw); err != nil {
+			return fmt.Errorf("%s: %v", v.Name, err)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	folder := NewStringNodeID(1, robot.ID)
+	if _, ok := s.nodes[folder]; ok {
+		return fmt.Errorf("robot %q already added", robot.ID)
+	}
+	s.addNode(&node{id: folder, class: NodeClassObject, browseName: QualifiedName{NamespaceIndex: 1, Name: robot.ID}, displayName: robot.ID, typeDef: NewNumericNodeID(0, idFolderType)})
+	s.addReference(NewNumericNodeID(0, idObjectsFolder), idOrganizes, folder)
+	for i, v := range vars {
+		var access uint8 = AccessLevelRead
+		if v.Writable && !snapshot.IsReadOnly(v.Name) {
+			access |= AccessLevelWrite
+		}
+		s.addVariable(folder, idOrganizes, robot, v.Name, nil, values[i], access)
+	}
+	return nil
+}
+
+// addVariable adds the node of a robot variable or STRUC member and its
+// members. s.mu must be held.
+func (s *Server) addVariable(parent NodeID, refType uint32, robot *gateway.Robot, varName string, path []string, value krl.Value, access uint8) {
+	name := varName
+	if len(path) > 0 {
+		name = path[len(path)-1]
+	}
+	n := &node{
+		id:          RobotNodeID(robot.ID, varName, path...),
+		class:       NodeClassVariable,
+		browseName:  QualifiedName{NamespaceIndex: 1, Name: name},
+		displayName: name,
+		typeDef:     NewNumericNodeID(0, idBaseDataVariableType),
+		dataType:    dataTypeOf(value.Kind),
+		valueRank:   -1,
+		access:      access,
+		robot:       robot,
+		varName:     varName,
+		path:        path,
+		kind:        value.Kind,
+	}
+	s.addNode(n)
+	s.addReference(parent, refType, n.id)
+	for _, f := range value.Fields {
+		s.addVariable(n.id, idHasComponent, robot, varName, append(path[:len(path):len(path)], f.Name), f.Value, access)
+	}
+}
+
+// dataTypeOf returns the data type of variables of a KRL kind.
+func dataTypeOf(kind krl.Kind) NodeID {
+	switch kind {
+	case krl.Int:
+		return DataTypeInt32
+	case krl.Real:
+		return DataTypeFloat
+	case krl.Bool:
+		return DataTypeBoolean
+	}
+	return DataTypeString
+}
+
+// member returns the member of v at path.
+func member(v krl.Value, path []string) (krl.Value, bool) {
+	for _, name := range path {
+		var ok bool
+		if v, ok = v.Field(name); !ok {
+			return krl.Value{}, false
+		}
+	}
+	return v, true
+}
+
+// variantOf converts a KRL value to the Variant of a node of the given kind.
+func variantOf(v krl.Value, kind krl.Kind) (Variant, StatusCode) {
+	switch kind {
+	case krl.Int, krl.Real:
+		f, ok := v.Float()
+		if !ok {
+			return Variant{}, BadTypeMismatch
+		}
+		if kind == krl.Int {
+			return Variant{int32(f)}, Good
+		}
+		return Variant{float32(f)}, Good
+	case krl.Bool:
+		if v.Kind != krl.Bool {
+			return Variant{}, BadTypeMismatch
+		}
+		return Variant{v.Bool}, Good
+	case krl.String:
+		return Variant{v.Text()}, Good
+	}
+	return Variant{v.String()}, Good
+}
+
+// literalOf converts a written Variant to the KRL literal of a node of the given kind.
+func literalOf(v Variant, kind krl.Kind) (string, StatusCode) {
+	switch kind {
+	case krl.Int:
+		f, ok := number(v.Value)
+		if !ok {
+			return "", BadTypeMismatch
+		}
+		if f != math.Trunc(f) || f < math.MinInt32 || f > math.MaxInt32 {
+			return "", BadOutOfRange
+		}
+		return strconv.FormatInt(int64(f), 10), Good
+	case krl.Real:
+		f, ok := number(v.Value)
+		if !ok {
+			return "", BadTypeMismatch
+		}
+		return krl.Value{Kind: krl.Real, Real: f}.String(), Good
+	case krl.Bool:
+		b, ok := v.Value.(bool)
+		if !ok {
+			return "", BadTypeMismatch
+		}
+		return krl.Value{Kind: krl.Bool, Bool: b}.String(), Good
+	}
+
+	s, ok := v.Value.(string)
+	if !ok {
+		return "", BadTypeMismatch
+	}
+	switch kind {
+	case krl.String:
+		if strings.ContainsAny(s, "\"\r\n") {
+			return "", BadOutOfRange
+		}
+		return krl.Value{Kind: krl.String, Str: s}.String(), Good
+	case krl.Enum:
+		s = "#" + strings.TrimPrefix(s, "#")
+	}
+	parsed, err := krl.Parse(s)
+	if err != nil || parsed.Kind != kind {
+		return "", BadTypeMismatch
+	}
+	return s, Good
+}
+
+// number returns numeric Variant values as float64.
+func number(v any) (float64, bool) {
+	switch v := v.(type) {
+	case int8:
+		return float64(v), true
+	case uint8:
+		return float64(v), true
+	case int16:
+		return float64(v), true
+	case uint16:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+// partialLiteral wraps the literal of a STRUC member in aggregates, so that
+// writing it to the variable only changes the member: {FRAME {X 1.0}}.
+func partialLiteral(path []string, literal string) string {
+	for i := len(path) - 1; i >= 0; i-- {
+		literal = "{" + path[i] + " " + literal + "}"
+	}
+	return literal
+}
+
+// statusOf maps an error of a robot request to a status code.
+func statusOf(err error) StatusCode {
+	switch {
+	case errors.Is(err, openshowvar.ErrVariableNotFound):
+		return BadNotFound
+	case errors.Is(err, context.DeadlineExceeded):
+		return BadTimeout
+	}
+	return BadCommunicationError
+}
+
+// robotValue converts a value read from the robot to the DataValue of n.
+func (n *node) robotValue(raw string, readErr error, t time.Time) DataValue {
+	dv := DataValue{SourceTimestamp: t}
+	if readErr != nil {
+		dv.Status = statusOf(readErr)
+		return dv
+	}
+	parsed, err := krl.Parse(raw)
+	if err == nil {
+		if parsed, ok := member(parsed, n.path); ok {
+			dv.Value, dv.Status = variantOf(parsed, n.kind)
+			return dv
+		}
+	}
+	dv.Status = BadTypeMismatch
+	return dv
+}
@@ -0,0 +1,874 @@
+// Package opcua serves robot variables over OPC UA, with a minimal client.
+//
+// Address space, with robots in namespace 1 (NamespaceURI):
+//
+//	Objects (i=85)
+//	  Server (i=2253)                  NamespaceArray, ServerStatus, ...
+//	  cell1 (ns=1;s=cell1)             a folder per robot
+//	    $OV_PRO (ns=1;s=cell1/$OV_PRO) a variable per configured KRL variable
+//	    $POS_ACT (ns=1;s=cell1/$POS_ACT)
+//	      X (ns=1;s=cell1/$POS_ACT.X)  a component per STRUC member
+//
+// Values are read from the robot on every Read and sampled with the
+// subscriptions of the openshowvar client for monitored items. Only the
+// security policy None and anonymous sessions are supported, so the server
+// belongs on a trusted network.
+package opcua
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"net"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/selimserbes/go-openshowvar/pkg/openshowvar"
+)
+
+// Defaults and limits of the server.
+const (
+	defaultTimeout             = 5 * time.Second
+	defaultMinSamplingInterval = 50 * time.Millisecond
+	minPublishingInterval      = 50 * time.Millisecond
+	maxSessionTimeout          = time.Hour
+	defaultSessionTimeout      = time.Minute
+	channelLifetime            = time.Hour
+	// maxPublishRequests is the number of Publish requests queued per session.
+	maxPublishRequests = 10
+	productURI         = "urn:go-openshowvar"
+	anonymousPolicyID  = "anonymous"
+)
+
+// Server is an OPC UA server exposing robot variables as nodes.
+//
+// The server implements the binary protocol over TCP with the security
+// policy None and anonymous sessions, and the services GetEndpoints,
+// FindServers, CreateSession, ActivateSession, CloseSession, Browse, Read,
+// Write, CreateSubscription, ModifySubscription, SetPublishingMode,
+// DeleteSubscriptions, CreateMonitoredItems, DeleteMonitoredItems and
+// Publish. Other services fail with BadServiceUnsupported.
+type Server struct {
+	// EndpointURL is returned by GetEndpoints, e.g. opc.tcp://robots:4840.
+	// If empty, the URL the client connected to is returned.
+	EndpointURL string
+	// Timeout bounds reads and writes of robot variables, 5s if zero.
+	Timeout time.Duration
+	// MinSamplingInterval is the shortest sampling interval of monitored
+	// items, 50ms if zero.
+	MinSamplingInterval time.Duration
+
+	start time.Time
+
+	mu        sync.RWMutex
+	nodes     map[NodeID]*node
+	sessions  map[NodeID]*session
+	listeners map[net.Listener]struct{}
+	conns     map[*uaConn]struct{}
+	lastID    uint32
+	closed    bool
+	done      chan struct{}
+}
+
+// NewServer creates a server with the standard nodes of namespace 0. Add
+// robots with AddRobot before serving.
+func NewServer() *Server {
+	s := &Server{
+		start:     time.Now(),
+		nodes:     make(map[NodeID]*node),
+		sessions:  make(map[NodeID]*session),
+		listeners: make(map[net.Listener]struct{}),
+		conns:     make(map[*uaConn]struct{}),
+		done:      make(chan struct{}),
+	}
+	s.addStandardNodes()
+	go s.expireSessions()
+	return s
+}
+
+// Serve accepts connections on l until the server is closed.
+//
+// Parameters:
+// - l: The listener, e.g. from net.Listen("tcp", ":4840").
+//
+// Returns: The error of Accept, nil after Close.
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return errors.New("opcua: server closed")
+	}
+	s.listeners[l] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.listeners, l)
+		s.mu.Unlock()
+	}()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			select {
+			case <-s.done:
+				return nil
+			default:
+				return err
+			}
+		}
+		go s.ServeConn(conn)
+	}
+}
+
+// ServeConn serves a single connection and closes it when done.
+func (s *Server) ServeConn(conn net.Conn) {
+	c := newUAConn(conn)
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		conn.Close()
+		return
+	}
+	s.conns[c] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, c)
+		s.mu.Unlock()
+		c.Close()
+	}()
+
+	endpointURL, err := s.hello(c)
+	if err != nil {
+		c.sendError(err)
+		return
+	}
+
+	for {
+		msg, err := c.readMessage()
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				c.sendError(err)
+			}
+			return
+		}
+		if msg.typ == "CLO" {
+			return
+		}
+		if msg.typ == "MSG" && msg.channelID != c.channelID {
+			c.sendError(BadSecureChannelIDInvalid)
+			return
+		}
+
+		v, typeID, err := decodeMessage(msg.body)
+		if err != nil {
+			c.sendError(BadDecodingError)
+			return
+		}
+		if msg.typ == "OPN" {
+			req, ok := v.(*OpenSecureChannelRequest)
+			if !ok {
+				c.sendError(BadTCPMessageTypeInvalid)
+				return
+			}
+			if err := s.openChannel(c, msg, req); err != nil {
+				c.sendError(err)
+				return
+			}
+			continue
+		}
+		req, ok := v.(request)
+		if !ok {
+			// Unknown services are answered with a fault, which needs the
+			// request handle from the header after the type ID.
+			d := &decoder{b: msg.body}
+			typeID.decode(d)
+			var h RequestHeader
+			d.value(reflect.ValueOf(&h))
+			s.send(c, msg.requestID, h.RequestHandle, fault(BadServiceUnsupported))
+			continue
+		}
+		go s.handle(c, endpointURL, msg.requestID, req)
+	}
+}
+
+// hello answers the HEL message which starts a connection and returns the
+// endpoint URL requested by the client.
+func (s *Server) hello(c *uaConn) (string, error) {
+	c.conn.SetReadDeadline(time.Now().Add(defaultTimeout))
+	typ, _, body, err := c.readChunk()
+	if err != nil {
+		return "", err
+	}
+	c.conn.SetReadDeadline(time.Time{})
+	if typ != "HEL" {
+		return "", BadTCPMessageTypeInvalid
+	}
+	var h hello
+	if err := decode(body, &h); err != nil {
+		return "", BadDecodingError
+	}
+	// Chunks must hold at least the headers and some of the body.
+	if h.ReceiveBufferSize < 8192 {
+		return "", BadTCPMessageTooLarge
+	}
+	c.chunkSize = min(h.ReceiveBufferSize, bufferSize)
+	return h.EndpointURL, c.writeRaw("ACK", &acknowledge{
+		ReceiveBufferSize: bufferSize,
+		SendBufferSize:    c.chunkSize,
+		MaxMessageSize:    maxMessageSize,
+	})
+}
+
+// openChannel issues or renews the security token of the secure channel.
+func (s *Server) openChannel(c *uaConn, msg *message, req *OpenSecureChannelRequest) error {
+	if req.SecurityMode != securityModeNone {
+		return BadSecurityPolicyRejected
+	}
+	// RequestType 0 issues a token, 1 renews it. Responses sent concurrently
+	// read the IDs while holding wmu.
+	c.wmu.Lock()
+	switch {
+	case req.RequestType == 0 && c.channelID == 0:
+		c.channelID = s.nextID()
+	case req.RequestType == 0 || msg.channelID != c.channelID || c.channelID == 0:
+		c.wmu.Unlock()
+		return BadSecureChannelIDInvalid
+	}
+	c.tokenID++
+	channelID, tokenID := c.channelID, c.tokenID
+	c.wmu.Unlock()
+	lifetime := uint32(channelLifetime / time.Millisecond)
+	if req.RequestedLifetime > 0 {
+		lifetime = min(req.RequestedLifetime, lifetime)
+	}
+	resp := &OpenSecureChannelResponse{
+		SecurityToken: ChannelSecurityToken{
+			ChannelID:       channelID,
+			TokenID:         tokenID,
+			CreatedAt:       time.Now(),
+			RevisedLifetime: lifetime,
+		},
+	}
+	resp.Timestamp = time.Now()
+	resp.RequestHandle = req.RequestHandle
+	body, err := encodeMessage(resp)
+	if err != nil {
+		return err
+	}
+	return c.writeMessage("OPN", msg.requestID, body)
+}
+
+// handle runs a service request and sends the response. Publish requests
+// are answered later by their subscription.
+func (s *Server) handle(c *uaConn, endpointURL string, requestID uint32, req request) {
+	handle := req.requestHeader().RequestHandle
+	if resp := s.dispatch(c, endpointURL, requestID, req); resp != nil {
+		s.send(c, requestID, handle, resp)
+	}
+}
+
+// send sends a response, or a fault if it cannot be encoded.
+func (s *Server) send(c *uaConn, requestID, handle uint32, resp response) {
+	h := resp.responseHeader()
+	h.Timestamp = time.Now()
+	h.RequestHandle = handle
+	body, err := encodeMessage(resp)
+	if err != nil {
+		f := fault(BadEncodingError)
+		f.Timestamp = h.Timestamp
+		f.RequestHandle = handle
+		body, _ = encodeMessage(f)
+	}
+	c.writeMessage("MSG", requestID, body)
+}
+
+// fault creates a ServiceFault with a bad result.
+func fault(code StatusCode) *ServiceFault {
+	return &ServiceFault{ResponseHeader{ServiceResult: code}}
+}
+
+// dispatch runs a service request.
+func (s *Server) dispatch(c *uaConn, endpointURL string, requestID uint32, req request) response {
+	switch r := req.(type) {
+	case *GetEndpointsRequest:
+		return &GetEndpointsResponse{Endpoints: s.endpoints(c, endpointURL)}
+	case *FindServersRequest:
+		return &FindServersResponse{Servers: []ApplicationDescription{s.application(c, endpointURL)}}
+	case *CreateSessionRequest:
+		return s.createSession(c, endpointURL, r)
+	case *ActivateSessionRequest:
+		return s.activateSession(c, r)
+	case *CloseSessionRequest:
+		return s.closeSession(c, r)
+	}
+
+	sess, code := s.session(c, req.requestHeader().AuthenticationToken)
+	if code.IsBad() {
+		return fault(code)
+	}
+	switch r := req.(type) {
+	case *BrowseRequest:
+		return s.browse(r)
+	case *ReadRequest:
+		return s.read(r)
+	case *WriteRequest:
+		return s.write(r)
+	case *CreateSubscriptionRequest:
+		return s.createSubscription(sess, r)
+	case *ModifySubscriptionRequest:
+		return sess.modifySubscription(r)
+	case *SetPublishingModeRequest:
+		return sess.setPublishingMode(r)
+	case *DeleteSubscriptionsRequest:
+		return sess.deleteSubscriptions(r)
+	case *CreateMonitoredItemsRequest:
+		return s.createMonitoredItems(sess, r)
+	case *DeleteMonitoredItemsRequest:
+		return sess.deleteMonitoredItems(r)
+	case *PublishRequest:
+		return sess.publish(c, requestID, r)
+	case *RepublishRequest:
+		// Notification messages are not kept for retransmission.
+		return fault(BadMessageNotAvailable)
+	}
+	return fault(BadServiceUnsupported)
+}
+
+// endpointURL returns the advertised endpoint URL.
+func (s *Server) endpointURL(c *uaConn, requested string) string {
+	switch {
+	case s.EndpointURL != "":
+		return s.EndpointURL
+	case requested != "":
+		return requested
+	}
+	return "opc.tcp://" + c.conn.LocalAddr().String()
+}
+
+// applicationURI returns the URI of the server application.
+func (s *Server) applicationURI() string {
+	return productURI + ":server"
+}
+
+// application describes the server application.
+func (s *Server) application(c *uaConn, endpointURL string) ApplicationDescription {
+	return ApplicationDescription{
+		ApplicationURI:  s.applicationURI(),
+		ProductURI:      productURI,
+		ApplicationName: LocalizedText{Text: "go-openshowvar OPC UA server"},
+		DiscoveryURLs:   []string{s.endpointURL(c, endpointURL)},
+	}
+}
+
+// endpoints describes the only endpoint: no security, anonymous users.
+func (s *Server) endpoints(c *uaConn, endpointURL string) []EndpointDescription {
+	return []EndpointDescription{{
+		EndpointURL:       s.endpointURL(c, endpointURL),
+		Server:            s.application(c, endpointURL),
+		SecurityMode:      securityModeNone,
+		SecurityPolicyURI: securityPolicyNone,
+		UserIdentityTokens: []UserTokenPolicy{{
+			PolicyID:  anonymousPolicyID,
+			TokenType: tokenTypeAnonymous,
+		}},
+		TransportProfileURI: transportProfile,
+	}}
+}
+
+// nextID returns a new ID for channels, sessions, subscriptions and items.
+func (s *Server) nextID() uint32 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastID++
+	return s.lastID
+}
+
+// timeout returns the timeout of robot requests.
+func (s *Server) timeout() time.Duration {
+	if s.Timeout > 0 {
+		return s.Timeout
+	}
+	return defaultTimeout
+}
+
+// minSamplingInterval returns the shortest sampling interval.
+func (s *Server) minSamplingInterval() time.Duration {
+	if s.MinSamplingInterval > 0 {
+		return s.MinSamplingInterval
+	}
+	return defaultMinSamplingInterval
+}
+
+// node returns a node of the address space.
+func (s *Server) node(id NodeID) (*node, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	n, ok := s.nodes[id]
+	return n, ok
+}
+
+// Close closes the listeners, connections and sessions.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	close(s.done)
+	for l := range s.listeners {
+		l.Close()
+	}
+	for c := range s.conns {
+		c.Close()
+	}
+	sessions := make([]*session, 0, len(s.sessions))
+	for _, sess := range s.sessions {
+		sessions = append(sessions, sess)
+	}
+	s.sessions = make(map[NodeID]*session)
+	s.mu.Unlock()
+
+	for _, sess := range sessions {
+		sess.close()
+	}
+	return nil
+}
+
+// session is a client session.
+type session struct {
+	id    NodeID
+	token NodeID
+	// timeout closes the session when no request arrives in time.
+	timeout time.Duration
+
+	mu        sync.Mutex
+	conn      *uaConn
+	activated bool
+	lastUsed  time.Time
+	closed    bool
+	subs      map[uint32]*subscription
+	// queue holds the Publish requests waiting for notifications.
+	queue []*publishRequest
+}
+
+// publishRequest is a queued Publish request.
+type publishRequest struct {
+	conn      *uaConn
+	requestID uint32
+	handle    uint32
+	acks      []StatusCode
+}
+
+// createSession creates a session, which is bound to the secure channel
+// once activated.
+func (s *Server) createSession(c *uaConn, endpointURL string, req *CreateSessionRequest) response {
+	timeout := time.Duration(req.RequestedSessionTimeout * float64(time.Millisecond))
+	if timeout <= 0 {
+		timeout = defaultSessionTimeout
+	}
+	timeout = min(timeout, maxSessionTimeout)
+
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return fault(BadInternalError)
+	}
+	sess := &session{
+		id:       NewNumericNodeID(1, s.nextID()),
+		token:    NodeID{Type: OpaqueID, Text: string(token)},
+		timeout:  timeout,
+		conn:     c,
+		lastUsed: time.Now(),
+		subs:     make(map[uint32]*subscription),
+	}
+	s.mu.Lock()
+	s.sessions[sess.token] = sess
+	s.mu.Unlock()
+
+	return &CreateSessionResponse{
+		SessionID:             sess.id,
+		AuthenticationToken:   sess.token,
+		RevisedSessionTimeout: float64(timeout / time.Millisecond),
+		ServerEndpoints:       s.endpoints(c, endpointURL),
+		MaxRequestMessageSize: maxMessageSize,
+	}
+}
+
+// activateSession activates a session with an anonymous identity and binds
+// it to the secure channel of the request.
+func (s *Server) activateSession(c *uaConn, req *ActivateSessionRequest) response {
+	s.mu.RLock()
+	sess, ok := s.sessions[req.AuthenticationToken]
+	s.mu.RUnlock()
+	if !ok {
+		return fault(BadSessionIDInvalid)
+	}
+	// A missing identity token is anonymous.
+	switch token := req.UserIdentityToken; token.Value.(type) {
+	case *AnonymousIdentityToken:
+	case nil:
+		if !token.TypeID.IsNull() {
+			return fault(BadIdentityTokenInvalid)
+		}
+	default:
+		return fault(BadIdentityTokenInvalid)
+	}
+
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	if sess.closed {
+		return fault(BadSessionClosed)
+	}
+	sess.conn = c
+	sess.activated = true
+	sess.lastUsed = time.Now()
+	return &ActivateSessionResponse{}
+}
+
+// closeSession closes a session and deletes its subscriptions.
+func (s *Server) closeSession(c *uaConn, req *CloseSessionRequest) response {
+	sess, code := s.session(c, req.AuthenticationToken)
+	if code.IsBad() {
+		return fault(code)
+	}
+	s.mu.Lock()
+	delete(s.sessions, sess.token)
+	s.mu.Unlock()
+	sess.close()
+	return &CloseSessionResponse{}
+}
+
+// session returns the activated session of a request.
+func (s *Server) session(c *uaConn, token NodeID) (*session, StatusCode) {
+	s.mu.RLock()
+	sess, ok := s.sessions[token]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, BadSessionIDInvalid
+	}
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	switch {
+	case sess.closed:
+		return nil, BadSessionClosed
+	case !sess.activated:
+		return nil, BadSessionNotActivated
+	case sess.conn != c:
+		return nil, BadSecureChannelIDInvalid
+	}
+	sess.lastUsed = time.Now()
+	return sess, Good
+}
+
+// expireSessions closes sessions without requests for their timeout.
+func (s *Server) expireSessions() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+		}
+		var expired []*session
+		s.mu.Lock()
+		for token, sess := range s.sessions {
+			sess.mu.Lock()
+			if time.Since(sess.lastUsed) > sess.timeout {
+				expired = append(expired, sess)
+				delete(s.sessions, token)
+			}
+			sess.mu.Unlock()
+		}
+		s.mu.Unlock()
+		for _, sess := range expired {
+			sess.close()
+		}
+	}
+}
+
+// close deletes the subscriptions of the session and answers its queued
+// Publish requests.
+func (sess *session) close() {
+	sess.mu.Lock()
+	sess.closed = true
+	for id, sub := range sess.subs {
+		sub.stop()
+		delete(sess.subs, id)
+	}
+	queue := sess.queue
+	sess.queue = nil
+	sess.mu.Unlock()
+
+	for _, p := range queue {
+		p.fail(BadSessionClosed)
+	}
+}
+
+// fail answers a queued Publish request with a fault.
+func (p *publishRequest) fail(code StatusCode) {
+	f := fault(code)
+	f.Timestamp = time.Now()
+	f.RequestHandle = p.handle
+	body, err := encodeMessage(f)
+	if err == nil {
+		p.conn.writeMessage("MSG", p.requestID, body)
+	}
+}
+
+// browse returns the references of nodes.
+func (s *Server) browse(req *BrowseRequest) response {
+	if len(req.NodesToBrowse) == 0 {
+		return fault(BadNothingToDo)
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	results := make([]BrowseResult, len(req.NodesToBrowse))
+	for i, desc := range req.NodesToBrowse {
+		n, ok := s.nodes[desc.NodeID]
+		switch {
+		case !ok:
+			results[i].StatusCode = BadNodeIDUnknown
+			continue
+		case desc.BrowseDirection < 0 || desc.BrowseDirection > 2:
+			results[i].StatusCode = BadBrowseDirectionInvalid
+			continue
+		}
+		refs := []ReferenceDescription{}
+		for _, ref := range n.refs {
+			// BrowseDirection 0 is forward, 1 inverse and 2 both.
+			if desc.BrowseDirection == 0 && !ref.forward || desc.BrowseDirection == 1 && ref.forward {
+				continue
+			}
+			if !desc.ReferenceTypeID.IsNull() && ref.typeID != desc.ReferenceTypeID &&
+				!(desc.IncludeSubtypes && isSubtype(ref.typeID, desc.ReferenceTypeID)) {
+				continue
+			}
+			target := s.nodes[ref.target]
+			if desc.NodeClassMask != 0 && desc.NodeClassMask&uint32(target.class) == 0 {
+				continue
+			}
+			refs = append(refs, ReferenceDescription{
+				ReferenceTypeID: ref.typeID,
+				IsForward:       ref.forward,
+				NodeID:          ExpandedNodeID{NodeID: target.id},
+				BrowseName:      target.browseName,
+				DisplayName:     LocalizedText{Text: target.displayName},
+				NodeClass:       target.class,
+				TypeDefinition:  ExpandedNodeID{NodeID: target.typeDef},
+			})
+		}
+		results[i].References = refs
+	}
+	return &BrowseResponse{Results: results}
+}
+
+// referenceSupertypes maps the reference types used by the server to their
+// supertypes.
+var referenceSupertypes = map[uint32]uint32{
+	idNonHierarchical:        idReferences,
+	idHierarchicalReferences: idReferences,
+	idHasChild:               idHierarchicalReferences,
+	idOrganizes:              idHierarchicalReferences,
+	idAggregates:             idHasChild,
+	idHasSubtype:             idHasChild,
+	idHasProperty:            idAggregates,
+	idHasComponent:           idAggregates,
+	idHasTypeDefinition:      idNonHierarchical,
+}
+
+// isSubtype reports whether the reference type t is a subtype of super.
+func isSubtype(t, super NodeID) bool {
+	if t.Namespace != 0 || super.Namespace != 0 || t.Type != NumericID || super.Type != NumericID {
+		return false
+	}
+	for id, ok := t.Numeric, true; ok; id, ok = referenceSupertypes[id] {
+		if id == super.Numeric {
+			return true
+		}
+	}
+	return false
+}
+
+// read returns attributes of nodes. The values of robot variables are read
+// from the robot, once per variable for all its members.
+func (s *Server) read(req *ReadRequest) response {
+	if len(req.NodesToRead) == 0 {
+		return fault(BadNothingToDo)
+	}
+	if req.TimestampsToReturn < timestampsSource || req.TimestampsToReturn > timestampsNeither {
+		return fault(BadTimestampsToReturnInvalid)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout())
+	defer cancel()
+
+	type rawValue struct {
+		value string
+		err   error
+		time  time.Time
+	}
+	values := make(map[*node]rawValue)
+	results := make([]DataValue, len(req.NodesToRead))
+	for i, rv := range req.NodesToRead {
+		n, ok := s.node(rv.NodeID)
+		switch {
+		case !ok:
+			results[i].Status = BadNodeIDUnknown
+			continue
+		case rv.IndexRange != "":
+			results[i].Status = BadIndexRangeInvalid
+			continue
+		case rv.AttributeID != AttributeValue || n.robot == nil:
+			results[i] = s.attribute(n, rv.AttributeID)
+		default:
+			root := s.rootOf(n)
+			raw, ok := values[root]
+			if !ok {
+				raw.value, raw.err = n.robot.Do(ctx, func(ctx context.Context, osv *openshowvar.OpenShowVar) (string, error) {
+					return osv.ReadContext(ctx, n.varName)
+				})
+				raw.time = time.Now()
+				values[root] = raw
+			}
+			results[i] = n.robotValue(raw.value, raw.err, raw.time)
+		}
+		results[i] = withTimestamps(results[i], req.TimestampsToReturn)
+	}
+	return &ReadResponse{Results: results}
+}
+
+// rootOf returns the node of the variable n is a member of, n itself for
+// variables.
+func (s *Server) rootOf(n *node) *node {
+	if len(n.path) == 0 {
+		return n
+	}
+	root, _ := s.node(RobotNodeID(n.robot.ID, n.varName))
+	return root
+}
+
+// withTimestamps keeps the requested timestamps of a value.
+func withTimestamps(dv DataValue, timestamps int32) DataValue {
+	if dv.Status == BadNodeIDUnknown || dv.Status == BadAttributeIDInvalid {
+		return dv
+	}
+	switch timestamps {
+	case timestampsSource:
+		dv.ServerTimestamp = time.Time{}
+	case timestampsServer:
+		dv.SourceTimestamp = time.Time{}
+		dv.ServerTimestamp = time.Now()
+	case timestampsBoth:
+		dv.ServerTimestamp = time.Now()
+	case timestampsNeither:
+		dv.SourceTimestamp, dv.ServerTimestamp = time.Time{}, time.Time{}
+	}
+	return dv
+}
+
+// attribute returns an attribute other than the value of robot variables.
+func (s *Server) attribute(n *node, id AttributeID) DataValue {
+	var v any
+	switch id {
+	case AttributeNodeID:
+		v = n.id
+	case AttributeNodeClass:
+		v = int32(n.class)
+	case AttributeBrowseName:
+		v = n.browseName
+	case AttributeDisplayName:
+		v = LocalizedText{Text: n.displayName}
+	case AttributeDescription:
+		v = LocalizedText{}
+	case AttributeWriteMask, AttributeUserWriteMask:
+		v = uint32(0)
+	}
+	if n.class == NodeClassObject && id == AttributeEventNotifier {
+		v = uint8(0)
+	}
+	if n.class == NodeClassVariable {
+		switch id {
+		case AttributeValue:
+			return DataValue{Value: n.value(), SourceTimestamp: time.Now()}
+		case AttributeDataType:
+			v = n.dataType
+		case AttributeValueRank:
+			v = n.valueRank
+		case AttributeArrayDimensions:
+			if n.valueRank == 1 {
+				v = []uint32{0}
+			} else {
+				v = []uint32{}
+			}
+		case AttributeAccessLevel, AttributeUserAccessLevel:
+			v = n.access
+		case AttributeMinimumSamplingInterval:
+			v = float64(s.minSamplingInterval() / time.Millisecond)
+		case AttributeHistorizing:
+			v = false
+		}
+	}
+	if v == nil {
+		return DataValue{Status: BadAttributeIDInvalid}
+	}
+	return DataValue{Value: Variant{v}}
+}
+
+// write writes values of robot variables.
+func (s *Server) write(req *WriteRequest) response {
+	if len(req.NodesToWrite) == 0 {
+		return fault(BadNothingToDo)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout())
+	defer cancel()
+
+	results := make([]StatusCode, len(req.NodesToWrite))
+	for i, wv := range req.NodesToWrite {
+		n, ok := s.node(wv.NodeID)
+		switch {
+		case !ok:
+			results[i] = BadNodeIDUnknown
+			continue
+		case wv.AttributeID != AttributeValue:
+			if s.attribute(n, wv.AttributeID).Status.IsBad() {
+				results[i] = BadAttributeIDInvalid
+			} else {
+				results[i] = BadNotWritable
+			}
+			continue
+		case wv.IndexRange != "":
+			results[i] = BadIndexRangeInvalid
+			continue
+		case n.access&AccessLevelWrite == 0:
+			results[i] = BadNotWritable
+			continue
+		}
+		literal, code := literalOf(wv.Value.Value, n.kind)
+		if code.IsBad() {
+			results[i] = code
+			continue
+		}
+		literal = partialLiteral(n.path, literal)
+		_, err := n.robot.Do(ctx, func(ctx context.Context, osv *openshowvar.OpenShowVar) (string, error) {
+			return osv.WriteContext(ctx, n.varName, literal)
+		})
+		if err != nil {
+			results[i] = statusOf(err)
+		}
+	}
+	return &WriteResponse{Results: results}
+}
+
+// sortedIDs returns the keys of a map of IDs in ascending order.
+func sortedIDs[V any](m map[uint32]V) []uint32 {
+	ids := make([]uint32, 0, len(m))
+	for id := range m {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
@@ -0,0 +1,689 @@
+package opcua
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// Well-known node IDs of namespace 0.
+const (
+	idBaseDataType           = 24
+	idReferences             = 31
+	idNonHierarchical        = 32
+	idHierarchicalReferences = 33
+	idHasChild               = 34
+	idOrganizes              = 35
+	idHasTypeDefinition      = 40
+	idAggregates             = 44
+	idHasSubtype             = 45
+	idHasProperty            = 46
+	idHasComponent           = 47
+	idBaseObjectType         = 58
+	idFolderType             = 61
+	idBaseDataVariableType   = 63
+	idPropertyType           = 68
+	idRootFolder             = 84
+	idObjectsFolder          = 85
+	idTypesFolder            = 86
+	idViewsFolder            = 87
+	idServer                 = 2253
+	idServerArray            = 2254
+	idNamespaceArray         = 2255
+	idServerStatus           = 2256
+	idServerStatusStartTime  = 2257
+	idServerStatusTime       = 2258
+	idServerStatusState      = 2259
+	idServerStatusType       = 2138
+	idServerType             = 2004
+	idServerStatusDataType   = 862
+)
+
+// NodeClass is the class of a node.
+type NodeClass int32
+
+// Node classes.
+const (
+	NodeClassObject   NodeClass = 1
+	NodeClassVariable NodeClass = 2
+)
+
+// AttributeID identifies an attribute of a node.
+type AttributeID uint32
+
+// Attributes supported by the server.
+const (
+	AttributeNodeID                  AttributeID = 1
+	AttributeNodeClass               AttributeID = 2
+	AttributeBrowseName              AttributeID = 3
+	AttributeDisplayName             AttributeID = 4
+	AttributeDescription             AttributeID = 5
+	AttributeWriteMask               AttributeID = 6
+	AttributeUserWriteMask           AttributeID = 7
+	AttributeEventNotifier           AttributeID = 12
+	AttributeValue                   AttributeID = 13
+	AttributeDataType                AttributeID = 14
+	AttributeValueRank               AttributeID = 15
+	AttributeArrayDimensions         AttributeID = 16
+	AttributeAccessLevel             AttributeID = 17
+	AttributeUserAccessLevel         AttributeID = 18
+	AttributeMinimumSamplingInterval AttributeID = 19
+	AttributeHistorizing             AttributeID = 20
+)
+
+// Access level bits of variables.
+const (
+	AccessLevelRead  uint8 = 0x01
+	AccessLevelWrite uint8 = 0x02
+)
+
+// Data type node IDs of variables mapped from KRL.
+var (
+	DataTypeBoolean = NewNumericNodeID(0, typeBoolean)
+	DataTypeInt32   = NewNumericNodeID(0, typeInt32)
+	DataTypeFloat   = NewNumericNodeID(0, typeFloat)
+	DataTypeString  = NewNumericNodeID(0, typeString)
+)
+
+// Protocol constants.
+const (
+	securityPolicyNone = "http://opcfoundation.org/UA/SecurityPolicy#None"
+	transportProfile   = "http://opcfoundation.org/UA-Profile/Transport/uatcp-uasc-uabinary"
+	securityModeNone   = 1
+	tokenTypeAnonymous = 0
+)
+
+// Timestamps to return.
+const (
+	timestampsSource  = 0
+	timestampsServer  = 1
+	timestampsBoth    = 2
+	timestampsNeither = 3
+)
+
+// Monitoring modes.
+const (
+	monitoringDisabled  = 0
+	monitoringSampling  = 1
+	monitoringReporting = 2
+)
+
+// RequestHeader starts every request.
+type RequestHeader struct {
+	AuthenticationToken NodeID
+	Timestamp           time.Time
+	RequestHandle       uint32
+	ReturnDiagnostics   uint32
+	AuditEntryID        string
+	TimeoutHint         uint32
+	AdditionalHeader    ExtensionObject
+}
+
+func (h *RequestHeader) requestHeader() *RequestHeader { return h }
+
+// ResponseHeader starts every response.
+type ResponseHeader struct {
+	Timestamp          time.Time
+	RequestHandle      uint32
+	ServiceResult      StatusCode
+	ServiceDiagnostics DiagnosticInfo
+	StringTable        []string
+	AdditionalHeader   ExtensionObject
+}
+
+func (h *ResponseHeader) responseHeader() *ResponseHeader { return h }
+
+// request is implemented by all service requests.
+type request interface {
+	requestHeader() *RequestHeader
+}
+
+// response is implemented by all service responses.
+type response interface {
+	responseHeader() *ResponseHeader
+}
+
+// ServiceFault is the response to a failed request.
+type ServiceFault struct {
+	ResponseHeader
+}
+
+// ApplicationDescription describes a client or server.
+type ApplicationDescription struct {
+	ApplicationURI      string
+	ProductURI          string
+	ApplicationName     LocalizedText
+	ApplicationType     int32
+	GatewayServerURI    string
+	DiscoveryProfileURI string
+	DiscoveryURLs       []string
+}
+
+// UserTokenPolicy describes an accepted user identity.
+type UserTokenPolicy struct {
+	PolicyID          string
+	TokenType         int32
+	IssuedTokenType   string
+	IssuerEndpointURL string
+	SecurityPolicyURI string
+}
+
+// EndpointDescription describes an endpoint of a server.
+type EndpointDescription struct {
+	EndpointURL         string
+	Server              ApplicationDescription
+	ServerCertificate   []byte
+	SecurityMode        int32
+	SecurityPolicyURI   string
+	UserIdentityTokens  []UserTokenPolicy
+	TransportProfileURI string
+	SecurityLevel       uint8
+}
+
+// SignatureData is a signature, empty without security.
+type SignatureData struct {
+	Algorithm string
+	Signature []byte
+}
+
+// ChannelSecurityToken identifies the keys of a secure channel.
+type ChannelSecurityToken struct {
+	ChannelID       uint32
+	TokenID         uint32
+	CreatedAt       time.Time
+	RevisedLifetime uint32
+}
+
+// OpenSecureChannelRequest is the request of the OpenSecureChannel service.
+type OpenSecureChannelRequest struct {
+	RequestHeader
+	ClientProtocolVersion uint32
+	RequestType           int32
+	SecurityMode          int32
+	ClientNonce           []byte
+	RequestedLifetime     uint32
+}
+
+// OpenSecureChannelResponse is the response of the OpenSecureChannel service.
+type OpenSecureChannelResponse struct {
+	ResponseHeader
+	ServerProtocolVersion uint32
+	SecurityToken         ChannelSecurityToken
+	ServerNonce           []byte
+}
+
+// CloseSecureChannelRequest is the request of the CloseSecureChannel service.
+type CloseSecureChannelRequest struct {
+	RequestHeader
+}
+
+// FindServersRequest is the request of the FindServers service.
+type FindServersRequest struct {
+	RequestHeader
+	EndpointURL string
+	LocaleIDs   []string
+	ServerURIs  []string
+}
+
+// FindServersResponse is the response of the FindServers service.
+type FindServersResponse struct {
+	ResponseHeader
+	Servers []ApplicationDescription
+}
+
+// GetEndpointsRequest is the request of the GetEndpoints service.
+type GetEndpointsRequest struct {
+	RequestHeader
+	EndpointURL string
+	LocaleIDs   []string
+	ProfileURIs []string
+}
+
+// GetEndpointsResponse is the response of the GetEndpoints service.
+type GetEndpointsResponse struct {
+	ResponseHeader
+	Endpoints []EndpointDescription
+}
+
+// CreateSessionRequest is the request of the CreateSession service.
+type CreateSessionRequest struct {
+	RequestHeader
+	ClientDescription       ApplicationDescription
+	ServerURI               string
+	EndpointURL             string
+	SessionName             string
+	ClientNonce             []byte
+	ClientCertificate       []byte
+	RequestedSessionTimeout float64
+	MaxResponseMessageSize  uint32
+}
+
+// SignedSoftwareCertificate is a software certificate, unused without security.
+type SignedSoftwareCertificate struct {
+	CertificateData []byte
+	Signature       []byte
+}
+
+// CreateSessionResponse is the response of the CreateSession service.
+type CreateSessionResponse struct {
+	ResponseHeader
+	SessionID                  NodeID
+	AuthenticationToken        NodeID
+	RevisedSessionTimeout      float64
+	ServerNonce                []byte
+	ServerCertificate          []byte
+	ServerEndpoints            []EndpointDescription
+	ServerSoftwareCertificates []SignedSoftwareCertificate
+	ServerSignature            SignatureData
+	MaxRequestMessageSize      uint32
+}
+
+// AnonymousIdentityToken activates a session without a user.
+type AnonymousIdentityToken struct {
+	PolicyID string
+}
+
+// UserNameIdentityToken activates a session with a user name, not accepted by the server.
+type UserNameIdentityToken struct {
+	PolicyID            string
+	UserName            string
+	Password            []byte
+	EncryptionAlgorithm string
+}
+
+// ActivateSessionRequest is the request of the ActivateSession service.
+type ActivateSessionRequest struct {
+	RequestHeader
+	ClientSignature            SignatureData
+	ClientSoftwareCertificates []SignedSoftwareCertificate
+	LocaleIDs                  []string
+	UserIdentityToken          ExtensionObject
+	UserTokenSignature         SignatureData
+}
+
+// ActivateSessionResponse is the response of the ActivateSession service.
+type ActivateSessionResponse struct {
+	ResponseHeader
+	ServerNonce     []byte
+	Results         []StatusCode
+	DiagnosticInfos []DiagnosticInfo
+}
+
+// CloseSessionRequest is the request of the CloseSession service.
+type CloseSessionRequest struct {
+	RequestHeader
+	DeleteSubscriptions bool
+}
+
+// CloseSessionResponse is the response of the CloseSession service.
+type CloseSessionResponse struct {
+	ResponseHeader
+}
+
+// ViewDescription selects a view, the whole address space if null.
+type ViewDescription struct {
+	ViewID      NodeID
+	Timestamp   time.Time
+	ViewVersion uint32
+}
+
+// BrowseDescription selects the references of a node to return.
+type BrowseDescription struct {
+	NodeID          NodeID
+	BrowseDirection int32
+	ReferenceTypeID NodeID
+	IncludeSubtypes bool
+	NodeClassMask   uint32
+	ResultMask      uint32
+}
+
+// ReferenceDescription is a reference returned by Browse.
+type ReferenceDescription struct {
+	ReferenceTypeID NodeID
+	IsForward       bool
+	NodeID          ExpandedNodeID
+	BrowseName      QualifiedName
+	DisplayName     LocalizedText
+	NodeClass       NodeClass
+	TypeDefinition  ExpandedNodeID
+}
+
+// BrowseResult holds the references of one node.
+type BrowseResult struct {
+	StatusCode        StatusCode
+	ContinuationPoint []byte
+	References        []ReferenceDescription
+}
+
+// BrowseRequest is the request of the Browse service.
+type BrowseRequest struct {
+	RequestHeader
+	View                          ViewDescription
+	RequestedMaxReferencesPerNode uint32
+	NodesToBrowse                 []BrowseDescription
+}
+
+// BrowseResponse is the response of the Browse service.
+type BrowseResponse struct {
+	ResponseHeader
+	Results         []BrowseResult
+	DiagnosticInfos []DiagnosticInfo
+}
+
+// ReadValueID selects an attribute of a node.
+type ReadValueID struct {
+	NodeID       NodeID
+	AttributeID  AttributeID
+	IndexRange   string
+	DataEncoding QualifiedName
+}
+
+// ReadRequest is the request of the Read service.
+type ReadRequest struct {
+	RequestHeader
+	MaxAge             float64
+	TimestampsToReturn int32
+	NodesToRead        []ReadValueID
+}
+
+// ReadResponse is the response of the Read service.
+type ReadResponse struct {
+	ResponseHeader
+	Results         []DataValue
+	DiagnosticInfos []DiagnosticInfo
+}
+
+// WriteValue is an attribute value to write.
+type WriteValue struct {
+	NodeID      NodeID
+	AttributeID AttributeID
+	IndexRange  string
+	Value       DataValue
+}
+
+// WriteRequest is the request of the Write service.
+type WriteRequest struct {
+	RequestHeader
+	NodesToWrite []WriteValue
+}
+
+// WriteResponse is the response of the Write service.
+type WriteResponse struct {
+	ResponseHeader
+	Results         []StatusCode
+	DiagnosticInfos []DiagnosticInfo
+}
+
+// CreateSubscriptionRequest is the request of the CreateSubscription service.
+type CreateSubscriptionRequest struct {
+	RequestHeader
+	RequestedPublishingInterval float64
+	RequestedLifetimeCount      uint32
+	RequestedMaxKeepAliveCount  uint32
+	MaxNotificationsPerPublish  uint32
+	PublishingEnabled           bool
+	Priority                    uint8
+}
+
+// CreateSubscriptionResponse is the response of the CreateSubscription service.
+type CreateSubscriptionResponse struct {
+	ResponseHeader
+	SubscriptionID            uint32
+	RevisedPublishingInterval float64
+	RevisedLifetimeCount      uint32
+	RevisedMaxKeepAliveCount  uint32
+}
+
+// ModifySubscriptionRequest is the request of the ModifySubscription service.
+type ModifySubscriptionRequest struct {
+	RequestHeader
+	SubscriptionID              uint32
+	RequestedPublishingInterval float64
+	RequestedLifetimeCount      uint32
+	RequestedMaxKeepAliveCount  uint32
+	MaxNotificationsPerPublish  uint32
+	Priority                    uint8
+}
+
+// ModifySubscriptionResponse is the response of the ModifySubscription service.
+type ModifySubscriptionResponse struct {
+	ResponseHeader
+	RevisedPublishingInterval float64
+	RevisedLifetimeCount      uint32
+	RevisedMaxKeepAliveCount  uint32
+}
+
+// SetPublishingModeRequest is the request of the SetPublishingMode service.
+type SetPublishingModeRequest struct {
+	RequestHeader
+	PublishingEnabled bool
+	SubscriptionIDs   []uint32
+}
+
+// SetPublishingModeResponse is the response of the SetPublishingMode service.
+type SetPublishingModeResponse struct {
+	ResponseHeader
+	Results         []StatusCode
+	DiagnosticInfos []DiagnosticInfo
+}
+
+// DeleteSubscriptionsRequest is the request of the DeleteSubscriptions service.
+type DeleteSubscriptionsRequest struct {
+	RequestHeader
+	SubscriptionIDs []uint32
+}
+
+// DeleteSubscriptionsResponse is the response of the DeleteSubscriptions service.
+type DeleteSubscriptionsResponse struct {
+	ResponseHeader
+	Results         []StatusCode
+	DiagnosticInfos []DiagnosticInfo
+}
+
+// MonitoringParameters configures a monitored item.
+type MonitoringParameters struct {
+	ClientHandle     uint32
+	SamplingInterval float64
+	Filter           ExtensionObject
+	QueueSize        uint32
+	DiscardOldest    bool
+}
+
+// MonitoredItemCreateRequest creates a monitored item.
+type MonitoredItemCreateRequest struct {
+	ItemToMonitor       ReadValueID
+	MonitoringMode      int32
+	RequestedParameters MonitoringParameters
+}
+
+// MonitoredItemCreateResult is the result of creating a monitored item.
+type MonitoredItemCreateResult struct {
+	StatusCode              StatusCode
+	MonitoredItemID         uint32
+	RevisedSamplingInterval float64
+	RevisedQueueSize        uint32
+	FilterResult            ExtensionObject
+}
+
+// CreateMonitoredItemsRequest is the request of the CreateMonitoredItems service.
+type CreateMonitoredItemsRequest struct {
+	RequestHeader
+	SubscriptionID     uint32
+	TimestampsToReturn int32
+	ItemsToCreate      []MonitoredItemCreateRequest
+}
+
+// CreateMonitoredItemsResponse is the response of the CreateMonitoredItems service.
+type CreateMonitoredItemsResponse struct {
+	ResponseHeader
+	Results         []MonitoredItemCreateResult
+	DiagnosticInfos []DiagnosticInfo
+}
+
+// DeleteMonitoredItemsRequest is the request of the DeleteMonitoredItems service.
+type DeleteMonitoredItemsRequest struct {
+	RequestHeader
+	SubscriptionID   uint32
+	MonitoredItemIDs []uint32
+}
+
+// DeleteMonitoredItemsResponse is the response of the DeleteMonitoredItems service.
+type DeleteMonitoredItemsResponse struct {
+	ResponseHeader
+	Results         []StatusCode
+	DiagnosticInfos []DiagnosticInfo
+}
+
+// SubscriptionAcknowledgement acknowledges a notification message.
+type SubscriptionAcknowledgement struct {
+	SubscriptionID uint32
+	SequenceNumber uint32
+}
+
+// NotificationMessage carries the notifications of a publishing cycle,
+// none for keep-alive messages.
+type NotificationMessage struct {
+	SequenceNumber   uint32
+	PublishTime      time.Time
+	NotificationData []ExtensionObject
+}
+
+// MonitoredItemNotification is a new value of a monitored item.
+type MonitoredItemNotification struct {
+	ClientHandle uint32
+	Value        DataValue
+}
+
+// DataChangeNotification carries new values of monitored items.
+type DataChangeNotification struct {
+	MonitoredItems  []MonitoredItemNotification
+	DiagnosticInfos []DiagnosticInfo
+}
+
+// PublishRequest is the request of the Publish service.
+type PublishRequest struct {
+	RequestHeader
+	SubscriptionAcknowledgements []SubscriptionAcknowledgement
+}
+
+// PublishResponse is the response of the Publish service.
+type PublishResponse struct {
+	ResponseHeader
+	SubscriptionID           uint32
+	AvailableSequenceNumbers []uint32
+	MoreNotifications        bool
+	NotificationMessage      NotificationMessage
+	Results                  []StatusCode
+	DiagnosticInfos          []DiagnosticInfo
+}
+
+// RepublishRequest is the request of the Republish service.
+type RepublishRequest struct {
+	RequestHeader
+	SubscriptionID           uint32
+	RetransmitSequenceNumber uint32
+}
+
+// ServerStatusDataType is the value of the ServerStatus variable.
+type ServerStatusDataType struct {
+	StartTime           time.Time
+	CurrentTime         time.Time
+	State               int32
+	BuildInfo           BuildInfo
+	SecondsTillShutdown uint32
+	ShutdownReason      LocalizedText
+}
+
+// BuildInfo describes the server software.
+type BuildInfo struct {
+	ProductURI       string
+	ManufacturerName string
+	ProductName      string
+	SoftwareVersion  string
+	BuildNumber      string
+	BuildDate        time.Time
+}
+
+// encodingIDs maps structures to the node IDs of their binary encoding.
+var encodingIDs = map[reflect.Type]uint32{}
+
+// encodingTypes is the inverse of encodingIDs.
+var encodingTypes = map[NodeID]reflect.Type{}
+
+func register(id uint32, v any) {
+	t := reflect.TypeOf(v)
+	encodingIDs[t] = id
+	encodingTypes[NewNumericNodeID(0, id)] = t
+}
+
+func init() {
+	register(321, AnonymousIdentityToken{})
+	register(324, UserNameIdentityToken{})
+	register(397, ServiceFault{})
+	register(422, FindServersRequest{})
+	register(425, FindServersResponse{})
+	register(428, GetEndpointsRequest{})
+	register(431, GetEndpointsResponse{})
+	register(446, OpenSecureChannelRequest{})
+	register(449, OpenSecureChannelResponse{})
+	register(452, CloseSecureChannelRequest{})
+	register(461, CreateSessionRequest{})
+	register(464, CreateSessionResponse{})
+	register(467, ActivateSessionRequest{})
+	register(470, ActivateSessionResponse{})
+	register(473, CloseSessionRequest{})
+	register(476, CloseSessionResponse{})
+	register(527, BrowseRequest{})
+	register(530, BrowseResponse{})
+	register(631, ReadRequest{})
+	register(634, ReadResponse{})
+	register(673, WriteRequest{})
+	register(676, WriteResponse{})
+	register(751, CreateMonitoredItemsRequest{})
+	register(754, CreateMonitoredItemsResponse{})
+	register(781, DeleteMonitoredItemsRequest{})
+	register(784, DeleteMonitoredItemsResponse{})
+	register(787, CreateSubscriptionRequest{})
+	register(790, CreateSubscriptionResponse{})
+	register(793, ModifySubscriptionRequest{})
+	register(796, ModifySubscriptionResponse{})
+	register(799, SetPublishingModeRequest{})
+	register(802, SetPublishingModeResponse{})
+	register(811, DataChangeNotification{})
+	register(826, PublishRequest{})
+	register(829, PublishResponse{})
+	register(832, RepublishRequest{})
+	register(847, DeleteSubscriptionsRequest{})
+	register(850, DeleteSubscriptionsResponse{})
+	register(864, ServerStatusDataType{})
+}
+
+// encodeMessage encodes a service request or response with its type ID.
+func encodeMessage(v any) ([]byte, error) {
+	id, ok := encodingIDs[reflect.Indirect(reflect.ValueOf(v)).Type()]
+	if !ok {
+		return nil, fmt.Errorf("opcua: no encoding for %T", v)
+	}
+	e := &encoder{}
+	NewNumericNodeID(0, id).encode(e)
+	e.value(reflect.ValueOf(v))
+	return e.b, e.err
+}
+
+// decodeMessage decodes a service request or response. For unknown types
+// the returned NodeID identifies the type and the value is nil.
+func decodeMessage(b []byte) (any, NodeID, error) {
+	d := &decoder{b: b}
+	var id NodeID
+	id.decode(d)
+	if d.err != nil {
+		return nil, id, d.err
+	}
+	t, ok := encodingTypes[id]
+	if !ok {
+		return nil, id, nil
+	}
+	v := reflect.New(t)
+	d.value(v)
+	return v.Interface(), id, d.err
+}
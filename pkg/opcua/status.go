@@ -0,0 +1,98 @@
+package opcua
+
+import "fmt"
+
+// StatusCode is the result of an operation. Codes with the high bit set are
+// bad, StatusCode implements error for them.
+type StatusCode uint32
+
+// Status codes used by the server and client.
+const (
+	Good                              StatusCode = 0
+	BadUnexpectedError                StatusCode = 0x80010000
+	BadInternalError                  StatusCode = 0x80020000
+	BadCommunicationError             StatusCode = 0x80050000
+	BadEncodingError                  StatusCode = 0x80060000
+	BadDecodingError                  StatusCode = 0x80070000
+	BadTimeout                        StatusCode = 0x800A0000
+	BadServiceUnsupported             StatusCode = 0x800B0000
+	BadNothingToDo                    StatusCode = 0x800F0000
+	BadIdentityTokenInvalid           StatusCode = 0x80200000
+	BadSecureChannelIDInvalid         StatusCode = 0x80220000
+	BadSessionIDInvalid               StatusCode = 0x80250000
+	BadSessionClosed                  StatusCode = 0x80260000
+	BadSessionNotActivated            StatusCode = 0x80270000
+	BadSubscriptionIDInvalid          StatusCode = 0x80280000
+	BadTimestampsToReturnInvalid      StatusCode = 0x802B0000
+	BadNodeIDUnknown                  StatusCode = 0x80340000
+	BadAttributeIDInvalid             StatusCode = 0x80350000
+	BadIndexRangeInvalid              StatusCode = 0x80360000
+	BadNotReadable                    StatusCode = 0x803A0000
+	BadNotWritable                    StatusCode = 0x803B0000
+	BadOutOfRange                     StatusCode = 0x803C0000
+	BadNotFound                       StatusCode = 0x803E0000
+	BadMonitoredItemIDInvalid         StatusCode = 0x80420000
+	BadMonitoredItemFilterUnsupported StatusCode = 0x80440000
+	BadBrowseDirectionInvalid         StatusCode = 0x804D0000
+	BadSecurityPolicyRejected         StatusCode = 0x80550000
+	BadTypeMismatch                   StatusCode = 0x80740000
+	BadTooManyPublishRequests         StatusCode = 0x80780000
+	BadNoSubscription                 StatusCode = 0x80790000
+	BadMessageNotAvailable            StatusCode = 0x807B0000
+	BadTCPMessageTypeInvalid          StatusCode = 0x807E0000
+	BadTCPMessageTooLarge             StatusCode = 0x80800000
+)
+
+var statusNames = map[StatusCode]string{
+	Good:                              "Good",
+	BadUnexpectedError:                "BadUnexpectedError",
+	BadInternalError:                  "BadInternalError",
+	BadCommunicationError:             "BadCommunicationError",
+	BadEncodingError:                  "BadEncodingError",
+	BadDecodingError:                  "BadDecodingError",
+	BadTimeout:                        "BadTimeout",
+	BadServiceUnsupported:             "BadServiceUnsupported",
+	BadNothingToDo:                    "BadNothingToDo",
+	BadIdentityTokenInvalid:           "BadIdentityTokenInvalid",
+	BadSecureChannelIDInvalid:         "BadSecureChannelIdInvalid",
+	BadSessionIDInvalid:               "BadSessionIdInvalid",
+	BadSessionClosed:                  "BadSessionClosed",
+	BadSessionNotActivated:            "BadSessionNotActivated",
+	BadSubscriptionIDInvalid:          "BadSubscriptionIdInvalid",
+	BadTimestampsToReturnInvalid:      "BadTimestampsToReturnInvalid",
+	BadNodeIDUnknown:                  "BadNodeIdUnknown",
+	BadAttributeIDInvalid:             "BadAttributeIdInvalid",
+	BadIndexRangeInvalid:              "BadIndexRangeInvalid",
+	BadNotReadable:                    "BadNotReadable",
+	BadNotWritable:                    "BadNotWritable",
+	BadOutOfRange:                     "BadOutOfRange",
+	BadNotFound:                       "BadNotFound",
+	BadMonitoredItemIDInvalid:         "BadMonitoredItemIdInvalid",
+	BadMonitoredItemFilterUnsupported: "BadMonitoredItemFilterUnsupported",
+	BadBrowseDirectionInvalid:         "BadBrowseDirectionInvalid",
+	BadSecurityPolicyRejected:         "BadSecurityPolicyRejected",
+	BadTypeMismatch:                   "BadTypeMismatch",
+	BadTooManyPublishRequests:         "BadTooManyPublishRequests",
+	BadNoSubscription:                 "BadNoSubscription",
+	BadMessageNotAvailable:            "BadMessageNotAvailable",
+	BadTCPMessageTypeInvalid:          "BadTcpMessageTypeInvalid",
+	BadTCPMessageTooLarge:             "BadTcpMessageTooLarge",
+}
+
+// IsBad reports whether the code is bad.
+func (s StatusCode) IsBad() bool {
+	return s&0x80000000 != 0
+}
+
+// String returns the name of the code, or its hex value for unknown codes.
+func (s StatusCode) String() string {
+	if name, ok := statusNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("0x%08X", uint32(s))
+}
+
+// Error implements error.
+func (s StatusCode) Error() string {
+	return "opcua: " + s.String()
+}
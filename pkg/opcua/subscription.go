@@ -0,0 +1,416 @@
+package opcua
+
+import (
+	"context"
+	"reflect"
+	"time"
+)
+
+// dataChangeFilterID is the encoding ID of DataChangeFilter. The filter is
+// accepted, but values are always reported when they or their status change.
+const dataChangeFilterID = 724
+
+// subscription sends the changes of its monitored items each publishing
+// interval. All fields are guarded by the mutex of the session.
+type subscription struct {
+	id               uint32
+	interval         time.Duration
+	lifetimeCount    uint32
+	keepAliveCount   uint32
+	maxNotifications uint32
+	enabled          bool
+	items            map[uint32]*monitoredItem
+
+	// seq is the sequence number of the last notification message.
+	seq uint32
+	// keepAlive and lifetime count publishing intervals without a message
+	// and without a Publish request.
+	keepAlive uint32
+	lifetime  uint32
+
+	reset chan time.Duration
+	done  chan struct{}
+}
+
+// monitoredItem samples the value of a node. All fields but the constant
+// ones are guarded by the mutex of the session.
+type monitoredItem struct {
+	id           uint32
+	clientHandle uint32
+	node         *node
+	interval     time.Duration
+	timestamps   int32
+	mode         int32
+	cancel       context.CancelFunc
+
+	// last is the last sampled value, pending the value to report.
+	last    *DataValue
+	pending *DataValue
+}
+
+// revise clamps the requested publishing parameters.
+func (sub *subscription) revise(interval float64, lifetimeCount, keepAliveCount, maxNotifications uint32) {
+	sub.interval = max(time.Duration(interval*float64(time.Millisecond)), minPublishingInterval)
+	sub.keepAliveCount = max(keepAliveCount, 1)
+	// The lifetime must be at least three keep-alive intervals.
+	sub.lifetimeCount = max(lifetimeCount, 3*sub.keepAliveCount)
+	sub.maxNotifications = maxNotifications
+}
+
+// stop stops the publishing cycle and the sampling of the items.
+func (sub *subscription) stop() {
+	close(sub.done)
+	for _, item := range sub.items {
+		item.cancel()
+	}
+}
+
+// createSubscription creates a subscription and starts its publishing cycle.
+func (s *Server) createSubscription(sess *session, req *CreateSubscriptionRequest) response {
+	sub := &subscription{
+		id:      s.nextID(),
+		enabled: req.PublishingEnabled,
+		items:   make(map[uint32]*monitoredItem),
+		reset:   make(chan time.Duration, 1),
+		done:    make(chan struct{}),
+	}
+	sub.revise(req.RequestedPublishingInterval, req.RequestedLifetimeCount, req.RequestedMaxKeepAliveCount, req.MaxNotificationsPerPublish)
+
+	sess.mu.Lock()
+	if sess.closed {
+		sess.mu.Unlock()
+		return fault(BadSessionClosed)
+	}
+	sess.subs[sub.id] = sub
+	sess.mu.Unlock()
+	go sess.run(sub)
+
+	return &CreateSubscriptionResponse{
+		SubscriptionID:            sub.id,
+		RevisedPublishingInterval: float64(sub.interval / time.Millisecond),
+		RevisedLifetimeCount:      sub.lifetimeCount,
+		RevisedMaxKeepAliveCount:  sub.keepAliveCount,
+	}
+}
+
+// modifySubscription changes the publishing parameters of a subscription.
+func (sess *session) modifySubscription(req *ModifySubscriptionRequest) response {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	sub, ok := sess.subs[req.SubscriptionID]
+	if !ok {
+		return fault(BadSubscriptionIDInvalid)
+	}
+	sub.revise(req.RequestedPublishingInterval, req.RequestedLifetimeCount, req.RequestedMaxKeepAliveCount, req.MaxNotificationsPerPublish)
+	// Replace a pending interval which the cycle has not picked up yet.
+	select {
+	case <-sub.reset:
+	default:
+	}
+	sub.reset <- sub.interval
+	return &ModifySubscriptionResponse{
+		RevisedPublishingInterval: float64(sub.interval / time.Millisecond),
+		RevisedLifetimeCount:      sub.lifetimeCount,
+		RevisedMaxKeepAliveCount:  sub.keepAliveCount,
+	}
+}
+
+// setPublishingMode enables or disables sending notifications.
+func (sess *session) setPublishingMode(req *SetPublishingModeRequest) response {
+	if len(req.SubscriptionIDs) == 0 {
+		return fault(BadNothingToDo)
+	}
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	results := make([]StatusCode, len(req.SubscriptionIDs))
+	for i, id := range req.SubscriptionIDs {
+		sub, ok := sess.subs[id]
+		if !ok {
+			results[i] = BadSubscriptionIDInvalid
+			continue
+		}
+		sub.enabled = req.PublishingEnabled
+	}
+	return &SetPublishingModeResponse{Results: results}
+}
+
+// deleteSubscriptions deletes subscriptions and their monitored items.
+func (sess *session) deleteSubscriptions(req *DeleteSubscriptionsRequest) response {
+	if len(req.SubscriptionIDs) == 0 {
+		return fault(BadNothingToDo)
+	}
+	sess.mu.Lock()
+	results := make([]StatusCode, len(req.SubscriptionIDs))
+	for i, id := range req.SubscriptionIDs {
+		sub, ok := sess.subs[id]
+		if !ok {
+			results[i] = BadSubscriptionIDInvalid
+			continue
+		}
+		sub.stop()
+		delete(sess.subs, id)
+	}
+	queue := sess.drainQueue()
+	sess.mu.Unlock()
+
+	for _, p := range queue {
+		p.fail(BadNoSubscription)
+	}
+	return &DeleteSubscriptionsResponse{Results: results}
+}
+
+// drainQueue removes the queued Publish requests once the last subscription
+// is gone, they are answered with BadNoSubscription. sess.mu must be held.
+func (sess *session) drainQueue() []*publishRequest {
+	if len(sess.subs) > 0 {
+		return nil
+	}
+	queue := sess.queue
+	sess.queue = nil
+	return queue
+}
+
+// createMonitoredItems starts sampling the values of nodes.
+func (s *Server) createMonitoredItems(sess *session, req *CreateMonitoredItemsRequest) response {
+	if len(req.ItemsToCreate) == 0 {
+		return fault(BadNothingToDo)
+	}
+	if req.TimestampsToReturn < timestampsSource || req.TimestampsToReturn > timestampsNeither {
+		return fault(BadTimestampsToReturnInvalid)
+	}
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	sub, ok := sess.subs[req.SubscriptionID]
+	if !ok {
+		return fault(BadSubscriptionIDInvalid)
+	}
+
+	results := make([]MonitoredItemCreateResult, len(req.ItemsToCreate))
+	for i, create := range req.ItemsToCreate {
+		rv := create.ItemToMonitor
+		n, ok := s.node(rv.NodeID)
+		switch {
+		case !ok:
+			results[i].StatusCode = BadNodeIDUnknown
+			continue
+		case rv.AttributeID != AttributeValue || n.class != NodeClassVariable:
+			results[i].StatusCode = BadAttributeIDInvalid
+			continue
+		case rv.IndexRange != "":
+			results[i].StatusCode = BadIndexRangeInvalid
+			continue
+		case create.MonitoringMode < monitoringDisabled || create.MonitoringMode > monitoringReporting:
+			results[i].StatusCode = BadOutOfRange
+			continue
+		}
+		if filter := create.RequestedParameters.Filter.TypeID; !filter.IsNull() && filter != NewNumericNodeID(0, dataChangeFilterID) {
+			results[i].StatusCode = BadMonitoredItemFilterUnsupported
+			continue
+		}
+
+		// A negative sampling interval is the publishing interval.
+		interval := sub.interval
+		if requested := create.RequestedParameters.SamplingInterval; requested >= 0 {
+			interval = time.Duration(requested * float64(time.Millisecond))
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		item := &monitoredItem{
+			id:           s.nextID(),
+			clientHandle: create.RequestedParameters.ClientHandle,
+			node:         n,
+			interval:     max(interval, s.minSamplingInterval()),
+			timestamps:   req.TimestampsToReturn,
+			mode:         create.MonitoringMode,
+			cancel:       cancel,
+		}
+		sub.items[item.id] = item
+		if n.robot != nil {
+			go s.sample(ctx, sess, item)
+		} else {
+			// Server variables are sampled once.
+			item.report(withTimestamps(s.attribute(n, AttributeValue), item.timestamps))
+		}
+		results[i] = MonitoredItemCreateResult{
+			MonitoredItemID:         item.id,
+			RevisedSamplingInterval: float64(item.interval / time.Millisecond),
+			// Only the latest value of an item is queued.
+			RevisedQueueSize: 1,
+		}
+	}
+	return &CreateMonitoredItemsResponse{Results: results}
+}
+
+// deleteMonitoredItems stops sampling monitored items.
+func (sess *session) deleteMonitoredItems(req *DeleteMonitoredItemsRequest) response {
+	if len(req.MonitoredItemIDs) == 0 {
+		return fault(BadNothingToDo)
+	}
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	sub, ok := sess.subs[req.SubscriptionID]
+	if !ok {
+		return fault(BadSubscriptionIDInvalid)
+	}
+	results := make([]StatusCode, len(req.MonitoredItemIDs))
+	for i, id := range req.MonitoredItemIDs {
+		item, ok := sub.items[id]
+		if !ok {
+			results[i] = BadMonitoredItemIDInvalid
+			continue
+		}
+		item.cancel()
+		delete(sub.items, id)
+	}
+	return &DeleteMonitoredItemsResponse{Results: results}
+}
+
+// sample polls the variable of a robot node with Robot.Subscribe, so items
+// of the same variable share one poller.
+func (s *Server) sample(ctx context.Context, sess *session, item *monitoredItem) {
+	n := item.node
+	for change := range n.robot.Subscribe(ctx, n.varName, item.interval) {
+		dv := withTimestamps(n.robotValue(change.Value, change.Err, change.Time), item.timestamps)
+		sess.mu.Lock()
+		item.report(dv)
+		sess.mu.Unlock()
+	}
+}
+
+// report queues a sampled value if its value or status changed, which
+// matters for members of STRUC variables whose other members changed.
+// sess.mu must be held.
+func (item *monitoredItem) report(dv DataValue) {
+	if item.last != nil && item.last.Status == dv.Status && reflect.DeepEqual(item.last.Value, dv.Value) {
+		return
+	}
+	item.last = &dv
+	if item.mode == monitoringReporting {
+		item.pending = &dv
+	}
+}
+
+// run runs the publishing cycle of a subscription until it is deleted.
+func (sess *session) run(sub *subscription) {
+	ticker := time.NewTicker(sub.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-sub.done:
+			return
+		case interval := <-sub.reset:
+			ticker.Reset(interval)
+		case <-ticker.C:
+			sess.cycle(sub)
+		}
+	}
+}
+
+// cycle sends the pending notifications of a subscription, or a keep-alive
+// message after keepAliveCount intervals without any, as the response to a
+// queued Publish request. Without Publish requests the subscription expires
+// after lifetimeCount intervals.
+func (sess *session) cycle(sub *subscription) {
+	sess.mu.Lock()
+	if sess.subs[sub.id] != sub {
+		sess.mu.Unlock()
+		return
+	}
+	if len(sess.queue) == 0 {
+		sub.lifetime++
+		if sub.lifetime < sub.lifetimeCount {
+			sess.mu.Unlock()
+			return
+		}
+		sub.stop()
+		delete(sess.subs, sub.id)
+		queue := sess.drainQueue()
+		sess.mu.Unlock()
+		for _, p := range queue {
+			p.fail(BadNoSubscription)
+		}
+		return
+	}
+
+	var notes []MonitoredItemNotification
+	more := false
+	if sub.enabled {
+		for _, id := range sortedIDs(sub.items) {
+			item := sub.items[id]
+			if item.pending == nil {
+				continue
+			}
+			if sub.maxNotifications > 0 && uint32(len(notes)) == sub.maxNotifications {
+				more = true
+				break
+			}
+			notes = append(notes, MonitoredItemNotification{ClientHandle: item.clientHandle, Value: *item.pending})
+			item.pending = nil
+		}
+	}
+	msg := NotificationMessage{PublishTime: time.Now()}
+	if len(notes) > 0 {
+		sub.seq++
+		msg.SequenceNumber = sub.seq
+		msg.NotificationData = []ExtensionObject{NewExtensionObject(&DataChangeNotification{MonitoredItems: notes})}
+	} else {
+		sub.keepAlive++
+		if sub.keepAlive < sub.keepAliveCount {
+			sess.mu.Unlock()
+			return
+		}
+		// Keep-alive messages carry the next sequence number without using it.
+		msg.SequenceNumber = sub.seq + 1
+	}
+	sub.keepAlive = 0
+	p := sess.queue[0]
+	sess.queue = sess.queue[1:]
+	sess.mu.Unlock()
+
+	resp := &PublishResponse{
+		SubscriptionID:      sub.id,
+		MoreNotifications:   more,
+		NotificationMessage: msg,
+		Results:             p.acks,
+	}
+	resp.Timestamp = time.Now()
+	resp.RequestHandle = p.handle
+	body, err := encodeMessage(resp)
+	if err != nil {
+		p.fail(BadEncodingError)
+		return
+	}
+	p.conn.writeMessage("MSG", p.requestID, body)
+}
+
+// publish queues a Publish request, which is answered by the next
+// publishing cycle with notifications or a keep-alive message.
+func (sess *session) publish(c *uaConn, requestID uint32, req *PublishRequest) response {
+	sess.mu.Lock()
+	if len(sess.subs) == 0 {
+		sess.mu.Unlock()
+		return fault(BadNoSubscription)
+	}
+	// Notification messages are not kept for retransmission, so
+	// acknowledging them only checks the subscription.
+	acks := make([]StatusCode, len(req.SubscriptionAcknowledgements))
+	for i, ack := range req.SubscriptionAcknowledgements {
+		if _, ok := sess.subs[ack.SubscriptionID]; !ok {
+			acks[i] = BadSubscriptionIDInvalid
+		}
+	}
+	for _, sub := range sess.subs {
+		sub.lifetime = 0
+	}
+	var dropped *publishRequest
+	if len(sess.queue) == maxPublishRequests {
+		dropped = sess.queue[0]
+		sess.queue = sess.queue[1:]
+	}
+	sess.queue = append(sess.queue, &publishRequest{conn: c, requestID: requestID, handle: req.RequestHandle, acks: acks})
+	sess.mu.Unlock()
+
+	if dropped != nil {
+		dropped.fail(BadTooManyPublishRequests)
+	}
+	return nil
+}
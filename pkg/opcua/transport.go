@@ -0,0 +1,233 @@
+package opcua
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"sync"
+)
+
+// Buffer and message size limits of both sides.
+const (
+	bufferSize     = 65536
+	maxMessageSize = 16 << 20
+	// headerSize is the size of the message header.
+	headerSize = 8
+)
+
+// hello is the body of a HEL message.
+type hello struct {
+	ProtocolVersion   uint32
+	ReceiveBufferSize uint32
+	SendBufferSize    uint32
+	MaxMessageSize    uint32
+	MaxChunkCount     uint32
+	EndpointURL       string
+}
+
+// acknowledge is the body of an ACK message.
+type acknowledge struct {
+	ProtocolVersion   uint32
+	ReceiveBufferSize uint32
+	SendBufferSize    uint32
+	MaxMessageSize    uint32
+	MaxChunkCount     uint32
+}
+
+// transportError is the body of an ERR message.
+type transportError struct {
+	Error  StatusCode
+	Reason string
+}
+
+// asymmetricHeader is the security header of OPN messages.
+type asymmetricHeader struct {
+	SecurityPolicyURI             string
+	SenderCertificate             []byte
+	ReceiverCertificateThumbprint []byte
+}
+
+// message is a complete UA Secure Conversation message.
+type message struct {
+	// typ is OPN, MSG or CLO.
+	typ       string
+	channelID uint32
+	requestID uint32
+	body      []byte
+}
+
+// uaConn is a UA TCP connection carrying a secure channel with the
+// security policy None: messages are neither signed nor encrypted.
+type uaConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+
+	// wmu serializes writes, responses are sent from several goroutines.
+	wmu sync.Mutex
+	// channelID and tokenID identify the secure channel once it is open.
+	channelID uint32
+	tokenID   uint32
+	seq       uint32
+	// chunkSize is the receive buffer size of the peer.
+	chunkSize uint32
+}
+
+func newUAConn(conn net.Conn) *uaConn {
+	return &uaConn{conn: conn, r: bufio.NewReaderSize(conn, bufferSize), chunkSize: bufferSize}
+}
+
+// readChunk reads one chunk and returns its message type, chunk type and
+// the body after the message header.
+func (c *uaConn) readChunk() (string, byte, []byte, error) {
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(c.r, header); err != nil {
+		return "", 0, nil, err
+	}
+	size := binary.LittleEndian.Uint32(header[4:])
+	if size < headerSize || size > bufferSize {
+		return "", 0, nil, BadTCPMessageTooLarge
+	}
+	body := make([]byte, size-headerSize)
+	if _, err := io.ReadFull(c.r, body); err != nil {
+		return "", 0, nil, err
+	}
+	return string(header[:3]), header[3], body, nil
+}
+
+// readMessage reads the chunks of the next message and assembles it.
+func (c *uaConn) readMessage() (*message, error) {
+	var msg *message
+	for {
+		typ, chunk, body, err := c.readChunk()
+		if err != nil {
+			return nil, err
+		}
+		switch typ {
+		case "OPN", "MSG", "CLO":
+		case "ERR":
+			var e transportError
+			if err := decode(body, &e); err != nil {
+				return nil, err
+			}
+			return nil, fmt.Errorf("%v: %s", e.Error, e.Reason)
+		default:
+			return nil, BadTCPMessageTypeInvalid
+		}
+
+		d := &decoder{b: body}
+		channelID := d.uint32()
+		if typ == "OPN" {
+			var h asymmetricHeader
+			d.value(reflect.ValueOf(&h))
+			if d.err == nil && h.SecurityPolicyURI != securityPolicyNone {
+				return nil, BadSecurityPolicyRejected
+			}
+		} else {
+			// The token ID of the symmetric security header.
+			d.uint32()
+		}
+		// The sequence header.
+		d.uint32()
+		requestID := d.uint32()
+		if d.err != nil {
+			return nil, d.err
+		}
+
+		if msg == nil {
+			msg = &message{typ: typ, channelID: channelID, requestID: requestID}
+		}
+		msg.body = append(msg.body, d.b...)
+		if len(msg.body) > maxMessageSize {
+			return nil, BadTCPMessageTooLarge
+		}
+		switch chunk {
+		case 'F':
+			return msg, nil
+		case 'A':
+			// The sender aborted the message.
+			msg = nil
+		}
+	}
+}
+
+// writeMessage sends a message, split into chunks that fit the receive
+// buffer of the peer.
+func (c *uaConn) writeMessage(typ string, requestID uint32, body []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	var security []byte
+	if typ == "OPN" {
+		e := &encoder{}
+		e.value(reflect.ValueOf(&asymmetricHeader{SecurityPolicyURI: securityPolicyNone}))
+		security = e.b
+	} else {
+		security = binary.LittleEndian.AppendUint32(nil, c.tokenID)
+	}
+	limit := int(c.chunkSize) - headerSize - 4 - len(security) - 8
+	if limit <= 0 {
+		return BadTCPMessageTooLarge
+	}
+
+	for {
+		part := body
+		chunk := byte('F')
+		if len(part) > limit {
+			part, chunk = body[:limit], 'C'
+		}
+		body = body[len(part):]
+		c.seq++
+
+		e := &encoder{b: make([]byte, 0, headerSize+4+len(security)+8+len(part))}
+		e.b = append(e.b, typ...)
+		e.uint8(chunk)
+		e.uint32(uint32(headerSize + 4 + len(security) + 8 + len(part)))
+		e.uint32(c.channelID)
+		e.b = append(e.b, security...)
+		e.uint32(c.seq)
+		e.uint32(requestID)
+		e.b = append(e.b, part...)
+		if _, err := c.conn.Write(e.b); err != nil {
+			return err
+		}
+		if chunk == 'F' {
+			return nil
+		}
+	}
+}
+
+// writeRaw sends a HEL, ACK or ERR message.
+func (c *uaConn) writeRaw(typ string, v any) error {
+	body, err := encode(v)
+	if err != nil {
+		return err
+	}
+	e := &encoder{}
+	e.b = append(e.b, typ...)
+	e.uint8('F')
+	e.uint32(uint32(headerSize + len(body)))
+	e.b = append(e.b, body...)
+
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	_, err = c.conn.Write(e.b)
+	return err
+}
+
+// sendError sends an ERR message before the connection is closed.
+func (c *uaConn) sendError(err error) {
+	code := BadUnexpectedError
+	if !errors.As(err, &code) {
+		code = BadCommunicationError
+	}
+	c.writeRaw("ERR", &transportError{Error: code, Reason: err.Error()})
+}
+
+// Close closes the connection.
+func (c *uaConn) Close() error {
+	return c.conn.Close()
+}
@@ -0,0 +1,531 @@
+package opcua
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// IDType is the type of the identifier of a NodeID.
+type IDType uint8
+
+// NodeID identifier types.
+const (
+	NumericID IDType = iota
+	StringID
+	GUIDID
+	OpaqueID
+)
+
+// NodeID identifies a node. NodeIDs are comparable and used as map keys.
+type NodeID struct {
+	Namespace uint16
+	Type      IDType
+	// Numeric is the identifier of numeric NodeIDs.
+	Numeric uint32
+	// Text is the identifier of string NodeIDs, or the raw bytes of GUID
+	// and opaque NodeIDs.
+	Text string
+}
+
+// NewNumericNodeID creates a numeric NodeID.
+func NewNumericNodeID(ns uint16, id uint32) NodeID {
+	return NodeID{Namespace: ns, Type: NumericID, Numeric: id}
+}
+
+// NewStringNodeID creates a string NodeID.
+func NewStringNodeID(ns uint16, id string) NodeID {
+	return NodeID{Namespace: ns, Type: StringID, Text: id}
+}
+
+// IsNull reports whether n is the null NodeID i=0.
+func (n NodeID) IsNull() bool {
+	return n == NodeID{}
+}
+
+// String formats n in the standard notation, e.g. "i=85" or "ns=1;s=cell1/$OV_PRO".
+func (n NodeID) String() string {
+	var b strings.Builder
+	if n.Namespace != 0 {
+		fmt.Fprintf(&b, "ns=%d;", n.Namespace)
+	}
+	switch n.Type {
+	case NumericID:
+		fmt.Fprintf(&b, "i=%d", n.Numeric)
+	case StringID:
+		b.WriteString("s=" + n.Text)
+	case GUIDID:
+		fmt.Fprintf(&b, "g=%x", n.Text)
+	default:
+		fmt.Fprintf(&b, "b=%x", n.Text)
+	}
+	return b.String()
+}
+
+// ParseNodeID parses a numeric or string NodeID in the standard notation,
+// e.g. "i=2253" or "ns=1;s=cell1/$OV_PRO".
+func ParseNodeID(s string) (NodeID, error) {
+	var n NodeID
+	rest := s
+	if strings.HasPrefix(rest, "ns=") {
+		i := strings.IndexByte(rest, ';')
+		if i < 0 {
+			return NodeID{}, fmt.Errorf("invalid node id %q", s)
+		}
+		ns, err := strconv.ParseUint(rest[3:i], 10, 16)
+		if err != nil {
+			return NodeID{}, fmt.Errorf("invalid node id %q: %v", s, err)
+		}
+		n.Namespace = uint16(ns)
+		rest = rest[i+1:]
+	}
+	switch {
+	case strings.HasPrefix(rest, "i="):
+		id, err := strconv.ParseUint(rest[2:], 10, 32)
+		if err != nil {
+			return NodeID{}, fmt.Errorf("invalid node id %q: %v", s, err)
+		}
+		n.Type, n.Numeric = NumericID, uint32(id)
+	case strings.HasPrefix(rest, "s="):
+		n.Type, n.Text = StringID, rest[2:]
+	default:
+		return NodeID{}, fmt.Errorf("invalid node id %q", s)
+	}
+	return n, nil
+}
+
+// encode writes the most compact encoding of n.
+func (n NodeID) encode(e *encoder) {
+	n.encodeWithFlags(e, 0)
+}
+
+// encodeWithFlags writes n with the ExpandedNodeId flags in the encoding byte.
+func (n NodeID) encodeWithFlags(e *encoder, flags uint8) {
+	switch n.Type {
+	case NumericID:
+		switch {
+		case n.Namespace == 0 && n.Numeric <= 0xff:
+			e.uint8(0x00 | flags)
+			e.uint8(uint8(n.Numeric))
+		case n.Namespace <= 0xff && n.Numeric <= 0xffff:
+			e.uint8(0x01 | flags)
+			e.uint8(uint8(n.Namespace))
+			e.uint16(uint16(n.Numeric))
+		default:
+			e.uint8(0x02 | flags)
+			e.uint16(n.Namespace)
+			e.uint32(n.Numeric)
+		}
+	case StringID:
+		e.uint8(0x03 | flags)
+		e.uint16(n.Namespace)
+		e.string(n.Text)
+	case GUIDID:
+		e.uint8(0x04 | flags)
+		e.uint16(n.Namespace)
+		e.b = append(e.b, n.Text...)
+	default:
+		e.uint8(0x05 | flags)
+		e.uint16(n.Namespace)
+		e.byteString([]byte(n.Text))
+	}
+}
+
+func (n *NodeID) decode(d *decoder) {
+	n.decodeWithFlags(d, d.uint8())
+}
+
+// decodeWithFlags reads n after its encoding byte, ignoring the ExpandedNodeId flags.
+func (n *NodeID) decodeWithFlags(d *decoder, mask uint8) {
+	*n = NodeID{}
+	switch mask & 0x0f {
+	case 0x00:
+		n.Numeric = uint32(d.uint8())
+	case 0x01:
+		n.Namespace = uint16(d.uint8())
+		n.Numeric = uint32(d.uint16())
+	case 0x02:
+		n.Namespace = d.uint16()
+		n.Numeric = d.uint32()
+	case 0x03:
+		n.Namespace = d.uint16()
+		n.Type, n.Text = StringID, d.string()
+	case 0x04:
+		n.Namespace = d.uint16()
+		n.Type, n.Text = GUIDID, string(d.next(16))
+	case 0x05:
+		n.Namespace = d.uint16()
+		n.Type, n.Text = OpaqueID, string(d.byteString())
+	default:
+		if d.err == nil {
+			d.err = fmt.Errorf("opcua: invalid node id encoding 0x%02x", mask)
+		}
+	}
+}
+
+// ExpandedNodeID is a NodeID that may refer to another server.
+type ExpandedNodeID struct {
+	NodeID       NodeID
+	NamespaceURI string
+	ServerIndex  uint32
+}
+
+func (n ExpandedNodeID) encode(e *encoder) {
+	var flags uint8
+	if n.NamespaceURI != "" {
+		flags |= 0x80
+	}
+	if n.ServerIndex != 0 {
+		flags |= 0x40
+	}
+	n.NodeID.encodeWithFlags(e, flags)
+	if n.NamespaceURI != "" {
+		e.string(n.NamespaceURI)
+	}
+	if n.ServerIndex != 0 {
+		e.uint32(n.ServerIndex)
+	}
+}
+
+func (n *ExpandedNodeID) decode(d *decoder) {
+	mask := d.uint8()
+	n.NodeID.decodeWithFlags(d, mask)
+	n.NamespaceURI, n.ServerIndex = "", 0
+	if mask&0x80 != 0 {
+		n.NamespaceURI = d.string()
+	}
+	if mask&0x40 != 0 {
+		n.ServerIndex = d.uint32()
+	}
+}
+
+// QualifiedName is a name qualified by a namespace, used as browse name.
+type QualifiedName struct {
+	NamespaceIndex uint16
+	Name           string
+}
+
+// LocalizedText is a human readable text with an optional locale.
+type LocalizedText struct {
+	Locale string
+	Text   string
+}
+
+func (t LocalizedText) encode(e *encoder) {
+	var mask uint8
+	if t.Locale != "" {
+		mask |= 0x01
+	}
+	if t.Text != "" {
+		mask |= 0x02
+	}
+	e.uint8(mask)
+	if t.Locale != "" {
+		e.string(t.Locale)
+	}
+	if t.Text != "" {
+		e.string(t.Text)
+	}
+}
+
+func (t *LocalizedText) decode(d *decoder) {
+	mask := d.uint8()
+	*t = LocalizedText{}
+	if mask&0x01 != 0 {
+		t.Locale = d.string()
+	}
+	if mask&0x02 != 0 {
+		t.Text = d.string()
+	}
+}
+
+// DiagnosticInfo is vendor specific diagnostic information. The server never
+// returns any, received ones are skipped.
+type DiagnosticInfo struct{}
+
+func (DiagnosticInfo) encode(e *encoder) {
+	e.uint8(0)
+}
+
+func (*DiagnosticInfo) decode(d *decoder) {
+	mask := d.uint8()
+	// SymbolicId, NamespaceUri, Locale and LocalizedText are Int32.
+	for _, bit := range []uint8{0x01, 0x02, 0x08, 0x04} {
+		if mask&bit != 0 {
+			d.int32()
+		}
+	}
+	if mask&0x10 != 0 {
+		d.string()
+	}
+	if mask&0x20 != 0 {
+		d.uint32()
+	}
+	if mask&0x40 != 0 {
+		var inner DiagnosticInfo
+		inner.decode(d)
+	}
+}
+
+// ExtensionObject is a structure encoded with its type. Value holds a
+// pointer to a known structure, Body the encoding of unknown ones.
+type ExtensionObject struct {
+	TypeID NodeID
+	Value  any
+	Body   []byte
+}
+
+// NewExtensionObject wraps a known structure, e.g. &AnonymousIdentityToken{}.
+func NewExtensionObject(v any) ExtensionObject {
+	return ExtensionObject{Value: v}
+}
+
+func (o ExtensionObject) encode(e *encoder) {
+	if o.Value != nil {
+		id, ok := encodingIDs[reflect.Indirect(reflect.ValueOf(o.Value)).Type()]
+		if !ok {
+			e.err = fmt.Errorf("opcua: no encoding for %T", o.Value)
+			return
+		}
+		body, err := encode(o.Value)
+		if err != nil {
+			e.err = err
+			return
+		}
+		NewNumericNodeID(0, id).encode(e)
+		e.uint8(0x01)
+		e.byteString(body)
+		return
+	}
+	o.TypeID.encode(e)
+	if o.Body == nil {
+		e.uint8(0x00)
+		return
+	}
+	e.uint8(0x01)
+	e.byteString(o.Body)
+}
+
+func (o *ExtensionObject) decode(d *decoder) {
+	*o = ExtensionObject{}
+	o.TypeID.decode(d)
+	switch d.uint8() {
+	case 0x00:
+		return
+	case 0x01, 0x02:
+		o.Body = d.byteString()
+	default:
+		if d.err == nil {
+			d.err = fmt.Errorf("opcua: invalid extension object encoding")
+		}
+		return
+	}
+	if t, ok := encodingTypes[o.TypeID]; ok && d.err == nil {
+		v := reflect.New(t)
+		if err := decode(o.Body, v.Interface()); err == nil {
+			o.Value = v.Interface()
+		}
+	}
+}
+
+// Built-in type IDs of Variant values.
+const (
+	typeBoolean         = 1
+	typeSByte           = 2
+	typeByte            = 3
+	typeInt16           = 4
+	typeUInt16          = 5
+	typeInt32           = 6
+	typeUInt32          = 7
+	typeInt64           = 8
+	typeUInt64          = 9
+	typeFloat           = 10
+	typeDouble          = 11
+	typeString          = 12
+	typeDateTime        = 13
+	typeByteString      = 15
+	typeNodeID          = 17
+	typeExpandedNodeID  = 18
+	typeStatusCode      = 19
+	typeQualifiedName   = 20
+	typeLocalizedText   = 21
+	typeExtensionObject = 22
+	typeDataValue       = 23
+	typeVariant         = 24
+)
+
+// variantTypes maps the Go types of Variant values to built-in type IDs.
+var variantTypes = map[reflect.Type]uint8{
+	reflect.TypeOf(false):             typeBoolean,
+	reflect.TypeOf(int8(0)):           typeSByte,
+	reflect.TypeOf(uint8(0)):          typeByte,
+	reflect.TypeOf(int16(0)):          typeInt16,
+	reflect.TypeOf(uint16(0)):         typeUInt16,
+	reflect.TypeOf(int32(0)):          typeInt32,
+	reflect.TypeOf(uint32(0)):         typeUInt32,
+	reflect.TypeOf(int64(0)):          typeInt64,
+	reflect.TypeOf(uint64(0)):         typeUInt64,
+	reflect.TypeOf(float32(0)):        typeFloat,
+	reflect.TypeOf(float64(0)):        typeDouble,
+	reflect.TypeOf(""):                typeString,
+	timeType:                          typeDateTime,
+	reflect.TypeOf([]byte(nil)):       typeByteString,
+	reflect.TypeOf(NodeID{}):          typeNodeID,
+	reflect.TypeOf(ExpandedNodeID{}):  typeExpandedNodeID,
+	reflect.TypeOf(StatusCode(0)):     typeStatusCode,
+	reflect.TypeOf(QualifiedName{}):   typeQualifiedName,
+	reflect.TypeOf(LocalizedText{}):   typeLocalizedText,
+	reflect.TypeOf(ExtensionObject{}): typeExtensionObject,
+	reflect.TypeOf(DataValue{}):       typeDataValue,
+	reflect.TypeOf(Variant{}):         typeVariant,
+}
+
+// variantGoTypes is the inverse of variantTypes.
+var variantGoTypes = func() map[uint8]reflect.Type {
+	m := make(map[uint8]reflect.Type, len(variantTypes))
+	for t, id := range variantTypes {
+		m[id] = t
+	}
+	return m
+}()
+
+// Variant holds a value of any built-in type: bool, the sized integer
+// types, float32, float64, string, time.Time, []byte, NodeID,
+// ExpandedNodeID, StatusCode, QualifiedName, LocalizedText,
+// ExtensionObject, DataValue, or a slice of one of them. A nil Value is
+// the null Variant.
+type Variant struct {
+	Value any
+}
+
+// typeID returns the built-in type ID of the value and whether it is an array.
+func (v Variant) typeID() (uint8, bool, error) {
+	t := reflect.TypeOf(v.Value)
+	if id, ok := variantTypes[t]; ok {
+		return id, false, nil
+	}
+	if t.Kind() == reflect.Slice {
+		if id, ok := variantTypes[t.Elem()]; ok {
+			return id, true, nil
+		}
+	}
+	return 0, false, fmt.Errorf("opcua: unsupported variant type %s", t)
+}
+
+func (v Variant) encode(e *encoder) {
+	if v.Value == nil {
+		e.uint8(0)
+		return
+	}
+	id, array, err := v.typeID()
+	if err != nil {
+		e.err = err
+		return
+	}
+	if !array {
+		e.uint8(id)
+		e.value(reflect.ValueOf(v.Value))
+		return
+	}
+	e.uint8(id | 0x80)
+	s := reflect.ValueOf(v.Value)
+	e.int32(int32(s.Len()))
+	for i := 0; i < s.Len(); i++ {
+		e.value(s.Index(i))
+	}
+}
+
+func (v *Variant) decode(d *decoder) {
+	mask := d.uint8()
+	v.Value = nil
+	if mask == 0 || d.err != nil {
+		return
+	}
+	t, ok := variantGoTypes[mask&0x3f]
+	if !ok {
+		d.err = fmt.Errorf("opcua: unsupported variant type %d", mask&0x3f)
+		return
+	}
+	if mask&0x80 == 0 {
+		value := reflect.New(t)
+		d.value(value.Elem())
+		v.Value = value.Elem().Interface()
+		return
+	}
+	n := d.arrayLength()
+	if n < 0 {
+		n = 0
+	}
+	s := reflect.MakeSlice(reflect.SliceOf(t), n, n)
+	for i := 0; i < n && d.err == nil; i++ {
+		d.value(s.Index(i))
+	}
+	v.Value = s.Interface()
+	if mask&0x40 != 0 {
+		// Multi-dimensional arrays are returned flattened.
+		var dims []int32
+		d.value(reflect.ValueOf(&dims).Elem())
+	}
+}
+
+// DataValue is a value with its status and timestamps.
+type DataValue struct {
+	Value           Variant
+	Status          StatusCode
+	SourceTimestamp time.Time
+	ServerTimestamp time.Time
+}
+
+func (v DataValue) encode(e *encoder) {
+	var mask uint8
+	if v.Value.Value != nil {
+		mask |= 0x01
+	}
+	if v.Status != Good {
+		mask |= 0x02
+	}
+	if !v.SourceTimestamp.IsZero() {
+		mask |= 0x04
+	}
+	if !v.ServerTimestamp.IsZero() {
+		mask |= 0x08
+	}
+	e.uint8(mask)
+	if mask&0x01 != 0 {
+		v.Value.encode(e)
+	}
+	if mask&0x02 != 0 {
+		e.uint32(uint32(v.Status))
+	}
+	if mask&0x04 != 0 {
+		e.dateTime(v.SourceTimestamp)
+	}
+	if mask&0x08 != 0 {
+		e.dateTime(v.ServerTimestamp)
+	}
+}
+
+func (v *DataValue) decode(d *decoder) {
+	mask := d.uint8()
+	*v = DataValue{}
+	if mask&0x01 != 0 {
+		v.Value.decode(d)
+	}
+	if mask&0x02 != 0 {
+		v.Status = StatusCode(d.uint32())
+	}
+	if mask&0x04 != 0 {
+		v.SourceTimestamp = d.dateTime()
+	}
+	if mask&0x10 != 0 {
+		d.uint16()
+	}
+	if mask&0x08 != 0 {
+		v.ServerTimestamp = d.dateTime()
+	}
+	if mask&0x20 != 0 {
+		d.uint16()
+	}
+}
@@ -0,0 +1,162 @@
+package openshowvar
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// Operation modes used in the fifth byte of every OpenShowVar message.
+const (
+	ModeRead  byte = 0
+	ModeWrite byte = 1
+)
+
+// modeName returns the name of a mode as used in logs, metrics and traces.
+func modeName(mode byte) string {
+	if mode == ModeWrite {
+		return "write"
+	}
+	return "read"
+}
+
+// EncodeRequest builds a KukaVarProxy request frame.
+//
+// Parameters:
+// - msgID: The message ID placed in the header.
+// - varname: The name of the variable.
+// - val: The value to write (leave empty to read).
+//
+// Returns: The encoded frame or an error if a field does not fit into the message format.
+func EncodeRequest(msgID uint16, varname string, val string) ([]byte, error) {
+	if len(varname) > math.MaxUint16 {
+		return nil, errors.New("variable name too long")
+	}
+	if len(val) > math.MaxUint16 {
+		return nil, errors.New("value too long")
+	}
+
+	// Mode byte and variable name.
+	msg := make([]byte, 0, 5+len(varname)+len(val))
+	if val != "" {
+		msg = append(msg, ModeWrite)
+	} else {
+		msg = append(msg, ModeRead)
+	}
+	msg = binary.BigEndian.AppendUint16(msg, uint16(len(varname)))
+	msg = append(msg, varname...)
+
+	// Value, only present for write operations.
+	if val != "" {
+		msg = binary.BigEndian.AppendUint16(msg, uint16(len(val)))
+		msg = append(msg, val...)
+	}
+
+	if len(msg) > math.MaxUint16 {
+		return nil, errors.New("message too long")
+	}
+
+	// Message ID followed by the message length.
+	frame := make([]byte, 4, 4+len(msg))
+	binary.BigEndian.PutUint16(frame[0:2], msgID)
+	binary.BigEndian.PutUint16(frame[2:4], uint16(len(msg)))
+	return append(frame, msg...), nil
+}
+
+// DecodeRequest parses a KukaVarProxy request frame as produced by EncodeRequest.
+//
+// Parameters:
+// - frame: The complete request frame.
+//
+// Returns: The message ID, variable name and value (empty for reads) or an error.
+func DecodeRequest(frame []byte) (msgID uint16, varname string, val string, err error) {
+	if len(frame) < 7 {
+		return 0, "", "", errors.New("invalid request length")
+	}
+	msgID = binary.BigEndian.Uint16(frame[0:2])
+	if int(binary.BigEndian.Uint16(frame[2:4])) != len(frame)-4 {
+		return 0, "", "", errors.New("request length does not match header")
+	}
+
+	mode := frame[4]
+	nameLen := int(binary.BigEndian.Uint16(frame[5:7]))
+	if len(frame) < 7+nameLen {
+		return 0, "", "", errors.New("request length does not match variable name length")
+	}
+	varname = string(frame[7 : 7+nameLen])
+	rest := frame[7+nameLen:]
+
+	switch mode {
+	case ModeRead:
+		if len(rest) != 0 {
+			return 0, "", "", errors.New("unexpected data in read request")
+		}
+	case ModeWrite:
+		if len(rest) < 2 {
+			return 0, "", "", errors.New("missing value in write request")
+		}
+		valLen := int(binary.BigEndian.Uint16(rest[0:2]))
+		if len(rest) != 2+valLen {
+			return 0, "", "", errors.New("request length does not match value length")
+		}
+		val = string(rest[2:])
+		if val == "" {
+			return 0, "", "", errors.New("empty value in write request")
+		}
+	default:
+		return 0, "", "", errors.New("unknown request mode")
+	}
+
+	return msgID, varname, val, nil
+}
+
+// EncodeResponse builds a KukaVarProxy response frame.
+//
+// Parameters:
+// - msgID: The message ID of the request being answered.
+// - mode: ModeRead or ModeWrite, echoed from the request.
+// - val: The value of the variable.
+// - ok: Whether the operation succeeded.
+//
+// Returns: The encoded frame or an error if the value does not fit into the message format.
+func EncodeResponse(msgID uint16, mode byte, val string, ok bool) ([]byte, error) {
+	if len(val) > math.MaxUint16-6 {
+		return nil, errors.New("value too long")
+	}
+
+	frame := make([]byte, 0, 10+len(val))
+	frame = binary.BigEndian.AppendUint16(frame, msgID)
+	frame = binary.BigEndian.AppendUint16(frame, uint16(6+len(val)))
+	frame = append(frame, mode)
+	frame = binary.BigEndian.AppendUint16(frame, uint16(len(val)))
+	frame = append(frame, val...)
+
+	// Trailing status bytes, the last one signals success.
+	if ok {
+		frame = append(frame, 0, 1, 1)
+	} else {
+		frame = append(frame, 0, 1, 0)
+	}
+	return frame, nil
+}
+
+// DecodeResponse extracts the variable value from a KukaVarProxy response frame.
+//
+// Parameters:
+// - response: The response frame received from the server.
+//
+// Returns: The value of the variable as a string or an error.
+func DecodeResponse(response []byte) (string, error) {
+	// Ensure the response has a valid length.
+	if len(response) < 7 {
+		return "", errors.New("invalid response length")
+	}
+
+	// Extract the length of the variable value.
+	valLen := int(binary.BigEndian.Uint16(response[5:7]))
+	if len(response) < 7+valLen {
+		return "", errors.New("response length does not match value length")
+	}
+
+	return string(response[7 : 7+valLen]), nil
+}
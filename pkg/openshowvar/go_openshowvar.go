@@ -1,18 +1,61 @@
 package openshowvar
 
 import (
+	"context"
+	"crypto/tls"
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"net"
 	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
-// OpenShowVar struct is used to connect to a robot control system and read/write variable values over a TCP connection.
+// ErrVariableNotFound is returned when KukaVarProxy reports a failure, e.g.
+// for a variable that does not exist.
+var ErrVariableNotFound = errors.New("variable not found in response")
+
+// OpenShowVar struct is used to connect to a robot control system and read/write variable values over a TCP connection
+// or any other transport provided by a Dialer. Requests may be sent from several goroutines, they are serialized on the connection.
 type OpenShowVar struct {
 	TCP_IP   string
 	TCP_PORT int
 	Conn     net.Conn
+	// Dialer opens the connection, nil means TCP to TCP_IP:TCP_PORT.
+	Dialer Dialer
+	// TLSConfig enables TLS on top of the connection when set.
+	TLSConfig *tls.Config
+	// Interceptors wrap every request sent through Send, outermost first.
+	Interceptors []Interceptor
+	// Logger receives connection and request logs when set.
+	Logger *slog.Logger
+	// RedactedVars lists variable name patterns whose values are not logged.
+	RedactedVars []string
+	// Metrics records request and connection statistics when set.
+	Metrics *Metrics
+	// Tracer creates OpenTelemetry spans when set.
+	Tracer trace.Tracer
+	// SessionRecorder records every request and response frame when set.
+	SessionRecorder *SessionRecorder
+
+	connectedBefore bool
+	// broken is set when an interrupted request closed Conn.
+	broken bool
+	// connMu guards Conn and broken, ioMu serializes request/response exchanges on it.
+	connMu sync.Mutex
+	ioMu   sync.Mutex
+	// subs holds the shared pollers of Subscribe, keyed by variable name.
+	subsMu sync.Mutex
+	subs   map[string]*subscription
+
+	nextMsgID atomic.Uint32
 }
 
 // NewOpenShowVar creates a new instance of OpenShowVar.
@@ -20,29 +63,82 @@ type OpenShowVar struct {
 // Parameters:
 // - TCP_IP: IP address of the TCP server to connect to.
 // - TCP_PORT: Port number of the TCP server to connect to.
+// - opts: Optional settings such as WithDialer, WithTLSConfig, WithInterceptors, WithLogger, WithMetrics, WithTracerProvider or WithSessionRecorder.
 //
 // Returns: A new instance of OpenShowVar.
-func NewOpenShowVar(TCP_IP string, TCP_PORT int) *OpenShowVar {
-	return &OpenShowVar{
+func NewOpenShowVar(TCP_IP string, TCP_PORT int, opts ...Option) *OpenShowVar {
+	osv := &OpenShowVar{
 		TCP_IP:   TCP_IP,
 		TCP_PORT: TCP_PORT,
 	}
+	for _, opt := range opts {
+		opt(osv)
+	}
+	return osv
 }
 
-// Connect establishes a TCP connection to the server.
+// Connect establishes a connection to the server using the configured Dialer.
 //
 // Returns: nil if the connection is successful, otherwise an error.
 func (osv *OpenShowVar) Connect() error {
-	// Establish a TCP connection
-	conn, err := net.Dial("tcp", osv.TCP_IP+":"+strconv.Itoa(osv.TCP_PORT))
+	return osv.ConnectContext(context.Background())
+}
+
+// ConnectContext establishes a connection to the server, giving up when ctx is done.
+//
+// Parameters:
+// - ctx: Context bounding the connection attempt.
+//
+// Returns: nil if the connection is successful, otherwise an error.
+func (osv *OpenShowVar) ConnectContext(ctx context.Context) error {
+	ctx, span := osv.startSpan(ctx, "openshowvar.Connect")
+
+	// Fall back to TCP when no dialer is configured.
+	dialer := osv.Dialer
+	if dialer == nil {
+		dialer = TCPDialer{Address: osv.endpoint()}
+	}
+
+	// Wrap the connection in TLS if requested.
+	if osv.TLSConfig != nil {
+		config := osv.TLSConfig
+		if config.ServerName == "" && !config.InsecureSkipVerify {
+			config = config.Clone()
+			config.ServerName = osv.TCP_IP
+		}
+		dialer = TLSDialer{Dialer: dialer, Config: config}
+	}
+
+	// Establish the connection
+	conn, err := dialer.DialContext(ctx)
 	if err != nil {
+		if osv.Logger != nil {
+			osv.Logger.LogAttrs(ctx, slog.LevelWarn, "connect failed", slog.String("error", err.Error()))
+		}
+		endSpan(span, err)
 		return fmt.Errorf("connection error: %v", err)
 	}
+	endSpan(span, nil)
+	if osv.Logger != nil {
+		osv.Logger.LogAttrs(ctx, slog.LevelInfo, "connected", slog.String("remote", conn.RemoteAddr().String()))
+	}
+	if osv.Metrics != nil {
+		osv.Metrics.observeConnect(osv.endpoint(), osv.connectedBefore)
+	}
+	osv.connectedBefore = true
 	// Save the connection
+	osv.connMu.Lock()
 	osv.Conn = conn
+	osv.broken = false
+	osv.connMu.Unlock()
 	return nil
 }
 
+// endpoint returns the configured server address in host:port form.
+func (osv *OpenShowVar) endpoint() string {
+	return net.JoinHostPort(osv.TCP_IP, strconv.Itoa(osv.TCP_PORT))
+}
+
 // Send sends a request to read/write a variable value.
 //
 // Parameters:
@@ -51,69 +147,137 @@ func (osv *OpenShowVar) Connect() error {
 //
 // Returns: The response from the server or an error.
 func (osv *OpenShowVar) Send(varname string, val string) ([]byte, error) {
-	var msg []byte
-	temp := make([]byte, 0)
+	return osv.SendContext(context.Background(), varname, val)
+}
 
-	// If value is provided, prepare the message for writing.
+// SendContext sends a request to read/write a variable value through the interceptor chain.
+//
+// Parameters:
+// - ctx: Context bounding the request, its deadline is applied to the connection.
+// - varname: The name of the variable.
+// - val: The value to write (leave empty to read).
+//
+// Returns: The response from the server or an error.
+func (osv *OpenShowVar) SendContext(ctx context.Context, varname string, val string) ([]byte, error) {
+	req := Request{
+		MsgID:   uint16(osv.nextMsgID.Add(1)),
+		Mode:    ModeRead,
+		VarName: varname,
+		Value:   val,
+	}
 	if val != "" {
-		valLen := len(val)
-		msg = append(msg, byte((valLen&0xff00)>>8)) // MSB of value length
-		msg = append(msg, byte(valLen&0x00ff))      // LSB of value length
-		msg = append(msg, []byte(val)...)           // Value in ASCII
+		req.Mode = ModeWrite
 	}
 
-	// Prepare the message with the variable name.
-	if len(varname) > 0 {
-		varNameLen := len(varname)
-		temp = append(temp, byte(varNameLen>>8))     // MSB of variable name length
-		temp = append(temp, byte(varNameLen&0x00ff)) // LSB of variable name length
-		temp = append(temp, []byte(varname)...)      // Variable name in ASCII
+	// Trace the request as a Read or Write span.
+	spanName := "openshowvar.Read"
+	if req.Mode == ModeWrite {
+		spanName = "openshowvar.Write"
 	}
+	ctx, span := osv.startSpan(ctx, spanName,
+		attribute.String("openshowvar.var", varname),
+		attribute.String("openshowvar.mode", modeName(req.Mode)),
+		attribute.Int("openshowvar.msg_id", int(req.MsgID)),
+	)
 
-	// Determine if the operation is a read or write.
-	if val != "" {
-		temp = append([]byte{1}, temp...) // Write operation
-	} else {
-		temp = append([]byte{0}, temp...) // Read operation
+	resp, err := chain(osv.Interceptors, osv.roundTrip)(ctx, req)
+	if err != nil {
+		endSpan(span, err)
+		return nil, err
 	}
 
-	// Combine variable name and value parts into final message.
-	msg = append(temp, msg...)
+	// Interceptors answering on their own may only provide the value.
+	if resp.Frame == nil {
+		resp.Frame, err = EncodeResponse(req.MsgID, req.Mode, resp.Value, true)
+	}
+	endSpan(span, err, attribute.Int("openshowvar.response_size", len(resp.Frame)))
+	return resp.Frame, err
+}
 
-	// Create the message header.
-	var msgLen uint16 = uint16(len(msg))
-	header := make([]byte, 4)
+// roundTrip writes a request to the connection and reads the response.
+// It is the innermost handler of the interceptor chain.
+func (osv *OpenShowVar) roundTrip(ctx context.Context, req Request) (resp Response, err error) {
+	start := time.Now()
+	var sent, received int
+	var request, response []byte
+	defer func() {
+		latency := time.Since(start)
+		osv.logRequest(ctx, req, resp.Value, latency, err)
+		if osv.Metrics != nil {
+			osv.Metrics.observeRequest(osv.endpoint(), req.Mode, latency, sent, received, err)
+		}
+		if osv.SessionRecorder != nil && sent > 0 {
+			entry := SessionEntry{Time: start, Latency: latency, Request: request, Response: response}
+			if err != nil {
+				entry.Err = err.Error()
+			}
+			if osv.redacted(req.VarName) {
+				entry = redactEntry(req, entry)
+			}
+			osv.SessionRecorder.record(entry)
+		}
+	}()
 
-	// Message ID is set to 0, followed by message length.
-	binary.BigEndian.PutUint16(header[0:2], 0)
-	binary.BigEndian.PutUint16(header[2:4], msgLen)
+	// Build the request frame.
+	request, err = EncodeRequest(req.MsgID, req.VarName, req.Value)
+	if err != nil {
+		return Response{}, err
+	}
 
-	// Complete request to be sent.
-	request := append(header, msg...)
+	// Only one request may use the connection at a time.
+	osv.ioMu.Lock()
+	defer osv.ioMu.Unlock()
 
-	// fmt.Printf("Sent request: %x\n", request)
+	// Ensure the connection is established, dialing again if an interrupted
+	// request closed it.
+	osv.connMu.Lock()
+	conn, broken := osv.Conn, osv.broken
+	osv.connMu.Unlock()
+	if conn == nil && broken {
+		if err := osv.ConnectContext(ctx); err != nil {
+			return Response{}, err
+		}
+		osv.connMu.Lock()
+		conn = osv.Conn
+		osv.connMu.Unlock()
+	}
+	if conn == nil {
+		return Response{}, errors.New("not connected to server")
+	}
 
-	// Ensure the connection is established.
-	if osv.Conn == nil {
-		return nil, errors.New("not connected to server")
+	// Apply the context deadline and abort blocked I/O on cancellation.
+	if err := ctx.Err(); err != nil {
+		return Response{}, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+		defer conn.SetDeadline(time.Time{})
 	}
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Unix(1, 0))
+	})
+	defer stop()
 
 	// Send the request.
-	_, err := osv.Conn.Write(request)
+	osv.logFrame(ctx, "sent frame", req, request)
+	sent, err = conn.Write(request)
 	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %v", err)
+		return Response{}, fmt.Errorf("failed to send request: %w", osv.interrupted(ctx, conn, err))
 	}
 
-	// Read the response.
-	response := make([]byte, 1024)
-	n, err := osv.Conn.Read(response)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %v", err)
+	// Read the response, skipping late replies to earlier requests.
+	for {
+		response, err = readFrame(conn)
+		received += len(response)
+		if err != nil {
+			return Response{}, fmt.Errorf("failed to read response: %w", osv.interrupted(ctx, conn, err))
+		}
+		if binary.BigEndian.Uint16(response) == req.MsgID {
+			break
+		}
+		osv.logFrame(ctx, "dropped frame", req, response)
 	}
-
-	// Trim the response to the actual data size.
-	response = response[:n]
-	// fmt.Printf("Received response: %x\n", response)
+	osv.logFrame(ctx, "received frame", req, response)
 
 	// Filter visible characters from the response.
 	visibleChars := make([]byte, 0)
@@ -124,10 +288,68 @@ func (osv *OpenShowVar) Send(varname string, val string) ([]byte, error) {
 	}
 	responseStr := string(visibleChars)
 	if responseStr == "" || response[len(response)-1] == 0 {
-		return nil, errors.New("variable not found in response")
+		return Response{}, ErrVariableNotFound
+	}
+
+	// Extract the variable value.
+	value, err := DecodeResponse(response)
+	if err != nil {
+		return Response{}, err
+	}
+	return Response{Value: value, Frame: response}, nil
+}
+
+// readFrame reads a complete frame, whose header holds the message ID and
+// the length of the rest of the frame.
+func readFrame(conn net.Conn) ([]byte, error) {
+	frame := make([]byte, 4)
+	if _, err := io.ReadFull(conn, frame); err != nil {
+		return nil, err
+	}
+	frame = append(frame, make([]byte, binary.BigEndian.Uint16(frame[2:4]))...)
+	if _, err := io.ReadFull(conn, frame[4:]); err != nil {
+		return nil, err
+	}
+	return frame, nil
+}
+
+// interrupted closes the connection after an I/O error caused by ctx, since
+// the reply to the interrupted request may still arrive on it, and marks it
+// broken so that the next request dials again. It returns the error to report.
+func (osv *OpenShowVar) interrupted(ctx context.Context, conn net.Conn, err error) error {
+	err = contextError(ctx, err)
+	if ctx.Err() == nil && !errors.Is(err, context.DeadlineExceeded) {
+		return err
 	}
+	osv.connMu.Lock()
+	if osv.Conn != conn {
+		osv.connMu.Unlock()
+		return err
+	}
+	osv.Conn = nil
+	osv.broken = true
+	osv.connMu.Unlock()
 
-	return response, nil
+	conn.Close()
+	if osv.Logger != nil {
+		osv.Logger.LogAttrs(ctx, slog.LevelWarn, "connection closed after interrupted request", slog.String("error", err.Error()))
+	}
+	if osv.Metrics != nil {
+		osv.Metrics.observeDisconnect(osv.endpoint())
+	}
+	return err
+}
+
+// contextError prefers the context error over the I/O error it caused.
+func contextError(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	// The connection deadline may expire just before the context reports it.
+	if deadline, ok := ctx.Deadline(); ok && !time.Now().Before(deadline) {
+		return context.DeadlineExceeded
+	}
+	return err
 }
 
 // Read reads the value of a specified variable.
@@ -137,31 +359,30 @@ func (osv *OpenShowVar) Send(varname string, val string) ([]byte, error) {
 //
 // Returns: The value of the variable as a string or an error.
 func (osv *OpenShowVar) Read(varname string) (string, error) {
+	return osv.ReadContext(context.Background(), varname)
+}
+
+// ReadContext reads the value of a specified variable, giving up when ctx is done.
+//
+// Parameters:
+// - ctx: Context bounding the request.
+// - varname: The name of the variable to read.
+//
+// Returns: The value of the variable as a string or an error.
+func (osv *OpenShowVar) ReadContext(ctx context.Context, varname string) (string, error) {
 	// Check if the variable name is provided.
 	if varname == "" {
 		return "", errors.New("empty variable name")
 	}
 
 	// Send a request to read the variable.
-	response, err := osv.Send(varname, "")
+	response, err := osv.SendContext(ctx, varname, "")
 	if err != nil {
 		return "", err
 	}
 
-	// Ensure the response has a valid length.
-	if len(response) < 7 {
-		return "", errors.New("invalid response length")
-	}
-
-	// Extract the length of the variable value.
-	valLen := binary.BigEndian.Uint16(response[5:7])
-	if len(response) < int(7+valLen) {
-		return "", errors.New("response length does not match value length")
-	}
-
 	// Extract and return the variable value.
-	varValue := string(response[7 : 7+valLen])
-	return varValue, nil
+	return DecodeResponse(response)
 }
 
 // Write writes a value to a specified variable.
@@ -172,6 +393,18 @@ func (osv *OpenShowVar) Read(varname string) (string, error) {
 //
 // Returns: The written value as a string or an error.
 func (osv *OpenShowVar) Write(varname string, val string) (string, error) {
+	return osv.WriteContext(context.Background(), varname, val)
+}
+
+// WriteContext writes a value to a specified variable, giving up when ctx is done.
+//
+// Parameters:
+// - ctx: Context bounding the request.
+// - varname: The name of the variable to write.
+// - val: The value to write.
+//
+// Returns: The written value as a string or an error.
+func (osv *OpenShowVar) WriteContext(ctx context.Context, varname string, val string) (string, error) {
 	// Check if the variable name and value are provided.
 	if varname == "" {
 		return "", errors.New("empty variable name")
@@ -181,32 +414,31 @@ func (osv *OpenShowVar) Write(varname string, val string) (string, error) {
 	}
 
 	// Send a request to write the variable.
-	response, err := osv.Send(varname, val)
+	response, err := osv.SendContext(ctx, varname, val)
 	if err != nil {
 		return "", err
 	}
 
-	// Ensure the response has a valid length.
-	if len(response) < 7 {
-		return "", errors.New("invalid response length")
-	}
-
-	// Extract the length of the variable value.
-	valLen := binary.BigEndian.Uint16(response[5:7])
-	if len(response) < int(7+valLen) {
-		return "", errors.New("response length does not match value length")
-	}
-
 	// Extract and return the written variable value.
-	varValue := string(response[7 : 7+valLen])
-	return varValue, nil
+	return DecodeResponse(response)
 }
 
 // Disconnect terminates the TCP connection.
 func (osv *OpenShowVar) Disconnect() {
-	// Close the connection if it exists.
-	if osv.Conn != nil {
-		osv.Conn.Close()
-		osv.Conn = nil
+	osv.connMu.Lock()
+	conn := osv.Conn
+	osv.Conn = nil
+	osv.broken = false
+	osv.connMu.Unlock()
+
+	// Close the connection if it exists. This also aborts a request in progress.
+	if conn != nil {
+		conn.Close()
+		if osv.Logger != nil {
+			osv.Logger.LogAttrs(context.Background(), slog.LevelInfo, "disconnected")
+		}
+		if osv.Metrics != nil {
+			osv.Metrics.observeDisconnect(osv.endpoint())
+		}
 	}
 }
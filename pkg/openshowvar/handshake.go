@@ -0,0 +1,157 @@
+package openshowvar
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/selimserbes/go-openshowvar/pkg/krl"
+)
+
+// Errors returned by Handshake.Execute.
+var (
+	// ErrHandshakeTimeout is returned when the KRL side does not set or clear the ack in time.
+	ErrHandshakeTimeout = errors.New("handshake timeout")
+	// ErrStaleAck is returned when the ack is still set from an earlier command and does not clear.
+	ErrStaleAck = errors.New("stale handshake ack")
+)
+
+// defaultHandshakePoll is the ack polling interval used when PollInterval is zero.
+const defaultHandshakePoll = 20 * time.Millisecond
+
+// Assignment is a value to write to a variable.
+type Assignment struct {
+	Name  string
+	Value string
+}
+
+// Handshake runs a request/acknowledge exchange with a KRL program.
+//
+// The robot program waits for CommandVar to leave IdleCommand, processes the
+// command using the parameter variables, writes its result variables and sets
+// AckVar to AckValue. It clears the ack again once the command is reset to
+// IdleCommand.
+type Handshake struct {
+	// CommandVar receives the command, IdleCommand (e.g. "0") is written to reset it.
+	CommandVar  string
+	IdleCommand string
+	// AckVar is set to AckValue by the robot program when the command is done.
+	AckVar   string
+	AckValue string
+	// ResultVars are read after the ack is set.
+	ResultVars []string
+	// Timeout bounds the whole exchange, zero means it is bounded by the context only.
+	Timeout time.Duration
+	// PollInterval is the time between reads of AckVar, 20ms if zero.
+	PollInterval time.Duration
+}
+
+// Execute writes the parameters and command, waits for the ack, reads the
+// results and resets the command.
+//
+// If the ack is still set from an earlier exchange, the command is reset
+// first and Execute waits for the ack to clear, returning ErrStaleAck if it
+// does not. If the ack does not arrive in time, the command is reset and
+// ErrHandshakeTimeout is returned, mentioning the reset if it failed too.
+//
+// Parameters:
+// - ctx: Context bounding the exchange.
+// - osv: The connected client.
+// - command: The value written to CommandVar.
+// - params: Parameter variables written, in order, before the command.
+//
+// Returns: The values of ResultVars by name or an error.
+func (h *Handshake) Execute(ctx context.Context, osv *OpenShowVar, command string, params ...Assignment) (map[string]string, error) {
+	if h.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.Timeout)
+		defer cancel()
+	}
+
+	// Clear a stale ack left over from an earlier exchange.
+	acked, err := h.acked(ctx, osv)
+	if err != nil {
+		return nil, err
+	}
+	if acked {
+		if _, err := osv.WriteContext(ctx, h.CommandVar, h.IdleCommand); err != nil {
+			return nil, err
+		}
+		if err := h.waitAck(ctx, osv, false); err != nil {
+			if errors.Is(err, ErrHandshakeTimeout) {
+				return nil, fmt.Errorf("%w: %s did not clear", ErrStaleAck, h.AckVar)
+			}
+			return nil, err
+		}
+	}
+
+	// Parameters first, then the command that starts the robot side.
+	for _, param := range params {
+		if _, err := osv.WriteContext(ctx, param.Name, param.Value); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := osv.WriteContext(ctx, h.CommandVar, command); err != nil {
+		return nil, err
+	}
+
+	if err := h.waitAck(ctx, osv, true); err != nil {
+		// Withdraw the command so the robot does not pick it up late. An
+		// interrupted ack read closes the connection, so the reset is sent on
+		// a new one and cannot be answered by the late ack reply.
+		resetCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), time.Second)
+		defer cancel()
+		if _, resetErr := osv.WriteContext(resetCtx, h.CommandVar, h.IdleCommand); resetErr != nil {
+			return nil, fmt.Errorf("%w (reset of %s failed: %v)", err, h.CommandVar, resetErr)
+		}
+		return nil, err
+	}
+
+	results := make(map[string]string, len(h.ResultVars))
+	for _, name := range h.ResultVars {
+		value, err := osv.ReadContext(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		results[name] = value
+	}
+
+	// Reset the command and wait for the robot to release the ack.
+	if _, err := osv.WriteContext(ctx, h.CommandVar, h.IdleCommand); err != nil {
+		return nil, err
+	}
+	if err := h.waitAck(ctx, osv, false); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// acked reads AckVar and reports whether it equals AckValue.
+func (h *Handshake) acked(ctx context.Context, osv *OpenShowVar) (bool, error) {
+	value, err := osv.ReadContext(ctx, h.AckVar)
+	if err != nil {
+		return false, err
+	}
+	return krl.EqualStrings(value, h.AckValue, 0), nil
+}
+
+// waitAck waits until the ack is set or cleared, mapping a deadline to ErrHandshakeTimeout.
+func (h *Handshake) waitAck(ctx context.Context, osv *OpenShowVar, set bool) error {
+	interval := h.PollInterval
+	if interval <= 0 {
+		interval = defaultHandshakePoll
+	}
+
+	_, err := osv.WaitFor(ctx, h.AckVar, func(value string) bool {
+		return krl.EqualStrings(value, h.AckValue, 0) == set
+	}, interval)
+	if errors.Is(err, context.DeadlineExceeded) {
+		state := "set"
+		if !set {
+			state = "cleared"
+		}
+		return fmt.Errorf("%w: %s not %s", ErrHandshakeTimeout, h.AckVar, state)
+	}
+	return err
+}
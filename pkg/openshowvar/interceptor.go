@@ -0,0 +1,50 @@
+package openshowvar
+
+import "context"
+
+// Request describes a single read or write sent to KukaVarProxy.
+type Request struct {
+	// MsgID is the message ID placed in the frame header.
+	MsgID uint16
+	// Mode is ModeRead or ModeWrite.
+	Mode byte
+	// VarName is the name of the variable.
+	VarName string
+	// Value is the value to write, empty for reads.
+	Value string
+}
+
+// Response is the answer to a Request.
+type Response struct {
+	// Value is the variable value returned by the server.
+	Value string
+	// Frame is the raw response frame. Interceptors that answer a request
+	// themselves may leave it nil, a frame is then built from Value.
+	Frame []byte
+}
+
+// Handler performs a request and returns its response.
+type Handler func(ctx context.Context, req Request) (Response, error)
+
+// Interceptor observes or modifies a request. It calls next to continue the
+// chain, or returns a response or error itself to short-circuit it.
+type Interceptor func(ctx context.Context, req Request, next Handler) (Response, error)
+
+// WithInterceptors appends interceptors to the client. They run in the order
+// given, the first one being the outermost.
+func WithInterceptors(interceptors ...Interceptor) Option {
+	return func(osv *OpenShowVar) {
+		osv.Interceptors = append(osv.Interceptors, interceptors...)
+	}
+}
+
+// chain wraps handler with interceptors so that interceptors[0] runs first.
+func chain(interceptors []Interceptor, handler Handler) Handler {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], handler
+		handler = func(ctx context.Context, req Request) (Response, error) {
+			return interceptor(ctx, req, next)
+		}
+	}
+	return handler
+}
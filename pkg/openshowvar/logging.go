@@ -0,0 +1,82 @@
+package openshowvar
+
+import (
+	"context"
+	"encoding/hex"
+	"log/slog"
+	"time"
+
+	"github.com/selimserbes/go-openshowvar/pkg/krl"
+)
+
+// redactedValue replaces values of sensitive variables in log output.
+const redactedValue = "[REDACTED]"
+
+// WithLogger enables structured logging of connects, disconnects and requests.
+//
+// Requests are logged with variable name, mode, message ID, latency and outcome,
+// at debug level on success and warn level on failure. Raw frames are hex dumped
+// at debug level.
+func WithLogger(logger *slog.Logger) Option {
+	return func(osv *OpenShowVar) {
+		osv.Logger = logger
+	}
+}
+
+// WithRedactedVars hides the values of matching variables from log output
+// and from frames recorded by a SessionRecorder.
+//
+// Patterns are matched with krl.MatchName, e.g. "PASSWORD", "RECIPE_*" or
+// "PASSWORDS[1]", and also cover array elements and STRUC members. Frames of
+// redacted variables are not hex dumped.
+func WithRedactedVars(patterns ...string) Option {
+	return func(osv *OpenShowVar) {
+		osv.RedactedVars = append(osv.RedactedVars, patterns...)
+	}
+}
+
+// redacted reports whether the value of varname must not be logged.
+func (osv *OpenShowVar) redacted(varname string) bool {
+	for _, pattern := range osv.RedactedVars {
+		if krl.MatchName(pattern, varname) {
+			return true
+		}
+	}
+	return false
+}
+
+// logFrame hex dumps a frame at debug level.
+func (osv *OpenShowVar) logFrame(ctx context.Context, msg string, req Request, frame []byte) {
+	if osv.Logger == nil || osv.redacted(req.VarName) {
+		return
+	}
+	osv.Logger.LogAttrs(ctx, slog.LevelDebug, msg,
+		slog.Int("msg_id", int(req.MsgID)),
+		slog.String("frame", hex.EncodeToString(frame)),
+	)
+}
+
+// logRequest logs the outcome of a request.
+func (osv *OpenShowVar) logRequest(ctx context.Context, req Request, value string, latency time.Duration, err error) {
+	if osv.Logger == nil {
+		return
+	}
+
+	if osv.redacted(req.VarName) {
+		value = redactedValue
+	}
+	attrs := []slog.Attr{
+		slog.String("var", req.VarName),
+		slog.String("mode", modeName(req.Mode)),
+		slog.Int("msg_id", int(req.MsgID)),
+		slog.Duration("latency", latency),
+	}
+
+	if err != nil {
+		attrs = append(attrs, slog.String("error", err.Error()))
+		osv.Logger.LogAttrs(ctx, slog.LevelWarn, "request failed", attrs...)
+		return
+	}
+	attrs = append(attrs, slog.String("value", value))
+	osv.Logger.LogAttrs(ctx, slog.LevelDebug, "request", attrs...)
+}
@@ -0,0 +1,220 @@
+package openshowvar
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LatencyBuckets are the upper bounds, in seconds, of the request latency histogram.
+var LatencyBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5}
+
+// Metrics collects request and connection statistics for one or more clients.
+//
+// A single Metrics value can be shared by every client of a fleet, statistics
+// are kept per endpoint. It has no dependencies and can be exported with
+// WritePrometheus, served directly as an http.Handler, or read with Snapshot
+// by an adapter for another monitoring system.
+type Metrics struct {
+	mu        sync.Mutex
+	endpoints map[string]*EndpointStats
+}
+
+// EndpointStats holds the statistics of one KukaVarProxy endpoint.
+type EndpointStats struct {
+	// Endpoint is the host:port of the server.
+	Endpoint string
+	// Connected is the number of clients currently connected to the endpoint.
+	Connected int
+	// Reconnects counts successful connects after a client's first one.
+	Reconnects uint64
+	// BytesSent and BytesReceived count frame bytes on the wire.
+	BytesSent     uint64
+	BytesReceived uint64
+	// Read and Write hold the request statistics per mode.
+	Read  RequestStats
+	Write RequestStats
+}
+
+// RequestStats holds request counts and latencies for one mode.
+type RequestStats struct {
+	// Succeeded and Failed count requests by outcome.
+	Succeeded uint64
+	Failed    uint64
+	// Buckets holds cumulative request counts per LatencyBuckets bound.
+	Buckets []uint64
+	// LatencySum is the total latency of all requests.
+	LatencySum time.Duration
+}
+
+// NewMetrics creates an empty metrics collector.
+func NewMetrics() *Metrics {
+	return &Metrics{endpoints: make(map[string]*EndpointStats)}
+}
+
+// WithMetrics records request and connection statistics in m.
+func WithMetrics(m *Metrics) Option {
+	return func(osv *OpenShowVar) {
+		osv.Metrics = m
+	}
+}
+
+// endpoint returns the statistics of an endpoint, creating them if needed. m.mu must be held.
+func (m *Metrics) endpoint(name string) *EndpointStats {
+	stats, ok := m.endpoints[name]
+	if !ok {
+		stats = &EndpointStats{
+			Endpoint: name,
+			Read:     RequestStats{Buckets: make([]uint64, len(LatencyBuckets))},
+			Write:    RequestStats{Buckets: make([]uint64, len(LatencyBuckets))},
+		}
+		m.endpoints[name] = stats
+	}
+	return stats
+}
+
+// observeConnect records a successful connect.
+func (m *Metrics) observeConnect(endpoint string, reconnect bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stats := m.endpoint(endpoint)
+	stats.Connected++
+	if reconnect {
+		stats.Reconnects++
+	}
+}
+
+// observeDisconnect records a closed connection.
+func (m *Metrics) observeDisconnect(endpoint string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stats := m.endpoint(endpoint)
+	if stats.Connected > 0 {
+		stats.Connected--
+	}
+}
+
+// observeRequest records a request and the bytes it moved.
+func (m *Metrics) observeRequest(endpoint string, mode byte, latency time.Duration, sent, received int, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stats := m.endpoint(endpoint)
+	stats.BytesSent += uint64(sent)
+	stats.BytesReceived += uint64(received)
+
+	requests := &stats.Read
+	if mode == ModeWrite {
+		requests = &stats.Write
+	}
+	if err != nil {
+		requests.Failed++
+	} else {
+		requests.Succeeded++
+	}
+	requests.LatencySum += latency
+	for i, bound := range LatencyBuckets {
+		if latency.Seconds() <= bound {
+			requests.Buckets[i]++
+		}
+	}
+}
+
+// modeStats pairs request statistics with the mode label used on export.
+type modeStats struct {
+	name  string
+	stats RequestStats
+}
+
+// modes returns the request statistics of both modes.
+func (s EndpointStats) modes() []modeStats {
+	return []modeStats{{"read", s.Read}, {"write", s.Write}}
+}
+
+// Snapshot returns a copy of the statistics of all endpoints, sorted by endpoint.
+func (m *Metrics) Snapshot() []EndpointStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	snapshot := make([]EndpointStats, 0, len(m.endpoints))
+	for _, stats := range m.endpoints {
+		copied := *stats
+		copied.Read.Buckets = append([]uint64(nil), stats.Read.Buckets...)
+		copied.Write.Buckets = append([]uint64(nil), stats.Write.Buckets...)
+		snapshot = append(snapshot, copied)
+	}
+	sort.Slice(snapshot, func(i, j int) bool {
+		return snapshot[i].Endpoint < snapshot[j].Endpoint
+	})
+	return snapshot
+}
+
+// WritePrometheus writes all statistics in the Prometheus text exposition format.
+func (m *Metrics) WritePrometheus(w io.Writer) error {
+	snapshot := m.Snapshot()
+	bw := bufio.NewWriter(w)
+
+	family := func(name, kind, help string) {
+		fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+	}
+
+	family("openshowvar_requests_total", "counter", "Requests sent to KukaVarProxy by mode and result.")
+	for _, stats := range snapshot {
+		ep := quoteLabel(stats.Endpoint)
+		for _, mode := range stats.modes() {
+			fmt.Fprintf(bw, "openshowvar_requests_total{endpoint=%s,mode=%q,result=\"ok\"} %d\n", ep, mode.name, mode.stats.Succeeded)
+			fmt.Fprintf(bw, "openshowvar_requests_total{endpoint=%s,mode=%q,result=\"error\"} %d\n", ep, mode.name, mode.stats.Failed)
+		}
+	}
+
+	family("openshowvar_request_duration_seconds", "histogram", "Request latency by mode.")
+	for _, stats := range snapshot {
+		ep := quoteLabel(stats.Endpoint)
+		for _, mode := range stats.modes() {
+			for i, bound := range LatencyBuckets {
+				fmt.Fprintf(bw, "openshowvar_request_duration_seconds_bucket{endpoint=%s,mode=%q,le=%q} %d\n",
+					ep, mode.name, strconv.FormatFloat(bound, 'g', -1, 64), mode.stats.Buckets[i])
+			}
+			count := mode.stats.Succeeded + mode.stats.Failed
+			fmt.Fprintf(bw, "openshowvar_request_duration_seconds_bucket{endpoint=%s,mode=%q,le=\"+Inf\"} %d\n", ep, mode.name, count)
+			fmt.Fprintf(bw, "openshowvar_request_duration_seconds_sum{endpoint=%s,mode=%q} %g\n", ep, mode.name, mode.stats.LatencySum.Seconds())
+			fmt.Fprintf(bw, "openshowvar_request_duration_seconds_count{endpoint=%s,mode=%q} %d\n", ep, mode.name, count)
+		}
+	}
+
+	family("openshowvar_bytes_sent_total", "counter", "Frame bytes sent.")
+	for _, stats := range snapshot {
+		fmt.Fprintf(bw, "openshowvar_bytes_sent_total{endpoint=%s} %d\n", quoteLabel(stats.Endpoint), stats.BytesSent)
+	}
+	family("openshowvar_bytes_received_total", "counter", "Frame bytes received.")
+	for _, stats := range snapshot {
+		fmt.Fprintf(bw, "openshowvar_bytes_received_total{endpoint=%s} %d\n", quoteLabel(stats.Endpoint), stats.BytesReceived)
+	}
+	family("openshowvar_reconnects_total", "counter", "Successful connects after the first one.")
+	for _, stats := range snapshot {
+		fmt.Fprintf(bw, "openshowvar_reconnects_total{endpoint=%s} %d\n", quoteLabel(stats.Endpoint), stats.Reconnects)
+	}
+	family("openshowvar_connected", "gauge", "Number of connected clients.")
+	for _, stats := range snapshot {
+		fmt.Fprintf(bw, "openshowvar_connected{endpoint=%s} %d\n", quoteLabel(stats.Endpoint), stats.Connected)
+	}
+
+	return bw.Flush()
+}
+
+// ServeHTTP serves the statistics in the Prometheus text exposition format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WritePrometheus(w)
+}
+
+// quoteLabel quotes a label value using Prometheus escaping rules.
+func quoteLabel(value string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	return `"` + replacer.Replace(value) + `"`
+}
@@ -0,0 +1,245 @@
+package openshowvar
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Group is a set of variables read together at a fixed rate by a Poller.
+type Group struct {
+	// Name identifies the group in snapshots and statistics.
+	Name string
+	// Vars are the variables read in every cycle, in order.
+	Vars []string
+	// Interval is the time between the scheduled starts of two cycles.
+	Interval time.Duration
+	// Handler is called with each snapshot from the poller goroutine. Optional.
+	Handler func(Snapshot)
+	// C receives each snapshot without blocking, snapshots are dropped when it is full. Optional.
+	C chan<- Snapshot
+}
+
+// Sample is one variable value read during a cycle.
+type Sample struct {
+	VarName string
+	Value   string
+	// Err is set when the read failed.
+	Err error
+	// Time is when the value was read.
+	Time time.Time
+}
+
+// Snapshot holds the values of one group cycle.
+type Snapshot struct {
+	// Group is the name of the group.
+	Group string
+	// Scheduled is when the cycle was due, Start and End when its reads began and finished.
+	Scheduled time.Time
+	Start     time.Time
+	End       time.Time
+	// Jitter is the delay between Scheduled and Start.
+	Jitter time.Duration
+	// Overrun is set when the cycle finished after the next one was due,
+	// Missed counts the cycles skipped because of it.
+	Overrun bool
+	Missed  int
+	// Values holds one sample per variable of the group, in order.
+	Values []Sample
+}
+
+// GroupStats summarizes the scheduling behaviour of a group.
+type GroupStats struct {
+	Group string
+	// Cycles counts completed cycles, Overruns those that finished late.
+	Cycles   uint64
+	Overruns uint64
+	// Missed counts cycles skipped because of overruns.
+	Missed uint64
+	// MaxJitter is the largest delay between a scheduled and actual cycle start.
+	MaxJitter time.Duration
+	// Dropped counts snapshots not delivered because C was full.
+	Dropped uint64
+}
+
+// Poller reads groups of variables at different rates over one connection.
+//
+// Reads are scheduled one at a time, earliest deadline first: a slow group
+// with many variables is interleaved with faster groups instead of blocking
+// them for a whole cycle. Ties are broken by group order, so the schedule is
+// deterministic for a given set of groups.
+type Poller struct {
+	osv    *OpenShowVar
+	groups []*pollGroup
+
+	mu    sync.Mutex
+	stats []GroupStats
+}
+
+// pollGroup is the scheduling state of a group.
+type pollGroup struct {
+	Group
+	index int
+	next  time.Time
+	cycle *Snapshot
+}
+
+// NewPoller creates a poller for the given groups.
+//
+// Parameters:
+// - osv: The connected client used for all reads.
+// - groups: The variable groups to poll.
+//
+// Returns: A new Poller, started with Run.
+func NewPoller(osv *OpenShowVar, groups ...Group) *Poller {
+	p := &Poller{osv: osv, stats: make([]GroupStats, len(groups))}
+	for i, g := range groups {
+		p.groups = append(p.groups, &pollGroup{Group: g, index: i})
+		p.stats[i].Group = g.Name
+	}
+	return p
+}
+
+// Run polls all groups until ctx is done.
+//
+// Returns: The context error, or an error if a group has no positive interval.
+func (p *Poller) Run(ctx context.Context) error {
+	for _, g := range p.groups {
+		if g.Interval <= 0 {
+			return errors.New("poller group " + g.Name + " has no interval")
+		}
+	}
+
+	if len(p.groups) == 0 {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	start := time.Now()
+	for _, g := range p.groups {
+		g.next = start
+		g.cycle = nil
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		// Start the cycles that are due.
+		now := time.Now()
+		for _, g := range p.groups {
+			if g.cycle == nil && !now.Before(g.next) {
+				g.cycle = &Snapshot{
+					Group:     g.Name,
+					Scheduled: g.next,
+					Start:     now,
+					Jitter:    now.Sub(g.next),
+					Values:    make([]Sample, 0, len(g.Vars)),
+				}
+			}
+		}
+
+		g := p.pick()
+		if g == nil {
+			// Nothing to do until the next cycle is due.
+			timer := time.NewTimer(time.Until(p.nextDue()))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			case <-timer.C:
+			}
+			continue
+		}
+
+		// Read the next variable of the most urgent cycle.
+		if pos := len(g.cycle.Values); pos < len(g.Vars) {
+			name := g.Vars[pos]
+			value, err := p.osv.ReadContext(ctx, name)
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			g.cycle.Values = append(g.cycle.Values, Sample{VarName: name, Value: value, Err: err, Time: time.Now()})
+		}
+		if len(g.cycle.Values) == len(g.Vars) {
+			p.finish(g)
+		}
+	}
+}
+
+// pick returns the group with a cycle in progress whose deadline is earliest.
+func (p *Poller) pick() *pollGroup {
+	var best *pollGroup
+	for _, g := range p.groups {
+		if g.cycle == nil {
+			continue
+		}
+		if best == nil || g.cycle.Scheduled.Add(g.Interval).Before(best.cycle.Scheduled.Add(best.Interval)) {
+			best = g
+		}
+	}
+	return best
+}
+
+// nextDue returns the earliest scheduled start of all groups.
+func (p *Poller) nextDue() time.Time {
+	due := p.groups[0].next
+	for _, g := range p.groups[1:] {
+		if g.next.Before(due) {
+			due = g.next
+		}
+	}
+	return due
+}
+
+// finish completes the cycle of g, schedules the next one and delivers the snapshot.
+func (p *Poller) finish(g *pollGroup) {
+	snapshot := *g.cycle
+	g.cycle = nil
+	snapshot.End = time.Now()
+
+	// Skip the cycles whose start has already passed.
+	g.next = snapshot.Scheduled.Add(g.Interval)
+	for !g.next.After(snapshot.End) {
+		g.next = g.next.Add(g.Interval)
+		snapshot.Missed++
+	}
+	snapshot.Overrun = snapshot.Missed > 0
+
+	dropped := false
+	if g.C != nil {
+		select {
+		case g.C <- snapshot:
+		default:
+			dropped = true
+		}
+	}
+
+	p.mu.Lock()
+	stats := &p.stats[g.index]
+	stats.Cycles++
+	if snapshot.Overrun {
+		stats.Overruns++
+		stats.Missed += uint64(snapshot.Missed)
+	}
+	if snapshot.Jitter > stats.MaxJitter {
+		stats.MaxJitter = snapshot.Jitter
+	}
+	if dropped {
+		stats.Dropped++
+	}
+	p.mu.Unlock()
+
+	if g.Handler != nil {
+		g.Handler(snapshot)
+	}
+}
+
+// Stats returns the scheduling statistics of all groups, in the order they were given.
+func (p *Poller) Stats() []GroupStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]GroupStats(nil), p.stats...)
+}
@@ -0,0 +1,283 @@
+package openshowvar
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// SessionEntry is one request/response exchange of a recorded session.
+type SessionEntry struct {
+	// Time is when the request was sent.
+	Time time.Time
+	// Latency is the time until the response arrived or the exchange failed.
+	Latency time.Duration
+	// Request is the raw request frame.
+	Request []byte
+	// Response is the raw response frame, nil if none was received.
+	Response []byte
+	// Err is the error of the exchange, empty on success.
+	Err string
+}
+
+// sessionLine is the JSON Lines representation of a SessionEntry.
+type sessionLine struct {
+	Time     time.Time `json:"time"`
+	Latency  int64     `json:"latency_ns"`
+	Request  string    `json:"request"`
+	Response string    `json:"response,omitempty"`
+	Err      string    `json:"error,omitempty"`
+}
+
+// SessionRecorder writes every frame exchanged on the connection to a file,
+// one JSON object per line with hex encoded frames.
+type SessionRecorder struct {
+	mu  sync.Mutex
+	w   *bufio.Writer
+	err error
+}
+
+// NewSessionRecorder creates a session recorder writing to w.
+//
+// Parameters:
+// - w: The destination, e.g. a file.
+//
+// Returns: A new SessionRecorder, attached to a client with WithSessionRecorder.
+func NewSessionRecorder(w io.Writer) *SessionRecorder {
+	return &SessionRecorder{w: bufio.NewWriter(w)}
+}
+
+// WithSessionRecorder records all request and response frames of the client in rec.
+// Values of variables hidden with WithRedactedVars are recorded as [REDACTED].
+func WithSessionRecorder(rec *SessionRecorder) Option {
+	return func(osv *OpenShowVar) {
+		osv.SessionRecorder = rec
+	}
+}
+
+// Err returns the first error writing the session, which stops the recording.
+func (r *SessionRecorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// record writes one exchange and flushes it, so a crash keeps the session so far.
+func (r *SessionRecorder) record(entry SessionEntry) {
+	line := sessionLine{
+		Time:     entry.Time,
+		Latency:  int64(entry.Latency),
+		Request:  hex.EncodeToString(entry.Request),
+		Response: hex.EncodeToString(entry.Response),
+		Err:      entry.Err,
+	}
+	data, err := json.Marshal(line)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return
+	}
+	if err == nil {
+		r.w.Write(append(data, '\n'))
+		err = r.w.Flush()
+	}
+	r.err = err
+}
+
+// redactEntry replaces the written value in the request frame and the value
+// in the response frame of a recorded exchange with redactedValue.
+func redactEntry(req Request, entry SessionEntry) SessionEntry {
+	if req.Mode == ModeWrite {
+		if request, err := EncodeRequest(req.MsgID, req.VarName, redactedValue); err == nil {
+			entry.Request = request
+		}
+	}
+	if _, err := DecodeResponse(entry.Response); err == nil {
+		ok := entry.Response[len(entry.Response)-1] != 0
+		if response, err := EncodeResponse(req.MsgID, entry.Response[4], redactedValue, ok); err == nil {
+			entry.Response = response
+		}
+	}
+	return entry
+}
+
+// ReadSession reads a session written by a SessionRecorder.
+//
+// Parameters:
+// - r: The recorded session.
+//
+// Returns: The entries in the order they were recorded or an error.
+func ReadSession(r io.Reader) ([]SessionEntry, error) {
+	var entries []SessionEntry
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var line sessionLine
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			return nil, fmt.Errorf("session line %d: %v", n, err)
+		}
+		request, err := hex.DecodeString(line.Request)
+		if err != nil {
+			return nil, fmt.Errorf("session line %d: request: %v", n, err)
+		}
+		response, err := hex.DecodeString(line.Response)
+		if err != nil {
+			return nil, fmt.Errorf("session line %d: response: %v", n, err)
+		}
+		if len(response) == 0 {
+			response = nil
+		}
+		entries = append(entries, SessionEntry{
+			Time:     line.Time,
+			Latency:  time.Duration(line.Latency),
+			Request:  request,
+			Response: response,
+			Err:      line.Err,
+		})
+	}
+	return entries, scanner.Err()
+}
+
+// ReplayServer answers requests with the responses of a recorded session.
+//
+// Requests must arrive in the recorded order. Each one is compared with the
+// recorded request, ignoring the message ID, and answered with the recorded
+// response carrying the message ID of the incoming request. Redacted writes
+// match any value written to the variable. Exchanges that
+// failed without a response close the connection, so the client sees the
+// same error path as during the recording. The session continues across
+// connections, a reconnecting client picks up where the last one stopped.
+type ReplayServer struct {
+	// Timing delays every response by its recorded latency.
+	Timing bool
+
+	mu      sync.Mutex
+	entries []SessionEntry
+	next    int
+	err     error
+}
+
+// NewReplayServer creates a replay server for the given session.
+//
+// Parameters:
+// - entries: The recorded session, e.g. from ReadSession.
+//
+// Returns: A new ReplayServer, used with Serve, ServeListener or a PipeDialer.
+func NewReplayServer(entries []SessionEntry) *ReplayServer {
+	return &ReplayServer{entries: entries}
+}
+
+// Remaining returns the number of recorded exchanges not replayed yet.
+func (s *ReplayServer) Remaining() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.entries) - s.next
+}
+
+// Err returns the first divergence from the recording, nil if there is none.
+func (s *ReplayServer) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Serve answers requests on conn until it is closed or the replay diverges.
+func (s *ReplayServer) Serve(conn net.Conn) {
+	defer conn.Close()
+	for {
+		header := make([]byte, 4)
+		if _, err := io.ReadFull(conn, header); err != nil {
+			return
+		}
+		body := make([]byte, binary.BigEndian.Uint16(header[2:4]))
+		if _, err := io.ReadFull(conn, body); err != nil {
+			return
+		}
+		request := append(header, body...)
+
+		entry, ok := s.match(request)
+		if !ok {
+			return
+		}
+		if s.Timing {
+			time.Sleep(entry.Latency)
+		}
+		if entry.Response == nil {
+			return
+		}
+
+		response := append([]byte(nil), entry.Response...)
+		if len(response) >= 2 {
+			copy(response[:2], request[:2])
+		}
+		if _, err := conn.Write(response); err != nil {
+			return
+		}
+	}
+}
+
+// ServeListener accepts connections on listener and serves each of them.
+func (s *ReplayServer) ServeListener(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go s.Serve(conn)
+	}
+}
+
+// match returns the next recorded entry if request matches it.
+func (s *ReplayServer) match(request []byte) (SessionEntry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return SessionEntry{}, false
+	}
+	if s.next >= len(s.entries) {
+		s.err = fmt.Errorf("replay: unexpected request %s after the end of the session", describeRequest(request))
+		return SessionEntry{}, false
+	}
+
+	entry := s.entries[s.next]
+	if len(request) < 2 || len(entry.Request) < 2 || !bytes.Equal(request[2:], entry.Request[2:]) && !redactedMatch(request, entry.Request) {
+		s.err = fmt.Errorf("replay: request %d is %s, recorded %s", s.next+1, describeRequest(request), describeRequest(entry.Request))
+		return SessionEntry{}, false
+	}
+	s.next++
+	return entry, true
+}
+
+// redactedMatch reports whether request writes the variable of a recorded
+// write whose value was redacted.
+func redactedMatch(request, recorded []byte) bool {
+	_, name, val, err := DecodeRequest(recorded)
+	if err != nil || val != redactedValue {
+		return false
+	}
+	_, reqName, reqVal, err := DecodeRequest(request)
+	return err == nil && reqVal != "" && reqName == name
+}
+
+// describeRequest formats a request frame for error messages.
+func describeRequest(frame []byte) string {
+	_, varname, val, err := DecodeRequest(frame)
+	if err != nil {
+		return fmt.Sprintf("invalid frame %x", frame)
+	}
+	if val == "" {
+		return fmt.Sprintf("read %s", varname)
+	}
+	return fmt.Sprintf("write %s = %s", varname, val)
+}
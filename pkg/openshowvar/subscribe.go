@@ -0,0 +1,269 @@
+package openshowvar
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/selimserbes/go-openshowvar/pkg/krl"
+)
+
+// subscriberBuffer is the capacity of the channel returned by Subscribe.
+const subscriberBuffer = 16
+
+// minPollTimeout is the shortest time limit of a read of a poller, which is
+// otherwise ten poll intervals.
+const minPollTimeout = time.Second
+
+// Change is a value change reported by Subscribe.
+type Change struct {
+	// VarName is the name of the variable.
+	VarName string
+	// Value is the new value, Previous the last value delivered before it.
+	// Previous is empty for the first value of a subscription.
+	Value    string
+	Previous string
+	// Time is when the value was read.
+	Time time.Time
+	// Err is set when polling fails, Value and Previous are empty then.
+	Err error
+}
+
+// SubscribeOption configures a subscription.
+type SubscribeOption func(*subscriber)
+
+// WithTolerance treats INT and REAL values, including STRUC members, as unchanged
+// while they differ by no more than tolerance from the last delivered value.
+func WithTolerance(tolerance float64) SubscribeOption {
+	return func(s *subscriber) {
+		s.tolerance = tolerance
+	}
+}
+
+// WithDebounce delivers a change only after the new value has been read
+// unchanged for at least d. The first value is delivered immediately.
+func WithDebounce(d time.Duration) SubscribeOption {
+	return func(s *subscriber) {
+		s.debounce = d
+	}
+}
+
+// Subscribe polls a variable and delivers its value whenever it changes.
+//
+// The first value is delivered as soon as it has been read. Subscribers of the
+// same variable share a single poller that runs at the shortest interval
+// requested. A failing read is reported once on the channel; polling continues
+// and the value is delivered as soon as reads succeed again, even if it did
+// not change. A read that takes longer than ten intervals, and at least a
+// second, fails with context.DeadlineExceeded and the next read reconnects.
+// If the reader falls behind, the oldest undelivered changes are dropped.
+//
+// Parameters:
+// - ctx: The subscription ends and the channel is closed when ctx is done.
+// - varname: The name of the variable to watch.
+// - interval: Time between reads.
+// - opts: Optional settings such as WithTolerance or WithDebounce.
+//
+// Returns: A channel of changes.
+func (osv *OpenShowVar) Subscribe(ctx context.Context, varname string, interval time.Duration, opts ...SubscribeOption) <-chan Change {
+	sub := &subscriber{
+		interval: interval,
+		ch:       make(chan Change, subscriberBuffer),
+	}
+	for _, opt := range opts {
+		opt(sub)
+	}
+
+	// Join the poller of the variable, starting one if needed.
+	osv.subsMu.Lock()
+	if osv.subs == nil {
+		osv.subs = make(map[string]*subscription)
+	}
+	s, ok := osv.subs[varname]
+	if !ok {
+		var pollCtx context.Context
+		s = &subscription{
+			varname:     varname,
+			subscribers: make(map[*subscriber]struct{}),
+			wake:        make(chan struct{}, 1),
+		}
+		pollCtx, s.cancel = context.WithCancel(context.Background())
+		osv.subs[varname] = s
+		go osv.poll(pollCtx, s)
+	}
+	s.mu.Lock()
+	s.subscribers[sub] = struct{}{}
+	s.mu.Unlock()
+	osv.subsMu.Unlock()
+
+	// Poll right away so the new subscriber gets its first value.
+	s.notify()
+
+	context.AfterFunc(ctx, func() {
+		osv.unsubscribe(s, sub)
+	})
+	return sub.ch
+}
+
+// unsubscribe removes sub from s and stops the poller when it was the last subscriber.
+func (osv *OpenShowVar) unsubscribe(s *subscription, sub *subscriber) {
+	osv.subsMu.Lock()
+	defer osv.subsMu.Unlock()
+
+	s.mu.Lock()
+	delete(s.subscribers, sub)
+	close(sub.ch)
+	remaining := len(s.subscribers)
+	s.mu.Unlock()
+
+	if remaining == 0 {
+		delete(osv.subs, s.varname)
+		s.cancel()
+	}
+}
+
+// poll reads the variable of s until ctx is done and hands each result to its subscribers.
+func (osv *OpenShowVar) poll(ctx context.Context, s *subscription) {
+	for {
+		s.mu.Lock()
+		interval := s.interval()
+		s.mu.Unlock()
+
+		// A read in progress is not cancelled, the poller exits once it
+		// returns. A read that hangs fails after its time limit, which
+		// closes the connection so the next read reconnects.
+		readCtx, cancel := context.WithTimeout(context.Background(), max(10*interval, minPollTimeout))
+		value, err := osv.ReadContext(readCtx, s.varname)
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+		now := time.Now()
+
+		s.mu.Lock()
+		for sub := range s.subscribers {
+			sub.deliver(s.varname, value, err, now)
+		}
+		interval = s.interval()
+		s.mu.Unlock()
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-s.wake:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// subscription is the shared poller of one variable.
+type subscription struct {
+	varname string
+	cancel  context.CancelFunc
+	// wake triggers an immediate poll.
+	wake chan struct{}
+
+	mu          sync.Mutex
+	subscribers map[*subscriber]struct{}
+}
+
+// notify wakes the poller without blocking.
+func (s *subscription) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// interval returns the shortest interval of all subscribers. s.mu must be held.
+func (s *subscription) interval() time.Duration {
+	var interval time.Duration
+	for sub := range s.subscribers {
+		if interval == 0 || sub.interval < interval {
+			interval = sub.interval
+		}
+	}
+	if interval <= 0 {
+		interval = time.Second
+	}
+	return interval
+}
+
+// subscriber is one receiver of a subscription with its own filtering state.
+type subscriber struct {
+	interval  time.Duration
+	tolerance float64
+	debounce  time.Duration
+	ch        chan Change
+
+	hasValue     bool
+	last         string
+	hasPending   bool
+	pending      string
+	pendingSince time.Time
+	failing      bool
+}
+
+// equal compares two values using the subscriber's tolerance.
+func (sub *subscriber) equal(a, b string) bool {
+	if sub.tolerance > 0 {
+		return krl.EqualStrings(a, b, sub.tolerance)
+	}
+	return a == b
+}
+
+// deliver filters a poll result and sends it to the subscriber if it is a change.
+func (sub *subscriber) deliver(varname, value string, err error, now time.Time) {
+	if err != nil {
+		if !sub.failing {
+			sub.failing = true
+			sub.send(Change{VarName: varname, Time: now, Err: err})
+		}
+		return
+	}
+	// The first value after a failure is delivered even if it did not
+	// change, so subscribers learn that reads succeed again.
+	recovered := sub.failing
+	sub.failing = false
+
+	if !recovered && sub.hasValue && sub.equal(sub.last, value) {
+		sub.hasPending = false
+		return
+	}
+
+	// Wait until the new value has been stable for the debounce time.
+	if !recovered && sub.hasValue && sub.debounce > 0 {
+		if !sub.hasPending || !sub.equal(sub.pending, value) {
+			sub.hasPending = true
+			sub.pending = value
+			sub.pendingSince = now
+		}
+		if now.Sub(sub.pendingSince) < sub.debounce {
+			return
+		}
+	}
+
+	change := Change{VarName: varname, Value: value, Previous: sub.last, Time: now}
+	sub.hasValue = true
+	sub.last = value
+	sub.hasPending = false
+	sub.send(change)
+}
+
+// send queues a change, dropping the oldest queued one if the channel is full.
+func (sub *subscriber) send(change Change) {
+	for {
+		select {
+		case sub.ch <- change:
+			return
+		default:
+		}
+		select {
+		case <-sub.ch:
+		default:
+		}
+	}
+}
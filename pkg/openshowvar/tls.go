@@ -0,0 +1,66 @@
+package openshowvar
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+)
+
+// TLSDialer wraps another Dialer and runs a TLS client handshake over the stream it returns.
+//
+// It is used to reach KukaVarProxy behind a TLS terminating relay such as stunnel.
+type TLSDialer struct {
+	// Dialer opens the underlying stream.
+	Dialer Dialer
+	// Config is the TLS client configuration. It must set ServerName unless InsecureSkipVerify is used.
+	Config *tls.Config
+}
+
+// DialContext opens the underlying stream and completes the TLS handshake on it.
+func (d TLSDialer) DialContext(ctx context.Context) (net.Conn, error) {
+	conn, err := d.Dialer.DialContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConn := tls.Client(conn, d.Config)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("tls handshake: %v", err)
+	}
+	return tlsConn, nil
+}
+
+// WithTLSConfig makes Connect speak the OpenShowVar protocol over TLS.
+//
+// The TLS layer is added on top of the configured Dialer, or plain TCP if none is set.
+// When config.ServerName is empty, TCP_IP is used to verify the server certificate.
+// Client certificates are provided through config.Certificates.
+func WithTLSConfig(config *tls.Config) Option {
+	return func(osv *OpenShowVar) {
+		osv.TLSConfig = config
+	}
+}
+
+// VerifyPinnedKeys returns a function for tls.Config.VerifyConnection that accepts
+// the server only if the SHA-256 hash of its leaf certificate public key matches one of pins.
+//
+// Pinning is checked in addition to the regular certificate verification.
+func VerifyPinnedKeys(pins ...[sha256.Size]byte) func(tls.ConnectionState) error {
+	return func(state tls.ConnectionState) error {
+		if len(state.PeerCertificates) == 0 {
+			return errors.New("no server certificate")
+		}
+		hash := sha256.Sum256(state.PeerCertificates[0].RawSubjectPublicKeyInfo)
+		for _, pin := range pins {
+			if bytes.Equal(hash[:], pin[:]) {
+				return nil
+			}
+		}
+		return errors.New("server public key does not match any pin")
+	}
+}
@@ -0,0 +1,77 @@
+package openshowvar
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName identifies the spans created by this package.
+const tracerName = "github.com/selimserbes/go-openshowvar/pkg/openshowvar"
+
+// WithTracerProvider enables OpenTelemetry spans for Connect, Read, Write and
+// Send, and for batches started with TraceBatch.
+//
+// Spans are children of the span in the context passed to the ...Context
+// methods and carry the server address, variable name, mode, message ID and
+// response size.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(osv *OpenShowVar) {
+		osv.Tracer = tp.Tracer(tracerName)
+	}
+}
+
+// startSpan starts a client span with the server address attributes, or
+// returns ctx unchanged and a nil span when tracing is disabled.
+func (osv *OpenShowVar) startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	if osv.Tracer == nil {
+		return ctx, nil
+	}
+	attrs = append(attrs,
+		attribute.String("server.address", osv.TCP_IP),
+		attribute.Int("server.port", osv.TCP_PORT),
+	)
+	return osv.Tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+}
+
+// endSpan records err on span and ends it. It does nothing when span is nil.
+func endSpan(span trace.Span, err error, attrs ...attribute.KeyValue) {
+	if span == nil {
+		return
+	}
+	span.SetAttributes(attrs...)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// TraceBatch starts a span for a batch of reads or writes, e.g. of the
+// gateway batch endpoints, so the spans of its requests become its children.
+//
+// Parameters:
+// - ctx: The context of the batch.
+// - mode: ModeRead or ModeWrite.
+// - size: The number of variables in the batch.
+//
+// Returns: The context for the requests of the batch and a function ending
+// the span with the error of the batch, nil if it succeeded.
+func (osv *OpenShowVar) TraceBatch(ctx context.Context, mode byte, size int) (context.Context, func(err error)) {
+	if osv.Tracer == nil {
+		return ctx, func(error) {}
+	}
+	name := "openshowvar.BatchRead"
+	if mode == ModeWrite {
+		name = "openshowvar.BatchWrite"
+	}
+	ctx, span := osv.Tracer.Start(ctx, name, trace.WithAttributes(
+		attribute.String("server.address", osv.TCP_IP),
+		attribute.Int("server.port", osv.TCP_PORT),
+		attribute.String("openshowvar.mode", modeName(mode)),
+		attribute.Int("openshowvar.batch_size", size),
+	))
+	return ctx, func(err error) { endSpan(span, err) }
+}
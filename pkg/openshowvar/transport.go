@@ -0,0 +1,80 @@
+package openshowvar
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// Dialer opens the stream the client uses to talk to KukaVarProxy.
+//
+// Any implementation returning a net.Conn can be used, which allows the
+// OpenShowVar protocol to run over transports other than plain TCP.
+type Dialer interface {
+	DialContext(ctx context.Context) (net.Conn, error)
+}
+
+// DialerFunc adapts an ordinary function to the Dialer interface.
+type DialerFunc func(ctx context.Context) (net.Conn, error)
+
+// DialContext calls f(ctx).
+func (f DialerFunc) DialContext(ctx context.Context) (net.Conn, error) {
+	return f(ctx)
+}
+
+// TCPDialer connects to KukaVarProxy over TCP. It is the default transport.
+type TCPDialer struct {
+	// Address of the server in host:port form.
+	Address string
+	// Timeout for establishing the connection, zero means no timeout.
+	Timeout time.Duration
+}
+
+// DialContext establishes a TCP connection to d.Address.
+func (d TCPDialer) DialContext(ctx context.Context) (net.Conn, error) {
+	dialer := net.Dialer{Timeout: d.Timeout}
+	return dialer.DialContext(ctx, "tcp", d.Address)
+}
+
+// UnixDialer connects to KukaVarProxy, or a local relay in front of it, over a Unix domain socket.
+type UnixDialer struct {
+	// Path of the socket file.
+	Path string
+	// Timeout for establishing the connection, zero means no timeout.
+	Timeout time.Duration
+}
+
+// DialContext establishes a connection to the socket at d.Path.
+func (d UnixDialer) DialContext(ctx context.Context) (net.Conn, error) {
+	dialer := net.Dialer{Timeout: d.Timeout}
+	return dialer.DialContext(ctx, "unix", d.Path)
+}
+
+// PipeDialer connects the client to an in-memory server using net.Pipe.
+//
+// It is intended for tests: every dial creates a new pipe and runs Serve
+// with the server end in its own goroutine.
+type PipeDialer struct {
+	// Serve handles the server end of the pipe. It should close the connection when done.
+	Serve func(conn net.Conn)
+}
+
+// DialContext creates a pipe, starts d.Serve on the server end and returns the client end.
+func (d PipeDialer) DialContext(ctx context.Context) (net.Conn, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	client, server := net.Pipe()
+	go d.Serve(server)
+	return client, nil
+}
+
+// Option configures an OpenShowVar instance.
+type Option func(*OpenShowVar)
+
+// WithDialer sets the transport used by Connect instead of the default TCP dialer.
+func WithDialer(d Dialer) Option {
+	return func(osv *OpenShowVar) {
+		osv.Dialer = d
+	}
+}
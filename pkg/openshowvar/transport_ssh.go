@@ -0,0 +1,68 @@
+package openshowvar
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// SSHDialer reaches KukaVarProxy through an SSH jump host.
+//
+// Each dial opens a new SSH connection to JumpHost and forwards a TCP stream
+// from there to Address, so no system-level port forwarding is needed.
+type SSHDialer struct {
+	// JumpHost is the SSH server in host:port form.
+	JumpHost string
+	// Config holds the SSH credentials and host key policy. It is required.
+	Config *ssh.ClientConfig
+	// Address of KukaVarProxy in host:port form, as seen from the jump host.
+	Address string
+}
+
+// DialContext connects to the jump host and opens a forwarded stream to d.Address.
+func (d SSHDialer) DialContext(ctx context.Context) (net.Conn, error) {
+	if d.Config == nil {
+		return nil, errors.New("ssh dialer: missing client config")
+	}
+	dialer := net.Dialer{Timeout: d.Config.Timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", d.JumpHost)
+	if err != nil {
+		return nil, err
+	}
+
+	// Bound the SSH handshake by the context deadline.
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, d.JumpHost, d.Config)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("ssh handshake: %v", err)
+	}
+	conn.SetDeadline(time.Time{})
+	client := ssh.NewClient(sshConn, chans, reqs)
+
+	stream, err := client.DialContext(ctx, "tcp", d.Address)
+	if err != nil {
+		client.Close()
+		return nil, fmt.Errorf("ssh forward to %s: %v", d.Address, err)
+	}
+	return &tunnelConn{Conn: stream, client: client}, nil
+}
+
+// tunnelConn closes the underlying SSH client together with the forwarded stream.
+type tunnelConn struct {
+	net.Conn
+	client *ssh.Client
+}
+
+// Close closes the forwarded stream and the SSH connection it runs over.
+func (c *tunnelConn) Close() error {
+	err := c.Conn.Close()
+	c.client.Close()
+	return err
+}
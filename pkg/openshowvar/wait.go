@@ -0,0 +1,79 @@
+package openshowvar
+
+import (
+	"context"
+	"time"
+
+	"github.com/selimserbes/go-openshowvar/pkg/krl"
+)
+
+// defaultWaitPoll is the polling interval of the wait helpers used when the
+// given interval is not positive.
+const defaultWaitPoll = 20 * time.Millisecond
+
+// WaitFor polls a variable until its value satisfies predicate.
+//
+// Parameters:
+// - ctx: Context bounding the wait, e.g. with a timeout.
+// - varname: The name of the variable to poll.
+// - predicate: Reports whether a value ends the wait.
+// - pollInterval: Time between reads, 20ms if not positive.
+//
+// Returns: The satisfying value, or the first read error or context error.
+func (osv *OpenShowVar) WaitFor(ctx context.Context, varname string, predicate func(value string) bool, pollInterval time.Duration) (string, error) {
+	if pollInterval <= 0 {
+		pollInterval = defaultWaitPoll
+	}
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		value, err := osv.ReadContext(ctx, varname)
+		if err != nil {
+			return "", contextError(ctx, err)
+		}
+		if predicate(value) {
+			return value, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// WaitUntilEquals polls a variable until it equals want, e.g. until PART_READY is TRUE.
+// Values are compared as KRL literals, so "TRUE" matches "true" and "1.0" matches "1".
+//
+// Parameters:
+// - ctx: Context bounding the wait, e.g. with a timeout.
+// - varname: The name of the variable to poll.
+// - want: The expected value.
+// - pollInterval: Time between reads, 20ms if not positive.
+//
+// Returns: The matching value, or the first read error or context error.
+func (osv *OpenShowVar) WaitUntilEquals(ctx context.Context, varname string, want string, pollInterval time.Duration) (string, error) {
+	return osv.WaitFor(ctx, varname, func(value string) bool {
+		return krl.EqualStrings(value, want, 0)
+	}, pollInterval)
+}
+
+// WaitForChange polls a variable until its value differs from the value read first.
+//
+// Parameters:
+// - ctx: Context bounding the wait, e.g. with a timeout.
+// - varname: The name of the variable to poll.
+// - pollInterval: Time between reads, 20ms if not positive.
+//
+// Returns: The new value, or the first read error or context error.
+func (osv *OpenShowVar) WaitForChange(ctx context.Context, varname string, pollInterval time.Duration) (string, error) {
+	initial, err := osv.ReadContext(ctx, varname)
+	if err != nil {
+		return "", contextError(ctx, err)
+	}
+	return osv.WaitFor(ctx, varname, func(value string) bool {
+		return value != initial
+	}, pollInterval)
+}
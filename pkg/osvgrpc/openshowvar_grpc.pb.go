@@ -0,0 +1,356 @@
+// Access to the variables of KUKA robots through KukaVarProxy.
+//
+// Regenerate the Go code with:
+//
+//   protoc --go_out=. --go_opt=paths=source_relative \
+//     --go-grpc_out=. --go-grpc_opt=paths=source_relative openshowvar.proto
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v5.27.3
+// source: openshowvar.proto
+
+package osvgrpc
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	OpenShowVar_ListRobots_FullMethodName = "/openshowvar.v1.OpenShowVar/ListRobots"
+	OpenShowVar_Read_FullMethodName       = "/openshowvar.v1.OpenShowVar/Read"
+	OpenShowVar_Write_FullMethodName      = "/openshowvar.v1.OpenShowVar/Write"
+	OpenShowVar_BatchRead_FullMethodName  = "/openshowvar.v1.OpenShowVar/BatchRead"
+	OpenShowVar_BatchWrite_FullMethodName = "/openshowvar.v1.OpenShowVar/BatchWrite"
+	OpenShowVar_Watch_FullMethodName      = "/openshowvar.v1.OpenShowVar/Watch"
+)
+
+// OpenShowVarClient is the client API for OpenShowVar service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// OpenShowVar reads, writes and watches the variables of the robots served
+// by the server. Every request names the robot by its ID.
+//
+// Errors of whole requests use the gRPC status codes NOT_FOUND for unknown
+// robots and variables, INVALID_ARGUMENT for malformed requests,
+// DEADLINE_EXCEEDED for timeouts and UNAVAILABLE when the robot cannot be
+// reached.
+type OpenShowVarClient interface {
+	// ListRobots returns the robots served by the server.
+	ListRobots(ctx context.Context, in *ListRobotsRequest, opts ...grpc.CallOption) (*ListRobotsResponse, error)
+	// Read reads a variable.
+	Read(ctx context.Context, in *ReadRequest, opts ...grpc.CallOption) (*Variable, error)
+	// Write writes a variable and returns the value read back by the robot.
+	Write(ctx context.Context, in *WriteRequest, opts ...grpc.CallOption) (*Variable, error)
+	// BatchRead reads several variables. Missing variables are reported in
+	// the error field of their result.
+	BatchRead(ctx context.Context, in *BatchReadRequest, opts ...grpc.CallOption) (*BatchResponse, error)
+	// BatchWrite writes several variables in order. Rejected values are
+	// reported in the error field of their result.
+	BatchWrite(ctx context.Context, in *BatchWriteRequest, opts ...grpc.CallOption) (*BatchResponse, error)
+	// Watch polls variables and streams their changes. The first change of
+	// each variable carries its current value.
+	Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Change], error)
+}
+
+type openShowVarClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewOpenShowVarClient(cc grpc.ClientConnInterface) OpenShowVarClient {
+	return &openShowVarClient{cc}
+}
+
+func (c *openShowVarClient) ListRobots(ctx context.Context, in *ListRobotsRequest, opts ...grpc.CallOption) (*ListRobotsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListRobotsResponse)
+	err := c.cc.Invoke(ctx, OpenShowVar_ListRobots_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *openShowVarClient) Read(ctx context.Context, in *ReadRequest, opts ...grpc.CallOption) (*Variable, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Variable)
+	err := c.cc.Invoke(ctx, OpenShowVar_Read_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *openShowVarClient) Write(ctx context.Context, in *WriteRequest, opts ...grpc.CallOption) (*Variable, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Variable)
+	err := c.cc.Invoke(ctx, OpenShowVar_Write_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *openShowVarClient) BatchRead(ctx context.Context, in *BatchReadRequest, opts ...grpc.CallOption) (*BatchResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(BatchResponse)
+	err := c.cc.Invoke(ctx, OpenShowVar_BatchRead_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *openShowVarClient) BatchWrite(ctx context.Context, in *BatchWriteRequest, opts ...grpc.CallOption) (*BatchResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(BatchResponse)
+	err := c.cc.Invoke(ctx, OpenShowVar_BatchWrite_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *openShowVarClient) Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Change], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &OpenShowVar_ServiceDesc.Streams[0], OpenShowVar_Watch_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchRequest, Change]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type OpenShowVar_WatchClient = grpc.ServerStreamingClient[Change]
+
+// OpenShowVarServer is the server API for OpenShowVar service.
+// All implementations must embed UnimplementedOpenShowVarServer
+// for forward compatibility.
+//
+// OpenShowVar reads, writes and watches the variables of the robots served
+// by the server. Every request names the robot by its ID.
+//
+// Errors of whole requests use the gRPC status codes NOT_FOUND for unknown
+// robots and variables, INVALID_ARGUMENT for malformed requests,
+// DEADLINE_EXCEEDED for timeouts and UNAVAILABLE when the robot cannot be
+// reached.
+type OpenShowVarServer interface {
+	// ListRobots returns the robots served by the server.
+	ListRobots(context.Context, *ListRobotsRequest) (*ListRobotsResponse, error)
+	// Read reads a variable.
+	Read(context.Context, *ReadRequest) (*Variable, error)
+	// Write writes a variable and returns the value read back by the robot.
+	Write(context.Context, *WriteRequest) (*Variable, error)
+	// BatchRead reads several variables. Missing variables are reported in
+	// the error field of their result.
+	BatchRead(context.Context, *BatchReadRequest) (*BatchResponse, error)
+	// BatchWrite writes several variables in order. Rejected values are
+	// reported in the error field of their result.
+	BatchWrite(context.Context, *BatchWriteRequest) (*BatchResponse, error)
+	// Watch polls variables and streams their changes. The first change of
+	// each variable carries its current value.
+	Watch(*WatchRequest, grpc.ServerStreamingServer[Change]) error
+	mustEmbedUnimplementedOpenShowVarServer()
+}
+
+// UnimplementedOpenShowVarServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedOpenShowVarServer struct{}
+
+func (UnimplementedOpenShowVarServer) ListRobots(context.Context, *ListRobotsRequest) (*ListRobotsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListRobots not implemented")
+}
+func (UnimplementedOpenShowVarServer) Read(context.Context, *ReadRequest) (*Variable, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Read not implemented")
+}
+func (UnimplementedOpenShowVarServer) Write(context.Context, *WriteRequest) (*Variable, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Write not implemented")
+}
+func (UnimplementedOpenShowVarServer) BatchRead(context.Context, *BatchReadRequest) (*BatchResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BatchRead not implemented")
+}
+func (UnimplementedOpenShowVarServer) BatchWrite(context.Context, *BatchWriteRequest) (*BatchResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BatchWrite not implemented")
+}
+func (UnimplementedOpenShowVarServer) Watch(*WatchRequest, grpc.ServerStreamingServer[Change]) error {
+	return status.Errorf(codes.Unimplemented, "method Watch not implemented")
+}
+func (UnimplementedOpenShowVarServer) mustEmbedUnimplementedOpenShowVarServer() {}
+func (UnimplementedOpenShowVarServer) testEmbeddedByValue()                     {}
+
+// UnsafeOpenShowVarServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to OpenShowVarServer will
+// result in compilation errors.
+type UnsafeOpenShowVarServer interface {
+	mustEmbedUnimplementedOpenShowVarServer()
+}
+
+func RegisterOpenShowVarServer(s grpc.ServiceRegistrar, srv OpenShowVarServer) {
+	// If the following call pancis, it indicates UnimplementedOpenShowVarServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&OpenShowVar_ServiceDesc, srv)
+}
+
+func _OpenShowVar_ListRobots_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListRobotsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OpenShowVarServer).ListRobots(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: OpenShowVar_ListRobots_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OpenShowVarServer).ListRobots(ctx, req.(*ListRobotsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _OpenShowVar_Read_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReadRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OpenShowVarServer).Read(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: OpenShowVar_Read_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OpenShowVarServer).Read(ctx, req.(*ReadRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _OpenShowVar_Write_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(WriteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OpenShowVarServer).Write(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: OpenShowVar_Write_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OpenShowVarServer).Write(ctx, req.(*WriteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _OpenShowVar_BatchRead_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BatchReadRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OpenShowVarServer).BatchRead(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: OpenShowVar_BatchRead_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OpenShowVarServer).BatchRead(ctx, req.(*BatchReadRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _OpenShowVar_BatchWrite_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BatchWriteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OpenShowVarServer).BatchWrite(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: OpenShowVar_BatchWrite_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OpenShowVarServer).BatchWrite(ctx, req.(*BatchWriteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _OpenShowVar_Watch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(OpenShowVarServer).Watch(m, &grpc.GenericServerStream[WatchRequest, Change]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type OpenShowVar_WatchServer = grpc.ServerStreamingServer[Change]
+
+// OpenShowVar_ServiceDesc is the grpc.ServiceDesc for OpenShowVar service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var OpenShowVar_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "openshowvar.v1.OpenShowVar",
+	HandlerType: (*OpenShowVarServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListRobots",
+			Handler:    _OpenShowVar_ListRobots_Handler,
+		},
+		{
+			MethodName: "Read",
+			Handler:    _OpenShowVar_Read_Handler,
+		},
+		{
+			MethodName: "Write",
+			Handler:    _OpenShowVar_Write_Handler,
+		},
+		{
+			MethodName: "BatchRead",
+			Handler:    _OpenShowVar_BatchRead_Handler,
+		},
+		{
+			MethodName: "BatchWrite",
+			Handler:    _OpenShowVar_BatchWrite_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Watch",
+			Handler:       _OpenShowVar_Watch_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "openshowvar.proto",
+}
@@ -0,0 +1,293 @@
+// Package osvgrpc serves robot variables over gRPC.
+//
+// The service is defined in openshowvar.proto, openshowvar.pb.go and
+// openshowvar_grpc.pb.go are generated from it. Server implements the
+// service on top of the robots of a gateway, so HTTP and gRPC clients share
+// one connection and one poller per variable:
+//
+//	gw, _ := gateway.New(robots...)
+//	s := grpc.NewServer()
+//	osvgrpc.RegisterOpenShowVarServer(s, osvgrpc.NewServer(gw))
+//	s.Serve(listener)
+package osvgrpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/selimserbes/go-openshowvar/pkg/gateway"
+	"github.com/selimserbes/go-openshowvar/pkg/krl"
+	"github.com/selimserbes/go-openshowvar/pkg/openshowvar"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Server implements OpenShowVarServer for the robots of a gateway.
+type Server struct {
+	UnimplementedOpenShowVarServer
+
+	// Timeout bounds each request to a robot without a deadline of its own, 5s if zero.
+	Timeout time.Duration
+	// WatchInterval is the default poll interval of Watch, 100ms if zero.
+	WatchInterval time.Duration
+
+	gw *gateway.Gateway
+}
+
+// NewServer creates a gRPC server for the robots of gw.
+//
+// Parameters:
+// - gw: The gateway whose robots are served.
+//
+// Returns: A new Server, registered with RegisterOpenShowVarServer.
+func NewServer(gw *gateway.Gateway) *Server {
+	return &Server{gw: gw}
+}
+
+// ListRobots implements OpenShowVarServer.
+func (s *Server) ListRobots(ctx context.Context, req *ListRobotsRequest) (*ListRobotsResponse, error) {
+	resp := &ListRobotsResponse{}
+	for _, r := range s.gw.Robots() {
+		resp.Robots = append(resp.Robots, &Robot{
+			Id:        r.ID,
+			Address:   fmt.Sprintf("%s:%d", r.Client.TCP_IP, r.Client.TCP_PORT),
+			Connected: r.Connected(),
+		})
+	}
+	return resp, nil
+}
+
+// Read implements OpenShowVarServer.
+func (s *Server) Read(ctx context.Context, req *ReadRequest) (*Variable, error) {
+	r, err := s.robot(req.GetRobot())
+	if err != nil {
+		return nil, err
+	}
+	if req.GetName() == "" {
+		return nil, status.Error(codes.InvalidArgument, "missing name")
+	}
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	value, err := r.Do(ctx, func(ctx context.Context, osv *openshowvar.OpenShowVar) (string, error) {
+		return osv.ReadContext(ctx, req.GetName())
+	})
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return NewVariable(req.GetName(), value), nil
+}
+
+// Write implements OpenShowVarServer.
+func (s *Server) Write(ctx context.Context, req *WriteRequest) (*Variable, error) {
+	r, err := s.robot(req.GetRobot())
+	if err != nil {
+		return nil, err
+	}
+	if req.GetName() == "" || req.GetValue() == "" {
+		return nil, status.Error(codes.InvalidArgument, "missing name or value")
+	}
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	written, err := r.Do(ctx, func(ctx context.Context, osv *openshowvar.OpenShowVar) (string, error) {
+		return osv.WriteContext(ctx, req.GetName(), req.GetValue())
+	})
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return NewVariable(req.GetName(), written), nil
+}
+
+// BatchRead implements OpenShowVarServer. The request fails only when the
+// connection fails.
+func (s *Server) BatchRead(ctx context.Context, req *BatchReadRequest) (*BatchResponse, error) {
+	r, err := s.robot(req.GetRobot())
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	ctx, end := r.Client.TraceBatch(ctx, openshowvar.ModeRead, len(req.GetNames()))
+	resp := &BatchResponse{}
+	for _, name := range req.GetNames() {
+		value, err := r.Do(ctx, func(ctx context.Context, osv *openshowvar.OpenShowVar) (string, error) {
+			return osv.ReadContext(ctx, name)
+		})
+		if err != nil && !errors.Is(err, openshowvar.ErrVariableNotFound) {
+			end(err)
+			return nil, statusError(err)
+		}
+		resp.Variables = append(resp.Variables, result(name, value, err))
+	}
+	end(nil)
+	return resp, nil
+}
+
+// BatchWrite implements OpenShowVarServer. All values are checked before
+// any of them is written.
+func (s *Server) BatchWrite(ctx context.Context, req *BatchWriteRequest) (*BatchResponse, error) {
+	r, err := s.robot(req.GetRobot())
+	if err != nil {
+		return nil, err
+	}
+	for i, v := range req.GetValues() {
+		if v.GetName() == "" || v.GetValue() == "" {
+			return nil, status.Errorf(codes.InvalidArgument, "values[%d]: missing name or value", i)
+		}
+	}
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	ctx, end := r.Client.TraceBatch(ctx, openshowvar.ModeWrite, len(req.GetValues()))
+	resp := &BatchResponse{}
+	for _, v := range req.GetValues() {
+		written, err := r.Do(ctx, func(ctx context.Context, osv *openshowvar.OpenShowVar) (string, error) {
+			return osv.WriteContext(ctx, v.GetName(), v.GetValue())
+		})
+		if err != nil && !errors.Is(err, openshowvar.ErrVariableNotFound) {
+			end(err)
+			return nil, statusError(err)
+		}
+		resp.Variables = append(resp.Variables, result(v.GetName(), written, err))
+	}
+	end(nil)
+	return resp, nil
+}
+
+// Watch implements OpenShowVarServer.
+//
+// Variables are polled with Subscribe, so all watchers of a robot share one
+// poller per variable. A client that does not keep up skips values instead
+// of slowing down the poller. The robot is reconnected while reads fail
+// because of the connection.
+func (s *Server) Watch(req *WatchRequest, stream OpenShowVar_WatchServer) error {
+	r, err := s.robot(req.GetRobot())
+	if err != nil {
+		return err
+	}
+	if len(req.GetNames()) == 0 {
+		return status.Error(codes.InvalidArgument, "missing names")
+	}
+	interval := s.watchInterval()
+	if req.GetInterval() != nil {
+		interval = req.GetInterval().AsDuration()
+	}
+
+	ctx := stream.Context()
+	connectCtx, cancel := s.withTimeout(ctx)
+	err = r.Connect(connectCtx)
+	cancel()
+	if err != nil {
+		return statusError(err)
+	}
+
+	// Merge the changes of all variables into one channel.
+	changes := make(chan openshowvar.Change)
+	subscribed := make(map[string]bool)
+	for _, name := range req.GetNames() {
+		if subscribed[name] {
+			continue
+		}
+		subscribed[name] = true
+		go func(sub <-chan openshowvar.Change) {
+			for change := range sub {
+				select {
+				case changes <- change:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}(r.Subscribe(ctx, name, interval))
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case change := <-changes:
+			if err := stream.Send(newChange(r.ID, change)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// NewVariable creates the message of a value read from a robot, with the
+// typed value parsed from the KRL literal.
+func NewVariable(name, raw string) *Variable {
+	v := &Variable{Name: name, Raw: raw}
+	if parsed, err := krl.Parse(raw); err == nil {
+		if value, err := structpb.NewValue(parsed.Interface()); err == nil {
+			v.Value = value
+		}
+	}
+	return v
+}
+
+// newChange creates the message of a change of a watched variable.
+func newChange(robot string, change openshowvar.Change) *Change {
+	return &Change{
+		Robot:    robot,
+		Variable: result(change.VarName, change.Value, change.Err),
+		Previous: change.Previous,
+		Time:     timestamppb.New(change.Time),
+	}
+}
+
+// result creates the message of one variable of a batch.
+func result(name, value string, err error) *Variable {
+	if err != nil {
+		return &Variable{Name: name, Error: err.Error()}
+	}
+	return NewVariable(name, value)
+}
+
+// robot looks up a robot, returning a NotFound status if it does not exist.
+func (s *Server) robot(id string) (*gateway.Robot, error) {
+	r, ok := s.gw.Robot(id)
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "unknown robot %q", id)
+	}
+	return r, nil
+}
+
+// withTimeout applies Timeout to requests without a deadline.
+func (s *Server) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok {
+		return context.WithCancel(ctx)
+	}
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// watchInterval returns the default poll interval of Watch.
+func (s *Server) watchInterval() time.Duration {
+	if s.WatchInterval > 0 {
+		return s.WatchInterval
+	}
+	return 100 * time.Millisecond
+}
+
+// statusError maps an error of a robot request to a gRPC status.
+func statusError(err error) error {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, openshowvar.ErrVariableNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	}
+	return status.Error(codes.Unavailable, err.Error())
+}
@@ -0,0 +1,152 @@
+package recorder
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/selimserbes/go-openshowvar/pkg/openshowvar"
+)
+
+// csvPendingRecords is the number of records held back while waiting for
+// the first successful read of every variable.
+const csvPendingRecords = 100
+
+// csvEncoder writes records as CSV rows.
+//
+// The columns are time, elapsed and then one column per variable, or one per
+// member for STRUC values, taken from the first successful read of each
+// variable. Records are held back until every variable was read once, or
+// csvPendingRecords were held, and the header is written then. Variables
+// without a successful read by then get a single column. Values of failed
+// reads are left empty, and a later value with members missing from the
+// header is an error.
+type csvEncoder struct {
+	w *csv.Writer
+	// layouts holds the columns of each variable read successfully.
+	layouts map[string][]string
+	// pending holds the records received before the header was written.
+	pending []Record
+	columns []string
+	known   map[string]bool
+}
+
+// newCSVEncoder creates a CSV encoder.
+func newCSVEncoder(w io.Writer) *csvEncoder {
+	return &csvEncoder{w: csv.NewWriter(w), layouts: make(map[string][]string)}
+}
+
+// encode writes the record, or holds it back until the header is known.
+func (e *csvEncoder) encode(rec Record) error {
+	for _, s := range rec.Values {
+		if _, ok := e.layouts[s.VarName]; !ok && s.Err == nil {
+			var names []string
+			for _, c := range csvCells(s) {
+				names = append(names, c.name)
+			}
+			e.layouts[s.VarName] = names
+		}
+	}
+	if e.columns != nil {
+		return e.writeRow(rec)
+	}
+
+	e.pending = append(e.pending, rec)
+	for _, s := range rec.Values {
+		if _, ok := e.layouts[s.VarName]; !ok && len(e.pending) < csvPendingRecords {
+			return nil
+		}
+	}
+	return e.writePending()
+}
+
+// csvCell is the value of one column.
+type csvCell struct {
+	name  string
+	value string
+}
+
+// csvCells returns the cells of one sample in column order, none for a
+// failed read.
+func csvCells(s openshowvar.Sample) []csvCell {
+	if s.Err != nil {
+		return nil
+	}
+	v, ok := parseSample(s)
+	if !ok {
+		return []csvCell{{s.VarName, s.Value}}
+	}
+	var cells []csvCell
+	for _, f := range v.Flatten(s.VarName) {
+		cells = append(cells, csvCell{f.Name, f.Value.Text()})
+	}
+	return cells
+}
+
+// writePending writes the header and the records held back.
+func (e *csvEncoder) writePending() error {
+	if len(e.pending) == 0 {
+		return nil
+	}
+	e.columns = []string{}
+	e.known = make(map[string]bool)
+	for _, s := range e.pending[0].Values {
+		names, ok := e.layouts[s.VarName]
+		if !ok {
+			names = []string{s.VarName}
+		}
+		for _, name := range names {
+			e.columns = append(e.columns, name)
+			e.known[name] = true
+		}
+	}
+	if err := e.w.Write(append([]string{"time", "elapsed"}, e.columns...)); err != nil {
+		return err
+	}
+
+	pending := e.pending
+	e.pending = nil
+	for _, rec := range pending {
+		if err := e.writeRow(rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeRow writes one record below the header.
+func (e *csvEncoder) writeRow(rec Record) error {
+	values := make(map[string]string)
+	for _, s := range rec.Values {
+		for _, c := range csvCells(s) {
+			if !e.known[c.name] {
+				return fmt.Errorf("recorder: column %s of %s is not in the CSV header", c.name, s.VarName)
+			}
+			values[c.name] = c.value
+		}
+	}
+
+	row := make([]string, 0, 2+len(e.columns))
+	row = append(row, rec.Time.Format(time.RFC3339Nano), strconv.FormatFloat(rec.Elapsed.Seconds(), 'f', 6, 64))
+	for _, column := range e.columns {
+		row = append(row, values[column])
+	}
+	return e.w.Write(row)
+}
+
+// flush writes buffered rows to the file.
+func (e *csvEncoder) flush() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// close writes the records still held back and flushes the encoder, the
+// file itself is closed by the recorder.
+func (e *csvEncoder) close() error {
+	if err := e.writePending(); err != nil {
+		return err
+	}
+	return e.flush()
+}
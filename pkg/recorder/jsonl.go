@@ -0,0 +1,63 @@
+package recorder
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// jsonRecord is the JSON Lines representation of a record.
+type jsonRecord struct {
+	Time    time.Time         `json:"time"`
+	Elapsed float64           `json:"elapsed"`
+	Values  map[string]any    `json:"values"`
+	Errors  map[string]string `json:"errors,omitempty"`
+}
+
+// jsonEncoder writes records as JSON Lines with typed values. STRUC values
+// become nested objects, values that are not KRL literals are kept as strings.
+type jsonEncoder struct {
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+// newJSONEncoder creates a JSON Lines encoder.
+func newJSONEncoder(w io.Writer) *jsonEncoder {
+	bw := bufio.NewWriter(w)
+	return &jsonEncoder{w: bw, enc: json.NewEncoder(bw)}
+}
+
+// encode writes a record as one line.
+func (e *jsonEncoder) encode(rec Record) error {
+	out := jsonRecord{
+		Time:    rec.Time,
+		Elapsed: rec.Elapsed.Seconds(),
+		Values:  make(map[string]any, len(rec.Values)),
+	}
+	for _, s := range rec.Values {
+		if s.Err != nil {
+			if out.Errors == nil {
+				out.Errors = make(map[string]string)
+			}
+			out.Errors[s.VarName] = s.Err.Error()
+			continue
+		}
+		if v, ok := parseSample(s); ok {
+			out.Values[s.VarName] = v.Interface()
+		} else {
+			out.Values[s.VarName] = s.Value
+		}
+	}
+	return e.enc.Encode(out)
+}
+
+// flush writes buffered lines to the file.
+func (e *jsonEncoder) flush() error {
+	return e.w.Flush()
+}
+
+// close flushes the encoder, the file itself is closed by the recorder.
+func (e *jsonEncoder) close() error {
+	return e.flush()
+}
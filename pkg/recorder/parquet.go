@@ -0,0 +1,224 @@
+package recorder
+
+import (
+	"io"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/selimserbes/go-openshowvar/pkg/krl"
+)
+
+// parquetRowGroupRows is the number of records buffered per row group,
+// about eight minutes of samples at 20 Hz.
+const parquetRowGroupRows = 10000
+
+// parquetPendingRecords is the number of records held back while waiting
+// for the first successful read of every variable.
+const parquetPendingRecords = 100
+
+// parquetColumn is the schema of one variable or STRUC member, inferred
+// from its first value.
+type parquetColumn struct {
+	name   string
+	kind   krl.Kind
+	fields []parquetColumn
+}
+
+// parquetEncoder writes records as Apache Parquet.
+//
+// The schema has time, elapsed and one column per variable, typed by the
+// first successful read of the variable. INT becomes int32, REAL float, BOOL
+// boolean, STRING and ENUM strings, and STRUC a nested group. Records are
+// held back until every variable was read once, or parquetPendingRecords
+// were held, and the schema is fixed then. Variables without a successful
+// read by then, and values that are not KRL literals, become string columns.
+// Values of failed reads and values that do not match the schema are null.
+//
+// Records are written in row groups of parquetRowGroupRows, so the file only
+// grows, and is only readable, once a row group is complete or it is closed.
+type parquetEncoder struct {
+	out io.Writer
+	w   *parquet.Writer
+	// layouts holds the column of each variable read successfully.
+	layouts map[string]parquetColumn
+	// pending holds the records received before the schema was fixed.
+	pending []Record
+	columns []parquetColumn
+}
+
+// newParquetEncoder creates a Parquet encoder.
+func newParquetEncoder(w io.Writer) *parquetEncoder {
+	return &parquetEncoder{out: w, layouts: make(map[string]parquetColumn)}
+}
+
+// encode writes the record, or holds it back until the schema is known.
+func (e *parquetEncoder) encode(rec Record) error {
+	for _, s := range rec.Values {
+		if _, ok := e.layouts[s.VarName]; !ok && s.Err == nil {
+			column := parquetColumn{name: s.VarName}
+			if v, ok := parseSample(s); ok {
+				column = newParquetColumn(s.VarName, v)
+			}
+			e.layouts[s.VarName] = column
+		}
+	}
+	if e.w != nil {
+		return e.writeRow(rec)
+	}
+
+	e.pending = append(e.pending, rec)
+	for _, s := range rec.Values {
+		if _, ok := e.layouts[s.VarName]; !ok && len(e.pending) < parquetPendingRecords {
+			return nil
+		}
+	}
+	return e.writePending()
+}
+
+// writePending creates the writer and writes the records held back.
+func (e *parquetEncoder) writePending() error {
+	if len(e.pending) == 0 {
+		return nil
+	}
+	group := parquet.Group{
+		"time":    parquet.Timestamp(parquet.Nanosecond),
+		"elapsed": parquet.Leaf(parquet.DoubleType),
+	}
+	for _, s := range e.pending[0].Values {
+		column, ok := e.layouts[s.VarName]
+		if !ok {
+			column = parquetColumn{name: s.VarName}
+		}
+		e.columns = append(e.columns, column)
+		group[column.name] = column.node()
+	}
+	e.w = parquet.NewWriter(e.out,
+		parquet.NewSchema("recording", group),
+		parquet.Compression(&parquet.Zstd),
+		parquet.MaxRowsPerRowGroup(parquetRowGroupRows),
+	)
+
+	pending := e.pending
+	e.pending = nil
+	for _, rec := range pending {
+		if err := e.writeRow(rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeRow buffers one record in the current row group.
+func (e *parquetEncoder) writeRow(rec Record) error {
+	samples := make(map[string]string, len(rec.Values))
+	for _, s := range rec.Values {
+		if s.Err == nil {
+			samples[s.VarName] = s.Value
+		}
+	}
+
+	row := map[string]any{
+		"time":    rec.Time,
+		"elapsed": rec.Elapsed.Seconds(),
+	}
+	for _, column := range e.columns {
+		raw, ok := samples[column.name]
+		if !ok {
+			row[column.name] = nil
+			continue
+		}
+		if column.kind == krl.Invalid {
+			row[column.name] = raw
+			continue
+		}
+		v, err := krl.Parse(raw)
+		if err != nil {
+			row[column.name] = nil
+			continue
+		}
+		row[column.name] = column.value(v)
+	}
+	return e.w.Write(row)
+}
+
+// flush does nothing, records are written a row group at a time.
+func (e *parquetEncoder) flush() error {
+	return nil
+}
+
+// close writes the records still held back, the buffered row group and the
+// file footer.
+func (e *parquetEncoder) close() error {
+	if err := e.writePending(); err != nil {
+		return err
+	}
+	if e.w == nil {
+		return nil
+	}
+	return e.w.Close()
+}
+
+// newParquetColumn infers the column of a value.
+func newParquetColumn(name string, v krl.Value) parquetColumn {
+	column := parquetColumn{name: name, kind: v.Kind}
+	for _, f := range v.Fields {
+		column.fields = append(column.fields, newParquetColumn(f.Name, f.Value))
+	}
+	return column
+}
+
+// node returns the optional Parquet node of the column.
+func (c parquetColumn) node() parquet.Node {
+	switch c.kind {
+	case krl.Int:
+		return parquet.Optional(parquet.Int(32))
+	case krl.Real:
+		return parquet.Optional(parquet.Leaf(parquet.FloatType))
+	case krl.Bool:
+		return parquet.Optional(parquet.Leaf(parquet.BooleanType))
+	case krl.Enum:
+		return parquet.Optional(parquet.Enum())
+	case krl.Struc:
+		group := make(parquet.Group, len(c.fields))
+		for _, f := range c.fields {
+			group[f.name] = f.node()
+		}
+		return parquet.Optional(group)
+	default:
+		return parquet.Optional(parquet.String())
+	}
+}
+
+// value converts v to the Go value of the column, or nil if it does not match.
+func (c parquetColumn) value(v krl.Value) any {
+	switch c.kind {
+	case krl.Int:
+		if v.Kind == krl.Int {
+			return int32(v.Int)
+		}
+	case krl.Real:
+		if f, ok := v.Float(); ok {
+			return float32(f)
+		}
+	case krl.Bool:
+		if v.Kind == krl.Bool {
+			return v.Bool
+		}
+	case krl.String, krl.Enum:
+		if v.Kind == c.kind {
+			return v.Str
+		}
+	case krl.Struc:
+		if v.Kind != krl.Struc {
+			return nil
+		}
+		group := make(map[string]any, len(c.fields))
+		for _, f := range c.fields {
+			group[f.name] = nil
+			if member, ok := v.Field(f.name); ok {
+				group[f.name] = f.value(member)
+			}
+		}
+		return group
+	}
+	return nil
+}
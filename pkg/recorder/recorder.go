@@ -0,0 +1,249 @@
+// Package recorder logs robot variables over time to CSV, JSON Lines or Parquet files.
+package recorder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/selimserbes/go-openshowvar/pkg/krl"
+	"github.com/selimserbes/go-openshowvar/pkg/openshowvar"
+)
+
+// Format is the output format of a recording.
+type Format int
+
+// Supported output formats.
+const (
+	// CSV writes one row per sample with STRUC members flattened into columns.
+	CSV Format = iota
+	// JSONLines writes one JSON object per sample with typed, nested values.
+	JSONLines
+	// Parquet writes Apache Parquet with a schema inferred from the KRL types
+	// of the first sample and STRUC values as nested groups.
+	Parquet
+)
+
+// extension returns the file extension of the format.
+func (f Format) extension() string {
+	switch f {
+	case JSONLines:
+		return ".jsonl"
+	case Parquet:
+		return ".parquet"
+	}
+	return ".csv"
+}
+
+// Config describes a recording.
+type Config struct {
+	// Vars are the variables read in every sample, e.g. $POS_ACT or $VEL_ACT.
+	Vars []string
+	// Interval is the time between samples.
+	Interval time.Duration
+	// Format selects CSV, JSONLines or Parquet.
+	Format Format
+	// Path is the output file. With rotation enabled, a timestamp is inserted
+	// before the extension of every file, e.g. run-20240723-101500.000.csv.
+	Path string
+	// MaxBytes starts a new file once the current one reaches this size, zero disables it.
+	// Parquet files only grow when a row group is complete.
+	MaxBytes int64
+	// MaxAge starts a new file once the current one is this old, zero disables it.
+	MaxAge time.Duration
+}
+
+// Record is one sample of all variables.
+type Record struct {
+	// Time is the wall clock time of the sample.
+	Time time.Time
+	// Elapsed is the monotonic time since the recording started.
+	Elapsed time.Duration
+	// Values holds one sample per variable, in the order of Config.Vars.
+	Values []openshowvar.Sample
+}
+
+// encoder writes records in one output format.
+type encoder interface {
+	encode(rec Record) error
+	flush() error
+	close() error
+}
+
+// Recorder polls variables and streams the samples to files.
+type Recorder struct {
+	osv *openshowvar.OpenShowVar
+	cfg Config
+
+	file    *os.File
+	counter *countingWriter
+	enc     encoder
+	opened  time.Time
+	files   []string
+}
+
+// New creates a recorder.
+//
+// Parameters:
+// - osv: The connected client used for all reads.
+// - cfg: The recording configuration.
+//
+// Returns: A new Recorder, started with Run.
+func New(osv *openshowvar.OpenShowVar, cfg Config) *Recorder {
+	return &Recorder{osv: osv, cfg: cfg}
+}
+
+// Run records samples until ctx is done or writing fails.
+//
+// Returns: nil when ctx ends the recording, otherwise the error that stopped it.
+func (r *Recorder) Run(ctx context.Context) error {
+	if r.cfg.Path == "" {
+		return errors.New("recorder: no output path")
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	start := time.Now()
+	var writeErr error
+	poller := openshowvar.NewPoller(r.osv, openshowvar.Group{
+		Name:     "recorder",
+		Vars:     r.cfg.Vars,
+		Interval: r.cfg.Interval,
+		Handler: func(s openshowvar.Snapshot) {
+			rec := Record{Time: s.Start, Elapsed: s.Start.Sub(start), Values: s.Values}
+			if err := r.Write(rec); err != nil {
+				writeErr = err
+				cancel()
+			}
+		},
+	})
+
+	err := poller.Run(ctx)
+	if closeErr := r.Close(); writeErr == nil {
+		writeErr = closeErr
+	}
+	if writeErr != nil {
+		return writeErr
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return nil
+	}
+	return err
+}
+
+// Write appends a record, rotating the output file first if needed.
+func (r *Recorder) Write(rec Record) error {
+	if r.file == nil || r.rotationDue(rec.Time) {
+		if err := r.rotate(rec.Time); err != nil {
+			return err
+		}
+	}
+	if err := r.enc.encode(rec); err != nil {
+		return err
+	}
+	return r.enc.flush()
+}
+
+// Close flushes and closes the current output file. A Parquet file is only
+// complete once it is closed.
+func (r *Recorder) Close() error {
+	if r.file == nil {
+		return nil
+	}
+	err := r.enc.close()
+	if closeErr := r.file.Close(); err == nil {
+		err = closeErr
+	}
+	r.file = nil
+	return err
+}
+
+// Files returns the paths of all files written so far.
+func (r *Recorder) Files() []string {
+	return append([]string(nil), r.files...)
+}
+
+// rotationDue reports whether the current file has reached its size or age limit.
+func (r *Recorder) rotationDue(now time.Time) bool {
+	if r.cfg.MaxBytes > 0 && r.counter.n >= r.cfg.MaxBytes {
+		return true
+	}
+	return r.cfg.MaxAge > 0 && now.Sub(r.opened) >= r.cfg.MaxAge
+}
+
+// rotate closes the current file and opens the next one.
+func (r *Recorder) rotate(now time.Time) error {
+	if err := r.Close(); err != nil {
+		return err
+	}
+
+	file, err := r.create(now)
+	if err != nil {
+		return err
+	}
+	r.file = file
+	r.counter = &countingWriter{w: file}
+	r.opened = now
+	r.files = append(r.files, file.Name())
+	switch r.cfg.Format {
+	case JSONLines:
+		r.enc = newJSONEncoder(r.counter)
+	case Parquet:
+		r.enc = newParquetEncoder(r.counter)
+	default:
+		r.enc = newCSVEncoder(r.counter)
+	}
+	return nil
+}
+
+// create opens a new output file, timestamped when rotation is enabled.
+func (r *Recorder) create(now time.Time) (*os.File, error) {
+	if r.cfg.MaxBytes <= 0 && r.cfg.MaxAge <= 0 {
+		return os.Create(r.cfg.Path)
+	}
+
+	ext := filepath.Ext(r.cfg.Path)
+	if ext == "" {
+		ext = r.cfg.Format.extension()
+	}
+	base := strings.TrimSuffix(r.cfg.Path, filepath.Ext(r.cfg.Path)) + "-" + now.Format("20060102-150405.000")
+	for i := 0; ; i++ {
+		path := base + ext
+		if i > 0 {
+			path = fmt.Sprintf("%s-%d%s", base, i, ext)
+		}
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if !errors.Is(err, os.ErrExist) {
+			return file, err
+		}
+	}
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+// Write writes p to the underlying writer and counts the bytes.
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// parseSample parses the value of a sample, returning ok false for failed
+// reads and values that are not KRL literals.
+func parseSample(s openshowvar.Sample) (krl.Value, bool) {
+	if s.Err != nil {
+		return krl.Value{}, false
+	}
+	v, err := krl.Parse(s.Value)
+	return v, err == nil
+}
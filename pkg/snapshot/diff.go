@@ -0,0 +1,131 @@
+package snapshot
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/selimserbes/go-openshowvar/pkg/krl"
+)
+
+// ChangeKind tells how a variable differs between two snapshots.
+type ChangeKind int
+
+// Kinds of changes.
+const (
+	// Added variables are only in the second snapshot.
+	Added ChangeKind = iota
+	// Removed variables are only in the first snapshot.
+	Removed
+	// Changed variables are in both snapshots with different values.
+	Changed
+)
+
+// String returns the name of the kind.
+func (k ChangeKind) String() string {
+	switch k {
+	case Added:
+		return "added"
+	case Removed:
+		return "removed"
+	case Changed:
+		return "changed"
+	}
+	return "unknown"
+}
+
+// Change is a difference between two snapshots.
+type Change struct {
+	Name string
+	Kind ChangeKind
+	// Old and New are the values in the first and second snapshot.
+	Old string
+	New string
+	// Members lists the STRUC members that differ, e.g. "X" or "FRAME.Y".
+	Members []string
+}
+
+// String formats the change as one line, e.g. "~ $OV_PRO: 100 -> 50".
+func (c Change) String() string {
+	switch c.Kind {
+	case Added:
+		return fmt.Sprintf("+ %s = %s", c.Name, c.New)
+	case Removed:
+		return fmt.Sprintf("- %s = %s", c.Name, c.Old)
+	}
+	if len(c.Members) > 0 {
+		return fmt.Sprintf("~ %s [%s]: %s -> %s", c.Name, strings.Join(c.Members, ", "), c.Old, c.New)
+	}
+	return fmt.Sprintf("~ %s: %s -> %s", c.Name, c.Old, c.New)
+}
+
+// Diff compares two snapshots. Values are compared as KRL literals, so
+// "TRUE" equals "true" and "1.0" equals "1", and names case-insensitively.
+// Variables that could not be read are treated as missing.
+//
+// Parameters:
+// - a: The snapshot before, e.g. a maintenance intervention.
+// - b: The snapshot after.
+//
+// Returns: The changes, removed and changed variables in the order of a
+// followed by added variables in the order of b.
+func Diff(a, b *Snapshot) []Change {
+	var changes []Change
+	for _, old := range a.Vars {
+		if old.Err != "" {
+			continue
+		}
+		cur, ok := b.Lookup(old.Name)
+		if !ok || cur.Err != "" {
+			changes = append(changes, Change{Name: old.Name, Kind: Removed, Old: old.Value})
+			continue
+		}
+		if !krl.EqualStrings(old.Value, cur.Value, 0) {
+			changes = append(changes, Change{
+				Name:    old.Name,
+				Kind:    Changed,
+				Old:     old.Value,
+				New:     cur.Value,
+				Members: changedMembers(old.Value, cur.Value),
+			})
+		}
+	}
+
+	for _, cur := range b.Vars {
+		if cur.Err != "" {
+			continue
+		}
+		if old, ok := a.Lookup(cur.Name); !ok || old.Err != "" {
+			changes = append(changes, Change{Name: cur.Name, Kind: Added, New: cur.Value})
+		}
+	}
+	return changes
+}
+
+// changedMembers returns the STRUC members whose values differ, nil if
+// either value is not a STRUC.
+func changedMembers(a, b string) []string {
+	va, errA := krl.Parse(a)
+	vb, errB := krl.Parse(b)
+	if errA != nil || errB != nil || va.Kind != krl.Struc || vb.Kind != krl.Struc {
+		return nil
+	}
+
+	before := make(map[string]krl.Value)
+	for _, f := range va.Flatten("") {
+		before[strings.ToUpper(f.Name)] = f.Value
+	}
+	var members []string
+	for _, f := range vb.Flatten("") {
+		key := strings.ToUpper(f.Name)
+		if old, ok := before[key]; !ok || !krl.Equal(old, f.Value, 0) {
+			members = append(members, f.Name)
+		}
+		delete(before, key)
+	}
+	for _, f := range va.Flatten("") {
+		if _, ok := before[strings.ToUpper(f.Name)]; ok {
+			members = append(members, f.Name)
+		}
+	}
+	return members
+}
@@ -0,0 +1,214 @@
+package snapshot
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/selimserbes/go-openshowvar/pkg/krl"
+	"github.com/selimserbes/go-openshowvar/pkg/openshowvar"
+)
+
+// ReadOnlyVars are system variables that Restore never writes: actual
+// positions, inputs and controller state. A pattern also covers the array
+// elements and STRUC members of a variable, so $IN covers $IN[1].
+var ReadOnlyVars = []string{
+	"$POS_ACT", "$POS_ACT_MES", "$POS_INT",
+	"$AXIS_ACT", "$AXIS_ACT_MEAS", "$AXIS_INT",
+	"$VEL_ACT", "$VEL_AXIS_ACT", "$TORQUE_AXIS_ACT", "$CURR_ACT",
+	"$IN", "$ANIN",
+	"$MODE_OP", "$PRO_STATE*", "$PRO_IP*", "$ROB_STOPPED",
+}
+
+// RestoreOptions controls which variables Restore writes and in which order.
+// Patterns are matched with krl.MatchName: case-insensitively, with literal
+// brackets such as $TOOL_DATA[3], and also covering array elements and STRUC
+// members, like ReadOnlyVars.
+type RestoreOptions struct {
+	// DryRun reports what would be written without writing anything.
+	DryRun bool
+	// Include restricts the restore to matching variables, all if empty.
+	Include []string
+	// Exclude skips matching variables.
+	Exclude []string
+	// First lists variables written before all others, in the order of the patterns.
+	First []string
+	// Last lists variables written after all others, in the order of the patterns,
+	// e.g. a flag telling the robot program that a recipe is complete.
+	Last []string
+	// SkipUnchanged reads each variable first and skips it if it already has the value.
+	SkipUnchanged bool
+}
+
+// Action tells what Restore did with a variable.
+type Action int
+
+// Restore actions.
+const (
+	// Written variables were written successfully.
+	Written Action = iota
+	// Planned variables would have been written in a dry run.
+	Planned
+	// Skipped variables were filtered out, see Result.Reason.
+	Skipped
+	// Failed variables could not be written, see Result.Reason.
+	Failed
+)
+
+// String returns the name of the action.
+func (a Action) String() string {
+	switch a {
+	case Written:
+		return "written"
+	case Planned:
+		return "planned"
+	case Skipped:
+		return "skipped"
+	case Failed:
+		return "failed"
+	}
+	return "unknown"
+}
+
+// Result is the outcome for one variable of a snapshot.
+type Result struct {
+	Name   string
+	Value  string
+	Action Action
+	// Reason explains why a variable was skipped or failed.
+	Reason string
+}
+
+// String formats the result as one line, e.g. "written $OV_PRO = 100".
+func (r Result) String() string {
+	s := fmt.Sprintf("%s %s", r.Action, r.Name)
+	if r.Value != "" {
+		s += " = " + r.Value
+	}
+	if r.Reason != "" {
+		s += " (" + r.Reason + ")"
+	}
+	return s
+}
+
+// Report lists the outcome of a restore in the order the variables were processed.
+type Report struct {
+	Results []Result
+}
+
+// Count returns the number of variables with the given action.
+func (r *Report) Count(action Action) int {
+	n := 0
+	for _, res := range r.Results {
+		if res.Action == action {
+			n++
+		}
+	}
+	return n
+}
+
+// Restore writes the values of a snapshot back onto the controller.
+//
+// Variables that could not be read into the snapshot, read-only system
+// variables and variables filtered by the options are skipped. A failed
+// write is reported and the restore continues with the next variable.
+//
+// Parameters:
+// - ctx: Context bounding the restore.
+// - osv: The connected client.
+// - s: The snapshot to restore.
+// - opts: Filtering, ordering and dry-run options.
+//
+// Returns: The report, and the context error if ctx ended the restore early.
+func Restore(ctx context.Context, osv *openshowvar.OpenShowVar, s *Snapshot, opts RestoreOptions) (*Report, error) {
+	report := &Report{}
+	for _, v := range restoreOrder(s.Vars, opts.First, opts.Last) {
+		res := Result{Name: v.Name, Value: v.Value}
+		switch {
+		case v.Err != "":
+			res.Action, res.Reason = Skipped, "not in snapshot: "+v.Err
+		case IsReadOnly(v.Name):
+			res.Action, res.Reason = Skipped, "read-only"
+		case len(opts.Include) > 0 && !matchAny(opts.Include, v.Name):
+			res.Action, res.Reason = Skipped, "not included"
+		case matchAny(opts.Exclude, v.Name):
+			res.Action, res.Reason = Skipped, "excluded"
+		}
+		if res.Action == Skipped {
+			report.Results = append(report.Results, res)
+			continue
+		}
+
+		if opts.SkipUnchanged {
+			current, err := osv.ReadContext(ctx, v.Name)
+			if err := ctx.Err(); err != nil {
+				return report, err
+			}
+			if err == nil && krl.EqualStrings(current, v.Value, 0) {
+				res.Action, res.Reason = Skipped, "unchanged"
+				report.Results = append(report.Results, res)
+				continue
+			}
+		}
+
+		if opts.DryRun {
+			res.Action = Planned
+			report.Results = append(report.Results, res)
+			continue
+		}
+
+		_, err := osv.WriteContext(ctx, v.Name, v.Value)
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return report, ctxErr
+		}
+		res.Action = Written
+		if err != nil {
+			res.Action, res.Reason = Failed, err.Error()
+		}
+		report.Results = append(report.Results, res)
+	}
+	return report, nil
+}
+
+// restoreOrder sorts vars so that those matching first come first and those
+// matching last come last, each in pattern order, keeping the snapshot order otherwise.
+func restoreOrder(vars []Var, first, last []string) []Var {
+	taken := make([]bool, len(vars))
+	take := func(patterns []string) []Var {
+		var out []Var
+		for _, pattern := range patterns {
+			for i, v := range vars {
+				if !taken[i] && krl.MatchName(pattern, v.Name) {
+					taken[i] = true
+					out = append(out, v)
+				}
+			}
+		}
+		return out
+	}
+
+	head := take(first)
+	tail := take(last)
+	ordered := append([]Var(nil), head...)
+	for i, v := range vars {
+		if !taken[i] {
+			ordered = append(ordered, v)
+		}
+	}
+	return append(ordered, tail...)
+}
+
+// IsReadOnly reports whether name is one of ReadOnlyVars or an element or
+// member of one.
+func IsReadOnly(name string) bool {
+	return matchAny(ReadOnlyVars, name)
+}
+
+// matchAny reports whether name matches any of the patterns.
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if krl.MatchName(pattern, name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,178 @@
+// Package snapshot reads a set of robot variables into a document that can
+// be saved, compared with another snapshot and restored onto the controller.
+package snapshot
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/selimserbes/go-openshowvar/pkg/openshowvar"
+)
+
+// Snapshot holds the values of a set of variables at one point in time.
+type Snapshot struct {
+	// Time is when the snapshot was taken.
+	Time time.Time `json:"time"`
+	// Vars holds the variables in the order they were read.
+	Vars []Var `json:"vars"`
+}
+
+// Var is the value of one variable in a snapshot.
+type Var struct {
+	Name  string `json:"name"`
+	Value string `json:"value,omitempty"`
+	// Err is set when the variable could not be read.
+	Err string `json:"error,omitempty"`
+}
+
+// Take reads the given variables into a snapshot. Variables that cannot be
+// read are kept with their error, only a done context stops the snapshot.
+//
+// Parameters:
+// - ctx: Context bounding the snapshot.
+// - osv: The connected client.
+// - names: The variables to read, e.g. from ReadNames or Expand.
+//
+// Returns: The snapshot or the context error.
+func Take(ctx context.Context, osv *openshowvar.OpenShowVar, names []string) (*Snapshot, error) {
+	s := &Snapshot{Time: time.Now(), Vars: make([]Var, 0, len(names))}
+	for _, name := range names {
+		value, err := osv.ReadContext(ctx, name)
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		v := Var{Name: name, Value: value}
+		if err != nil {
+			v.Err = err.Error()
+		}
+		s.Vars = append(s.Vars, v)
+	}
+	return s, nil
+}
+
+// Lookup returns the variable with the given name, compared case-insensitively like KRL does.
+func (s *Snapshot) Lookup(name string) (Var, bool) {
+	for _, v := range s.Vars {
+		if strings.EqualFold(v.Name, name) {
+			return v, true
+		}
+	}
+	return Var{}, false
+}
+
+// Save writes the snapshot as indented JSON.
+func (s *Snapshot) Save(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(s)
+}
+
+// Load reads a snapshot written by Save.
+func Load(r io.Reader) (*Snapshot, error) {
+	var s Snapshot
+	if err := json.NewDecoder(r).Decode(&s); err != nil {
+		return nil, fmt.Errorf("failed to load snapshot: %v", err)
+	}
+	return &s, nil
+}
+
+// ReadNames reads variable names, one per line. Blank lines and KRL style
+// comments starting with ; are ignored, every name is expanded with Expand.
+//
+// Parameters:
+// - r: The list of names, e.g. a file.
+//
+// Returns: The expanded names in order or an error.
+func ReadNames(r io.Reader) ([]string, error) {
+	var patterns []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, ';'); i >= 0 {
+			line = line[:i]
+		}
+		if line = strings.TrimSpace(line); line != "" {
+			patterns = append(patterns, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return Expand(patterns...)
+}
+
+var (
+	// alternatives matches {A,B,C}.
+	alternatives = regexp.MustCompile(`\{([^{}]*)\}`)
+	// indexRange matches 1..16.
+	indexRange = regexp.MustCompile(`(\d+)\.\.(\d+)`)
+)
+
+// maxExpanded bounds the names a single pattern may expand to.
+const maxExpanded = 100000
+
+// Expand expands name patterns into variable names. {A,B} expands to each
+// alternative and lo..hi to each index in the range, so "$TOOL_DATA[1..16]"
+// gives the 16 tool frames and "{BASE,TOOL}_DATA[1..2]" four names.
+//
+// Parameters:
+// - patterns: The patterns, names without patterns are kept as they are.
+//
+// Returns: The expanded names in order or an error for invalid ranges.
+func Expand(patterns ...string) ([]string, error) {
+	var names []string
+	for _, pattern := range patterns {
+		expanded, err := expand(pattern)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, expanded...)
+	}
+	return names, nil
+}
+
+// expand expands the first pattern of s and recurses into the results.
+func expand(s string) ([]string, error) {
+	if m := alternatives.FindStringSubmatchIndex(s); m != nil {
+		var names []string
+		for _, alt := range strings.Split(s[m[2]:m[3]], ",") {
+			expanded, err := expand(s[:m[0]] + strings.TrimSpace(alt) + s[m[1]:])
+			if err != nil {
+				return nil, err
+			}
+			names = append(names, expanded...)
+			if len(names) > maxExpanded {
+				return nil, fmt.Errorf("pattern %q expands to more than %d names", s, maxExpanded)
+			}
+		}
+		return names, nil
+	}
+
+	if m := indexRange.FindStringSubmatchIndex(s); m != nil {
+		lo, errLo := strconv.Atoi(s[m[2]:m[3]])
+		hi, errHi := strconv.Atoi(s[m[4]:m[5]])
+		if errLo != nil || errHi != nil || lo > hi || hi-lo >= maxExpanded {
+			return nil, fmt.Errorf("invalid range %q in %q", s[m[0]:m[1]], s)
+		}
+		var names []string
+		for i := lo; i <= hi; i++ {
+			expanded, err := expand(s[:m[0]] + strconv.Itoa(i) + s[m[1]:])
+			if err != nil {
+				return nil, err
+			}
+			names = append(names, expanded...)
+			if len(names) > maxExpanded {
+				return nil, fmt.Errorf("pattern %q expands to more than %d names", s, maxExpanded)
+			}
+		}
+		return names, nil
+	}
+	return []string{s}, nil
+}
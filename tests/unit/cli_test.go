@@ -0,0 +1,151 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/selimserbes/go-openshowvar/internal/cli"
+	"github.com/selimserbes/go-openshowvar/pkg/openshowvar"
+	"github.com/stretchr/testify/assert"
+)
+
+// Tests the mapping of errors to exit codes.
+func TestCLIExitCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		code int
+	}{
+		{nil, cli.ExitOK},
+		{fmt.Errorf("%w: unknown format %q", cli.ErrUsage, "xml"), cli.ExitUsage},
+		{fmt.Errorf("$FOO: %w", openshowvar.ErrVariableNotFound), cli.ExitNotFound},
+		{&cli.ReportedError{Err: openshowvar.ErrVariableNotFound}, cli.ExitNotFound},
+		{fmt.Errorf("%w: refused", cli.ErrConnection), cli.ExitConnection},
+		{fmt.Errorf("failed to read response: %w", context.DeadlineExceeded), cli.ExitConnection},
+		{fmt.Errorf("failed to read response: %w", io.EOF), cli.ExitConnection},
+		{&net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, cli.ExitConnection},
+		{errors.New("open vars.txt: no such file or directory"), cli.ExitError},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.code, cli.ExitCode(tt.err), "%v", tt.err)
+	}
+}
+
+// Tests values in the plain, json and krl output formats.
+func TestCLIPrinterValue(t *testing.T) {
+	tests := []struct {
+		format string
+		named  bool
+		name   string
+		value  string
+		want   string
+	}{
+		{"plain", false, "$OV_PRO", "100", "100\n"},
+		{"plain", false, "PROG_NAME", `"main"`, "main\n"},
+		{"plain", true, "$OV_PRO", "100", "$OV_PRO\t100\n"},
+		{"plain", false, "$POS_ACT", "{E6POS: X 1.5, Y -2.0}", "{E6POS: X 1.5, Y -2.0}\n"},
+		{"json", false, "$OV_PRO", "100", `{"name":"$OV_PRO","value":100}` + "\n"},
+		{"json", false, "$IN[1]", "TRUE", `{"name":"$IN[1]","value":true}` + "\n"},
+		{"json", false, "$MODE_OP", "#T1", `{"name":"$MODE_OP","value":"#T1"}` + "\n"},
+		{"json", false, "$POS_ACT", "{E6POS: X 1.5, Y -2.0}", `{"name":"$POS_ACT","value":{"X":1.5,"Y":-2}}` + "\n"},
+		{"json", false, "RAW", "not krl", `{"name":"RAW","value":"not krl"}` + "\n"},
+		{"krl", false, "$OV_PRO", "100", "$OV_PRO = 100\n"},
+		{"krl", false, "$POS_ACT", "{E6POS:X 1.5,Y -2.0}", "$POS_ACT = {E6POS: X 1.5, Y -2.0}\n"},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		(&cli.Printer{W: &buf, Format: tt.format, Named: tt.named}).Value(tt.name, tt.value)
+		assert.Equal(t, tt.want, buf.String(), "%s %s", tt.format, tt.value)
+	}
+}
+
+// Tests changes and pings in the plain, json and krl output formats.
+func TestCLIPrinterChangeAndPing(t *testing.T) {
+	at := time.Date(2024, 7, 23, 10, 15, 0, 500e6, time.UTC)
+	first := openshowvar.Change{VarName: "$OV_PRO", Value: "100", Time: at}
+	next := openshowvar.Change{VarName: "$OV_PRO", Value: "75", Previous: "100", Time: at}
+
+	output := func(format string, print func(p *cli.Printer)) string {
+		var buf bytes.Buffer
+		print(&cli.Printer{W: &buf, Format: format, Named: true})
+		return buf.String()
+	}
+
+	assert.Equal(t, "10:15:00.500\t$OV_PRO\t75\n", output("plain", func(p *cli.Printer) { p.Change(next) }))
+	assert.Equal(t, "$OV_PRO = 75 ; 10:15:00.500\n", output("krl", func(p *cli.Printer) { p.Change(next) }))
+	assert.Equal(t, `{"time":"2024-07-23T10:15:00.5Z","name":"$OV_PRO","value":100}`+"\n", output("json", func(p *cli.Printer) { p.Change(first) }))
+	assert.Equal(t, `{"time":"2024-07-23T10:15:00.5Z","name":"$OV_PRO","value":75,"previous":100}`+"\n", output("json", func(p *cli.Printer) { p.Change(next) }))
+
+	assert.Equal(t, "connected in 1.500 ms\n", output("plain", func(p *cli.Printer) { p.Ping(0, 1500*time.Microsecond) }))
+	assert.Equal(t, "seq=2 time=0.250 ms\n", output("plain", func(p *cli.Printer) { p.Ping(2, 250*time.Microsecond) }))
+	assert.Equal(t, `{"latency_ms":0.25,"seq":2}`+"\n", output("json", func(p *cli.Printer) { p.Ping(2, 250*time.Microsecond) }))
+}
+
+// Tests tab completion of commands and variable names.
+func TestCLIComplete(t *testing.T) {
+	completer := &cli.Completer{Commands: []string{"get", "set", "watch", "vars", "history", "help", "quit"}}
+	for _, name := range []string{"$OV_PRO", "$OUT[", "$POS_ACT", "$POS_ACT_MES", "part_ready", "PART_READY"} {
+		completer.Remember(name)
+	}
+
+	tests := []struct {
+		line    string
+		pos     int
+		want    string
+		wantPos int
+		ok      bool
+	}{
+		{"g", 1, "get ", 4, true},
+		{"h", 1, "h", 1, true},
+		{"he", 2, "help ", 5, true},
+		{"x", 1, "", 0, false},
+		{"get $ov", 7, "get $OV_PRO ", 12, true},
+		{"get $O", 6, "get $O", 6, true},
+		{"get $ou", 7, "get $OUT[", 9, true},
+		{"get $pos_act", 12, "get $POS_ACT", 12, true},
+		{"get part", 8, "get PART_READY ", 15, true},
+		{"get $OV $POS", 7, "get $OV_PRO  $POS", 12, true},
+		{"get Z", 5, "", 0, false},
+	}
+	for _, tt := range tests {
+		line, pos, ok := completer.Complete(tt.line, tt.pos, '\t')
+		assert.Equal(t, tt.ok, ok, tt.line)
+		assert.Equal(t, tt.want, line, tt.line)
+		assert.Equal(t, tt.wantPos, pos, tt.line)
+	}
+
+	// Only tab completes.
+	_, _, ok := completer.Complete("g", 1, 'g')
+	assert.False(t, ok)
+	assert.Equal(t, []string{"$OUT[", "$OV_PRO", "$POS_ACT", "$POS_ACT_MES", "PART_READY"}, completer.Names())
+}
+
+// Tests indented formatting of STRUC values.
+func TestCLIPretty(t *testing.T) {
+	tests := []struct {
+		value, want string
+	}{
+		{"100", "100"},
+		{`"text"`, `"text"`},
+		{"not krl {", "not krl {"},
+		{"{E6POS: X 1.5, Y -2.0}", "{E6POS:\n  X 1.5\n  Y -2.0\n}"},
+		{"{FRAME: X 1.0, S {A 1, B TRUE}}", "{FRAME:\n  X 1.0\n  S {\n    A 1\n    B TRUE\n  }\n}"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, cli.Pretty(tt.value), tt.value)
+	}
+}
+
+// Tests the numbered command history.
+func TestCLIHistory(t *testing.T) {
+	var history cli.History
+	assert.Equal(t, "", history.String())
+	history.Add("get $OV_PRO")
+	history.Add("set $OV_PRO 50")
+	assert.Equal(t, "   1  get $OV_PRO\n   2  set $OV_PRO 50\n", history.String())
+}
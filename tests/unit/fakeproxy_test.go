@@ -0,0 +1,116 @@
+package test
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/selimserbes/go-openshowvar/pkg/openshowvar"
+)
+
+// In-memory stand-in for KukaVarProxy.
+//
+// Unlike startMockServer, which echoes a single request per connection, the fake
+// proxy keeps a table of variables and answers any number of framed requests
+// on a connection until the client closes it.
+type fakeProxy struct {
+	mu       sync.Mutex
+	vars     map[string]string
+	requests int
+	// delay returns how long to wait before answering a request for a
+	// variable, if set before serving.
+	delay func(name string) time.Duration
+}
+
+// Creates a fake proxy holding a copy of the given variables.
+func newFakeProxy(vars map[string]string) *fakeProxy {
+	p := &fakeProxy{vars: make(map[string]string)}
+	for k, v := range vars {
+		p.vars[k] = v
+	}
+	return p
+}
+
+// Returns the current value of a variable.
+func (p *fakeProxy) get(name string) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.vars[name]
+}
+
+// Sets the value of a variable, as if the robot program changed it.
+func (p *fakeProxy) set(name, val string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.vars[name] = val
+}
+
+// Removes a variable, so reads of it fail.
+func (p *fakeProxy) remove(name string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.vars, name)
+}
+
+// Returns the number of requests answered so far.
+func (p *fakeProxy) requestCount() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.requests
+}
+
+// Answers requests on conn until it is closed.
+func (p *fakeProxy) Serve(conn net.Conn) {
+	defer conn.Close()
+	for {
+		header := make([]byte, 4)
+		if _, err := io.ReadFull(conn, header); err != nil {
+			return
+		}
+		body := make([]byte, binary.BigEndian.Uint16(header[2:4]))
+		if _, err := io.ReadFull(conn, body); err != nil {
+			return
+		}
+
+		msgID, name, val, err := openshowvar.DecodeRequest(append(header, body...))
+		if err != nil {
+			return
+		}
+
+		mode := openshowvar.ModeRead
+		if val != "" {
+			mode = openshowvar.ModeWrite
+		}
+		if p.delay != nil {
+			time.Sleep(p.delay(name))
+		}
+
+		// Unknown variables are reported as failures, writes only update known ones.
+		p.mu.Lock()
+		p.requests++
+		current, ok := p.vars[name]
+		if ok && mode == openshowvar.ModeWrite {
+			p.vars[name] = val
+			current = val
+		}
+		p.mu.Unlock()
+
+		response, _ := openshowvar.EncodeResponse(msgID, mode, current, ok)
+		if _, err := conn.Write(response); err != nil {
+			return
+		}
+	}
+}
+
+// Accepts connections on listener and serves each of them.
+func (p *fakeProxy) ServeListener(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		go p.Serve(conn)
+	}
+}
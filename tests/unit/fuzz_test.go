@@ -0,0 +1,122 @@
+package test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/selimserbes/go-openshowvar/pkg/krl"
+	"github.com/selimserbes/go-openshowvar/pkg/openshowvar"
+)
+
+// Seed corpora for the frame decoders live in testdata/fuzz and contain
+// KukaVarProxy frames for common system and user variables.
+
+// Fuzzes encoding a request and decoding it back.
+func FuzzRequestRoundTrip(f *testing.F) {
+	f.Add(uint16(0), "$OV_PRO", "")
+	f.Add(uint16(1), "$OV_PRO", "50")
+	f.Add(uint16(42), "TARGET_POS", "{E6POS: X 100.0, Y 0.0, Z 500.0, A 0.0, B 90.0, C 0.0}")
+	f.Add(uint16(65535), "", "")
+
+	f.Fuzz(func(t *testing.T, msgID uint16, varname string, val string) {
+		frame, err := openshowvar.EncodeRequest(msgID, varname, val)
+		if err != nil {
+			return
+		}
+
+		gotID, gotName, gotVal, err := openshowvar.DecodeRequest(frame)
+		if err != nil {
+			t.Fatalf("decoding encoded request %x: %v", frame, err)
+		}
+		if gotID != msgID || gotName != varname || gotVal != val {
+			t.Fatalf("round trip mismatch: got (%d, %q, %q), want (%d, %q, %q)", gotID, gotName, gotVal, msgID, varname, val)
+		}
+	})
+}
+
+// Fuzzes decoding arbitrary request frames, which must never panic and must
+// re-encode to the same bytes when accepted.
+func FuzzDecodeRequest(f *testing.F) {
+	f.Add([]byte{})
+	f.Add([]byte{0, 0, 0, 3, 0, 0, 0})
+
+	f.Fuzz(func(t *testing.T, frame []byte) {
+		msgID, varname, val, err := openshowvar.DecodeRequest(frame)
+		if err != nil {
+			return
+		}
+
+		encoded, err := openshowvar.EncodeRequest(msgID, varname, val)
+		if err != nil {
+			t.Fatalf("re-encoding decoded request: %v", err)
+		}
+		if !bytes.Equal(encoded, frame) {
+			t.Fatalf("re-encoded request %x differs from input %x", encoded, frame)
+		}
+	})
+}
+
+// Fuzzes encoding a response and decoding it back.
+func FuzzResponseRoundTrip(f *testing.F) {
+	f.Add(uint16(0), openshowvar.ModeRead, "100", true)
+	f.Add(uint16(7), openshowvar.ModeWrite, "TRUE", true)
+	f.Add(uint16(9), openshowvar.ModeRead, "", false)
+
+	f.Fuzz(func(t *testing.T, msgID uint16, mode byte, val string, ok bool) {
+		frame, err := openshowvar.EncodeResponse(msgID, mode, val, ok)
+		if err != nil {
+			return
+		}
+
+		got, err := openshowvar.DecodeResponse(frame)
+		if err != nil {
+			t.Fatalf("decoding encoded response %x: %v", frame, err)
+		}
+		if got != val {
+			t.Fatalf("round trip mismatch: got %q, want %q", got, val)
+		}
+	})
+}
+
+// Fuzzes decoding arbitrary response frames, which must never panic.
+func FuzzDecodeResponse(f *testing.F) {
+	f.Add([]byte{})
+	f.Add([]byte{0, 0, 0, 3, 0, 0xff, 0xf9})
+
+	f.Fuzz(func(t *testing.T, frame []byte) {
+		val, err := openshowvar.DecodeResponse(frame)
+		if err != nil {
+			return
+		}
+		if len(val) > len(frame)-7 {
+			t.Fatalf("decoded value of %d bytes from a %d byte frame", len(val), len(frame))
+		}
+	})
+}
+
+// Fuzzes parsing KRL literals, which must format back to an equal value.
+func FuzzKRLParse(f *testing.F) {
+	f.Add("42")
+	f.Add("-1.5E+02")
+	f.Add("'H1F'")
+	f.Add(`"text"`)
+	f.Add("#T1")
+	f.Add("{E6POS: X 425.0, Y 0.0, Z 650.0, A 180.0, B 0.0, C 180.0, S 2, T 35, E1 0.0, E2 0.0, E3 0.0, E4 0.0, E5 0.0, E6 0.0}")
+	f.Add(`{TOOL: NAME "gripper", FRAME {X 1.0, Y 2.0}, ACTIVE TRUE}`)
+
+	f.Fuzz(func(t *testing.T, literal string) {
+		v, err := krl.Parse(literal)
+		if err != nil {
+			return
+		}
+
+		formatted := v.String()
+		again, err := krl.Parse(formatted)
+		if err != nil {
+			t.Fatalf("parsing formatted value %q of %q: %v", formatted, literal, err)
+		}
+		if !krl.Equal(v, again, 0) || again.String() != formatted {
+			t.Fatalf("round trip mismatch: %q formatted as %q, parsed back as %q", literal, formatted, again.String())
+		}
+	})
+}
@@ -0,0 +1,241 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/selimserbes/go-openshowvar/pkg/gateway"
+	"github.com/selimserbes/go-openshowvar/pkg/openshowvar"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Starts a gateway serving a robot backed by each fake proxy.
+func startGateway(t *testing.T, proxies map[string]*fakeProxy) *httptest.Server {
+	var robots []gateway.RobotConfig
+	for id, proxy := range proxies {
+		robots = append(robots, gateway.RobotConfig{
+			ID:      id,
+			Host:    "10.0.0.1",
+			Port:    7000,
+			Options: []openshowvar.Option{openshowvar.WithDialer(openshowvar.PipeDialer{Serve: proxy.Serve})},
+		})
+	}
+	gw, err := gateway.New(robots...)
+	require.NoError(t, err)
+	server := httptest.NewServer(gw)
+	t.Cleanup(func() {
+		server.Close()
+		gw.Close()
+	})
+	return server
+}
+
+// Sends a request to the gateway and decodes the JSON response.
+func gatewayRequest(t *testing.T, method, url, body string) (int, map[string]any) {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+
+	data, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	var out map[string]any
+	require.NoError(t, json.Unmarshal(data, &out), string(data))
+	return resp.StatusCode, out
+}
+
+// Tests reading and writing single variables of several robots.
+func TestGatewayReadWrite(t *testing.T) {
+	cell1 := newFakeProxy(map[string]string{"$POS_ACT": "{E6POS: X 425.0, Y -1.5}", "$OV_PRO": "100"})
+	cell2 := newFakeProxy(map[string]string{"$OV_PRO": "30", "$MODE_OP": "#T1"})
+	server := startGateway(t, map[string]*fakeProxy{"cell1": cell1, "cell2": cell2})
+
+	status, body := gatewayRequest(t, "GET", server.URL+"/robots/cell1/vars/"+url.PathEscape("$POS_ACT"), "")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, map[string]any{"X": 425.0, "Y": -1.5}, body["value"])
+	assert.Equal(t, "{E6POS: X 425.0, Y -1.5}", body["raw"])
+
+	status, body = gatewayRequest(t, "GET", server.URL+"/robots/cell2/vars/$MODE_OP", "")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "#T1", body["value"])
+
+	status, body = gatewayRequest(t, "PUT", server.URL+"/robots/cell2/vars/$OV_PRO", `{"value": 50}`)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, 50.0, body["value"])
+	assert.Equal(t, "50", cell2.get("$OV_PRO"))
+	assert.Equal(t, "100", cell1.get("$OV_PRO"))
+
+	// The connection is reused.
+	for i := 0; i < 3; i++ {
+		gatewayRequest(t, "GET", server.URL+"/robots/cell1/vars/$OV_PRO", "")
+	}
+	assert.Equal(t, 4, cell1.requestCount())
+
+	status, body = gatewayRequest(t, "GET", server.URL+"/robots", "")
+	assert.Equal(t, http.StatusOK, status)
+	robots := body["robots"].([]any)
+	require.Len(t, robots, 2)
+	assert.Equal(t, map[string]any{"id": "cell1", "address": "10.0.0.1:7000", "connected": true}, robots[0])
+}
+
+// Tests the status codes of failing requests.
+func TestGatewayErrors(t *testing.T) {
+	server := startGateway(t, map[string]*fakeProxy{"cell1": newFakeProxy(map[string]string{"$OV_PRO": "100"})})
+
+	status, body := gatewayRequest(t, "GET", server.URL+"/robots/cell9/vars/$OV_PRO", "")
+	assert.Equal(t, http.StatusNotFound, status)
+	assert.Equal(t, `unknown robot "cell9"`, body["error"])
+
+	status, body = gatewayRequest(t, "GET", server.URL+"/robots/cell1/vars/MISSING", "")
+	assert.Equal(t, http.StatusNotFound, status)
+	assert.Equal(t, "variable not found in response", body["error"])
+
+	status, _ = gatewayRequest(t, "PUT", server.URL+"/robots/cell1/vars/$OV_PRO", `{"value": {"X": 1}}`)
+	assert.Equal(t, http.StatusBadRequest, status)
+	status, _ = gatewayRequest(t, "PUT", server.URL+"/robots/cell1/vars/$OV_PRO", `{"val": 1}`)
+	assert.Equal(t, http.StatusBadRequest, status)
+}
+
+// Tests the batch endpoints.
+func TestGatewayBatch(t *testing.T) {
+	proxy := newFakeProxy(map[string]string{"$OV_PRO": "100", "PART_READY": "FALSE", "RECIPE": "3"})
+	server := startGateway(t, map[string]*fakeProxy{"cell1": proxy})
+
+	status, body := gatewayRequest(t, "POST", server.URL+"/robots/cell1/batch/read", `{"names": ["$OV_PRO", "MISSING", "PART_READY"]}`)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, []any{
+		map[string]any{"name": "$OV_PRO", "value": 100.0, "raw": "100"},
+		map[string]any{"name": "MISSING", "error": "variable not found in response"},
+		map[string]any{"name": "PART_READY", "value": false, "raw": "FALSE"},
+	}, body["values"])
+
+	status, body = gatewayRequest(t, "POST", server.URL+"/robots/cell1/batch/write",
+		`{"values": [{"name": "RECIPE", "value": "7"}, {"name": "PART_READY", "value": true}]}`)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Len(t, body["values"], 2)
+	assert.Equal(t, "7", proxy.get("RECIPE"))
+	assert.Equal(t, "TRUE", proxy.get("PART_READY"))
+
+	// Invalid values are rejected before anything is written.
+	status, _ = gatewayRequest(t, "POST", server.URL+"/robots/cell1/batch/write",
+		`{"values": [{"name": "RECIPE", "value": "9"}, {"name": "PART_READY", "value": null}]}`)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, "7", proxy.get("RECIPE"))
+}
+
+// Tests converting JSON values to KRL literals.
+func TestGatewayLiteral(t *testing.T) {
+	for raw, want := range map[string]string{`"{X 1.0}"`: "{X 1.0}", `12.5`: "12.5", `true`: "TRUE", `false`: "FALSE"} {
+		value, err := gateway.Literal(json.RawMessage(raw))
+		require.NoError(t, err, raw)
+		assert.Equal(t, want, value)
+	}
+	for _, raw := range []string{`""`, `null`, `[1]`, `{"a": 1}`, `{X 1.0}`} {
+		_, err := gateway.Literal(json.RawMessage(raw))
+		assert.Error(t, err, raw)
+	}
+}
+
+// Tests that Robot.Subscribe reconnects after reads failed because of the
+// connection.
+func TestGatewayRobotSubscribeReconnect(t *testing.T) {
+	proxy := newFakeProxy(map[string]string{"$OV_PRO": "100"})
+	var mu sync.Mutex
+	dials := 0
+	serve := func(conn net.Conn) {
+		mu.Lock()
+		dials++
+		first := dials == 1
+		mu.Unlock()
+		if first {
+			conn.Close()
+			return
+		}
+		proxy.Serve(conn)
+	}
+	robot := &gateway.Robot{ID: "cell1", Client: openshowvar.NewOpenShowVar("10.0.0.1", 7000, openshowvar.WithDialer(openshowvar.PipeDialer{Serve: serve}))}
+	defer robot.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, robot.Connect(ctx))
+
+	changes := robot.Subscribe(ctx, "$OV_PRO", 0)
+	change := <-changes
+	require.Error(t, change.Err)
+	for change = range changes {
+		if change.Err == nil {
+			break
+		}
+	}
+	require.NoError(t, change.Err)
+	assert.Equal(t, "100", change.Value)
+	assert.True(t, robot.Connected())
+
+	cancel()
+	for range changes {
+	}
+}
+
+// Closes the connection after the first response.
+type closeAfterWrite struct {
+	net.Conn
+}
+
+func (c closeAfterWrite) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.Conn.Close()
+	return n, err
+}
+
+// Tests that Robot.Subscribe stops reconnecting once reads succeed again,
+// even if the value did not change.
+func TestGatewayRobotSubscribeRecovery(t *testing.T) {
+	proxy := newFakeProxy(map[string]string{"$OV_PRO": "100"})
+	var mu sync.Mutex
+	dials := 0
+	serve := func(conn net.Conn) {
+		mu.Lock()
+		dials++
+		first := dials == 1
+		mu.Unlock()
+		if first {
+			// Drop the connection after the first read.
+			conn = closeAfterWrite{conn}
+		}
+		proxy.Serve(conn)
+	}
+	robot := &gateway.Robot{ID: "cell1", Client: openshowvar.NewOpenShowVar("10.0.0.1", 7000, openshowvar.WithDialer(openshowvar.PipeDialer{Serve: serve}))}
+	defer robot.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, robot.Connect(ctx))
+
+	changes := robot.Subscribe(ctx, "$OV_PRO", 0)
+	assert.Equal(t, "100", (<-changes).Value)
+	assert.Error(t, (<-changes).Err)
+	change := <-changes
+	require.NoError(t, change.Err)
+	assert.Equal(t, "100", change.Value)
+
+	// No more reconnects after the recovery.
+	time.Sleep(gateway.ReconnectInterval + gateway.ReconnectInterval/2)
+	mu.Lock()
+	assert.Equal(t, 2, dials)
+	mu.Unlock()
+
+	cancel()
+	for range changes {
+	}
+}
@@ -0,0 +1,161 @@
+package test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/selimserbes/go-openshowvar/pkg/gateway"
+	"github.com/selimserbes/go-openshowvar/pkg/openshowvar"
+	"github.com/selimserbes/go-openshowvar/pkg/osvgrpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// Starts an in-process gRPC server for a robot backed by a fake proxy and
+// returns a client connected to it.
+func startGRPC(t *testing.T, proxy *fakeProxy) osvgrpc.OpenShowVarClient {
+	gw, err := gateway.New(gateway.RobotConfig{
+		ID:      "cell1",
+		Host:    "10.0.0.1",
+		Port:    7000,
+		Options: []openshowvar.Option{openshowvar.WithDialer(openshowvar.PipeDialer{Serve: proxy.Serve})},
+	})
+	require.NoError(t, err)
+	server := osvgrpc.NewServer(gw)
+	server.WatchInterval = 10 * time.Millisecond
+
+	listener := bufconn.Listen(1 << 20)
+	s := grpc.NewServer()
+	osvgrpc.RegisterOpenShowVarServer(s, server)
+	go s.Serve(listener)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		conn.Close()
+		s.Stop()
+		gw.Close()
+	})
+	return osvgrpc.NewOpenShowVarClient(conn)
+}
+
+// Tests reading and writing single variables over gRPC.
+func TestGRPCReadWrite(t *testing.T) {
+	proxy := newFakeProxy(map[string]string{"$POS_ACT": "{E6POS: X 425.0, Y -1.5}", "$OV_PRO": "100"})
+	client := startGRPC(t, proxy)
+	ctx := context.Background()
+
+	v, err := client.Read(ctx, &osvgrpc.ReadRequest{Robot: "cell1", Name: "$POS_ACT"})
+	require.NoError(t, err)
+	assert.Equal(t, "{E6POS: X 425.0, Y -1.5}", v.Raw)
+	fields := v.Value.GetStructValue().GetFields()
+	assert.Equal(t, 425.0, fields["X"].GetNumberValue())
+	assert.Equal(t, -1.5, fields["Y"].GetNumberValue())
+
+	v, err = client.Write(ctx, &osvgrpc.WriteRequest{Robot: "cell1", Name: "$OV_PRO", Value: "50"})
+	require.NoError(t, err)
+	assert.Equal(t, "50", v.Raw)
+	assert.Equal(t, 50.0, v.Value.GetNumberValue())
+	assert.Equal(t, "50", proxy.get("$OV_PRO"))
+
+	robots, err := client.ListRobots(ctx, &osvgrpc.ListRobotsRequest{})
+	require.NoError(t, err)
+	require.Len(t, robots.Robots, 1)
+	assert.Equal(t, "cell1", robots.Robots[0].Id)
+	assert.Equal(t, "10.0.0.1:7000", robots.Robots[0].Address)
+	assert.True(t, robots.Robots[0].Connected)
+}
+
+// Tests the status codes of failed requests.
+func TestGRPCErrors(t *testing.T) {
+	client := startGRPC(t, newFakeProxy(map[string]string{"$OV_PRO": "100"}))
+	ctx := context.Background()
+
+	_, err := client.Read(ctx, &osvgrpc.ReadRequest{Robot: "cell1", Name: "$MISSING"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = client.Read(ctx, &osvgrpc.ReadRequest{Robot: "cell9", Name: "$OV_PRO"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = client.Write(ctx, &osvgrpc.WriteRequest{Robot: "cell1", Name: "$OV_PRO"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = client.BatchWrite(ctx, &osvgrpc.BatchWriteRequest{Robot: "cell1", Values: []*osvgrpc.VariableWrite{{Name: "$OV_PRO", Value: "1"}, {Name: "$OV_PRO"}}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = client.Read(ctx, &osvgrpc.ReadRequest{Robot: "cell1", Name: "$OV_PRO"})
+	assert.NoError(t, err, "the connection is kept after request errors")
+}
+
+// Tests batch reads and writes with per-variable errors.
+func TestGRPCBatch(t *testing.T) {
+	proxy := newFakeProxy(map[string]string{"$OV_PRO": "100", "$MODE_OP": "#T1"})
+	client := startGRPC(t, proxy)
+	ctx := context.Background()
+
+	resp, err := client.BatchRead(ctx, &osvgrpc.BatchReadRequest{Robot: "cell1", Names: []string{"$OV_PRO", "$MISSING", "$MODE_OP"}})
+	require.NoError(t, err)
+	require.Len(t, resp.Variables, 3)
+	assert.Equal(t, "100", resp.Variables[0].Raw)
+	assert.NotEmpty(t, resp.Variables[1].Error)
+	assert.Equal(t, "#T1", resp.Variables[2].Value.GetStringValue())
+
+	resp, err = client.BatchWrite(ctx, &osvgrpc.BatchWriteRequest{Robot: "cell1", Values: []*osvgrpc.VariableWrite{
+		{Name: "$OV_PRO", Value: "30"},
+		{Name: "$MISSING", Value: "1"},
+	}})
+	require.NoError(t, err)
+	require.Len(t, resp.Variables, 2)
+	assert.Equal(t, "30", resp.Variables[0].Raw)
+	assert.NotEmpty(t, resp.Variables[1].Error)
+	assert.Equal(t, "30", proxy.get("$OV_PRO"))
+}
+
+// Tests watching variables over a server stream.
+func TestGRPCWatch(t *testing.T) {
+	proxy := newFakeProxy(map[string]string{"$OV_PRO": "100", "$MODE_OP": "#T1"})
+	client := startGRPC(t, proxy)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	stream, err := client.Watch(ctx, &osvgrpc.WatchRequest{
+		Robot:    "cell1",
+		Names:    []string{"$OV_PRO", "$MODE_OP"},
+		Interval: durationpb.New(20 * time.Millisecond),
+	})
+	require.NoError(t, err)
+
+	first := map[string]*osvgrpc.Change{}
+	for len(first) < 2 {
+		change, err := stream.Recv()
+		require.NoError(t, err)
+		first[change.Variable.Name] = change
+	}
+	assert.Equal(t, "100", first["$OV_PRO"].Variable.Raw)
+	assert.Equal(t, "#T1", first["$MODE_OP"].Variable.Raw)
+	assert.Empty(t, first["$OV_PRO"].Previous)
+	assert.Equal(t, "cell1", first["$OV_PRO"].Robot)
+
+	proxy.set("$OV_PRO", "75")
+	change, err := stream.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, "$OV_PRO", change.Variable.Name)
+	assert.Equal(t, "75", change.Variable.Raw)
+	assert.Equal(t, "100", change.Previous)
+	assert.WithinDuration(t, time.Now(), change.Time.AsTime(), time.Second)
+
+	empty, err := client.Watch(ctx, &osvgrpc.WatchRequest{Robot: "cell1"})
+	require.NoError(t, err)
+	_, err = empty.Recv()
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
@@ -0,0 +1,131 @@
+package test
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/selimserbes/go-openshowvar/pkg/openshowvar"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Simulates the KRL side of the handshake: it multiplies P_A by P_B when
+// CMD_NR is 1, and clears the ack when the command is reset.
+func runRobotProgram(ctx context.Context, proxy *fakeProxy, clearAck bool) {
+	for ctx.Err() == nil {
+		time.Sleep(time.Millisecond)
+		cmd, ack := proxy.get("CMD_NR"), proxy.get("CMD_ACK")
+		switch {
+		case cmd == "1" && ack == "FALSE":
+			a, _ := strconv.Atoi(proxy.get("P_A"))
+			b, _ := strconv.Atoi(proxy.get("P_B"))
+			proxy.set("RESULT", strconv.Itoa(a*b))
+			proxy.set("CMD_ACK", "TRUE")
+		case cmd == "0" && ack == "TRUE" && clearAck:
+			proxy.set("CMD_ACK", "FALSE")
+		}
+	}
+}
+
+// Returns the handshake definition used by the tests.
+func testHandshake() *openshowvar.Handshake {
+	return &openshowvar.Handshake{
+		CommandVar:   "CMD_NR",
+		IdleCommand:  "0",
+		AckVar:       "CMD_ACK",
+		AckValue:     "TRUE",
+		ResultVars:   []string{"RESULT"},
+		Timeout:      500 * time.Millisecond,
+		PollInterval: time.Millisecond,
+	}
+}
+
+// Returns the variables of an idle robot program.
+func handshakeVars() map[string]string {
+	return map[string]string{"CMD_NR": "0", "CMD_ACK": "FALSE", "P_A": "0", "P_B": "0", "RESULT": "0"}
+}
+
+// Tests a complete request/acknowledge exchange.
+func TestHandshake(t *testing.T) {
+	proxy := newFakeProxy(handshakeVars())
+	osv := connectFake(t, proxy)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go runRobotProgram(ctx, proxy, true)
+
+	results, err := testHandshake().Execute(ctx, osv, "1",
+		openshowvar.Assignment{Name: "P_A", Value: "6"},
+		openshowvar.Assignment{Name: "P_B", Value: "7"},
+	)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"RESULT": "42"}, results)
+	assert.Equal(t, "0", proxy.get("CMD_NR"))
+	assert.Equal(t, "FALSE", proxy.get("CMD_ACK"))
+}
+
+// Tests that a missing ack times out and withdraws the command.
+func TestHandshakeTimeout(t *testing.T) {
+	proxy := newFakeProxy(handshakeVars())
+	osv := connectFake(t, proxy)
+
+	handshake := testHandshake()
+	handshake.Timeout = 50 * time.Millisecond
+	_, err := handshake.Execute(context.Background(), osv, "1")
+	assert.ErrorIs(t, err, openshowvar.ErrHandshakeTimeout)
+	assert.Equal(t, "0", proxy.get("CMD_NR"))
+}
+
+// Tests that the command is withdrawn when the robot answers the ack read
+// only after the deadline, and the late answer is not taken for the reply to
+// the reset.
+func TestHandshakeTimeoutLateReply(t *testing.T) {
+	proxy := newFakeProxy(handshakeVars())
+	proxy.delay = func(name string) time.Duration {
+		if name == "CMD_ACK" && proxy.get("CMD_NR") == "1" {
+			return 200 * time.Millisecond
+		}
+		return 0
+	}
+	osv := connectFake(t, proxy)
+
+	handshake := testHandshake()
+	handshake.Timeout = 50 * time.Millisecond
+	_, err := handshake.Execute(context.Background(), osv, "1")
+	assert.ErrorIs(t, err, openshowvar.ErrHandshakeTimeout)
+	assert.NotContains(t, err.Error(), "reset")
+	assert.Equal(t, "0", proxy.get("CMD_NR"))
+}
+
+// Tests that a stale ack is cleared before the command is sent.
+func TestHandshakeStaleAck(t *testing.T) {
+	vars := handshakeVars()
+	vars["CMD_NR"] = "1"
+	vars["CMD_ACK"] = "TRUE"
+	proxy := newFakeProxy(vars)
+	osv := connectFake(t, proxy)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go runRobotProgram(ctx, proxy, true)
+
+	results, err := testHandshake().Execute(ctx, osv, "1",
+		openshowvar.Assignment{Name: "P_A", Value: "2"},
+		openshowvar.Assignment{Name: "P_B", Value: "3"},
+	)
+	require.NoError(t, err)
+	assert.Equal(t, "6", results["RESULT"])
+}
+
+// Tests that an ack that never clears is reported as stale.
+func TestHandshakeStaleAckStuck(t *testing.T) {
+	vars := handshakeVars()
+	vars["CMD_ACK"] = "TRUE"
+	proxy := newFakeProxy(vars)
+	osv := connectFake(t, proxy)
+
+	handshake := testHandshake()
+	handshake.Timeout = 50 * time.Millisecond
+	_, err := handshake.Execute(context.Background(), osv, "1")
+	assert.ErrorIs(t, err, openshowvar.ErrStaleAck)
+}
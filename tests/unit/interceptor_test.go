@@ -0,0 +1,215 @@
+package test
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/selimserbes/go-openshowvar/pkg/openshowvar"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Tests that interceptors run in order around the request.
+func TestInterceptorOrder(t *testing.T) {
+	var calls []string
+	trace := func(name string) openshowvar.Interceptor {
+		return func(ctx context.Context, req openshowvar.Request, next openshowvar.Handler) (openshowvar.Response, error) {
+			calls = append(calls, name+" before")
+			resp, err := next(ctx, req)
+			calls = append(calls, name+" after")
+			return resp, err
+		}
+	}
+
+	proxy := newFakeProxy(map[string]string{"$OV_PRO": "100"})
+	osv := openshowvar.NewOpenShowVar("", 0,
+		openshowvar.WithDialer(openshowvar.PipeDialer{Serve: proxy.Serve}),
+		openshowvar.WithInterceptors(trace("first"), trace("second")),
+	)
+	require.NoError(t, osv.Connect())
+	defer osv.Disconnect()
+
+	_, err := osv.Read("$OV_PRO")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"first before", "second before", "second after", "first after"}, calls)
+}
+
+// Tests interceptors that modify requests and responses.
+func TestInterceptorModify(t *testing.T) {
+	rename := func(ctx context.Context, req openshowvar.Request, next openshowvar.Handler) (openshowvar.Response, error) {
+		req.VarName = "$" + req.VarName
+		resp, err := next(ctx, req)
+		resp.Frame = nil
+		resp.Value = "<" + resp.Value + ">"
+		return resp, err
+	}
+
+	proxy := newFakeProxy(map[string]string{"$OV_PRO": "100"})
+	osv := openshowvar.NewOpenShowVar("", 0,
+		openshowvar.WithDialer(openshowvar.PipeDialer{Serve: proxy.Serve}),
+		openshowvar.WithInterceptors(rename),
+	)
+	require.NoError(t, osv.Connect())
+	defer osv.Disconnect()
+
+	value, err := osv.Read("OV_PRO")
+	assert.NoError(t, err)
+	assert.Equal(t, "<100>", value)
+}
+
+// Tests interceptors that answer or reject requests without reaching the server.
+func TestInterceptorShortCircuit(t *testing.T) {
+	cache := func(ctx context.Context, req openshowvar.Request, next openshowvar.Handler) (openshowvar.Response, error) {
+		if req.VarName == "CACHED" {
+			return openshowvar.Response{Value: "42"}, nil
+		}
+		return next(ctx, req)
+	}
+	writeGuard := func(ctx context.Context, req openshowvar.Request, next openshowvar.Handler) (openshowvar.Response, error) {
+		if req.Mode == openshowvar.ModeWrite {
+			return openshowvar.Response{}, errors.New("writes are disabled")
+		}
+		return next(ctx, req)
+	}
+
+	// Not connected: only short-circuited requests can succeed.
+	osv := openshowvar.NewOpenShowVar("", 0, openshowvar.WithInterceptors(cache, writeGuard))
+
+	value, err := osv.Read("CACHED")
+	assert.NoError(t, err)
+	assert.Equal(t, "42", value)
+
+	_, err = osv.Write("$OV_PRO", "50")
+	assert.EqualError(t, err, "writes are disabled")
+
+	_, err = osv.Read("$OV_PRO")
+	assert.EqualError(t, err, "not connected to server")
+}
+
+// Tests that each request gets a new message ID.
+func TestInterceptorMessageIDs(t *testing.T) {
+	var ids []uint16
+	record := func(ctx context.Context, req openshowvar.Request, next openshowvar.Handler) (openshowvar.Response, error) {
+		ids = append(ids, req.MsgID)
+		return next(ctx, req)
+	}
+
+	proxy := newFakeProxy(map[string]string{"$OV_PRO": "100"})
+	osv := openshowvar.NewOpenShowVar("", 0,
+		openshowvar.WithDialer(openshowvar.PipeDialer{Serve: proxy.Serve}),
+		openshowvar.WithInterceptors(record),
+	)
+	require.NoError(t, osv.Connect())
+	defer osv.Disconnect()
+
+	for i := 0; i < 3; i++ {
+		_, err := osv.Read("$OV_PRO")
+		assert.NoError(t, err)
+	}
+	assert.Len(t, ids, 3)
+	assert.NotEqual(t, ids[0], ids[1])
+	assert.NotEqual(t, ids[1], ids[2])
+}
+
+// Tests that a context deadline aborts a request the server never answers.
+func TestReadContextDeadline(t *testing.T) {
+	silent := openshowvar.PipeDialer{Serve: func(conn net.Conn) {
+		defer conn.Close()
+		buf := make([]byte, 1024)
+		for {
+			if _, err := conn.Read(buf); err != nil {
+				return
+			}
+		}
+	}}
+	osv := openshowvar.NewOpenShowVar("", 0, openshowvar.WithDialer(silent))
+	require.NoError(t, osv.Connect())
+	defer osv.Disconnect()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := osv.ReadContext(ctx, "$OV_PRO")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+// Serves requests on conn, answering each read with the variable name
+// followed by "-value". Requests for SLOW are answered after delay, and every
+// answer is preceded by a reply carrying another message ID if stale is set.
+func serveDelayed(conn net.Conn, delay time.Duration, stale bool) {
+	defer conn.Close()
+	for {
+		header := make([]byte, 4)
+		if _, err := io.ReadFull(conn, header); err != nil {
+			return
+		}
+		body := make([]byte, binary.BigEndian.Uint16(header[2:4]))
+		if _, err := io.ReadFull(conn, body); err != nil {
+			return
+		}
+		msgID, name, _, err := openshowvar.DecodeRequest(append(header, body...))
+		if err != nil {
+			return
+		}
+		if name == "SLOW" {
+			time.Sleep(delay)
+		}
+		if stale {
+			response, _ := openshowvar.EncodeResponse(msgID+100, openshowvar.ModeRead, "stale", true)
+			if _, err := conn.Write(response); err != nil {
+				return
+			}
+		}
+		response, _ := openshowvar.EncodeResponse(msgID, openshowvar.ModeRead, name+"-value", true)
+		if _, err := conn.Write(response); err != nil {
+			return
+		}
+	}
+}
+
+// Tests that the late reply to a timed out request is not returned for the
+// next one. Over a synchronous pipe, the server blocks writing the late
+// reply, so the next request would also hang if the connection was kept.
+func TestReadAfterContextDeadline(t *testing.T) {
+	dialer := openshowvar.PipeDialer{Serve: func(conn net.Conn) { serveDelayed(conn, 200*time.Millisecond, false) }}
+	osv := openshowvar.NewOpenShowVar("", 0, openshowvar.WithDialer(dialer))
+	require.NoError(t, osv.Connect())
+	defer osv.Disconnect()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := osv.ReadContext(ctx, "SLOW")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		value, err := osv.Read("B")
+		assert.NoError(t, err)
+		assert.Equal(t, "B-value", value)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		osv.Disconnect()
+		t.Fatal("read after deadline hangs")
+	}
+}
+
+// Tests that replies with another message ID are dropped.
+func TestReadDropsStaleReplies(t *testing.T) {
+	dialer := openshowvar.PipeDialer{Serve: func(conn net.Conn) { serveDelayed(conn, 0, true) }}
+	osv := openshowvar.NewOpenShowVar("", 0, openshowvar.WithDialer(dialer))
+	require.NoError(t, osv.Connect())
+	defer osv.Disconnect()
+
+	for _, name := range []string{"A", "B"} {
+		value, err := osv.Read(name)
+		assert.NoError(t, err)
+		assert.Equal(t, name+"-value", value)
+	}
+}
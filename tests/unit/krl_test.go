@@ -0,0 +1,99 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/selimserbes/go-openshowvar/pkg/krl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Tests parsing of KRL literals of every kind.
+func TestKRLParse(t *testing.T) {
+	cases := []struct {
+		literal string
+		want    krl.Value
+	}{
+		{"42", krl.Value{Kind: krl.Int, Int: 42}},
+		{" -7 ", krl.Value{Kind: krl.Int, Int: -7}},
+		{"'H1F'", krl.Value{Kind: krl.Int, Int: 31}},
+		{"'B101'", krl.Value{Kind: krl.Int, Int: 5}},
+		{"1.5", krl.Value{Kind: krl.Real, Real: 1.5}},
+		{"1.5E+02", krl.Value{Kind: krl.Real, Real: 150}},
+		{"TRUE", krl.Value{Kind: krl.Bool, Bool: true}},
+		{"false", krl.Value{Kind: krl.Bool, Bool: false}},
+		{`"hello world"`, krl.Value{Kind: krl.String, Str: "hello world"}},
+		{"#T1", krl.Value{Kind: krl.Enum, Str: "T1"}},
+	}
+	for _, c := range cases {
+		got, err := krl.Parse(c.literal)
+		require.NoError(t, err, c.literal)
+		assert.Equal(t, c.want, got, c.literal)
+	}
+}
+
+// Tests parsing of STRUC literals.
+func TestKRLParseStruc(t *testing.T) {
+	v, err := krl.Parse("{E6POS: X 425.0, Y -1.5, Z 650.0, A 180.0, B 0.0, C 180.0, S 2, T 35}")
+	require.NoError(t, err)
+	assert.Equal(t, krl.Struc, v.Kind)
+	assert.Equal(t, "E6POS", v.Type)
+	assert.Len(t, v.Fields, 8)
+
+	y, ok := v.Field("y")
+	assert.True(t, ok)
+	assert.Equal(t, -1.5, y.Real)
+	s, _ := v.Field("S")
+	assert.Equal(t, krl.Int, s.Kind)
+
+	// Nested and untyped STRUC values.
+	v, err = krl.Parse(`{TOOL: NAME "gripper", FRAME {X 1.0, Y 2.0}, ACTIVE TRUE, MODE #FAST}`)
+	require.NoError(t, err)
+	frame, _ := v.Field("FRAME")
+	assert.Equal(t, "", frame.Type)
+	x, _ := frame.Field("X")
+	assert.Equal(t, 1.0, x.Real)
+	assert.Equal(t, `{TOOL: NAME "gripper", FRAME {X 1.0, Y 2.0}, ACTIVE TRUE, MODE #FAST}`, v.String())
+}
+
+// Tests that malformed literals are rejected.
+func TestKRLParseErrors(t *testing.T) {
+	for _, literal := range []string{"", "{", "{X}", "{X 1.0", `"open`, "#", "1.0.0", "MAYBE", "'Z12'", "1 2"} {
+		_, err := krl.Parse(literal)
+		assert.Error(t, err, literal)
+	}
+}
+
+// Tests comparison with tolerance.
+func TestKRLEqual(t *testing.T) {
+	assert.True(t, krl.EqualStrings("1.0", "1.05", 0.1))
+	assert.False(t, krl.EqualStrings("1.0", "1.5", 0.1))
+	assert.True(t, krl.EqualStrings("1", "1.0", 0))
+	assert.True(t, krl.EqualStrings("{E6POS: X 1.0}", "{e6pos: x 1.01}", 0.1))
+	assert.False(t, krl.EqualStrings("{E6POS: X 1.0}", "{E6POS: X 1.0, Y 0.0}", 0.1))
+	assert.False(t, krl.EqualStrings("TRUE", "1", 0))
+	assert.True(t, krl.EqualStrings("not krl", "not krl", 0))
+}
+
+// Tests variable name patterns with array indices, wildcards and members.
+func TestKRLMatchName(t *testing.T) {
+	tests := []struct {
+		pattern, name string
+		match         bool
+	}{
+		{"$TOOL_DATA[3]", "$TOOL_DATA[3]", true},
+		{"$TOOL_DATA[3]", "$tool_data[3].X", true},
+		{"$TOOL_DATA[3]", "$TOOL_DATA3", false},
+		{"$TOOL_DATA[3]", "$TOOL_DATA[13]", false},
+		{"RECIPE[*]", "RECIPE[2]", true},
+		{"RECIPE[*]", "RECIPE", false},
+		{"$IN", "$IN[1]", true},
+		{"$POS_ACT", "$POS_ACT.X", true},
+		{"$POS_ACT", "$POS_ACT_MES", false},
+		{"$PRO_STATE*", "$PRO_STATE1", true},
+		{"recipe_*", "RECIPE_ID", true},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.match, krl.MatchName(tt.pattern, tt.name), "%s %s", tt.pattern, tt.name)
+	}
+}
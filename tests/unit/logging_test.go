@@ -0,0 +1,121 @@
+package test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/selimserbes/go-openshowvar/pkg/openshowvar"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Decodes JSON log lines into maps.
+func logEntries(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	var entries []map[string]any
+	for _, line := range bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n")) {
+		entry := make(map[string]any)
+		require.NoError(t, json.Unmarshal(line, &entry))
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// Tests logging of connects, requests, frames and disconnects.
+func TestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	proxy := newFakeProxy(map[string]string{"$OV_PRO": "100"})
+	osv := openshowvar.NewOpenShowVar("", 0,
+		openshowvar.WithDialer(openshowvar.PipeDialer{Serve: proxy.Serve}),
+		openshowvar.WithLogger(logger),
+	)
+	require.NoError(t, osv.Connect())
+	_, err := osv.Read("$OV_PRO")
+	require.NoError(t, err)
+	_, err = osv.Read("MISSING")
+	require.Error(t, err)
+	osv.Disconnect()
+
+	entries := logEntries(t, &buf)
+	var messages []string
+	for _, entry := range entries {
+		messages = append(messages, entry["msg"].(string))
+	}
+	assert.Equal(t, []string{
+		"connected",
+		"sent frame", "received frame", "request",
+		"sent frame", "received frame", "request failed",
+		"disconnected",
+	}, messages)
+
+	// Successful request.
+	request := entries[3]
+	assert.Equal(t, "DEBUG", request["level"])
+	assert.Equal(t, "$OV_PRO", request["var"])
+	assert.Equal(t, "read", request["mode"])
+	assert.Equal(t, "100", request["value"])
+	assert.Contains(t, request, "msg_id")
+	assert.Contains(t, request, "latency")
+	assert.Equal(t, entries[1]["msg_id"], request["msg_id"])
+
+	// Frame dump of the request.
+	frame, _ := openshowvar.EncodeRequest(uint16(request["msg_id"].(float64)), "$OV_PRO", "")
+	assert.Equal(t, hex.EncodeToString(frame), entries[1]["frame"])
+
+	// Failed request.
+	failed := entries[6]
+	assert.Equal(t, "WARN", failed["level"])
+	assert.Equal(t, "MISSING", failed["var"])
+	assert.Contains(t, failed, "error")
+}
+
+// Tests that values of redacted variables are hidden.
+func TestLoggerRedaction(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	proxy := newFakeProxy(map[string]string{"SECRET_PIN": "1234", "$OV_PRO": "100"})
+	osv := openshowvar.NewOpenShowVar("", 0,
+		openshowvar.WithDialer(openshowvar.PipeDialer{Serve: proxy.Serve}),
+		openshowvar.WithLogger(logger),
+		openshowvar.WithRedactedVars("SECRET_*"),
+	)
+	require.NoError(t, osv.Connect())
+	defer osv.Disconnect()
+
+	_, err := osv.Write("SECRET_PIN", "9876")
+	require.NoError(t, err)
+
+	assert.NotContains(t, buf.String(), "9876")
+	assert.NotContains(t, buf.String(), "frame")
+	entries := logEntries(t, &buf)
+	assert.Equal(t, "[REDACTED]", entries[len(entries)-1]["value"])
+}
+
+// Tests that redaction patterns naming array elements cover them and their members.
+func TestLoggerRedactionArrayElement(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	proxy := newFakeProxy(map[string]string{"PASSWORDS[1]": "\"hunter2\"", "PASSWORDS[2]": "\"public\""})
+	osv := connectFake(t, proxy, openshowvar.WithLogger(logger), openshowvar.WithRedactedVars("PASSWORDS[1]"))
+
+	_, err := osv.Read("PASSWORDS[1]")
+	require.NoError(t, err)
+	_, err = osv.Read("PASSWORDS[2]")
+	require.NoError(t, err)
+
+	assert.NotContains(t, buf.String(), "hunter2")
+	entries := logEntries(t, &buf)
+	var values []any
+	for _, entry := range entries {
+		if entry["msg"] == "request" {
+			values = append(values, entry["value"])
+		}
+	}
+	assert.Equal(t, []any{"[REDACTED]", "\"public\""}, values)
+}
@@ -0,0 +1,79 @@
+package test
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/selimserbes/go-openshowvar/pkg/openshowvar"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Tests request, byte and connection statistics.
+func TestMetrics(t *testing.T) {
+	metrics := openshowvar.NewMetrics()
+	proxy := newFakeProxy(map[string]string{"$OV_PRO": "100"})
+	osv := openshowvar.NewOpenShowVar("robot1", 7000,
+		openshowvar.WithDialer(openshowvar.PipeDialer{Serve: proxy.Serve}),
+		openshowvar.WithMetrics(metrics),
+	)
+
+	require.NoError(t, osv.Connect())
+	_, err := osv.Read("$OV_PRO")
+	require.NoError(t, err)
+	_, err = osv.Read("MISSING")
+	require.Error(t, err)
+	_, err = osv.Write("$OV_PRO", "50")
+	require.NoError(t, err)
+
+	// Reconnect once and leave the client connected.
+	osv.Disconnect()
+	require.NoError(t, osv.Connect())
+	defer osv.Disconnect()
+
+	snapshot := metrics.Snapshot()
+	require.Len(t, snapshot, 1)
+	stats := snapshot[0]
+	assert.Equal(t, "robot1:7000", stats.Endpoint)
+	assert.Equal(t, 1, stats.Connected)
+	assert.Equal(t, uint64(1), stats.Reconnects)
+	assert.Equal(t, uint64(1), stats.Read.Succeeded)
+	assert.Equal(t, uint64(1), stats.Read.Failed)
+	assert.Equal(t, uint64(1), stats.Write.Succeeded)
+	assert.Equal(t, uint64(0), stats.Write.Failed)
+	assert.Positive(t, stats.BytesSent)
+	assert.Positive(t, stats.BytesReceived)
+	assert.Positive(t, stats.Read.LatencySum)
+
+	// Cumulative buckets never exceed the request count.
+	last := stats.Read.Buckets[len(stats.Read.Buckets)-1]
+	assert.LessOrEqual(t, last, stats.Read.Succeeded+stats.Read.Failed)
+}
+
+// Tests the Prometheus text export.
+func TestMetricsPrometheus(t *testing.T) {
+	metrics := openshowvar.NewMetrics()
+	proxy := newFakeProxy(map[string]string{"$OV_PRO": "100"})
+	osv := openshowvar.NewOpenShowVar("robot1", 7000,
+		openshowvar.WithDialer(openshowvar.PipeDialer{Serve: proxy.Serve}),
+		openshowvar.WithMetrics(metrics),
+	)
+	require.NoError(t, osv.Connect())
+	defer osv.Disconnect()
+	_, err := osv.Read("$OV_PRO")
+	require.NoError(t, err)
+
+	recorder := httptest.NewRecorder()
+	metrics.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	body := recorder.Body.String()
+
+	assert.True(t, strings.HasPrefix(recorder.Header().Get("Content-Type"), "text/plain"))
+	assert.Contains(t, body, "# TYPE openshowvar_requests_total counter\n")
+	assert.Contains(t, body, `openshowvar_requests_total{endpoint="robot1:7000",mode="read",result="ok"} 1`+"\n")
+	assert.Contains(t, body, `openshowvar_requests_total{endpoint="robot1:7000",mode="write",result="ok"} 0`+"\n")
+	assert.Contains(t, body, `openshowvar_request_duration_seconds_bucket{endpoint="robot1:7000",mode="read",le="+Inf"} 1`+"\n")
+	assert.Contains(t, body, `openshowvar_request_duration_seconds_count{endpoint="robot1:7000",mode="read"} 1`+"\n")
+	assert.Contains(t, body, `openshowvar_connected{endpoint="robot1:7000"} 1`+"\n")
+	assert.Contains(t, body, `openshowvar_reconnects_total{endpoint="robot1:7000"} 0`+"\n")
+}
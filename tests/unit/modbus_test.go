@@ -0,0 +1,227 @@
+package test
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/selimserbes/go-openshowvar/pkg/gateway"
+	"github.com/selimserbes/go-openshowvar/pkg/modbus"
+	"github.com/selimserbes/go-openshowvar/pkg/openshowvar"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// modbusClient sends raw Modbus TCP requests.
+type modbusClient struct {
+	t    *testing.T
+	conn net.Conn
+	txID uint16
+	unit uint8
+}
+
+// Starts a Modbus server for a robot backed by a fake proxy as unit 1 and
+// returns a client connected to it.
+func startModbus(t *testing.T, proxy *fakeProxy, mappings []modbus.Mapping) *modbusClient {
+	robot := &gateway.Robot{
+		ID:     "cell1",
+		Client: openshowvar.NewOpenShowVar("10.0.0.1", 7000, openshowvar.WithDialer(openshowvar.PipeDialer{Serve: proxy.Serve})),
+	}
+	server := modbus.NewServer()
+	require.NoError(t, server.AddRobot(1, robot, mappings))
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go server.Serve(listener)
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		conn.Close()
+		server.Close()
+		robot.Close()
+	})
+	return &modbusClient{t: t, conn: conn, unit: 1}
+}
+
+// do sends a request PDU and returns the response PDU.
+func (c *modbusClient) do(pdu ...byte) []byte {
+	c.txID++
+	frame := binary.BigEndian.AppendUint16(nil, c.txID)
+	frame = binary.BigEndian.AppendUint16(frame, 0)
+	frame = binary.BigEndian.AppendUint16(frame, uint16(len(pdu)+1))
+	frame = append(frame, c.unit)
+	frame = append(frame, pdu...)
+	c.conn.SetDeadline(time.Now().Add(5 * time.Second))
+	_, err := c.conn.Write(frame)
+	require.NoError(c.t, err)
+
+	header := make([]byte, 7)
+	_, err = io.ReadFull(c.conn, header)
+	require.NoError(c.t, err)
+	require.Equal(c.t, c.txID, binary.BigEndian.Uint16(header))
+	require.Equal(c.t, c.unit, header[6])
+	resp := make([]byte, binary.BigEndian.Uint16(header[4:])-1)
+	_, err = io.ReadFull(c.conn, resp)
+	require.NoError(c.t, err)
+	return resp
+}
+
+// readRegisters reads holding registers.
+func (c *modbusClient) readRegisters(addr, quantity uint16) []uint16 {
+	resp := c.do(3, byte(addr>>8), byte(addr), byte(quantity>>8), byte(quantity))
+	require.Equal(c.t, byte(3), resp[0], "exception %v", resp)
+	regs := make([]uint16, quantity)
+	for i := range regs {
+		regs[i] = binary.BigEndian.Uint16(resp[2+2*i:])
+	}
+	return regs
+}
+
+// writeRegisters writes holding registers and returns the response PDU.
+func (c *modbusClient) writeRegisters(addr uint16, regs ...uint16) []byte {
+	pdu := []byte{16, byte(addr >> 8), byte(addr), 0, byte(len(regs)), byte(2 * len(regs))}
+	for _, r := range regs {
+		pdu = binary.BigEndian.AppendUint16(pdu, r)
+	}
+	return c.do(pdu...)
+}
+
+// Tests reading INT, scaled REAL and float32 values from holding registers.
+func TestModbusReadRegisters(t *testing.T) {
+	proxy := newFakeProxy(map[string]string{"$OV_PRO": "75", "$POS_ACT.X": "-1234.56", "$POS_ACT.Y": "12.5", "COUNT": "70000"})
+	client := startModbus(t, proxy, []modbus.Mapping{
+		{Table: modbus.HoldingRegisters, Address: 0, Var: "$OV_PRO"},
+		{Table: modbus.HoldingRegisters, Address: 1, Var: "$POS_ACT.X", Type: modbus.Int32, Scale: 100},
+		{Table: modbus.HoldingRegisters, Address: 3, Var: "$POS_ACT.Y", Type: modbus.Float32},
+		{Table: modbus.HoldingRegisters, Address: 5, Var: "COUNT"},
+	})
+
+	regs := client.readRegisters(0, 5)
+	assert.Equal(t, uint16(75), regs[0])
+	assert.Equal(t, int32(-123456), int32(uint32(regs[1])<<16|uint32(regs[2])))
+	assert.Equal(t, float32(12.5), math.Float32frombits(uint32(regs[3])<<16|uint32(regs[4])))
+
+	// Reads may start in the middle of a 32-bit value.
+	assert.Equal(t, []uint16{regs[2]}, client.readRegisters(2, 1))
+
+	// Values that do not fit the register type fail instead of wrapping.
+	assert.Equal(t, []byte{0x83, byte(modbus.ServerDeviceFailure)}, client.do(3, 0, 5, 0, 1))
+	// Unmapped addresses are illegal.
+	assert.Equal(t, []byte{0x83, byte(modbus.IllegalDataAddress)}, client.do(3, 0, 4, 0, 3))
+}
+
+// Tests writing scaled values to holding registers.
+func TestModbusWriteRegisters(t *testing.T) {
+	proxy := newFakeProxy(map[string]string{"$OV_PRO": "75", "SPEED": "0.0", "TARGET": "0.0", "$POS_ACT.X": "0.0"})
+	client := startModbus(t, proxy, []modbus.Mapping{
+		{Table: modbus.HoldingRegisters, Address: 0, Var: "$OV_PRO"},
+		{Table: modbus.HoldingRegisters, Address: 1, Var: "SPEED", Scale: 10},
+		{Table: modbus.HoldingRegisters, Address: 2, Var: "TARGET", Type: modbus.Float32},
+		{Table: modbus.HoldingRegisters, Address: 4, Var: "$POS_ACT.X"},
+	})
+
+	// Write Single Register echoes the request.
+	assert.Equal(t, []byte{6, 0, 0, 0, 50}, client.do(6, 0, 0, 0, 50))
+	assert.Equal(t, "50", proxy.get("$OV_PRO"))
+
+	assert.Equal(t, []byte{16, 0, 1, 0, 1}, client.writeRegisters(1, 125))
+	assert.Equal(t, "12.5", proxy.get("SPEED"))
+
+	bits := math.Float32bits(-2.25)
+	assert.Equal(t, []byte{16, 0, 2, 0, 2}, client.writeRegisters(2, uint16(bits>>16), uint16(bits)))
+	assert.Equal(t, "-2.25", proxy.get("TARGET"))
+
+	// Half of a 32-bit value cannot be written.
+	assert.Equal(t, []byte{0x90, byte(modbus.IllegalDataAddress)}, client.writeRegisters(3, 0))
+	// Read-only system variables are never written.
+	assert.Equal(t, []byte{0x86, byte(modbus.IllegalDataAddress)}, client.do(6, 0, 4, 0, 1))
+	assert.Equal(t, "0.0", proxy.get("$POS_ACT.X"))
+}
+
+// Tests BOOL variables and arrays as coils and packed into registers.
+func TestModbusBits(t *testing.T) {
+	vars := map[string]string{"FLAG": "TRUE"}
+	for i := 1; i <= 20; i++ {
+		vars["$OUT["+strconv.Itoa(i)+"]"] = "FALSE"
+	}
+	vars["$OUT[2]"] = "TRUE"
+	vars["$OUT[17]"] = "TRUE"
+	proxy := newFakeProxy(vars)
+	client := startModbus(t, proxy, []modbus.Mapping{
+		{Table: modbus.Coils, Address: 0, Var: "$OUT", Count: 20},
+		{Table: modbus.Coils, Address: 20, Var: "FLAG"},
+		{Table: modbus.HoldingRegisters, Address: 100, Var: "$OUT", Count: 20},
+	})
+
+	// Read Coils packs 21 bits into 3 bytes, LSB first.
+	assert.Equal(t, []byte{1, 3, 0x02, 0x00, 0x11}, client.do(1, 0, 0, 0, 21))
+	assert.Equal(t, []uint16{0x0002, 0x0001}, client.readRegisters(100, 2))
+
+	// Write Single Coil and Write Multiple Coils.
+	assert.Equal(t, []byte{5, 0, 20, 0, 0}, client.do(5, 0, 20, 0, 0))
+	assert.Equal(t, "FALSE", proxy.get("FLAG"))
+	assert.Equal(t, []byte{15, 0, 0, 0, 3}, client.do(15, 0, 0, 0, 3, 1, 0x05))
+	assert.Equal(t, "TRUE", proxy.get("$OUT[1]"))
+	assert.Equal(t, "FALSE", proxy.get("$OUT[2]"))
+	assert.Equal(t, "TRUE", proxy.get("$OUT[3]"))
+	assert.Equal(t, []byte{0x85, byte(modbus.IllegalDataValue)}, client.do(5, 0, 20, 0x12, 0x34))
+
+	// Writing a packed register writes its 16 elements.
+	assert.Equal(t, []byte{6, 0, 100, 0x80, 0x00}, client.do(6, 0, 100, 0x80, 0x00))
+	assert.Equal(t, "FALSE", proxy.get("$OUT[1]"))
+	assert.Equal(t, "TRUE", proxy.get("$OUT[16]"))
+	assert.Equal(t, "TRUE", proxy.get("$OUT[17]"))
+}
+
+// Tests that reads of part of a BOOL array only read the addressed elements.
+func TestModbusReadRange(t *testing.T) {
+	vars := make(map[string]string)
+	for i := 1; i <= 256; i++ {
+		vars["$OUT["+strconv.Itoa(i)+"]"] = "FALSE"
+	}
+	vars["$OUT[100]"] = "TRUE"
+	vars["$OUT[200]"] = "TRUE"
+	proxy := newFakeProxy(vars)
+	client := startModbus(t, proxy, []modbus.Mapping{
+		{Table: modbus.Coils, Address: 0, Var: "$OUT", Count: 256},
+		{Table: modbus.HoldingRegisters, Address: 0, Var: "$OUT", Count: 256},
+	})
+
+	before := proxy.requestCount()
+	assert.Equal(t, []byte{1, 1, 0x01}, client.do(1, 0, 99, 0, 1))
+	assert.Equal(t, 1, proxy.requestCount()-before)
+
+	// Register 12 packs $OUT[193] to $OUT[208].
+	before = proxy.requestCount()
+	assert.Equal(t, []uint16{0x0080}, client.readRegisters(12, 1))
+	assert.Equal(t, 16, proxy.requestCount()-before)
+}
+
+// Tests exceptions for unknown units and function codes.
+func TestModbusExceptions(t *testing.T) {
+	proxy := newFakeProxy(map[string]string{"$OV_PRO": "75"})
+	client := startModbus(t, proxy, []modbus.Mapping{{Table: modbus.InputRegisters, Address: 0, Var: "$OV_PRO"}})
+
+	assert.Equal(t, []byte{4, 2, 0, 75}, client.do(4, 0, 0, 0, 1))
+	// Input registers are not holding registers.
+	assert.Equal(t, []byte{0x83, byte(modbus.IllegalDataAddress)}, client.do(3, 0, 0, 0, 1))
+	assert.Equal(t, []byte{0x83, byte(modbus.IllegalDataValue)}, client.do(3, 0, 0, 0, 200))
+	assert.Equal(t, []byte{0x87, byte(modbus.IllegalFunction)}, client.do(7))
+
+	client.unit = 2
+	assert.Equal(t, []byte{0x84, byte(modbus.GatewayPathUnavailable)}, client.do(4, 0, 0, 0, 1))
+
+	server := modbus.NewServer()
+	err := server.AddRobot(1, &gateway.Robot{ID: "cell1"}, []modbus.Mapping{
+		{Table: modbus.HoldingRegisters, Address: 0, Var: "A", Type: modbus.Int32},
+		{Table: modbus.HoldingRegisters, Address: 1, Var: "B"},
+	})
+	assert.ErrorContains(t, err, "taken by A")
+	err = server.AddRobot(1, &gateway.Robot{ID: "cell1"}, []modbus.Mapping{{Table: modbus.Coils, Var: "A", Scale: 10}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,195 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	mochi "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/listeners"
+	"github.com/selimserbes/go-openshowvar/pkg/gateway"
+	"github.com/selimserbes/go-openshowvar/pkg/mqttbridge"
+	"github.com/selimserbes/go-openshowvar/pkg/openshowvar"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Starts an embedded MQTT broker and returns it with its address.
+func startBroker(t *testing.T) (*mochi.Server, string) {
+	broker := mochi.New(&mochi.Options{Logger: slog.New(slog.NewTextHandler(io.Discard, nil))})
+	require.NoError(t, broker.AddHook(new(auth.AllowHook), nil))
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	require.NoError(t, broker.AddListener(listeners.NewNet("test", listener)))
+	require.NoError(t, broker.Serve())
+	t.Cleanup(func() { broker.Close() })
+	return broker, "tcp://" + listener.Addr().String()
+}
+
+// Connects an MQTT client to the broker, subscribed to all robot topics.
+func mqttClient(t *testing.T, address string) (mqtt.Client, <-chan mqtt.Message) {
+	messages := make(chan mqtt.Message, 100)
+	client := mqtt.NewClient(mqtt.NewClientOptions().AddBroker(address).SetClientID("test"))
+	token := client.Connect()
+	require.True(t, token.WaitTimeout(5*time.Second))
+	require.NoError(t, token.Error())
+	token = client.Subscribe("robots/#", 1, func(_ mqtt.Client, msg mqtt.Message) { messages <- msg })
+	require.True(t, token.WaitTimeout(5*time.Second))
+	require.NoError(t, token.Error())
+	t.Cleanup(func() { client.Disconnect(0) })
+	return client, messages
+}
+
+// Waits for the next message on a topic, skipping the others.
+func nextMessage(t *testing.T, messages <-chan mqtt.Message, topic string) mqtt.Message {
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case msg := <-messages:
+			if msg.Topic() == topic {
+				return msg
+			}
+		case <-timeout:
+			t.Fatalf("no message on %s", topic)
+			return nil
+		}
+	}
+}
+
+// Waits until the availability of the robot is published as want.
+func waitAvailability(t *testing.T, messages <-chan mqtt.Message, want string) {
+	for string(nextMessage(t, messages, "robots/cell1/availability").Payload()) != want {
+	}
+}
+
+// Decodes a published variable.
+func decodeEvent(t *testing.T, msg mqtt.Message) gateway.Event {
+	var event gateway.Event
+	require.NoError(t, json.Unmarshal(msg.Payload(), &event), string(msg.Payload()))
+	return event
+}
+
+// Starts a bridge for a robot backed by a fake proxy.
+func startBridge(t *testing.T, proxy *fakeProxy, address string, autoReconnect bool, vars ...string) context.CancelFunc {
+	robot := &gateway.Robot{ID: "cell1", Client: openshowvar.NewOpenShowVar("10.0.0.1", 7000, openshowvar.WithDialer(openshowvar.PipeDialer{Serve: proxy.Serve}))}
+	opts := mqtt.NewClientOptions().AddBroker(address).SetClientID("bridge").SetAutoReconnect(autoReconnect)
+	bridge := mqttbridge.New(robot, opts, mqttbridge.Config{Vars: vars, Interval: 10 * time.Millisecond, QoS: 1})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- bridge.Run(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		assert.NoError(t, <-done)
+		robot.Close()
+	})
+	return cancel
+}
+
+// Tests publishing variables and their changes as retained JSON.
+func TestMQTTBridgePublish(t *testing.T) {
+	_, address := startBroker(t)
+	proxy := newFakeProxy(map[string]string{"$OV_PRO": "100", "$POS_ACT": "{E6POS: X 1.0, Y 2.0}"})
+	_, messages := mqttClient(t, address)
+	startBridge(t, proxy, address, true, "$OV_PRO", "$POS_ACT", "$MISSING")
+
+	waitAvailability(t, messages, "online")
+
+	first := map[string]gateway.Event{}
+	for len(first) < 3 {
+		select {
+		case msg := <-messages:
+			if msg.Topic() != "robots/cell1/availability" {
+				first[msg.Topic()] = decodeEvent(t, msg)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("missing values")
+		}
+	}
+	event := first["robots/cell1/vars/$POS_ACT"]
+	assert.Equal(t, "cell1", event.Robot)
+	assert.Equal(t, map[string]any{"X": 1.0, "Y": 2.0}, event.Value)
+	assert.Equal(t, "100", first["robots/cell1/vars/$OV_PRO"].Raw)
+	assert.NotEmpty(t, first["robots/cell1/vars/$MISSING"].Error)
+
+	proxy.set("$OV_PRO", "30")
+	for {
+		event = decodeEvent(t, nextMessage(t, messages, "robots/cell1/vars/$OV_PRO"))
+		if event.Raw == "30" {
+			break
+		}
+	}
+	assert.Equal(t, "100", event.Previous)
+
+	// Late subscribers receive the retained values.
+	late := mqtt.NewClient(mqtt.NewClientOptions().AddBroker(address).SetClientID("late"))
+	require.True(t, late.Connect().WaitTimeout(5*time.Second))
+	defer late.Disconnect(0)
+	retained := make(chan mqtt.Message, 1)
+	late.Subscribe("robots/cell1/vars/$OV_PRO", 1, func(_ mqtt.Client, msg mqtt.Message) { retained <- msg })
+	select {
+	case msg := <-retained:
+		assert.True(t, msg.Retained())
+		assert.Equal(t, "30", decodeEvent(t, msg).Raw)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no retained value")
+	}
+}
+
+// Tests writing values published to set topics.
+func TestMQTTBridgeSet(t *testing.T) {
+	_, address := startBroker(t)
+	proxy := newFakeProxy(map[string]string{"$OV_PRO": "100", "TARGET": "{X 0.0}", "$MODE_OP": "#T1"})
+	client, messages := mqttClient(t, address)
+	startBridge(t, proxy, address, true, "$OV_PRO", "TARGET")
+	waitAvailability(t, messages, "online")
+
+	client.Publish("robots/cell1/vars/$OV_PRO/set", 1, false, "50")
+	event := decodeEvent(t, nextMessage(t, messages, "robots/cell1/vars/$OV_PRO/set/result"))
+	assert.Empty(t, event.Error)
+	assert.Equal(t, "50", event.Raw)
+	assert.Equal(t, "50", proxy.get("$OV_PRO"))
+
+	client.Publish("robots/cell1/vars/TARGET/set", 1, false, "{X 5.0}")
+	event = decodeEvent(t, nextMessage(t, messages, "robots/cell1/vars/TARGET/set/result"))
+	assert.Empty(t, event.Error)
+	assert.Equal(t, "{X 5.0}", proxy.get("TARGET"))
+
+	// Only bridged variables can be written.
+	client.Publish("robots/cell1/vars/$MODE_OP/set", 1, false, `"#AUT"`)
+	event = decodeEvent(t, nextMessage(t, messages, "robots/cell1/vars/$MODE_OP/set/result"))
+	assert.Contains(t, event.Error, "not bridged")
+	assert.Equal(t, "#T1", proxy.get("$MODE_OP"))
+}
+
+// Tests the availability on shutdown and the last will on a lost connection.
+func TestMQTTBridgeAvailability(t *testing.T) {
+	broker, address := startBroker(t)
+	_, messages := mqttClient(t, address)
+	proxy := newFakeProxy(map[string]string{"$OV_PRO": "100"})
+	startBridge(t, proxy, address, false, "$OV_PRO")
+	waitAvailability(t, messages, "online")
+
+	// The broker publishes the last will when the bridge disappears.
+	client, ok := broker.Clients.Get("bridge")
+	require.True(t, ok)
+	client.Stop(io.EOF)
+	waitAvailability(t, messages, "offline")
+}
+
+// Tests that a clean shutdown publishes the robot as offline.
+func TestMQTTBridgeShutdown(t *testing.T) {
+	_, address := startBroker(t)
+	_, messages := mqttClient(t, address)
+	cancel := startBridge(t, newFakeProxy(map[string]string{"$OV_PRO": "100"}), address, true, "$OV_PRO")
+	waitAvailability(t, messages, "online")
+
+	cancel()
+	waitAvailability(t, messages, "offline")
+}
@@ -0,0 +1,386 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/selimserbes/go-openshowvar/pkg/gateway"
+	"github.com/selimserbes/go-openshowvar/pkg/opcua"
+	"github.com/selimserbes/go-openshowvar/pkg/openshowvar"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Starts an OPC UA server for a robot backed by a fake proxy and returns its
+// address.
+func startOPCUAServer(t *testing.T, proxy *fakeProxy, vars []opcua.Variable) string {
+	robot := &gateway.Robot{
+		ID:     "cell1",
+		Client: openshowvar.NewOpenShowVar("10.0.0.1", 7000, openshowvar.WithDialer(openshowvar.PipeDialer{Serve: proxy.Serve})),
+	}
+	server := opcua.NewServer()
+	server.MinSamplingInterval = 10 * time.Millisecond
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, server.AddRobot(ctx, robot, vars))
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go server.Serve(listener)
+	t.Cleanup(func() {
+		server.Close()
+		robot.Close()
+	})
+	return listener.Addr().String()
+}
+
+// Starts an OPC UA server for a robot backed by a fake proxy and returns a
+// client connected to it.
+func startOPCUA(t *testing.T, proxy *fakeProxy, vars []opcua.Variable) *opcua.Client {
+	addr := startOPCUAServer(t, proxy, vars)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	client, err := opcua.Dial(ctx, "opc.tcp://"+addr)
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+// Returns the browse names of the references of a node.
+func browseNames(t *testing.T, client *opcua.Client, id opcua.NodeID) []string {
+	refs, err := client.Browse(context.Background(), id)
+	require.NoError(t, err)
+	var names []string
+	for _, ref := range refs {
+		names = append(names, ref.BrowseName.Name)
+	}
+	return names
+}
+
+// Tests browsing from the Objects folder to the members of a STRUC variable.
+func TestOPCUABrowse(t *testing.T) {
+	proxy := newFakeProxy(map[string]string{"$POS_ACT": "{E6POS: X 425.0, Y -1.5}", "$OV_PRO": "100"})
+	client := startOPCUA(t, proxy, []opcua.Variable{{Name: "$POS_ACT"}, {Name: "$OV_PRO", Writable: true}})
+
+	assert.Equal(t, []string{"Server", "cell1"}, browseNames(t, client, opcua.NewNumericNodeID(0, 85)))
+	assert.Equal(t, []string{"$POS_ACT", "$OV_PRO"}, browseNames(t, client, opcua.NewStringNodeID(1, "cell1")))
+	assert.Equal(t, []string{"X", "Y"}, browseNames(t, client, opcua.RobotNodeID("cell1", "$POS_ACT")))
+
+	_, err := client.Browse(context.Background(), opcua.NewStringNodeID(1, "cell2"))
+	assert.ErrorIs(t, err, opcua.BadNodeIDUnknown)
+}
+
+// Tests the data types and values of variables read from the robot.
+func TestOPCUARead(t *testing.T) {
+	proxy := newFakeProxy(map[string]string{
+		"$POS_ACT":  "{E6POS: X 425.0, Y -1.5}",
+		"$OV_PRO":   "100",
+		"$IN[1]":    "TRUE",
+		"$MODE_OP":  "#T1",
+		"PROG_NAME": "\"main\"",
+	})
+	client := startOPCUA(t, proxy, []opcua.Variable{{Name: "$POS_ACT"}, {Name: "$OV_PRO"}, {Name: "$IN[1]"}, {Name: "$MODE_OP"}, {Name: "PROG_NAME"}})
+	ctx := context.Background()
+
+	ids := []opcua.NodeID{
+		opcua.RobotNodeID("cell1", "$POS_ACT", "X"),
+		opcua.RobotNodeID("cell1", "$OV_PRO"),
+		opcua.RobotNodeID("cell1", "$IN[1]"),
+		opcua.RobotNodeID("cell1", "$MODE_OP"),
+		opcua.RobotNodeID("cell1", "PROG_NAME"),
+		opcua.RobotNodeID("cell1", "$POS_ACT"),
+	}
+	values, err := client.Read(ctx, ids...)
+	require.NoError(t, err)
+	require.Len(t, values, len(ids))
+	assert.Equal(t, float32(425), values[0].Value.Value)
+	assert.Equal(t, int32(100), values[1].Value.Value)
+	assert.Equal(t, true, values[2].Value.Value)
+	assert.Equal(t, "#T1", values[3].Value.Value)
+	assert.Equal(t, "main", values[4].Value.Value)
+	assert.Equal(t, "{E6POS: X 425.0, Y -1.5}", values[5].Value.Value)
+	assert.False(t, values[0].SourceTimestamp.IsZero())
+
+	dataType, err := client.ReadAttribute(ctx, ids[0], opcua.AttributeDataType)
+	require.NoError(t, err)
+	assert.Equal(t, opcua.DataTypeFloat, dataType.Value)
+
+	namespaces, err := client.ReadAttribute(ctx, opcua.NewNumericNodeID(0, 2255), opcua.AttributeValue)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"http://opcfoundation.org/UA/", opcua.NamespaceURI}, namespaces.Value)
+
+	// Unknown nodes fail individually.
+	values, err = client.Read(ctx, opcua.RobotNodeID("cell1", "$OV_PRO"), opcua.NewStringNodeID(1, "unknown"))
+	require.NoError(t, err)
+	assert.Equal(t, opcua.Good, values[0].Status)
+	assert.Equal(t, opcua.BadNodeIDUnknown, values[1].Status)
+}
+
+// Tests that only writable variables can be written and read-only system
+// variables never are.
+func TestOPCUAWrite(t *testing.T) {
+	proxy := newFakeProxy(map[string]string{"$POS_ACT": "{E6POS: X 425.0, Y -1.5}", "$OV_PRO": "100", "BASE_DATA": "{FRAME: X 0.0, Y 0.0}", "COUNT": "1"})
+	client := startOPCUA(t, proxy, []opcua.Variable{
+		{Name: "$POS_ACT", Writable: true},
+		{Name: "$OV_PRO", Writable: true},
+		{Name: "BASE_DATA", Writable: true},
+		{Name: "COUNT"},
+	})
+	ctx := context.Background()
+
+	require.NoError(t, client.Write(ctx, opcua.RobotNodeID("cell1", "$OV_PRO"), int32(50)))
+	assert.Equal(t, "50", proxy.get("$OV_PRO"))
+
+	// Writing a member writes a partial aggregate.
+	require.NoError(t, client.Write(ctx, opcua.RobotNodeID("cell1", "BASE_DATA", "Y"), float32(2.5)))
+	assert.Equal(t, "{Y 2.5}", proxy.get("BASE_DATA"))
+
+	assert.ErrorIs(t, client.Write(ctx, opcua.RobotNodeID("cell1", "$OV_PRO"), "fast"), opcua.BadTypeMismatch)
+	assert.ErrorIs(t, client.Write(ctx, opcua.RobotNodeID("cell1", "$OV_PRO"), 1.5), opcua.BadOutOfRange)
+	assert.ErrorIs(t, client.Write(ctx, opcua.RobotNodeID("cell1", "COUNT"), int32(2)), opcua.BadNotWritable)
+	assert.ErrorIs(t, client.Write(ctx, opcua.RobotNodeID("cell1", "$POS_ACT", "X"), float32(0)), opcua.BadNotWritable)
+	assert.Equal(t, "1", proxy.get("COUNT"))
+
+	access, err := client.ReadAttribute(ctx, opcua.RobotNodeID("cell1", "$OV_PRO"), opcua.AttributeAccessLevel)
+	require.NoError(t, err)
+	assert.Equal(t, opcua.AccessLevelRead|opcua.AccessLevelWrite, access.Value)
+	access, err = client.ReadAttribute(ctx, opcua.RobotNodeID("cell1", "$POS_ACT"), opcua.AttributeAccessLevel)
+	require.NoError(t, err)
+	assert.Equal(t, opcua.AccessLevelRead, access.Value)
+}
+
+// Tests that subscriptions deliver the current values and then changes.
+func TestOPCUASubscribe(t *testing.T) {
+	proxy := newFakeProxy(map[string]string{"$POS_ACT": "{E6POS: X 425.0, Y -1.5}", "$OV_PRO": "100"})
+	client := startOPCUA(t, proxy, []opcua.Variable{{Name: "$POS_ACT"}, {Name: "$OV_PRO"}})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	x := opcua.RobotNodeID("cell1", "$POS_ACT", "X")
+	ov := opcua.RobotNodeID("cell1", "$OV_PRO")
+	sub, err := client.Subscribe(ctx, 20*time.Millisecond, x, ov)
+	require.NoError(t, err)
+
+	next := func() opcua.DataChange {
+		select {
+		case change := <-sub.Changes():
+			return change
+		case <-ctx.Done():
+			t.Fatal("no change")
+			return opcua.DataChange{}
+		}
+	}
+	initial := map[opcua.NodeID]any{}
+	for len(initial) < 2 {
+		change := next()
+		initial[change.NodeID] = change.Value.Value.Value
+	}
+	assert.Equal(t, map[opcua.NodeID]any{x: float32(425), ov: int32(100)}, initial)
+
+	// A change of another member does not notify X.
+	proxy.set("$POS_ACT", "{E6POS: X 425.0, Y 3.0}")
+	proxy.set("$OV_PRO", "75")
+	change := next()
+	assert.Equal(t, ov, change.NodeID)
+	assert.Equal(t, int32(75), change.Value.Value.Value)
+
+	proxy.set("$POS_ACT", "{E6POS: X 430.0, Y 3.0}")
+	change = next()
+	assert.Equal(t, x, change.NodeID)
+	assert.Equal(t, float32(430), change.Value.Value.Value)
+
+	require.NoError(t, sub.Close(ctx))
+	_, ok := <-sub.Changes()
+	assert.False(t, ok)
+}
+
+// capturedMessage is a message of testdata/opcua/gopcua.txt.
+type capturedMessage struct {
+	fromClient bool
+	data       []byte
+}
+
+// Loads the messages captured between a gopcua client and the server.
+func loadCapture(t *testing.T) []capturedMessage {
+	file, err := os.ReadFile(filepath.Join("testdata", "opcua", "gopcua.txt"))
+	require.NoError(t, err)
+	var msgs []capturedMessage
+	for _, line := range strings.Split(string(file), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		data, err := hex.DecodeString(fields[2])
+		require.NoError(t, err)
+		require.Equal(t, fields[1], string(data[:3]))
+		msgs = append(msgs, capturedMessage{fromClient: fields[0] == "c2s", data: data})
+	}
+	return msgs
+}
+
+// Reads one message from a connection.
+func readOPCUAMessage(t *testing.T, conn net.Conn) []byte {
+	header := make([]byte, 8)
+	_, err := io.ReadFull(conn, header)
+	require.NoError(t, err)
+	msg := make([]byte, binary.LittleEndian.Uint32(header[4:]))
+	copy(msg, header)
+	_, err = io.ReadFull(conn, msg[8:])
+	require.NoError(t, err)
+	return msg
+}
+
+// Returns the offset of the service body of an OPN or MSG message, after the
+// security and sequence headers.
+func opcuaBody(msg []byte) int {
+	if string(msg[:3]) == "OPN" {
+		uri := int(binary.LittleEndian.Uint32(msg[12:]))
+		// Policy URI, sender certificate, receiver thumbprint, sequence
+		// number and request ID.
+		return 16 + uri + 4 + 4 + 8
+	}
+	return 24
+}
+
+// Returns the opaque authentication token in a CreateSession response.
+func sessionToken(t *testing.T, msg []byte) []byte {
+	prefix := []byte{0x05, 0x00, 0x00, 0x10, 0x00, 0x00, 0x00}
+	i := bytes.Index(msg, prefix)
+	require.GreaterOrEqual(t, i, 0, "no authentication token")
+	return msg[i : i+len(prefix)+16]
+}
+
+// Tests the server against messages captured from a third-party client,
+// github.com/gopcua/opcua v0.5.3, rather than the package's own client. The
+// captured requests are replayed with the channel, token and authentication
+// token issued by the new server, and every response must be of the type
+// the client received and succeed.
+func TestOPCUACapturedClient(t *testing.T) {
+	proxy := newFakeProxy(map[string]string{"$POS_ACT": "{E6POS: X 425.0, Y -1.5}", "$OV_PRO": "100"})
+	addr := startOPCUAServer(t, proxy, []opcua.Variable{{Name: "$OV_PRO", Writable: true}, {Name: "$POS_ACT"}})
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	msgs := loadCapture(t)
+	require.NotEmpty(t, msgs)
+	var channel, oldToken, newToken []byte
+	for i := 0; i < len(msgs); i++ {
+		req := bytes.Clone(msgs[i].data)
+		require.True(t, msgs[i].fromClient)
+		typ := string(req[:3])
+		if typ == "MSG" || typ == "CLO" {
+			copy(req[8:16], channel)
+			if oldToken != nil {
+				req = bytes.ReplaceAll(req, oldToken, newToken)
+			}
+		}
+		_, err := conn.Write(req)
+		require.NoError(t, err)
+		if typ == "CLO" {
+			break
+		}
+
+		i++
+		want := msgs[i].data
+		resp := readOPCUAMessage(t, conn)
+		require.Equal(t, string(want[:4]), string(resp[:4]), "response to message %d", i)
+		if typ == "HEL" {
+			assert.Equal(t, want[8:], resp[8:])
+			continue
+		}
+
+		// The type of the response and its service result.
+		body, wantBody := opcuaBody(resp), opcuaBody(want)
+		assert.Equal(t, want[wantBody:wantBody+4], resp[body:body+4], "response type to message %d", i)
+		result := binary.LittleEndian.Uint32(resp[body+4+8+4:])
+		assert.Zero(t, result, "service result of message %d", i)
+
+		switch {
+		case typ == "OPN":
+			// Channel ID and token ID of the security token, after the
+			// response header and the protocol version.
+			channel = resp[body+32 : body+40]
+		case oldToken == nil:
+			oldToken, newToken = sessionToken(t, want), sessionToken(t, resp)
+			assert.NotEqual(t, oldToken, newToken)
+		}
+		if strings.Contains(string(req), "cell1/$POS_ACT.X") {
+			// Int32 100 and Float 425.
+			assert.True(t, bytes.Contains(resp, []byte{0x06, 0x64, 0x00, 0x00, 0x00}))
+			assert.True(t, bytes.Contains(resp, []byte{0x0a, 0x00, 0x80, 0xd4, 0x43}))
+		}
+	}
+
+	// CLO closes the connection without a response.
+	_, err = conn.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+// Tests that arrays longer than the decoder allows are rejected before they
+// are allocated, even if the message holds enough bytes for them.
+func TestOPCUAArrayLength(t *testing.T) {
+	proxy := newFakeProxy(map[string]string{"$OV_PRO": "100"})
+	addr := startOPCUAServer(t, proxy, []opcua.Variable{{Name: "$OV_PRO"}})
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	// HEL and OPN from the captured session.
+	msgs := loadCapture(t)
+	var channel []byte
+	for i := 0; i < 4; i += 2 {
+		_, err := conn.Write(msgs[i].data)
+		require.NoError(t, err)
+		resp := readOPCUAMessage(t, conn)
+		if string(resp[:3]) == "OPN" {
+			body := opcuaBody(resp)
+			channel = resp[body+32 : body+40]
+		}
+	}
+
+	// The captured Read with 100000 nodes to read. Zero bytes decode as
+	// empty ReadValueIDs of 16 bytes.
+	var read []byte
+	for _, msg := range msgs {
+		if msg.fromClient && bytes.Contains(msg.data, []byte("cell1/$POS_ACT.X")) {
+			read = msg.data
+		}
+	}
+	require.NotNil(t, read)
+	nodes := bytes.Index(read, append([]byte{0x03, 0x01, 0x00, 0x0d, 0x00, 0x00, 0x00}, "cell1/$OV_PRO"...))
+	require.Positive(t, nodes)
+	body := append(bytes.Clone(read[24:nodes-4]), binary.LittleEndian.AppendUint32(nil, 100000)...)
+	body = append(body, make([]byte, 100000*16)...)
+
+	// Send it in chunks that fit the receive buffer.
+	for len(body) > 0 {
+		n := min(len(body), 60000)
+		chunk := []byte("MSGC")
+		if n == len(body) {
+			chunk[3] = 'F'
+		}
+		chunk = binary.LittleEndian.AppendUint32(chunk, uint32(24+n))
+		chunk = append(chunk, channel...)
+		chunk = append(chunk, read[16:24]...)
+		chunk = append(chunk, body[:n]...)
+		body = body[n:]
+		_, err := conn.Write(chunk)
+		require.NoError(t, err)
+	}
+
+	resp := readOPCUAMessage(t, conn)
+	require.Equal(t, "ERRF", string(resp[:4]))
+	assert.Equal(t, uint32(opcua.BadDecodingError), binary.LittleEndian.Uint32(resp[8:]))
+}
@@ -0,0 +1,109 @@
+package test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/selimserbes/go-openshowvar/pkg/openshowvar"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Tests that groups are polled at their own rates.
+func TestPoller(t *testing.T) {
+	proxy := newFakeProxy(map[string]string{"$POS_ACT": "{X 1.0}", "$OV_PRO": "100", "RECIPE": "7"})
+	osv := connectFake(t, proxy)
+
+	var mu sync.Mutex
+	var fast []openshowvar.Snapshot
+	slow := make(chan openshowvar.Snapshot, 100)
+	poller := openshowvar.NewPoller(osv,
+		openshowvar.Group{
+			Name:     "fast",
+			Vars:     []string{"$POS_ACT"},
+			Interval: 10 * time.Millisecond,
+			Handler: func(s openshowvar.Snapshot) {
+				mu.Lock()
+				fast = append(fast, s)
+				mu.Unlock()
+			},
+		},
+		openshowvar.Group{
+			Name:     "slow",
+			Vars:     []string{"$OV_PRO", "RECIPE"},
+			Interval: 50 * time.Millisecond,
+			C:        slow,
+		},
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 240*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, poller.Run(ctx), context.DeadlineExceeded)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.InDelta(t, 24, len(fast), 6)
+	assert.InDelta(t, 5, len(slow), 1)
+
+	// Snapshot contents and timestamps.
+	first := fast[0]
+	assert.Equal(t, "fast", first.Group)
+	require.Len(t, first.Values, 1)
+	assert.Equal(t, "{X 1.0}", first.Values[0].Value)
+	assert.NoError(t, first.Values[0].Err)
+	assert.False(t, first.Start.Before(first.Scheduled))
+	assert.False(t, first.End.Before(first.Start))
+	assert.Equal(t, first.Start.Sub(first.Scheduled), first.Jitter)
+	for i := 1; i < len(fast); i++ {
+		assert.Equal(t, 10*time.Millisecond*time.Duration(1+fast[i-1].Missed), fast[i].Scheduled.Sub(fast[i-1].Scheduled))
+	}
+
+	s := <-slow
+	require.Len(t, s.Values, 2)
+	assert.Equal(t, "100", s.Values[0].Value)
+	assert.Equal(t, "7", s.Values[1].Value)
+
+	stats := poller.Stats()
+	assert.Equal(t, "fast", stats[0].Group)
+	assert.Equal(t, uint64(len(fast)), stats[0].Cycles)
+	assert.Equal(t, "slow", stats[1].Group)
+}
+
+// Tests that reads slower than the interval are reported as overruns.
+func TestPollerOverrun(t *testing.T) {
+	slowReads := func(ctx context.Context, req openshowvar.Request, next openshowvar.Handler) (openshowvar.Response, error) {
+		time.Sleep(25 * time.Millisecond)
+		return next(ctx, req)
+	}
+	proxy := newFakeProxy(map[string]string{"$OV_PRO": "100"})
+	osv := connectFake(t, proxy, openshowvar.WithInterceptors(slowReads))
+
+	snapshots := make(chan openshowvar.Snapshot, 100)
+	poller := openshowvar.NewPoller(osv, openshowvar.Group{
+		Name:     "fast",
+		Vars:     []string{"$OV_PRO"},
+		Interval: 10 * time.Millisecond,
+		C:        snapshots,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Millisecond)
+	defer cancel()
+	poller.Run(ctx)
+
+	s := <-snapshots
+	assert.True(t, s.Overrun)
+	assert.GreaterOrEqual(t, s.Missed, 2)
+
+	stats := poller.Stats()[0]
+	assert.Positive(t, stats.Overruns)
+	assert.Positive(t, stats.Missed)
+	assert.Positive(t, stats.MaxJitter)
+}
+
+// Tests that a group without an interval is rejected.
+func TestPollerInvalidInterval(t *testing.T) {
+	poller := openshowvar.NewPoller(openshowvar.NewOpenShowVar("", 0), openshowvar.Group{Name: "broken", Vars: []string{"$OV_PRO"}})
+	assert.Error(t, poller.Run(context.Background()))
+}
@@ -0,0 +1,274 @@
+package test
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/selimserbes/go-openshowvar/pkg/openshowvar"
+	"github.com/selimserbes/go-openshowvar/pkg/recorder"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Reads all rows of a CSV file.
+func readCSV(t *testing.T, path string) [][]string {
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+	rows, err := csv.NewReader(file).ReadAll()
+	require.NoError(t, err)
+	return rows
+}
+
+// Tests recording to CSV with STRUC values flattened into columns.
+func TestRecorderCSV(t *testing.T) {
+	proxy := newFakeProxy(map[string]string{
+		"$POS_ACT": "{E6POS: X 425.0, Y -1.5, Z 650.0}",
+		"$OV_PRO":  "100",
+		"$MODE_OP": "#T1",
+	})
+	osv := connectFake(t, proxy)
+
+	path := filepath.Join(t.TempDir(), "run.csv")
+	rec := recorder.New(osv, recorder.Config{
+		Vars:     []string{"$POS_ACT", "$OV_PRO", "$MODE_OP"},
+		Interval: 10 * time.Millisecond,
+		Path:     path,
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 55*time.Millisecond)
+	defer cancel()
+	require.NoError(t, rec.Run(ctx))
+
+	rows := readCSV(t, path)
+	require.GreaterOrEqual(t, len(rows), 4)
+	assert.Equal(t, []string{"time", "elapsed", "$POS_ACT.X", "$POS_ACT.Y", "$POS_ACT.Z", "$OV_PRO", "$MODE_OP"}, rows[0])
+	assert.Equal(t, []string{"425.0", "-1.5", "650.0", "100", "#T1"}, rows[1][2:])
+
+	// Wall clock and monotonic timestamps.
+	first, err := time.Parse(time.RFC3339Nano, rows[1][0])
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), first, time.Second)
+	assert.Equal(t, "0.000", rows[1][1][:5])
+	assert.NotEqual(t, rows[1][1], rows[2][1])
+}
+
+// Tests that the CSV columns of a STRUC variable whose first read failed are
+// taken from its first successful read.
+func TestRecorderCSVFailedFirstRead(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "run.csv")
+	rec := recorder.New(nil, recorder.Config{Path: path})
+	start := time.Now()
+	failed := errors.New("connection error")
+
+	require.NoError(t, rec.Write(recorder.Record{Time: start, Values: []openshowvar.Sample{
+		{VarName: "$POS_ACT", Err: failed},
+		{VarName: "$OV_PRO", Value: "100"},
+	}}))
+	require.NoError(t, rec.Write(recorder.Record{Time: start.Add(time.Second), Elapsed: time.Second, Values: []openshowvar.Sample{
+		{VarName: "$POS_ACT", Value: "{E6POS: X 425.0, Y -1.5}"},
+		{VarName: "$OV_PRO", Value: "90"},
+	}}))
+	require.NoError(t, rec.Close())
+
+	rows := readCSV(t, path)
+	require.Len(t, rows, 3)
+	assert.Equal(t, []string{"time", "elapsed", "$POS_ACT.X", "$POS_ACT.Y", "$OV_PRO"}, rows[0])
+	assert.Equal(t, []string{"", "", "100"}, rows[1][2:])
+	assert.Equal(t, []string{"425.0", "-1.5", "90"}, rows[2][2:])
+}
+
+// Tests that values with columns missing from the CSV header are an error.
+func TestRecorderCSVNewColumns(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "run.csv")
+	rec := recorder.New(nil, recorder.Config{Path: path})
+	defer rec.Close()
+
+	// The header is written once the variable was read.
+	require.NoError(t, rec.Write(recorder.Record{Time: time.Now(), Values: []openshowvar.Sample{{VarName: "BASE", Value: "{FRAME: X 1.0}"}}}))
+	err := rec.Write(recorder.Record{Time: time.Now(), Values: []openshowvar.Sample{{VarName: "BASE", Value: "{FRAME: X 1.0, Y 2.0}"}}})
+	assert.EqualError(t, err, "recorder: column BASE.Y of BASE is not in the CSV header")
+}
+
+// Tests recording to JSON Lines with typed values and errors.
+func TestRecorderJSONLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "run.jsonl")
+	rec := recorder.New(nil, recorder.Config{Format: recorder.JSONLines, Path: path})
+	now := time.Now()
+	require.NoError(t, rec.Write(recorder.Record{
+		Time:    now,
+		Elapsed: 1500 * time.Millisecond,
+		Values: []openshowvar.Sample{
+			{VarName: "$POS_ACT", Value: "{E6POS: X 425.0, Y -1.5}"},
+			{VarName: "$OV_PRO", Value: "100"},
+			{VarName: "PART_READY", Value: "TRUE"},
+			{VarName: "RAW", Value: "not krl"},
+			{VarName: "MISSING", Err: errors.New("variable not found in response")},
+		},
+	}))
+	require.NoError(t, rec.Close())
+
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	require.True(t, scanner.Scan())
+
+	var line map[string]any
+	require.NoError(t, json.Unmarshal(scanner.Bytes(), &line))
+	assert.Equal(t, 1.5, line["elapsed"])
+	values := line["values"].(map[string]any)
+	assert.Equal(t, map[string]any{"X": 425.0, "Y": -1.5}, values["$POS_ACT"])
+	assert.Equal(t, 100.0, values["$OV_PRO"])
+	assert.Equal(t, true, values["PART_READY"])
+	assert.Equal(t, "not krl", values["RAW"])
+	assert.Equal(t, map[string]any{"MISSING": "variable not found in response"}, line["errors"])
+	assert.False(t, scanner.Scan())
+}
+
+// Tests rotation by size and by age.
+func TestRecorderRotation(t *testing.T) {
+	dir := t.TempDir()
+	sample := []openshowvar.Sample{{VarName: "$OV_PRO", Value: "100"}}
+	start := time.Date(2024, 7, 23, 10, 15, 0, 0, time.UTC)
+
+	// Rotate by size: every file holds the header and one row.
+	rec := recorder.New(nil, recorder.Config{Path: filepath.Join(dir, "size.csv"), MaxBytes: 1})
+	for i := 0; i < 3; i++ {
+		require.NoError(t, rec.Write(recorder.Record{Time: start, Values: sample}))
+	}
+	require.NoError(t, rec.Close())
+	files := rec.Files()
+	require.Len(t, files, 3)
+	assert.Equal(t, filepath.Join(dir, "size-20240723-101500.000.csv"), files[0])
+	for _, file := range files {
+		rows := readCSV(t, file)
+		assert.Equal(t, []string{"time", "elapsed", "$OV_PRO"}, rows[0])
+		assert.Len(t, rows, 2)
+	}
+
+	// Rotate by age.
+	rec = recorder.New(nil, recorder.Config{Path: filepath.Join(dir, "age.csv"), MaxAge: time.Minute})
+	for i := 0; i < 4; i++ {
+		at := start.Add(time.Duration(i) * 40 * time.Second)
+		require.NoError(t, rec.Write(recorder.Record{Time: at, Values: sample}))
+	}
+	require.NoError(t, rec.Close())
+	assert.Len(t, rec.Files(), 2)
+}
+
+// Reads a Parquet file and returns the types of its columns and its rows.
+func readParquet(t *testing.T, path string) (map[string]string, []map[string]any) {
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+	info, err := file.Stat()
+	require.NoError(t, err)
+	pf, err := parquet.OpenFile(file, info.Size())
+	require.NoError(t, err)
+
+	schema := pf.Schema()
+	types := make(map[string]string)
+	for _, path := range schema.Columns() {
+		leaf, ok := schema.Lookup(path...)
+		require.True(t, ok)
+		types[strings.Join(path, ".")] = leaf.Node.Type().String()
+	}
+
+	reader := parquet.NewReader(pf)
+	var rows []map[string]any
+	for {
+		row := map[string]any{}
+		if err := reader.Read(&row); err != nil {
+			require.ErrorIs(t, err, io.EOF)
+			break
+		}
+		rows = append(rows, row)
+	}
+	assert.EqualValues(t, len(rows), pf.NumRows())
+	return types, rows
+}
+
+// Tests recording to Parquet with a schema inferred from KRL types.
+func TestRecorderParquet(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "run.parquet")
+	rec := recorder.New(nil, recorder.Config{Format: recorder.Parquet, Path: path})
+	start := time.Date(2024, 7, 23, 10, 15, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		values := []openshowvar.Sample{
+			{VarName: "$POS_ACT", Value: fmt.Sprintf("{E6POS: X %d.5, Y -1.5, S 2}", i)},
+			{VarName: "$OV_PRO", Value: "100"},
+			{VarName: "PART_READY", Value: "TRUE"},
+			{VarName: "$MODE_OP", Value: "#T1"},
+			{VarName: "NAME", Value: `"gripper"`},
+			{VarName: "RAW", Value: "not krl"},
+		}
+		if i == 1 {
+			values[1] = openshowvar.Sample{VarName: "$OV_PRO", Err: errors.New("variable not found in response")}
+		}
+		at := start.Add(time.Duration(i) * 50 * time.Millisecond)
+		require.NoError(t, rec.Write(recorder.Record{Time: at, Elapsed: at.Sub(start), Values: values}))
+	}
+	require.NoError(t, rec.Close())
+
+	types, rows := readParquet(t, path)
+
+	// Column types follow the KRL types of the first successful reads.
+	assert.Equal(t, "INT(32,true)", types["$OV_PRO"])
+	assert.Equal(t, "FLOAT", types["$POS_ACT.X"])
+	assert.Equal(t, "INT(32,true)", types["$POS_ACT.S"])
+	assert.Equal(t, "BOOLEAN", types["PART_READY"])
+	assert.Equal(t, "ENUM", types["$MODE_OP"])
+	assert.Equal(t, "STRING", types["NAME"])
+	assert.Equal(t, "STRING", types["RAW"])
+	assert.Contains(t, types["time"], "TIMESTAMP")
+
+	require.Len(t, rows, 3)
+	assert.Equal(t, map[string]any{"X": float32(2.5), "Y": float32(-1.5), "S": int32(2)}, rows[2]["$POS_ACT"])
+	assert.Equal(t, int32(100), rows[0]["$OV_PRO"])
+	assert.Nil(t, rows[1]["$OV_PRO"])
+	assert.Equal(t, true, rows[0]["PART_READY"])
+	assert.Equal(t, "not krl", rows[0]["RAW"])
+	assert.Equal(t, 0.1, rows[2]["elapsed"])
+}
+
+// Tests that Parquet columns are typed by the first successful read when
+// the first read of a variable failed.
+func TestRecorderParquetFailedFirstRead(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "run.parquet")
+	rec := recorder.New(nil, recorder.Config{Format: recorder.Parquet, Path: path})
+	start := time.Date(2024, 7, 23, 10, 15, 0, 0, time.UTC)
+	failed := errors.New("connection reset")
+	records := [][]openshowvar.Sample{
+		{{VarName: "$POS_ACT", Err: failed}, {VarName: "SPEED", Err: failed}, {VarName: "$OV_PRO", Value: "100"}},
+		{{VarName: "$POS_ACT", Value: "{E6POS: X 1.5, Y -1.5}"}, {VarName: "SPEED", Err: failed}, {VarName: "$OV_PRO", Value: "90"}},
+		{{VarName: "$POS_ACT", Value: "{E6POS: X 2.5, Y -1.5}"}, {VarName: "SPEED", Value: "0.25"}, {VarName: "$OV_PRO", Value: "80"}},
+	}
+	for i, values := range records {
+		at := start.Add(time.Duration(i) * 50 * time.Millisecond)
+		require.NoError(t, rec.Write(recorder.Record{Time: at, Elapsed: at.Sub(start), Values: values}))
+	}
+	require.NoError(t, rec.Close())
+
+	types, rows := readParquet(t, path)
+	assert.Equal(t, "FLOAT", types["$POS_ACT.X"])
+	assert.Equal(t, "FLOAT", types["SPEED"])
+	assert.Equal(t, "INT(32,true)", types["$OV_PRO"])
+
+	require.Len(t, rows, 3)
+	assert.Nil(t, rows[0]["$POS_ACT"])
+	assert.Nil(t, rows[1]["SPEED"])
+	assert.Equal(t, map[string]any{"X": float32(1.5), "Y": float32(-1.5)}, rows[1]["$POS_ACT"])
+	assert.Equal(t, float32(0.25), rows[2]["SPEED"])
+	assert.Equal(t, int32(100), rows[0]["$OV_PRO"])
+}
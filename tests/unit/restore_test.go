@@ -0,0 +1,125 @@
+package test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/selimserbes/go-openshowvar/pkg/snapshot"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Returns a snapshot of a recipe together with system variables.
+func recipeSnapshot() *snapshot.Snapshot {
+	return &snapshot.Snapshot{Vars: []snapshot.Var{
+		{Name: "RECIPE_VALID", Value: "TRUE"},
+		{Name: "$POS_ACT", Value: "{E6POS: X 1.0}"},
+		{Name: "SPEED", Value: "50"},
+		{Name: "$IN[1]", Value: "TRUE"},
+		{Name: "RECIPE_ID", Value: "7"},
+		{Name: "TEMP_OFFSET", Value: "1.5"},
+		{Name: "FAILED", Err: "variable not found in response"},
+	}}
+}
+
+// Tests restoring a snapshot with safety filtering and ordering.
+func TestRestore(t *testing.T) {
+	proxy := newFakeProxy(map[string]string{
+		"RECIPE_VALID": "FALSE",
+		"$POS_ACT":     "{E6POS: X 425.0}",
+		"SPEED":        "100",
+		"$IN[1]":       "FALSE",
+		"RECIPE_ID":    "3",
+		"TEMP_OFFSET":  "0.0",
+	})
+	osv := connectFake(t, proxy)
+
+	report, err := snapshot.Restore(context.Background(), osv, recipeSnapshot(), snapshot.RestoreOptions{
+		Exclude: []string{"TEMP_*"},
+		First:   []string{"RECIPE_ID"},
+		Last:    []string{"RECIPE_VALID"},
+	})
+	require.NoError(t, err)
+
+	var lines []string
+	for _, res := range report.Results {
+		lines = append(lines, res.String())
+	}
+	assert.Equal(t, []string{
+		"written RECIPE_ID = 7",
+		"skipped $POS_ACT = {E6POS: X 1.0} (read-only)",
+		"written SPEED = 50",
+		"skipped $IN[1] = TRUE (read-only)",
+		"skipped TEMP_OFFSET = 1.5 (excluded)",
+		"skipped FAILED (not in snapshot: variable not found in response)",
+		"written RECIPE_VALID = TRUE",
+	}, lines)
+	assert.Equal(t, 3, report.Count(snapshot.Written))
+
+	assert.Equal(t, "7", proxy.get("RECIPE_ID"))
+	assert.Equal(t, "TRUE", proxy.get("RECIPE_VALID"))
+	assert.Equal(t, "{E6POS: X 425.0}", proxy.get("$POS_ACT"))
+	assert.Equal(t, "FALSE", proxy.get("$IN[1]"))
+	assert.Equal(t, "0.0", proxy.get("TEMP_OFFSET"))
+}
+
+// Tests a dry run with include patterns and unchanged values.
+func TestRestoreDryRun(t *testing.T) {
+	proxy := newFakeProxy(map[string]string{"RECIPE_VALID": "FALSE", "RECIPE_ID": "7.0", "SPEED": "100"})
+	osv := connectFake(t, proxy)
+
+	report, err := snapshot.Restore(context.Background(), osv, recipeSnapshot(), snapshot.RestoreOptions{
+		DryRun:        true,
+		Include:       []string{"recipe_*"},
+		SkipUnchanged: true,
+	})
+	require.NoError(t, err)
+
+	actions := make(map[string]snapshot.Action)
+	for _, res := range report.Results {
+		actions[res.Name] = res.Action
+	}
+	assert.Equal(t, snapshot.Planned, actions["RECIPE_VALID"])
+	assert.Equal(t, snapshot.Skipped, actions["RECIPE_ID"])
+	assert.Equal(t, snapshot.Skipped, actions["SPEED"])
+	assert.Equal(t, 0, report.Count(snapshot.Written))
+	assert.Equal(t, "FALSE", proxy.get("RECIPE_VALID"))
+}
+
+// Tests that failed writes are reported and the restore continues.
+func TestRestoreFailedWrite(t *testing.T) {
+	proxy := newFakeProxy(map[string]string{"SPEED": "100"})
+	osv := connectFake(t, proxy)
+
+	report, err := snapshot.Restore(context.Background(), osv, recipeSnapshot(), snapshot.RestoreOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 1, report.Count(snapshot.Written))
+	assert.Equal(t, 3, report.Count(snapshot.Failed))
+	assert.Equal(t, "50", proxy.get("SPEED"))
+}
+
+// Tests include and exclude patterns naming array elements.
+func TestRestoreArrayElements(t *testing.T) {
+	s := &snapshot.Snapshot{Vars: []snapshot.Var{
+		{Name: "$TOOL_DATA[2]", Value: "{FRAME: X 2.0}"},
+		{Name: "$TOOL_DATA[3]", Value: "{FRAME: X 3.0}"},
+		{Name: "RECIPE[1]", Value: "10"},
+		{Name: "RECIPE[2]", Value: "20"},
+	}}
+	skipped := func(opts snapshot.RestoreOptions) []string {
+		opts.DryRun = true
+		report, err := snapshot.Restore(context.Background(), nil, s, opts)
+		require.NoError(t, err)
+		var names []string
+		for _, res := range report.Results {
+			if res.Action == snapshot.Skipped {
+				names = append(names, res.Name)
+			}
+		}
+		return names
+	}
+
+	assert.Equal(t, []string{"$TOOL_DATA[2]", "RECIPE[1]"}, skipped(snapshot.RestoreOptions{Include: []string{"$TOOL_DATA[3]", "RECIPE[2]"}}))
+	assert.Equal(t, []string{"$TOOL_DATA[3]", "RECIPE[2]"}, skipped(snapshot.RestoreOptions{Exclude: []string{"$TOOL_DATA[3]", "RECIPE[2]"}}))
+	assert.Equal(t, []string{"RECIPE[1]", "RECIPE[2]"}, skipped(snapshot.RestoreOptions{Exclude: []string{"RECIPE[*]"}}))
+}
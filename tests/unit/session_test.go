@@ -0,0 +1,175 @@
+package test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/selimserbes/go-openshowvar/pkg/openshowvar"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Records a session against the fake proxy and returns it.
+func recordSession(t *testing.T) []openshowvar.SessionEntry {
+	proxy := newFakeProxy(map[string]string{"$OV_PRO": "100", "PART_READY": "FALSE"})
+	var buf bytes.Buffer
+	rec := openshowvar.NewSessionRecorder(&buf)
+	osv := connectFake(t, proxy, openshowvar.WithSessionRecorder(rec))
+
+	_, err := osv.Read("$OV_PRO")
+	require.NoError(t, err)
+	_, err = osv.Write("PART_READY", "TRUE")
+	require.NoError(t, err)
+	_, err = osv.Read("MISSING")
+	require.Error(t, err)
+	_, err = osv.Read("PART_READY")
+	require.NoError(t, err)
+	require.NoError(t, rec.Err())
+
+	entries, err := openshowvar.ReadSession(&buf)
+	require.NoError(t, err)
+	return entries
+}
+
+// Tests that every frame sent through Send is recorded.
+func TestSessionRecorder(t *testing.T) {
+	start := time.Now()
+	entries := recordSession(t)
+	require.Len(t, entries, 4)
+
+	request, err := openshowvar.EncodeRequest(2, "PART_READY", "TRUE")
+	require.NoError(t, err)
+	assert.Equal(t, request, entries[1].Request)
+	value, err := openshowvar.DecodeResponse(entries[1].Response)
+	require.NoError(t, err)
+	assert.Equal(t, "TRUE", value)
+
+	// Failed exchanges keep the response frame and the error.
+	assert.NotNil(t, entries[2].Response)
+	assert.Equal(t, "variable not found in response", entries[2].Err)
+
+	for _, entry := range entries {
+		assert.WithinDuration(t, start, entry.Time, time.Second)
+		assert.Greater(t, entry.Latency, time.Duration(0))
+	}
+}
+
+// Tests that a replayed session gives the client the recorded results.
+func TestReplayServer(t *testing.T) {
+	server := openshowvar.NewReplayServer(recordSession(t))
+	osv := openshowvar.NewOpenShowVar("", 0, openshowvar.WithDialer(openshowvar.PipeDialer{Serve: server.Serve}))
+	require.NoError(t, osv.Connect())
+	defer osv.Disconnect()
+
+	value, err := osv.Read("$OV_PRO")
+	require.NoError(t, err)
+	assert.Equal(t, "100", value)
+	value, err = osv.Write("PART_READY", "TRUE")
+	require.NoError(t, err)
+	assert.Equal(t, "TRUE", value)
+	_, err = osv.Read("MISSING")
+	assert.EqualError(t, err, "variable not found in response")
+	value, err = osv.Read("PART_READY")
+	require.NoError(t, err)
+	assert.Equal(t, "TRUE", value)
+
+	assert.Equal(t, 0, server.Remaining())
+	assert.NoError(t, server.Err())
+
+	// Requests past the end of the session are reported.
+	_, err = osv.Read("$OV_PRO")
+	assert.Error(t, err)
+	assert.ErrorContains(t, server.Err(), "after the end of the session")
+}
+
+// Tests that diverging requests stop the replay.
+func TestReplayServerMismatch(t *testing.T) {
+	server := openshowvar.NewReplayServer(recordSession(t))
+	osv := openshowvar.NewOpenShowVar("", 0, openshowvar.WithDialer(openshowvar.PipeDialer{Serve: server.Serve}))
+	require.NoError(t, osv.Connect())
+	defer osv.Disconnect()
+
+	_, err := osv.Read("PART_READY")
+	assert.Error(t, err)
+	assert.EqualError(t, server.Err(), "replay: request 1 is read PART_READY, recorded read $OV_PRO")
+	assert.Equal(t, 4, server.Remaining())
+}
+
+// Tests replay with recorded latencies over a TCP listener, across reconnects.
+func TestReplayServerTiming(t *testing.T) {
+	entries := []openshowvar.SessionEntry{}
+	for i, latency := range []time.Duration{50 * time.Millisecond, 0} {
+		request, err := openshowvar.EncodeRequest(uint16(i+1), "$OV_PRO", "")
+		require.NoError(t, err)
+		response, err := openshowvar.EncodeResponse(uint16(i+1), openshowvar.ModeRead, "100", true)
+		require.NoError(t, err)
+		entries = append(entries, openshowvar.SessionEntry{Latency: latency, Request: request, Response: response})
+	}
+	// The first exchange lost its connection.
+	entries[0].Response = nil
+
+	server := openshowvar.NewReplayServer(entries)
+	server.Timing = true
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go server.ServeListener(listener)
+
+	addr := listener.Addr().(*net.TCPAddr)
+	osv := openshowvar.NewOpenShowVar(addr.IP.String(), addr.Port)
+	require.NoError(t, osv.Connect())
+
+	start := time.Now()
+	_, err = osv.Read("$OV_PRO")
+	assert.Error(t, err)
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+
+	osv.Disconnect()
+	require.NoError(t, osv.Connect())
+	defer osv.Disconnect()
+	value, err := osv.Read("$OV_PRO")
+	require.NoError(t, err)
+	assert.Equal(t, "100", value)
+}
+
+// Tests that values of redacted variables are not recorded and that redacted
+// writes replay with any value.
+func TestSessionRecorderRedaction(t *testing.T) {
+	proxy := newFakeProxy(map[string]string{"PASSWORDS[1]": "\"old\"", "$OV_PRO": "100"})
+	var buf bytes.Buffer
+	rec := openshowvar.NewSessionRecorder(&buf)
+	osv := connectFake(t, proxy, openshowvar.WithSessionRecorder(rec), openshowvar.WithRedactedVars("PASSWORDS"))
+
+	_, err := osv.Write("PASSWORDS[1]", "\"hunter2\"")
+	require.NoError(t, err)
+	_, err = osv.Read("PASSWORDS[1]")
+	require.NoError(t, err)
+	_, err = osv.Read("$OV_PRO")
+	require.NoError(t, err)
+	require.NoError(t, rec.Err())
+
+	assert.NotContains(t, buf.String(), hex.EncodeToString([]byte("hunter2")))
+	entries, err := openshowvar.ReadSession(&buf)
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	value, err := openshowvar.DecodeResponse(entries[1].Response)
+	require.NoError(t, err)
+	assert.Equal(t, "[REDACTED]", value)
+	value, err = openshowvar.DecodeResponse(entries[2].Response)
+	require.NoError(t, err)
+	assert.Equal(t, "100", value)
+
+	server := openshowvar.NewReplayServer(entries)
+	replay := openshowvar.NewOpenShowVar("", 0, openshowvar.WithDialer(openshowvar.PipeDialer{Serve: server.Serve}))
+	require.NoError(t, replay.Connect())
+	defer replay.Disconnect()
+	_, err = replay.Write("PASSWORDS[1]", "\"other\"")
+	require.NoError(t, err)
+	value, err = replay.Read("PASSWORDS[1]")
+	require.NoError(t, err)
+	assert.Equal(t, "[REDACTED]", value)
+	assert.NoError(t, server.Err())
+}
@@ -0,0 +1,99 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/selimserbes/go-openshowvar/pkg/snapshot"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Tests expanding name patterns.
+func TestSnapshotExpand(t *testing.T) {
+	names, err := snapshot.Expand("$OV_PRO", "{BASE,TOOL}_DATA[1..2]", "ARR[1..2,3]")
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"$OV_PRO",
+		"BASE_DATA[1]", "BASE_DATA[2]", "TOOL_DATA[1]", "TOOL_DATA[2]",
+		"ARR[1,3]", "ARR[2,3]",
+	}, names)
+
+	_, err = snapshot.Expand("ARR[3..1]")
+	assert.Error(t, err)
+
+	// Alternatives are limited like ranges, before they grow exponentially.
+	_, err = snapshot.Expand(strings.Repeat("{A,B}", 40))
+	assert.ErrorContains(t, err, "expands to more than 100000 names")
+}
+
+// Tests reading a names file with comments.
+func TestSnapshotReadNames(t *testing.T) {
+	names, err := snapshot.ReadNames(strings.NewReader("; Tool frames\n$TOOL_DATA[1..2]\n\n$OV_PRO ; override\n"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"$TOOL_DATA[1]", "$TOOL_DATA[2]", "$OV_PRO"}, names)
+}
+
+// Tests taking, saving and loading a snapshot.
+func TestSnapshotTake(t *testing.T) {
+	proxy := newFakeProxy(map[string]string{"$OV_PRO": "100", "$TOOL_DATA[1]": "{FRAME: X 1.0, Y 2.0}"})
+	osv := connectFake(t, proxy)
+
+	s, err := snapshot.Take(context.Background(), osv, []string{"$OV_PRO", "$TOOL_DATA[1]", "MISSING"})
+	require.NoError(t, err)
+	assert.Equal(t, []snapshot.Var{
+		{Name: "$OV_PRO", Value: "100"},
+		{Name: "$TOOL_DATA[1]", Value: "{FRAME: X 1.0, Y 2.0}"},
+		{Name: "MISSING", Err: "variable not found in response"},
+	}, s.Vars)
+
+	var buf bytes.Buffer
+	require.NoError(t, s.Save(&buf))
+	loaded, err := snapshot.Load(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, s.Vars, loaded.Vars)
+	assert.True(t, s.Time.Equal(loaded.Time))
+
+	v, ok := loaded.Lookup("$ov_pro")
+	assert.True(t, ok)
+	assert.Equal(t, "100", v.Value)
+
+	// A done context stops the snapshot.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = snapshot.Take(ctx, osv, []string{"$OV_PRO"})
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+// Tests comparing snapshots with KRL-aware comparison.
+func TestSnapshotDiff(t *testing.T) {
+	before := &snapshot.Snapshot{Vars: []snapshot.Var{
+		{Name: "$OV_PRO", Value: "100"},
+		{Name: "PART_READY", Value: "TRUE"},
+		{Name: "SPEED", Value: "1.0"},
+		{Name: "$TOOL_DATA[1]", Value: "{TOOL: FRAME {X 1.0, Y 2.0}, ACTIVE TRUE}"},
+		{Name: "OLD_VAR", Value: "5"},
+		{Name: "FAILED", Err: "variable not found in response"},
+	}}
+	after := &snapshot.Snapshot{Vars: []snapshot.Var{
+		{Name: "$ov_pro", Value: "50"},
+		{Name: "PART_READY", Value: "true"},
+		{Name: "SPEED", Value: "1"},
+		{Name: "$TOOL_DATA[1]", Value: "{TOOL: FRAME {X 1.0, Y 2.5}, ACTIVE TRUE}"},
+		{Name: "NEW_VAR", Value: `"new"`},
+		{Name: "FAILED", Value: "7"},
+	}}
+
+	changes := snapshot.Diff(before, after)
+	require.Len(t, changes, 5)
+	assert.Equal(t, snapshot.Change{Name: "$OV_PRO", Kind: snapshot.Changed, Old: "100", New: "50"}, changes[0])
+	assert.Equal(t, []string{"FRAME.Y"}, changes[1].Members)
+	assert.Equal(t, "~ $TOOL_DATA[1] [FRAME.Y]: {TOOL: FRAME {X 1.0, Y 2.0}, ACTIVE TRUE} -> {TOOL: FRAME {X 1.0, Y 2.5}, ACTIVE TRUE}", changes[1].String())
+	assert.Equal(t, "- OLD_VAR = 5", changes[2].String())
+	assert.Equal(t, `+ NEW_VAR = "new"`, changes[3].String())
+	assert.Equal(t, snapshot.Change{Name: "FAILED", Kind: snapshot.Added, New: "7"}, changes[4])
+
+	assert.Empty(t, snapshot.Diff(before, before))
+}
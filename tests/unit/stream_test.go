@@ -0,0 +1,209 @@
+package test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+	"github.com/selimserbes/go-openshowvar/pkg/gateway"
+	"github.com/selimserbes/go-openshowvar/pkg/openshowvar"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Starts a gateway polling streamed variables of a fake proxy every 10ms.
+func startStreamGateway(t *testing.T, proxy *fakeProxy) *httptest.Server {
+	gw, err := gateway.New(gateway.RobotConfig{
+		ID:      "cell1",
+		Host:    "10.0.0.1",
+		Port:    7000,
+		Options: []openshowvar.Option{openshowvar.WithDialer(openshowvar.PipeDialer{Serve: proxy.Serve})},
+	})
+	require.NoError(t, err)
+	gw.StreamInterval = 10 * time.Millisecond
+	server := httptest.NewServer(gw)
+	t.Cleanup(func() {
+		server.CloseClientConnections()
+		server.Close()
+		gw.Close()
+	})
+	return server
+}
+
+// Reads the next Server-Sent Event with its event name and data.
+func readSSE(t *testing.T, r *bufio.Reader) (string, gateway.Event) {
+	var name string
+	var event gateway.Event
+	for {
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case line == "" && name != "":
+			return name, event
+		case strings.HasPrefix(line, "event: "):
+			name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event))
+		}
+	}
+}
+
+// Tests streaming changes of variables as Server-Sent Events.
+func TestGatewayEvents(t *testing.T) {
+	proxy := newFakeProxy(map[string]string{"$OV_PRO": "100", "$POS_ACT": "{E6POS: X 1.0}"})
+	server := startStreamGateway(t, proxy)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/robots/cell1/events?name=$OV_PRO", nil)
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	r := bufio.NewReader(resp.Body)
+	name, event := readSSE(t, r)
+	assert.Equal(t, "change", name)
+	assert.Equal(t, "cell1", event.Robot)
+	assert.Equal(t, "$OV_PRO", event.Name)
+	assert.Equal(t, "100", event.Raw)
+	assert.EqualValues(t, 100, event.Value)
+	assert.Empty(t, event.Previous)
+
+	proxy.set("$OV_PRO", "50")
+	_, event = readSSE(t, r)
+	assert.Equal(t, "50", event.Raw)
+	assert.Equal(t, "100", event.Previous)
+}
+
+// Tests the errors of stream requests.
+func TestGatewayEventsErrors(t *testing.T) {
+	server := startStreamGateway(t, newFakeProxy(nil))
+
+	status, body := gatewayRequest(t, http.MethodGet, server.URL+"/robots/cell1/events", "")
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Contains(t, body["error"], "missing name")
+
+	status, _ = gatewayRequest(t, http.MethodGet, server.URL+"/robots/cell1/events?name=$OV_PRO&interval=fast", "")
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	status, _ = gatewayRequest(t, http.MethodGet, server.URL+"/robots/cell9/events?name=$OV_PRO", "")
+	assert.Equal(t, http.StatusNotFound, status)
+}
+
+// Tests subscribing and unsubscribing variables over a WebSocket.
+func TestGatewayWebSocket(t *testing.T) {
+	proxy := newFakeProxy(map[string]string{"$OV_PRO": "100", "$MODE_OP": "#T1"})
+	server := startStreamGateway(t, proxy)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, _, err := websocket.Dial(ctx, "ws"+strings.TrimPrefix(server.URL, "http")+"/robots/cell1/ws?name=$OV_PRO", nil)
+	require.NoError(t, err)
+	defer conn.CloseNow()
+
+	var event gateway.Event
+	require.NoError(t, wsjson.Read(ctx, conn, &event))
+	assert.Equal(t, "$OV_PRO", event.Name)
+	assert.Equal(t, "100", event.Raw)
+
+	require.NoError(t, wsjson.Write(ctx, conn, map[string]any{"subscribe": []string{"$MODE_OP", "$MISSING"}, "interval": "20ms"}))
+	seen := map[string]gateway.Event{}
+	for len(seen) < 2 {
+		require.NoError(t, wsjson.Read(ctx, conn, &event))
+		seen[event.Name] = event
+	}
+	assert.Equal(t, "#T1", seen["$MODE_OP"].Value)
+	assert.NotEmpty(t, seen["$MISSING"].Error)
+
+	// After unsubscribing only changes of the remaining variables arrive.
+	require.NoError(t, wsjson.Write(ctx, conn, map[string]any{"unsubscribe": []string{"$OV_PRO"}}))
+	time.Sleep(100 * time.Millisecond)
+	proxy.set("$OV_PRO", "10")
+	proxy.set("$MODE_OP", "#AUT")
+	require.NoError(t, wsjson.Read(ctx, conn, &event))
+	assert.Equal(t, "$MODE_OP", event.Name)
+	assert.Equal(t, "#AUT", event.Raw)
+	assert.Equal(t, "#T1", event.Previous)
+}
+
+// A response writer handing each write to the test, blocking until it is taken.
+type blockingWriter struct {
+	header http.Header
+	writes chan string
+}
+
+func (w *blockingWriter) Header() http.Header { return w.header }
+func (w *blockingWriter) WriteHeader(int)     {}
+func (w *blockingWriter) Flush()              {}
+func (w *blockingWriter) Write(p []byte) (int, error) {
+	w.writes <- string(p)
+	return len(p), nil
+}
+
+// Tests that a client not reading keeps only the latest change of a variable.
+func TestGatewayEventsConflation(t *testing.T) {
+	proxy := newFakeProxy(map[string]string{"$OV_PRO": "0"})
+	gw, err := gateway.New(gateway.RobotConfig{
+		ID:      "cell1",
+		Options: []openshowvar.Option{openshowvar.WithDialer(openshowvar.PipeDialer{Serve: proxy.Serve})},
+	})
+	require.NoError(t, err)
+	defer gw.Close()
+	gw.StreamInterval = 10 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &blockingWriter{header: http.Header{}, writes: make(chan string)}
+	req := httptest.NewRequest(http.MethodGet, "/robots/cell1/events?name=$OV_PRO", nil).WithContext(ctx)
+	done := make(chan struct{})
+	go func() {
+		gw.ServeHTTP(w, req)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		for {
+			select {
+			case <-w.writes:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	next := func() gateway.Event {
+		var event gateway.Event
+		select {
+		case data := <-w.writes:
+			data = data[strings.Index(data, "data: ")+len("data: "):]
+			require.NoError(t, json.Unmarshal([]byte(strings.TrimSpace(data)), &event))
+		case <-time.After(5 * time.Second):
+			t.Fatal("no event")
+		}
+		return event
+	}
+	assert.Equal(t, "0", next().Raw)
+
+	// While the client is blocked the changes are merged into one event.
+	for i := 1; i <= 10; i++ {
+		proxy.set("$OV_PRO", strconv.Itoa(i))
+		time.Sleep(20 * time.Millisecond)
+	}
+	event := next()
+	assert.Equal(t, "1", event.Raw, "the change read before the client blocked")
+	event = next()
+	assert.Equal(t, "10", event.Raw)
+	assert.Equal(t, "1", event.Previous)
+	assert.Equal(t, 8, event.Coalesced)
+}
@@ -0,0 +1,203 @@
+package test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/selimserbes/go-openshowvar/pkg/openshowvar"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Connects a client to a fake proxy over a pipe.
+func connectFake(t *testing.T, proxy *fakeProxy, opts ...openshowvar.Option) *openshowvar.OpenShowVar {
+	opts = append([]openshowvar.Option{openshowvar.WithDialer(openshowvar.PipeDialer{Serve: proxy.Serve})}, opts...)
+	osv := openshowvar.NewOpenShowVar("", 0, opts...)
+	require.NoError(t, osv.Connect())
+	t.Cleanup(osv.Disconnect)
+	return osv
+}
+
+// Receives the next change or fails after a timeout.
+func nextChange(t *testing.T, changes <-chan openshowvar.Change) openshowvar.Change {
+	t.Helper()
+	select {
+	case change, ok := <-changes:
+		require.True(t, ok, "channel closed")
+		return change
+	case <-time.After(2 * time.Second):
+		t.Fatal("no change received")
+	}
+	return openshowvar.Change{}
+}
+
+// Asserts that no change arrives within a few poll intervals.
+func noChange(t *testing.T, changes <-chan openshowvar.Change) {
+	t.Helper()
+	select {
+	case change := <-changes:
+		t.Fatalf("unexpected change %+v", change)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// Tests that the first value and later changes are delivered once.
+func TestSubscribe(t *testing.T) {
+	proxy := newFakeProxy(map[string]string{"PART_READY": "FALSE"})
+	osv := connectFake(t, proxy)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	changes := osv.Subscribe(ctx, "PART_READY", 5*time.Millisecond)
+
+	first := nextChange(t, changes)
+	assert.Equal(t, "PART_READY", first.VarName)
+	assert.Equal(t, "FALSE", first.Value)
+	assert.Equal(t, "", first.Previous)
+	assert.NoError(t, first.Err)
+	noChange(t, changes)
+
+	proxy.set("PART_READY", "TRUE")
+	second := nextChange(t, changes)
+	assert.Equal(t, "TRUE", second.Value)
+	assert.Equal(t, "FALSE", second.Previous)
+
+	// The channel is closed when the context is done.
+	cancel()
+	require.Eventually(t, func() bool {
+		_, ok := <-changes
+		return !ok
+	}, time.Second, time.Millisecond)
+}
+
+// Tests that REAL changes within the tolerance are ignored.
+func TestSubscribeTolerance(t *testing.T) {
+	proxy := newFakeProxy(map[string]string{"$POS_ACT": "{E6POS: X 100.0, Y 0.0, Z 500.0}"})
+	osv := connectFake(t, proxy)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes := osv.Subscribe(ctx, "$POS_ACT", 5*time.Millisecond, openshowvar.WithTolerance(0.1))
+	nextChange(t, changes)
+
+	proxy.set("$POS_ACT", "{E6POS: X 100.05, Y 0.0, Z 500.0}")
+	noChange(t, changes)
+
+	proxy.set("$POS_ACT", "{E6POS: X 101.0, Y 0.0, Z 500.0}")
+	assert.Equal(t, "{E6POS: X 101.0, Y 0.0, Z 500.0}", nextChange(t, changes).Value)
+}
+
+// Tests that a change is only delivered once it has been stable for the debounce time.
+func TestSubscribeDebounce(t *testing.T) {
+	proxy := newFakeProxy(map[string]string{"$OV_PRO": "100"})
+	osv := connectFake(t, proxy)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes := osv.Subscribe(ctx, "$OV_PRO", 5*time.Millisecond, openshowvar.WithDebounce(100*time.Millisecond))
+	nextChange(t, changes)
+
+	// A short glitch is suppressed.
+	proxy.set("$OV_PRO", "50")
+	time.Sleep(20 * time.Millisecond)
+	proxy.set("$OV_PRO", "100")
+	noChange(t, changes)
+
+	proxy.set("$OV_PRO", "75")
+	start := time.Now()
+	assert.Equal(t, "75", nextChange(t, changes).Value)
+	assert.GreaterOrEqual(t, time.Since(start), 90*time.Millisecond)
+}
+
+// Tests that read errors are reported once per failure streak.
+func TestSubscribeError(t *testing.T) {
+	proxy := newFakeProxy(nil)
+	osv := connectFake(t, proxy)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes := osv.Subscribe(ctx, "PART_READY", 5*time.Millisecond)
+
+	assert.Error(t, nextChange(t, changes).Err)
+	noChange(t, changes)
+
+	proxy.set("PART_READY", "TRUE")
+	change := nextChange(t, changes)
+	assert.NoError(t, change.Err)
+	assert.Equal(t, "TRUE", change.Value)
+}
+
+// Tests that the value is delivered when reads succeed again after a
+// failure, even if it did not change.
+func TestSubscribeRecovery(t *testing.T) {
+	proxy := newFakeProxy(map[string]string{"PART_READY": "TRUE"})
+	osv := connectFake(t, proxy)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes := osv.Subscribe(ctx, "PART_READY", 5*time.Millisecond)
+	assert.Equal(t, "TRUE", nextChange(t, changes).Value)
+
+	proxy.remove("PART_READY")
+	assert.Error(t, nextChange(t, changes).Err)
+
+	proxy.set("PART_READY", "TRUE")
+	change := nextChange(t, changes)
+	assert.NoError(t, change.Err)
+	assert.Equal(t, "TRUE", change.Value)
+	assert.Equal(t, "TRUE", change.Previous)
+	noChange(t, changes)
+}
+
+// Tests that a read that hangs fails after the time limit of the poller and
+// polling recovers on a new connection.
+func TestSubscribeReadTimeout(t *testing.T) {
+	proxy := newFakeProxy(map[string]string{"PART_READY": "FALSE"})
+	var stalled atomic.Bool
+	proxy.delay = func(name string) time.Duration {
+		if !stalled.Swap(true) {
+			return 5 * time.Second
+		}
+		return 0
+	}
+	osv := connectFake(t, proxy)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes := osv.Subscribe(ctx, "PART_READY", 5*time.Millisecond)
+
+	assert.ErrorIs(t, nextChange(t, changes).Err, context.DeadlineExceeded)
+	change := nextChange(t, changes)
+	assert.NoError(t, change.Err)
+	assert.Equal(t, "FALSE", change.Value)
+}
+
+// Tests that subscribers of the same variable share one poller.
+func TestSubscribeCoalesce(t *testing.T) {
+	proxy := newFakeProxy(map[string]string{"$OV_PRO": "100"})
+	osv := connectFake(t, proxy)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var subscribers []<-chan openshowvar.Change
+	for i := 0; i < 10; i++ {
+		subscribers = append(subscribers, osv.Subscribe(ctx, "$OV_PRO", 20*time.Millisecond))
+	}
+	for _, changes := range subscribers {
+		assert.Equal(t, "100", nextChange(t, changes).Value)
+	}
+
+	before := proxy.requestCount()
+	time.Sleep(200 * time.Millisecond)
+	polls := proxy.requestCount() - before
+
+	// Ten separate pollers would need about 100 reads.
+	assert.LessOrEqual(t, polls, 15)
+	assert.GreaterOrEqual(t, polls, 5)
+
+	proxy.set("$OV_PRO", "50")
+	for _, changes := range subscribers {
+		assert.Equal(t, "50", nextChange(t, changes).Value)
+	}
+}
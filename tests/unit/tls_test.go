@@ -0,0 +1,159 @@
+package test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/selimserbes/go-openshowvar/pkg/openshowvar"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Certificates issued by a throwaway CA for the TLS tests.
+type testPKI struct {
+	pool   *x509.CertPool
+	server tls.Certificate
+	client tls.Certificate
+}
+
+// Generates a CA, a server certificate for 127.0.0.1 and a client certificate.
+func newTestPKI(t *testing.T) *testPKI {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	require.NoError(t, err)
+	caCert, err := x509.ParseCertificate(caDER)
+	require.NoError(t, err)
+
+	issue := func(serial int64, usage x509.ExtKeyUsage) tls.Certificate {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: "test"},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+			IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+		require.NoError(t, err)
+		leaf, err := x509.ParseCertificate(der)
+		require.NoError(t, err)
+		return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(caCert)
+	return &testPKI{
+		pool:   pool,
+		server: issue(2, x509.ExtKeyUsageServerAuth),
+		client: issue(3, x509.ExtKeyUsageClientAuth),
+	}
+}
+
+// Starts a fake proxy behind a TLS listener that requires a client certificate.
+func startTLSProxy(t *testing.T, pki *testPKI) *net.TCPAddr {
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{pki.server},
+		ClientCAs:    pki.pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	proxy := newFakeProxy(map[string]string{"$OV_PRO": "100"})
+	go proxy.ServeListener(listener)
+	return listener.Addr().(*net.TCPAddr)
+}
+
+// Tests reading over TLS with client certificate authentication.
+func TestTLSConnect(t *testing.T) {
+	pki := newTestPKI(t)
+	addr := startTLSProxy(t, pki)
+
+	osv := openshowvar.NewOpenShowVar(addr.IP.String(), addr.Port, openshowvar.WithTLSConfig(&tls.Config{
+		RootCAs:      pki.pool,
+		Certificates: []tls.Certificate{pki.client},
+	}))
+	require.NoError(t, osv.Connect())
+	defer osv.Disconnect()
+
+	value, err := osv.Read("$OV_PRO")
+	assert.NoError(t, err)
+	assert.Equal(t, "100", value)
+}
+
+// Tests that the server rejects a client without a certificate.
+func TestTLSConnectWithoutClientCertificate(t *testing.T) {
+	pki := newTestPKI(t)
+	addr := startTLSProxy(t, pki)
+
+	osv := openshowvar.NewOpenShowVar(addr.IP.String(), addr.Port, openshowvar.WithTLSConfig(&tls.Config{
+		RootCAs: pki.pool,
+	}))
+
+	// With TLS 1.3 the rejection may only surface on the first exchange.
+	err := osv.Connect()
+	if err == nil {
+		defer osv.Disconnect()
+		_, err = osv.Read("$OV_PRO")
+	}
+	assert.Error(t, err)
+}
+
+// Tests that an untrusted server certificate fails the handshake.
+func TestTLSConnectUntrustedServer(t *testing.T) {
+	pki := newTestPKI(t)
+	addr := startTLSProxy(t, pki)
+
+	osv := openshowvar.NewOpenShowVar(addr.IP.String(), addr.Port, openshowvar.WithTLSConfig(&tls.Config{
+		Certificates: []tls.Certificate{pki.client},
+	}))
+	assert.Error(t, osv.Connect())
+	assert.Nil(t, osv.Conn)
+}
+
+// Tests public key pinning of the server certificate.
+func TestTLSPinning(t *testing.T) {
+	pki := newTestPKI(t)
+	addr := startTLSProxy(t, pki)
+	pin := sha256.Sum256(pki.server.Leaf.RawSubjectPublicKeyInfo)
+	otherPin := sha256.Sum256(pki.client.Leaf.RawSubjectPublicKeyInfo)
+
+	// Matching pin.
+	osv := openshowvar.NewOpenShowVar(addr.IP.String(), addr.Port, openshowvar.WithTLSConfig(&tls.Config{
+		RootCAs:          pki.pool,
+		Certificates:     []tls.Certificate{pki.client},
+		VerifyConnection: openshowvar.VerifyPinnedKeys(otherPin, pin),
+	}))
+	require.NoError(t, osv.Connect())
+	osv.Disconnect()
+
+	// Mismatching pin.
+	osv = openshowvar.NewOpenShowVar(addr.IP.String(), addr.Port, openshowvar.WithTLSConfig(&tls.Config{
+		RootCAs:          pki.pool,
+		Certificates:     []tls.Certificate{pki.client},
+		VerifyConnection: openshowvar.VerifyPinnedKeys(otherPin),
+	}))
+	assert.Error(t, osv.Connect())
+}
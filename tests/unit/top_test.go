@@ -0,0 +1,88 @@
+package test
+
+import (
+	"bytes"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/selimserbes/go-openshowvar/internal/top"
+	"github.com/selimserbes/go-openshowvar/pkg/openshowvar"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ansi matches the escape sequences used by the table.
+var ansi = regexp.MustCompile("\x1b\\[[0-9;?]*[A-Za-z]")
+
+// Renders a table and returns its lines without escape sequences.
+func renderTop(table *top.Table, width int, now time.Time) []string {
+	var buf bytes.Buffer
+	table.Render(&buf, "osv-top", width, now)
+	return strings.Split(ansi.ReplaceAllString(buf.String(), ""), "\r\n")
+}
+
+// Tests scaling of sparklines between the minimum and maximum value.
+func TestTopSparkline(t *testing.T) {
+	tests := []struct {
+		values []float64
+		want   string
+	}{
+		{nil, ""},
+		{[]float64{5, 5, 5}, "▁▁▁"},
+		{[]float64{0, 7}, "▁█"},
+		{[]float64{0, 1, 2, 3, 4, 5, 6, 7}, "▁▂▃▄▅▆▇█"},
+		{[]float64{-1, 0, 1}, "▁▄█"},
+		{[]float64{100, 0.5, 100}, "█▁█"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, top.Sparkline(tt.values), "%v", tt.values)
+	}
+}
+
+// Tests that rows fill the terminal width and the value column shrinks to
+// at least 10 columns.
+func TestTopColumnWidths(t *testing.T) {
+	const points = 8
+	names := []string{"$OV_PRO", "A_VERY_LONG_VARIABLE_NAME[12]", "$MODE_OP"}
+	table := top.NewTable(names, time.Second, points)
+
+	start := time.Now()
+	for i := 0; i < points+2; i++ {
+		at := start.Add(time.Duration(i) * 100 * time.Millisecond)
+		table.Update(openshowvar.Snapshot{Values: []openshowvar.Sample{
+			{VarName: names[0], Value: strconv.Itoa(50 + i), Time: at},
+			{VarName: names[1], Value: "{E6POS: X 425.0, Y -1.5, Z 650.0, A 0.0, B 90.0, C 0.0}", Time: at},
+			{VarName: names[2], Err: errors.New("connection error"), Time: at},
+		}})
+	}
+	now := start.Add(time.Second)
+
+	for _, width := range []int{120, 200} {
+		lines := renderTop(table, width, now)
+		require.GreaterOrEqual(t, len(lines), 6)
+		assert.True(t, strings.HasPrefix(lines[2], "NAME"))
+		row := lines[3]
+		assert.Equal(t, width, utf8.RuneCountInString(row), row)
+		assert.True(t, strings.HasSuffix(row, "▁▂▃▄▅▆▇█"), row)
+		assert.True(t, strings.HasPrefix(lines[4], "A_VERY_LONG_VARIABL… "), lines[4])
+		assert.Contains(t, lines[5], "connection err…")
+	}
+
+	// The value column keeps 10 columns on narrow terminals.
+	lines := renderTop(table, 40, now)
+	assert.Equal(t, 20+10+2*8+24+points+5, utf8.RuneCountInString(lines[3]))
+	assert.Equal(t, "59", strings.Fields(lines[3])[1])
+}
+
+// Tests that the status is shown next to the title.
+func TestTopStatus(t *testing.T) {
+	table := top.NewTable([]string{"$OV_PRO"}, time.Second, 0)
+	assert.False(t, strings.Contains(renderTop(table, 120, time.Now())[0], "connection lost"))
+	table.Status = "connection lost: EOF"
+	assert.Contains(t, renderTop(table, 120, time.Now())[0], "connection lost: EOF")
+}
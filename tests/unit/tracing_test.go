@@ -0,0 +1,145 @@
+package test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/selimserbes/go-openshowvar/pkg/gateway"
+	"github.com/selimserbes/go-openshowvar/pkg/openshowvar"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// Collects span attributes into a map.
+func spanAttributes(span sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	attrs := make(map[attribute.Key]attribute.Value)
+	for _, kv := range span.Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+	return attrs
+}
+
+// Tests spans for Connect, Read and Write.
+func TestTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	proxy := newFakeProxy(map[string]string{"$OV_PRO": "100"})
+	osv := openshowvar.NewOpenShowVar("robot1", 7000,
+		openshowvar.WithDialer(openshowvar.PipeDialer{Serve: proxy.Serve}),
+		openshowvar.WithTracerProvider(provider),
+	)
+
+	// Requests are children of the caller's span.
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "cycle")
+	require.NoError(t, osv.ConnectContext(ctx))
+	defer osv.Disconnect()
+	_, err := osv.ReadContext(ctx, "$OV_PRO")
+	require.NoError(t, err)
+	_, err = osv.WriteContext(ctx, "$OV_PRO", "50")
+	require.NoError(t, err)
+	_, err = osv.ReadContext(ctx, "MISSING")
+	require.Error(t, err)
+	parent.End()
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 5)
+	names := make([]string, 0, len(spans))
+	for _, span := range spans[:4] {
+		names = append(names, span.Name())
+		assert.Equal(t, parent.SpanContext().SpanID(), span.Parent().SpanID())
+	}
+	assert.Equal(t, []string{"openshowvar.Connect", "openshowvar.Read", "openshowvar.Write", "openshowvar.Read"}, names)
+
+	// Address attributes on every span.
+	connect := spanAttributes(spans[0])
+	assert.Equal(t, "robot1", connect["server.address"].AsString())
+	assert.Equal(t, int64(7000), connect["server.port"].AsInt64())
+
+	// Request attributes.
+	read := spanAttributes(spans[1])
+	assert.Equal(t, "$OV_PRO", read["openshowvar.var"].AsString())
+	assert.Equal(t, "read", read["openshowvar.mode"].AsString())
+	assert.Contains(t, read, attribute.Key("openshowvar.msg_id"))
+	assert.Positive(t, read["openshowvar.response_size"].AsInt64())
+	assert.Equal(t, "write", spanAttributes(spans[2])["openshowvar.mode"].AsString())
+
+	// Failed request.
+	assert.Equal(t, codes.Error, spans[3].Status().Code)
+	assert.Equal(t, codes.Unset, spans[1].Status().Code)
+}
+
+// Tests that no spans are created without a tracer provider.
+func TestTracingDisabled(t *testing.T) {
+	proxy := newFakeProxy(map[string]string{"$OV_PRO": "100"})
+	osv := openshowvar.NewOpenShowVar("robot1", 7000, openshowvar.WithDialer(openshowvar.PipeDialer{Serve: proxy.Serve}))
+	require.NoError(t, osv.Connect())
+	defer osv.Disconnect()
+
+	_, err := osv.Read("$OV_PRO")
+	assert.NoError(t, err)
+	assert.Nil(t, osv.Tracer)
+}
+
+// Tests that the requests of gateway batches are children of a batch span.
+func TestTracingBatch(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	proxy := newFakeProxy(map[string]string{"$OV_PRO": "100", "RECIPE": "3"})
+	gw, err := gateway.New(gateway.RobotConfig{
+		ID:   "cell1",
+		Host: "robot1",
+		Port: 7000,
+		Options: []openshowvar.Option{
+			openshowvar.WithDialer(openshowvar.PipeDialer{Serve: proxy.Serve}),
+			openshowvar.WithTracerProvider(provider),
+		},
+	})
+	require.NoError(t, err)
+	server := httptest.NewServer(gw)
+	defer server.Close()
+	defer gw.Close()
+
+	status, _ := gatewayRequest(t, "POST", server.URL+"/robots/cell1/batch/read", `{"names": ["$OV_PRO", "MISSING"]}`)
+	require.Equal(t, http.StatusOK, status)
+	status, _ = gatewayRequest(t, "POST", server.URL+"/robots/cell1/batch/write", `{"values": [{"name": "RECIPE", "value": 7}]}`)
+	require.Equal(t, http.StatusOK, status)
+
+	batches := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		if span.Name() == "openshowvar.BatchRead" || span.Name() == "openshowvar.BatchWrite" {
+			batches[span.Name()] = span
+		}
+	}
+	require.Len(t, batches, 2)
+	read := spanAttributes(batches["openshowvar.BatchRead"])
+	assert.Equal(t, "read", read["openshowvar.mode"].AsString())
+	assert.Equal(t, int64(2), read["openshowvar.batch_size"].AsInt64())
+	assert.Equal(t, "robot1", read["server.address"].AsString())
+	assert.Equal(t, int64(1), spanAttributes(batches["openshowvar.BatchWrite"])["openshowvar.batch_size"].AsInt64())
+
+	// A variable that is not found does not fail the batch.
+	assert.Equal(t, codes.Unset, batches["openshowvar.BatchRead"].Status().Code)
+
+	children := map[string]int{}
+	for _, span := range recorder.Ended() {
+		for name, batch := range batches {
+			if span.Parent().SpanID() == batch.SpanContext().SpanID() {
+				children[name+" "+span.Name()]++
+			}
+		}
+	}
+	// The connection is opened by the first request.
+	assert.Equal(t, map[string]int{
+		"openshowvar.BatchRead openshowvar.Connect": 1,
+		"openshowvar.BatchRead openshowvar.Read":    2,
+		"openshowvar.BatchWrite openshowvar.Write":  1,
+	}, children)
+}
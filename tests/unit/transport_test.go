@@ -0,0 +1,164 @@
+package test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"net"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/selimserbes/go-openshowvar/pkg/openshowvar"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+// Tests reading and writing over an in-memory pipe.
+func TestPipeDialer(t *testing.T) {
+	proxy := newFakeProxy(map[string]string{"$OV_PRO": "100"})
+	osv := openshowvar.NewOpenShowVar("", 0, openshowvar.WithDialer(openshowvar.PipeDialer{Serve: proxy.Serve}))
+	require.NoError(t, osv.Connect())
+	defer osv.Disconnect()
+
+	value, err := osv.Read("$OV_PRO")
+	assert.NoError(t, err)
+	assert.Equal(t, "100", value)
+
+	value, err = osv.Write("$OV_PRO", "50")
+	assert.NoError(t, err)
+	assert.Equal(t, "50", value)
+
+	_, err = osv.Read("MISSING")
+	assert.Error(t, err)
+}
+
+// Tests reading over a Unix domain socket.
+func TestUnixDialer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "osv.sock")
+	listener, err := net.Listen("unix", path)
+	require.NoError(t, err)
+	defer listener.Close()
+
+	proxy := newFakeProxy(map[string]string{"$OV_PRO": "100"})
+	go proxy.ServeListener(listener)
+
+	osv := openshowvar.NewOpenShowVar("", 0, openshowvar.WithDialer(openshowvar.UnixDialer{Path: path}))
+	require.NoError(t, osv.Connect())
+	defer osv.Disconnect()
+
+	value, err := osv.Read("$OV_PRO")
+	assert.NoError(t, err)
+	assert.Equal(t, "100", value)
+}
+
+// Tests reading through an SSH jump host.
+func TestSSHDialer(t *testing.T) {
+	// Start the fake proxy on a TCP port that is only reached through the tunnel.
+	target, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer target.Close()
+	proxy := newFakeProxy(map[string]string{"$OV_PRO": "100"})
+	go proxy.ServeListener(target)
+
+	jumpHost := startSSHServer(t)
+	defer jumpHost.Close()
+
+	osv := openshowvar.NewOpenShowVar("", 0, openshowvar.WithDialer(openshowvar.SSHDialer{
+		JumpHost: jumpHost.Addr().String(),
+		Config: &ssh.ClientConfig{
+			User:            "robot",
+			HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		},
+		Address: target.Addr().String(),
+	}))
+	require.NoError(t, osv.Connect())
+	defer osv.Disconnect()
+
+	value, err := osv.Read("$OV_PRO")
+	assert.NoError(t, err)
+	assert.Equal(t, "100", value)
+}
+
+// Tests that an SSH dialer without a client config fails instead of panicking.
+func TestSSHDialerMissingConfig(t *testing.T) {
+	osv := openshowvar.NewOpenShowVar("", 0, openshowvar.WithDialer(openshowvar.SSHDialer{JumpHost: "127.0.0.1:22", Address: "10.0.0.1:7000"}))
+	err := osv.Connect()
+	assert.ErrorContains(t, err, "missing client config")
+}
+
+// Starts an SSH server without authentication that forwards direct-tcpip channels.
+func startSSHServer(t *testing.T) net.Listener {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(key)
+	require.NoError(t, err)
+	config := &ssh.ServerConfig{NoClientAuth: true}
+	config.AddHostKey(signer)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_, chans, reqs, err := ssh.NewServerConn(conn, config)
+				if err != nil {
+					return
+				}
+				go ssh.DiscardRequests(reqs)
+				for newChan := range chans {
+					if newChan.ChannelType() != "direct-tcpip" {
+						newChan.Reject(ssh.UnknownChannelType, "unsupported channel type")
+						continue
+					}
+					go forwardChannel(newChan)
+				}
+			}()
+		}
+	}()
+
+	return listener
+}
+
+// Connects a direct-tcpip channel to the address it requests.
+func forwardChannel(newChan ssh.NewChannel) {
+	// Payload: host string, port uint32, originator host string, originator port uint32.
+	payload := newChan.ExtraData()
+	if len(payload) < 4 {
+		newChan.Reject(ssh.ConnectionFailed, "malformed request")
+		return
+	}
+	hostLen := binary.BigEndian.Uint32(payload[0:4])
+	if len(payload) < int(8+hostLen) {
+		newChan.Reject(ssh.ConnectionFailed, "malformed request")
+		return
+	}
+	host := string(payload[4 : 4+hostLen])
+	port := binary.BigEndian.Uint32(payload[4+hostLen : 8+hostLen])
+
+	target, err := net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(int(port))))
+	if err != nil {
+		newChan.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	channel, reqs, err := newChan.Accept()
+	if err != nil {
+		target.Close()
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+
+	go func() {
+		io.Copy(channel, target)
+		channel.Close()
+	}()
+	io.Copy(target, channel)
+	target.Close()
+}
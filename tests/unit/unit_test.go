@@ -62,11 +62,12 @@ func processRequest(request []byte) []byte {
 
 	// Modify the response to match the expected behavior in tests.
 	if request[4] == 1 {
-		// For write requests, echo only the value part with the necessary header.
+		// For write requests, echo only the value part with the necessary header
+		// and the message ID of the request.
 		varNameLen := int(request[5])<<8 | int(request[6])
 		valLen := int(request[7+varNameLen])<<8 | int(request[7+varNameLen+1])
 		response = append(
-			[]byte{0, 0, 0, byte(3 + valLen), 1, byte(valLen >> 8), byte(valLen & 0xFF)},
+			[]byte{request[0], request[1], 0, byte(3 + valLen), 1, byte(valLen >> 8), byte(valLen & 0xFF)},
 			request[7+varNameLen+2:]...)
 	}
 
@@ -122,6 +123,14 @@ func TestRead(t *testing.T) {
 	assert.Equal(t, "existing_var", response)
 }
 
+// Tests that reading a missing variable returns ErrVariableNotFound.
+func TestReadMissingVariable(t *testing.T) {
+	osv := connectFake(t, newFakeProxy(map[string]string{"$OV_PRO": "100"}))
+
+	_, err := osv.Read("MISSING")
+	assert.ErrorIs(t, err, openshowvar.ErrVariableNotFound)
+}
+
 // Tests the `Write` method of the `OpenShowVar` struct.
 func TestWrite(t *testing.T) {
 	// Start a mock server.
@@ -0,0 +1,93 @@
+package test
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Tests waiting for a value that satisfies a predicate.
+func TestWaitFor(t *testing.T) {
+	proxy := newFakeProxy(map[string]string{"COUNTER": "0"})
+	osv := connectFake(t, proxy)
+
+	go func() {
+		for i := 1; i <= 5; i++ {
+			time.Sleep(5 * time.Millisecond)
+			proxy.set("COUNTER", strconv.Itoa(i))
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	value, err := osv.WaitFor(ctx, "COUNTER", func(value string) bool {
+		n, _ := strconv.Atoi(value)
+		return n >= 3
+	}, time.Millisecond)
+	assert.NoError(t, err)
+	n, _ := strconv.Atoi(value)
+	assert.GreaterOrEqual(t, n, 3)
+}
+
+// Tests waiting for a BOOL flag set by the robot program.
+func TestWaitUntilEquals(t *testing.T) {
+	proxy := newFakeProxy(map[string]string{"PART_READY": "FALSE"})
+	osv := connectFake(t, proxy)
+
+	time.AfterFunc(20*time.Millisecond, func() { proxy.set("PART_READY", "true") })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	value, err := osv.WaitUntilEquals(ctx, "PART_READY", "TRUE", time.Millisecond)
+	assert.NoError(t, err)
+	assert.Equal(t, "true", value)
+}
+
+// Tests waiting for any change.
+func TestWaitForChange(t *testing.T) {
+	proxy := newFakeProxy(map[string]string{"$MODE_OP": "#T1"})
+	osv := connectFake(t, proxy)
+
+	time.AfterFunc(20*time.Millisecond, func() { proxy.set("$MODE_OP", "#AUT") })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	value, err := osv.WaitForChange(ctx, "$MODE_OP", time.Millisecond)
+	assert.NoError(t, err)
+	assert.Equal(t, "#AUT", value)
+}
+
+// Tests that the wait ends with the context error or a read error.
+func TestWaitForErrors(t *testing.T) {
+	proxy := newFakeProxy(map[string]string{"PART_READY": "FALSE"})
+	osv := connectFake(t, proxy)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	_, err := osv.WaitUntilEquals(ctx, "PART_READY", "TRUE", time.Millisecond)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	_, err = osv.WaitUntilEquals(context.Background(), "MISSING", "TRUE", time.Millisecond)
+	assert.Error(t, err)
+}
+
+// Tests that intervals that are not positive fall back to the default.
+func TestWaitForDefaultInterval(t *testing.T) {
+	proxy := newFakeProxy(map[string]string{"PART_READY": "FALSE"})
+	osv := connectFake(t, proxy)
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		proxy.set("PART_READY", "TRUE")
+	}()
+
+	for _, interval := range []time.Duration{0, -time.Second} {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		value, err := osv.WaitUntilEquals(ctx, "PART_READY", "TRUE", interval)
+		cancel()
+		assert.NoError(t, err)
+		assert.Equal(t, "TRUE", value)
+	}
+}